@@ -0,0 +1,207 @@
+package aac
+
+import "errors"
+
+const (
+	adtsHeaderSize = 7
+	adtsCRCSize    = 2
+
+	// MaxADTSFrameSize is the largest frame, header included, ADTS can describe.
+	MaxADTSFrameSize = 0x1fff
+)
+
+var (
+	ErrInvalidADTS      = errors.New("aac: invalid ADTS header")
+	ErrUnsupportedADTS  = errors.New("aac: ADTS frames with multiple raw data blocks are not supported")
+	ErrADTSIncompatible = errors.New("aac: format can not be described by an ADTS header")
+	ErrFrameTooLarge    = errors.New("aac: frame too large for ADTS")
+)
+
+// ADTSHeader holds the fields of an ADTS frame header.
+type ADTSHeader struct {
+	// MpegVersion is either 2 or 4
+	MpegVersion    uint8
+	ObjectType     uint8
+	FrequencyIndex uint8
+	Channels       uint8
+	// HeaderLength is 9 when the header is followed by a CRC
+	HeaderLength int
+	// FrameLength includes the header
+	FrameLength   int
+	RawDataBlocks int
+}
+
+// ParseADTSHeader parses the header at the start of the data.
+func ParseADTSHeader(data []byte) (*ADTSHeader, error) {
+	if len(data) < adtsHeaderSize {
+		return nil, ErrInvalidADTS
+	}
+
+	// syncword and layer 0
+	if data[0] != 0xff || data[1]&0xf6 != 0xf0 {
+		return nil, ErrInvalidADTS
+	}
+
+	header := &ADTSHeader{
+		MpegVersion:    4,
+		ObjectType:     data[2]>>6 + 1,
+		FrequencyIndex: (data[2] >> 2) & 0x0f,
+		Channels:       (data[2]&0x01)<<2 | data[3]>>6,
+		HeaderLength:   adtsHeaderSize,
+		FrameLength:    int(data[3]&0x03)<<11 | int(data[4])<<3 | int(data[5])>>5,
+		RawDataBlocks:  int(data[6]&0x03) + 1,
+	}
+
+	if data[1]&0x08 != 0 {
+		header.MpegVersion = 2
+	}
+
+	// protection absent flag
+	if data[1]&0x01 == 0 {
+		header.HeaderLength += adtsCRCSize
+	}
+
+	if int(header.FrequencyIndex) >= len(sampleRates) || header.FrameLength < header.HeaderLength {
+		return nil, ErrInvalidADTS
+	}
+
+	return header, nil
+}
+
+// NewADTSHeader returns the header describing frames of the format.
+//
+// HE-AAC is described as AAC LC at the core sample rate, decoders find
+// the extensions in the frames themselves. The core is taken from the config
+// when the format has one, otherwise it is derived from the output format.
+func NewADTSHeader(format *Format) (*ADTSHeader, error) {
+	header := &ADTSHeader{
+		MpegVersion:  4,
+		HeaderLength: adtsHeaderSize,
+	}
+
+	if format.MpegVersion == 2 {
+		header.MpegVersion = 2
+	}
+
+	var sampleRate uint32
+
+	if len(format.Config) > 0 {
+		config, err := DecodeAudioSpecificConfig(format.Config)
+		if err != nil {
+			return nil, ErrADTSIncompatible
+		}
+
+		header.ObjectType = config.ObjectType
+		header.Channels = config.ChannelConfig
+		sampleRate = config.SampleRate
+	} else {
+		var ok bool
+		if header.ObjectType, sampleRate, header.Channels, ok = coreFormat(format); !ok {
+			return nil, ErrADTSIncompatible
+		}
+	}
+
+	// channel configurations past 7 came after ADTS
+	if header.ObjectType < ObjectTypeMain || header.ObjectType > ObjectTypeLTP || header.Channels > 7 {
+		return nil, ErrADTSIncompatible
+	}
+
+	index, ok := frequencyIndex(sampleRate)
+	if !ok {
+		return nil, ErrADTSIncompatible
+	}
+	header.FrequencyIndex = index
+
+	return header, nil
+}
+
+// coreFormat returns the object type, sample rate and channel configuration
+// of the core of a format without a config, assuming SBR doubles the rate
+// and PS makes stereo of a mono core.
+func coreFormat(format *Format) (uint8, uint32, uint8, bool) {
+	channels := format.Channels
+	switch {
+	case channels == 8:
+		channels = 7
+	case channels > 6:
+		return 0, 0, 0, false
+	}
+
+	switch format.Profile {
+	case ProfileMain:
+		return ObjectTypeMain, format.SampleRate, channels, true
+	case ProfileLC:
+		return ObjectTypeLC, format.SampleRate, channels, true
+	case ProfileSSR:
+		return ObjectTypeSSR, format.SampleRate, channels, true
+	case ProfileLTP:
+		return ObjectTypeLTP, format.SampleRate, channels, true
+	case ProfileHE:
+		return ObjectTypeLC, format.SampleRate / 2, channels, true
+	case ProfileHEv2:
+		return ObjectTypeLC, format.SampleRate / 2, 1, true
+	}
+
+	return 0, 0, 0, false
+}
+
+func frequencyIndex(sampleRate uint32) (uint8, bool) {
+	for i, rate := range sampleRates {
+		if rate == sampleRate {
+			return uint8(i), true
+		}
+	}
+
+	return 0, false
+}
+
+func (h *ADTSHeader) SampleRate() uint32 {
+	return sampleRates[h.FrequencyIndex]
+}
+
+// Format returns the format of the frames, samplesPerFrame is not signalled by
+// ADTS and zero means the default.
+func (h *ADTSHeader) Format(samplesPerFrame uint32) *Format {
+	if samplesPerFrame == 0 {
+		samplesPerFrame = DefaultSamplesPerFrame
+	}
+
+	return &Format{
+		SampleRate:      h.SampleRate(),
+		SamplesPerFrame: samplesPerFrame,
+		Profile:         aotToProfile(h.ObjectType),
+		Channels:        h.Channels,
+		MpegVersion:     h.MpegVersion,
+		Encapsulation:   EncapsulationADTS,
+		Config: []byte{
+			h.ObjectType<<3 | h.FrequencyIndex>>1,
+			h.FrequencyIndex<<7 | h.Channels<<3,
+		},
+		ConfigType: ConfigTypeAudioSpecific,
+	}
+}
+
+// Encode prefixes a raw frame with the header, without a CRC.
+func (h *ADTSHeader) Encode(frame []byte) ([]byte, error) {
+	length := adtsHeaderSize + len(frame)
+	if length > MaxADTSFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+
+	out := make([]byte, adtsHeaderSize, length)
+	out[0] = 0xff
+	// layer 0, no CRC
+	out[1] = 0xf1
+	if h.MpegVersion == 2 {
+		out[1] |= 0x08
+	}
+	out[2] = (h.ObjectType-1)<<6 | h.FrequencyIndex<<2 | h.Channels>>2
+	out[3] = h.Channels<<6 | byte(length>>11)
+	out[4] = byte(length >> 3)
+	// buffer fullness of 0x7ff means variable bitrate
+	out[5] = byte(length<<5) | 0x1f
+	// a single raw data block
+	out[6] = 0xfc
+
+	return append(out, frame...), nil
+}
@@ -0,0 +1,135 @@
+package aac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestADTSHeaderRoundTrip(t *testing.T) {
+	// AAC LC, 44100Hz, stereo
+	format, err := ParseAudioSpecificConfig([]byte{0x12, 0x10})
+	assert.Nil(t, err)
+
+	header, err := NewADTSHeader(format)
+	assert.Nil(t, err)
+
+	frame, err := header.Encode([]byte{0x21, 0x00, 0x03})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x03}, frame)
+
+	parsed, err := ParseADTSHeader(frame)
+	assert.Nil(t, err)
+	assert.Equal(t, &ADTSHeader{
+		MpegVersion:    4,
+		ObjectType:     2,
+		FrequencyIndex: 4,
+		Channels:       2,
+		HeaderLength:   7,
+		FrameLength:    10,
+		RawDataBlocks:  1,
+	}, parsed)
+	assert.Equal(t, uint32(44100), parsed.SampleRate())
+
+	assert.Equal(t, &Format{
+		SampleRate:      44100,
+		SamplesPerFrame: 1024,
+		Profile:         ProfileLC,
+		Channels:        2,
+		MpegVersion:     4,
+		Encapsulation:   EncapsulationADTS,
+		Config:          []byte{0x12, 0x10},
+		ConfigType:      ConfigTypeAudioSpecific,
+	}, parsed.Format(0))
+}
+
+func TestParseADTSHeader(t *testing.T) {
+	// MPEG-2 AAC Main, 48000Hz, 5.1 with a CRC and two raw data blocks
+	header, err := ParseADTSHeader([]byte{0xff, 0xf8, 0x0d, 0x80, 0x20, 0x1f, 0xfd, 0x00, 0x00})
+	assert.Nil(t, err)
+	assert.Equal(t, &ADTSHeader{
+		MpegVersion:    2,
+		ObjectType:     1,
+		FrequencyIndex: 3,
+		Channels:       6,
+		HeaderLength:   9,
+		FrameLength:    256,
+		RawDataBlocks:  2,
+	}, header)
+
+	for _, data := range [][]byte{
+		{0xff, 0xf1, 0x50, 0x80},
+		// broken syncword
+		{0xff, 0xe1, 0x50, 0x80, 0x01, 0x5f, 0xfc},
+		// layer 1
+		{0xff, 0xf3, 0x50, 0x80, 0x01, 0x5f, 0xfc},
+		// reserved frequency index
+		{0xff, 0xf1, 0x74, 0x80, 0x01, 0x5f, 0xfc},
+		// frame shorter than the header
+		{0xff, 0xf1, 0x50, 0x80, 0x00, 0x5f, 0xfc},
+	} {
+		_, err := ParseADTSHeader(data)
+		assert.Equal(t, ErrInvalidADTS, err, data)
+	}
+}
+
+func TestNewADTSHeader(t *testing.T) {
+	// HE-AAC is signalled as LC at the core rate
+	header, err := NewADTSHeader(&Format{Profile: ProfileHE, SampleRate: 48000, Channels: 2, MpegVersion: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(2), header.ObjectType)
+	assert.Equal(t, uint8(6), header.FrequencyIndex)
+
+	frame, err := header.Encode(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, byte(0xf9), frame[1])
+
+	// the core of HE-AAC v2 is mono
+	header, err = NewADTSHeader(&Format{Profile: ProfileHEv2, SampleRate: 44100, Channels: 2})
+	assert.Nil(t, err)
+	assert.Equal(t, &ADTSHeader{MpegVersion: 4, ObjectType: 2, FrequencyIndex: 7, Channels: 1, HeaderLength: 7}, header)
+
+	// 8 channels are signalled by the channel configuration 7
+	header, err = NewADTSHeader(&Format{Profile: ProfileLC, SampleRate: 48000, Channels: 8})
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(7), header.Channels)
+
+	for _, format := range []*Format{
+		{Profile: ProfileUnknown, SampleRate: 44100, Channels: 2},
+		// explicit sample rate
+		{Profile: ProfileLC, SampleRate: 44000, Channels: 2},
+		{Profile: ProfileLC, SampleRate: 44100, Channels: 7},
+	} {
+		_, err := NewADTSHeader(format)
+		assert.Equal(t, ErrADTSIncompatible, err)
+	}
+
+	_, err = header.Encode(make([]byte, MaxADTSFrameSize))
+	assert.Equal(t, ErrFrameTooLarge, err)
+}
+
+func TestNewADTSHeaderFromConfig(t *testing.T) {
+	for _, test := range []struct {
+		config []byte
+		header *ADTSHeader
+	}{
+		// hierarchically signalled HE-AAC, 22050Hz stereo core
+		{[]byte{0x2b, 0x92, 0x08, 0x00}, &ADTSHeader{MpegVersion: 4, ObjectType: 2, FrequencyIndex: 7, Channels: 2, HeaderLength: 7}},
+		// backward compatible HE-AAC v2, 24000Hz mono core
+		{[]byte{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80}, &ADTSHeader{MpegVersion: 4, ObjectType: 2, FrequencyIndex: 6, Channels: 1, HeaderLength: 7}},
+	} {
+		format, err := ParseAudioSpecificConfig(test.config)
+		assert.Nil(t, err)
+
+		header, err := NewADTSHeader(format)
+		assert.Nil(t, err)
+		assert.Equal(t, test.header, header)
+	}
+
+	// USAC has no ADTS object type
+	format, err := ParseAudioSpecificConfig([]byte{0xf9, 0x46, 0x40})
+	assert.Nil(t, err)
+
+	_, err = NewADTSHeader(format)
+	assert.Equal(t, ErrADTSIncompatible, err)
+}
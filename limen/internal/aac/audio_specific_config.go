@@ -0,0 +1,563 @@
+package aac
+
+import (
+	"errors"
+	"fmt"
+
+	"limen/internal/util"
+)
+
+const (
+	ObjectTypeMain = 1
+	ObjectTypeLC   = 2
+	ObjectTypeSSR  = 3
+	ObjectTypeLTP  = 4
+	ObjectTypeSBR  = 5
+	ObjectTypePS   = 29
+
+	escapeObjectType     = 31
+	explicitFrequency    = 15
+	syncExtensionSBR     = 0x2b7
+	syncExtensionPS      = 0x548
+	objectTypeERBSAC     = 22
+	frequencyIndexLength = 4
+)
+
+var (
+	ErrInvalidAudioSpecificConfig = errors.New("aac: invalid audio specific config")
+	ErrUnsupportedObjectType      = errors.New("aac: audio object type is not supported")
+)
+
+// AudioSpecificConfig is the decoder configuration of MPEG-4 audio, only
+// the GASpecificConfig of the AAC object types is looked into.
+type AudioSpecificConfig struct {
+	// ObjectType of the core, AAC LC for HE-AAC
+	ObjectType    uint8
+	SampleRate    uint32
+	ChannelConfig uint8
+
+	// SBR and PS are either signalled hierarchically, with the object type
+	// of the extension ahead of the core one, or by a backward compatible
+	// sync extension following the core config, which may also explicitly
+	// signal the absence of SBR
+	SBR                 bool
+	PS                  bool
+	BackwardCompatible  bool
+	ExtensionSampleRate uint32
+
+	// GASpecificConfig
+	FrameLengthFlag    bool
+	DependsOnCoreCoder bool
+	CoreCoderDelay     uint16
+	ExtensionFlag      bool
+	LayerNr            uint8
+	NumOfSubFrame      uint8
+	LayerLength        uint16
+	// aacSectionDataResilienceFlag, aacScalefactorDataResilienceFlag
+	// and aacSpectralDataResilienceFlag from the most significant bit
+	ResilienceFlags uint8
+	ExtensionFlag3  bool
+	EpConfig        uint8
+
+	// ProgramConfig describes the channels when ChannelConfig is 0
+	ProgramConfig *ProgramConfig
+}
+
+// ProgramConfig is the program_config_element of a config without a
+// predefined channel configuration.
+type ProgramConfig struct {
+	ElementInstanceTag uint8
+	ObjectType         uint8
+	FrequencyIndex     uint8
+	FrontElements      []ChannelElement
+	SideElements       []ChannelElement
+	BackElements       []ChannelElement
+	LfeElements        []uint8
+	AssocDataElements  []uint8
+	CcElements         []ChannelElement
+
+	MonoMixdown          bool
+	MonoMixdownElement   uint8
+	StereoMixdown        bool
+	StereoMixdownElement uint8
+	MatrixMixdown        bool
+	MatrixMixdownIdx     uint8
+	PseudoSurround       bool
+
+	Comment []byte
+}
+
+// ChannelElement is either a channel pair or a single channel element,
+// for coupling channels the flag tells whether they are independently switched.
+type ChannelElement struct {
+	Flag bool
+	Tag  uint8
+}
+
+// Channels returns the number of channels excluding coupling channels.
+func (p *ProgramConfig) Channels() uint8 {
+	channels := len(p.LfeElements)
+
+	for _, elements := range [][]ChannelElement{p.FrontElements, p.SideElements, p.BackElements} {
+		for _, element := range elements {
+			channels++
+			if element.Flag {
+				channels++
+			}
+		}
+	}
+
+	return uint8(channels)
+}
+
+// channel counts of the predefined channel configurations
+var configChannels = []uint8{0, 1, 2, 3, 4, 5, 6, 8, 0, 0, 0, 7, 8, 24, 8}
+
+// isGeneralAudio tells whether the object type carries a GASpecificConfig.
+func isGeneralAudio(objectType uint8) bool {
+	switch objectType {
+	case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+		return true
+	}
+
+	return false
+}
+
+// hasEpConfig tells whether the object type is error resilient.
+func hasEpConfig(objectType uint8) bool {
+	switch objectType {
+	case 17, 19, 20, 21, 22, 23, 24, 25, 26, 27, 39:
+		return true
+	}
+
+	return false
+}
+
+func readObjectType(r *util.FieldReader) uint8 {
+	objectType := r.Bits(5)
+	if objectType == escapeObjectType {
+		objectType = 32 + r.Bits(6)
+	}
+
+	return uint8(objectType)
+}
+
+func readSampleRate(r *util.FieldReader) uint32 {
+	index := r.Bits(frequencyIndexLength)
+	if index == explicitFrequency {
+		return r.Bits(24)
+	}
+
+	if int(index) >= len(sampleRates) {
+		r.Fail()
+		return 0
+	}
+
+	return sampleRates[index]
+}
+
+// DecodeAudioSpecificConfig parses the config, for object types other than
+// the AAC ones only the object type, sample rate and channels are known.
+func DecodeAudioSpecificConfig(data []byte) (*AudioSpecificConfig, error) {
+	r := util.NewFieldReader(data, ErrInvalidAudioSpecificConfig)
+
+	config := &AudioSpecificConfig{ObjectType: readObjectType(r)}
+	config.SampleRate = readSampleRate(r)
+	config.ChannelConfig = uint8(r.Bits(4))
+
+	if config.ObjectType == ObjectTypeSBR || config.ObjectType == ObjectTypePS {
+		config.SBR = true
+		config.PS = config.ObjectType == ObjectTypePS
+		config.ExtensionSampleRate = readSampleRate(r)
+		config.ObjectType = readObjectType(r)
+
+		if config.ObjectType == objectTypeERBSAC {
+			// extensionChannelConfiguration
+			r.Bits(4)
+		}
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	if !isGeneralAudio(config.ObjectType) {
+		return config, nil
+	}
+
+	config.decodeGASpecificConfig(r)
+
+	if hasEpConfig(config.ObjectType) {
+		config.EpConfig = uint8(r.Bits(2))
+		if config.EpConfig > 1 {
+			return nil, ErrUnsupportedObjectType
+		}
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	if !config.SBR && r.BitsAvailable() >= 16 {
+		config.decodeSyncExtension(r)
+	}
+
+	return config, nil
+}
+
+func (c *AudioSpecificConfig) decodeGASpecificConfig(r *util.FieldReader) {
+	c.FrameLengthFlag = r.Flag()
+
+	c.DependsOnCoreCoder = r.Flag()
+	if c.DependsOnCoreCoder {
+		c.CoreCoderDelay = uint16(r.Bits(14))
+	}
+
+	c.ExtensionFlag = r.Flag()
+
+	if c.ChannelConfig == 0 {
+		c.ProgramConfig = decodeProgramConfig(r)
+	}
+
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		c.LayerNr = uint8(r.Bits(3))
+	}
+
+	if c.ExtensionFlag {
+		if c.ObjectType == objectTypeERBSAC {
+			c.NumOfSubFrame = uint8(r.Bits(5))
+			c.LayerLength = uint16(r.Bits(11))
+		}
+
+		switch c.ObjectType {
+		case 17, 19, 20, 23:
+			c.ResilienceFlags = uint8(r.Bits(3))
+		}
+
+		c.ExtensionFlag3 = r.Flag()
+	}
+}
+
+// decodeSyncExtension reads the backward compatible signalling of SBR and PS,
+// anything else following the config is ignored.
+func (c *AudioSpecificConfig) decodeSyncExtension(r *util.FieldReader) {
+	if r.Bits(11) != syncExtensionSBR || readObjectType(r) != ObjectTypeSBR {
+		return
+	}
+
+	sbr := r.Flag()
+	var extensionSampleRate uint32
+	if sbr {
+		extensionSampleRate = readSampleRate(r)
+	}
+
+	if r.Err() != nil {
+		return
+	}
+
+	c.BackwardCompatible = true
+	c.SBR = sbr
+	c.ExtensionSampleRate = extensionSampleRate
+
+	if sbr && r.BitsAvailable() >= 12 && r.Bits(11) == syncExtensionPS {
+		c.PS = r.Flag()
+	}
+}
+
+func decodeProgramConfig(r *util.FieldReader) *ProgramConfig {
+	config := &ProgramConfig{
+		ElementInstanceTag: uint8(r.Bits(4)),
+		ObjectType:         uint8(r.Bits(2)),
+		FrequencyIndex:     uint8(r.Bits(4)),
+	}
+
+	front, side, back := r.Bits(4), r.Bits(4), r.Bits(4)
+	lfe, assocData, cc := r.Bits(2), r.Bits(3), r.Bits(4)
+
+	if config.MonoMixdown = r.Flag(); config.MonoMixdown {
+		config.MonoMixdownElement = uint8(r.Bits(4))
+	}
+
+	if config.StereoMixdown = r.Flag(); config.StereoMixdown {
+		config.StereoMixdownElement = uint8(r.Bits(4))
+	}
+
+	if config.MatrixMixdown = r.Flag(); config.MatrixMixdown {
+		config.MatrixMixdownIdx = uint8(r.Bits(2))
+		config.PseudoSurround = r.Flag()
+	}
+
+	config.FrontElements = decodeChannelElements(r, front)
+	config.SideElements = decodeChannelElements(r, side)
+	config.BackElements = decodeChannelElements(r, back)
+
+	for i := uint32(0); i < lfe; i++ {
+		config.LfeElements = append(config.LfeElements, uint8(r.Bits(4)))
+	}
+
+	for i := uint32(0); i < assocData; i++ {
+		config.AssocDataElements = append(config.AssocDataElements, uint8(r.Bits(4)))
+	}
+
+	config.CcElements = decodeChannelElements(r, cc)
+
+	// the comment is byte aligned relative to the start of the config
+	if position := r.Position(); position%8 != 0 {
+		r.Bits(8 - position%8)
+	}
+
+	comment := r.Bits(8)
+	for i := uint32(0); i < comment; i++ {
+		config.Comment = append(config.Comment, byte(r.Bits(8)))
+	}
+
+	return config
+}
+
+func decodeChannelElements(r *util.FieldReader, count uint32) []ChannelElement {
+	var elements []ChannelElement
+	for i := uint32(0); i < count; i++ {
+		elements = append(elements, ChannelElement{Flag: r.Flag(), Tag: uint8(r.Bits(4))})
+	}
+
+	return elements
+}
+
+// Channels returns the number of output channels, parametric stereo
+// turns a mono core into stereo.
+func (c *AudioSpecificConfig) Channels() uint8 {
+	var channels uint8
+
+	switch {
+	case c.ChannelConfig == 0 && c.ProgramConfig != nil:
+		channels = c.ProgramConfig.Channels()
+	case int(c.ChannelConfig) < len(configChannels):
+		channels = configChannels[c.ChannelConfig]
+	}
+
+	if c.PS && channels == 1 {
+		return 2
+	}
+
+	return channels
+}
+
+// OutputSampleRate returns the sample rate after SBR.
+func (c *AudioSpecificConfig) OutputSampleRate() uint32 {
+	if c.SBR && c.ExtensionSampleRate > 0 {
+		return c.ExtensionSampleRate
+	}
+
+	return c.SampleRate
+}
+
+// SamplesPerFrame returns the number of output samples of a frame.
+func (c *AudioSpecificConfig) SamplesPerFrame() uint32 {
+	samples := uint32(1024)
+
+	switch {
+	// AAC LD
+	case c.ObjectType == 23 && c.FrameLengthFlag:
+		samples = 480
+	case c.ObjectType == 23:
+		samples = 512
+	case isGeneralAudio(c.ObjectType) && c.FrameLengthFlag:
+		samples = 960
+	}
+
+	if c.SampleRate > 0 {
+		samples = uint32(uint64(samples) * uint64(c.OutputSampleRate()) / uint64(c.SampleRate))
+	}
+
+	return samples
+}
+
+// Codecs returns the RFC 6381 codecs parameter, which names the first object
+// type of the config, so backward compatible HE-AAC is named as its core.
+func (c *AudioSpecificConfig) Codecs() string {
+	objectType := c.ObjectType
+	if c.SBR && !c.BackwardCompatible {
+		objectType = ObjectTypeSBR
+		if c.PS {
+			objectType = ObjectTypePS
+		}
+	}
+
+	return fmt.Sprintf("mp4a.40.%d", objectType)
+}
+
+func (c *AudioSpecificConfig) Profile() AACProfile {
+	switch {
+	case c.PS:
+		return ProfileHEv2
+	case c.SBR:
+		return ProfileHE
+	}
+
+	return aotToProfile(c.ObjectType)
+}
+
+// Marshal serializes the config, sample rates of the frequency table are
+// written as indexes.
+func (c *AudioSpecificConfig) Marshal() ([]byte, error) {
+	if !isGeneralAudio(c.ObjectType) {
+		return nil, ErrUnsupportedObjectType
+	}
+
+	if c.ChannelConfig > 15 || c.ChannelConfig == 0 && c.ProgramConfig == nil {
+		return nil, ErrInvalidAudioSpecificConfig
+	}
+
+	w := &util.BitWriter{}
+
+	if c.SBR && !c.BackwardCompatible {
+		if c.PS {
+			writeObjectType(w, ObjectTypePS)
+		} else {
+			writeObjectType(w, ObjectTypeSBR)
+		}
+		writeSampleRate(w, c.SampleRate)
+		w.WriteBits(4, uint64(c.ChannelConfig))
+		writeSampleRate(w, c.ExtensionSampleRate)
+		writeObjectType(w, c.ObjectType)
+		if c.ObjectType == objectTypeERBSAC {
+			w.WriteBits(4, uint64(c.ChannelConfig))
+		}
+	} else {
+		writeObjectType(w, c.ObjectType)
+		writeSampleRate(w, c.SampleRate)
+		w.WriteBits(4, uint64(c.ChannelConfig))
+	}
+
+	w.WriteFlag(c.FrameLengthFlag)
+	w.WriteFlag(c.DependsOnCoreCoder)
+	if c.DependsOnCoreCoder {
+		w.WriteBits(14, uint64(c.CoreCoderDelay))
+	}
+	w.WriteFlag(c.ExtensionFlag)
+
+	if c.ChannelConfig == 0 {
+		if err := c.ProgramConfig.marshal(w); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.ObjectType == 6 || c.ObjectType == 20 {
+		w.WriteBits(3, uint64(c.LayerNr))
+	}
+
+	if c.ExtensionFlag {
+		if c.ObjectType == objectTypeERBSAC {
+			w.WriteBits(5, uint64(c.NumOfSubFrame))
+			w.WriteBits(11, uint64(c.LayerLength))
+		}
+
+		switch c.ObjectType {
+		case 17, 19, 20, 23:
+			w.WriteBits(3, uint64(c.ResilienceFlags))
+		}
+
+		w.WriteFlag(c.ExtensionFlag3)
+	}
+
+	if hasEpConfig(c.ObjectType) {
+		w.WriteBits(2, uint64(c.EpConfig))
+	}
+
+	if c.BackwardCompatible {
+		w.WriteBits(11, syncExtensionSBR)
+		writeObjectType(w, ObjectTypeSBR)
+		w.WriteFlag(c.SBR)
+
+		if c.SBR {
+			writeSampleRate(w, c.ExtensionSampleRate)
+
+			if c.PS {
+				w.WriteBits(11, syncExtensionPS)
+				w.WriteFlag(true)
+			}
+		}
+	}
+
+	return w.Data, nil
+}
+
+func writeObjectType(w *util.BitWriter, objectType uint8) {
+	if objectType >= escapeObjectType {
+		w.WriteBits(5, escapeObjectType)
+		w.WriteBits(6, uint64(objectType-32))
+		return
+	}
+
+	w.WriteBits(5, uint64(objectType))
+}
+
+func writeSampleRate(w *util.BitWriter, sampleRate uint32) {
+	if index, ok := frequencyIndex(sampleRate); ok {
+		w.WriteBits(frequencyIndexLength, uint64(index))
+		return
+	}
+
+	w.WriteBits(frequencyIndexLength, explicitFrequency)
+	w.WriteBits(24, uint64(sampleRate))
+}
+
+func (p *ProgramConfig) marshal(w *util.BitWriter) error {
+	if len(p.FrontElements) > 15 || len(p.SideElements) > 15 || len(p.BackElements) > 15 ||
+		len(p.LfeElements) > 3 || len(p.AssocDataElements) > 7 || len(p.CcElements) > 15 || len(p.Comment) > 0xff {
+		return ErrInvalidAudioSpecificConfig
+	}
+
+	w.WriteBits(4, uint64(p.ElementInstanceTag))
+	w.WriteBits(2, uint64(p.ObjectType))
+	w.WriteBits(4, uint64(p.FrequencyIndex))
+	w.WriteBits(4, uint64(len(p.FrontElements)))
+	w.WriteBits(4, uint64(len(p.SideElements)))
+	w.WriteBits(4, uint64(len(p.BackElements)))
+	w.WriteBits(2, uint64(len(p.LfeElements)))
+	w.WriteBits(3, uint64(len(p.AssocDataElements)))
+	w.WriteBits(4, uint64(len(p.CcElements)))
+
+	w.WriteFlag(p.MonoMixdown)
+	if p.MonoMixdown {
+		w.WriteBits(4, uint64(p.MonoMixdownElement))
+	}
+
+	w.WriteFlag(p.StereoMixdown)
+	if p.StereoMixdown {
+		w.WriteBits(4, uint64(p.StereoMixdownElement))
+	}
+
+	w.WriteFlag(p.MatrixMixdown)
+	if p.MatrixMixdown {
+		w.WriteBits(2, uint64(p.MatrixMixdownIdx))
+		w.WriteFlag(p.PseudoSurround)
+	}
+
+	for _, elements := range [][]ChannelElement{p.FrontElements, p.SideElements, p.BackElements} {
+		writeChannelElements(w, elements)
+	}
+
+	for _, tags := range [][]uint8{p.LfeElements, p.AssocDataElements} {
+		for _, tag := range tags {
+			w.WriteBits(4, uint64(tag))
+		}
+	}
+
+	writeChannelElements(w, p.CcElements)
+
+	w.Align()
+	w.WriteBits(8, uint64(len(p.Comment)))
+	for _, b := range p.Comment {
+		w.WriteBits(8, uint64(b))
+	}
+
+	return nil
+}
+
+func writeChannelElements(w *util.BitWriter, elements []ChannelElement) {
+	for _, element := range elements {
+		w.WriteFlag(element.Flag)
+		w.WriteBits(4, uint64(element.Tag))
+	}
+}
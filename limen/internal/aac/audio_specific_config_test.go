@@ -0,0 +1,149 @@
+package aac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAudioSpecificConfig(t *testing.T) {
+	for _, test := range []struct {
+		name            string
+		config          []byte
+		sampleRate      uint32
+		samplesPerFrame uint32
+		profile         AACProfile
+		channels        uint8
+		codecs          string
+	}{
+		{"LC stereo", []byte{0x12, 0x10}, 44100, 1024, ProfileLC, 2, "mp4a.40.2"},
+		{"LC with 960 samples per frame", []byte{0x12, 0x14}, 44100, 960, ProfileLC, 2, "mp4a.40.2"},
+		// FFmpeg signals the absence of SBR
+		{"LC with sync extension", []byte{0x11, 0x90, 0x56, 0xe5, 0x00}, 48000, 1024, ProfileLC, 2, "mp4a.40.2"},
+		{"LC 5.1", []byte{0x11, 0xb0}, 48000, 1024, ProfileLC, 6, "mp4a.40.2"},
+		{"LC 7.1", []byte{0x11, 0xb8}, 48000, 1024, ProfileLC, 8, "mp4a.40.2"},
+		// explicit sample rate of 44000Hz
+		{"LC explicit sample rate", []byte{0x17, 0x80, 0x55, 0xf0, 0x10}, 44000, 1024, ProfileLC, 2, "mp4a.40.2"},
+		{"hierarchical HE-AAC", []byte{0x2b, 0x92, 0x08, 0x00}, 44100, 2048, ProfileHE, 2, "mp4a.40.5"},
+		{"hierarchical HE-AAC v2", []byte{0xeb, 0x8a, 0x08, 0x00}, 44100, 2048, ProfileHEv2, 2, "mp4a.40.29"},
+		// explicit backward compatible signalling of SBR
+		{"backward compatible HE-AAC", []byte{0x13, 0x10, 0x56, 0xe5, 0x98}, 48000, 2048, ProfileHE, 2, "mp4a.40.2"},
+		{"backward compatible HE-AAC v2", []byte{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80}, 48000, 2048, ProfileHEv2, 2, "mp4a.40.2"},
+		{"USAC", []byte{0xf9, 0x46, 0x40}, 48000, 1024, ProfileUnknown, 2, "mp4a.40.42"},
+	} {
+		format, err := ParseAudioSpecificConfig(test.config)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, &Format{
+			SampleRate:      test.sampleRate,
+			SamplesPerFrame: test.samplesPerFrame,
+			Profile:         test.profile,
+			Channels:        test.channels,
+			MpegVersion:     4,
+			Encapsulation:   EncapsulationNone,
+			Config:          test.config,
+			ConfigType:      ConfigTypeAudioSpecific,
+		}, format, test.name)
+
+		config, err := DecodeAudioSpecificConfig(test.config)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.codecs, config.Codecs(), test.name)
+	}
+}
+
+func TestDecodeAudioSpecificConfig(t *testing.T) {
+	config, err := DecodeAudioSpecificConfig([]byte{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80})
+	assert.Nil(t, err)
+	assert.Equal(t, &AudioSpecificConfig{
+		ObjectType:          ObjectTypeLC,
+		SampleRate:          24000,
+		ChannelConfig:       1,
+		SBR:                 true,
+		PS:                  true,
+		BackwardCompatible:  true,
+		ExtensionSampleRate: 48000,
+	}, config)
+
+	config, err = DecodeAudioSpecificConfig([]byte{0x2b, 0x92, 0x08, 0x00})
+	assert.Nil(t, err)
+	assert.Equal(t, &AudioSpecificConfig{
+		ObjectType:          ObjectTypeLC,
+		SampleRate:          22050,
+		ChannelConfig:       2,
+		SBR:                 true,
+		ExtensionSampleRate: 44100,
+	}, config)
+
+	for _, data := range [][]byte{
+		nil,
+		{0x12},
+		// reserved frequency index
+		{0x16, 0x90},
+		// missing core of hierarchical HE-AAC
+		{0x2b, 0x92},
+	} {
+		_, err := DecodeAudioSpecificConfig(data)
+		assert.Equal(t, ErrInvalidAudioSpecificConfig, err, data)
+	}
+}
+
+func TestMarshalAudioSpecificConfig(t *testing.T) {
+	for _, data := range [][]byte{
+		{0x12, 0x10},
+		{0x11, 0x90, 0x56, 0xe5, 0x00},
+		{0x17, 0x80, 0x55, 0xf0, 0x10},
+		{0x2b, 0x92, 0x08, 0x00},
+		{0xeb, 0x8a, 0x08, 0x00},
+		{0x13, 0x10, 0x56, 0xe5, 0x98},
+		{0x13, 0x08, 0x56, 0xe5, 0x9d, 0x48, 0x80},
+	} {
+		config, err := DecodeAudioSpecificConfig(data)
+		assert.Nil(t, err)
+
+		marshaled, err := config.Marshal()
+		assert.Nil(t, err)
+		assert.Equal(t, data, marshaled)
+	}
+
+	config, err := DecodeAudioSpecificConfig([]byte{0xf9, 0x46, 0x40})
+	assert.Nil(t, err)
+
+	_, err = config.Marshal()
+	assert.Equal(t, ErrUnsupportedObjectType, err)
+
+	// channel configuration 0 needs a program config
+	_, err = (&AudioSpecificConfig{ObjectType: ObjectTypeLC, SampleRate: 48000}).Marshal()
+	assert.Equal(t, ErrInvalidAudioSpecificConfig, err)
+}
+
+func TestProgramConfig(t *testing.T) {
+	// 5.1 described by a program config element instead of a channel configuration
+	config := &AudioSpecificConfig{
+		ObjectType: ObjectTypeLC,
+		SampleRate: 48000,
+		ProgramConfig: &ProgramConfig{
+			ObjectType:     1,
+			FrequencyIndex: 3,
+			FrontElements:  []ChannelElement{{Tag: 0}, {Flag: true, Tag: 0}},
+			BackElements:   []ChannelElement{{Flag: true, Tag: 1}},
+			LfeElements:    []uint8{0},
+			MatrixMixdown:  true,
+			Comment:        []byte("5.1"),
+		},
+	}
+
+	data, err := config.Marshal()
+	assert.Nil(t, err)
+
+	decoded, err := DecodeAudioSpecificConfig(data)
+	assert.Nil(t, err)
+	assert.Equal(t, config, decoded)
+	assert.Equal(t, uint8(6), decoded.Channels())
+
+	format, err := ParseAudioSpecificConfig(data)
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(6), format.Channels)
+
+	// truncated comment
+	_, err = DecodeAudioSpecificConfig(data[:len(data)-1])
+	assert.Equal(t, ErrInvalidAudioSpecificConfig, err)
+}
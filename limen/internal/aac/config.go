@@ -106,49 +106,21 @@ func ParseEsdsConfig(esds []byte) (*Format, error) {
 	return format, nil
 }
 
-func ParseAudioSpecificConfig(data []byte) (*Format, error) {
-	if len(data) < 2 {
-		return nil, errors.New("audio specific config is too short")
-	}
-
-	var payload uint64
-	reader := util.BitReader{
-		Data: data,
-	}
-
-	reader.ReadBits(5, &payload)
-	profile := byte(payload)
-
-	reader.ReadBits(4, &payload)
-	frequencyId := byte(payload)
-
-	customFrequencyLen := 0
-	if frequencyId == 15 {
-		customFrequencyLen = 24
-	}
-
-	var customFrequency uint32
-	if customFrequencyLen > 0 {
-		reader.ReadBits(customFrequencyLen, &payload)
-		customFrequency = uint32(payload)
-	}
+var sampleRates = []uint32{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
 
-	reader.ReadBits(4, &payload)
-	channelConfigId := byte(payload)
-
-	reader.ReadBits(1, &payload)
-	frameLengthId := byte(payload)
-
-	var sampleRate uint32
-	if frequencyId == 15 {
-		sampleRate = customFrequency
+// ParseAudioSpecificConfig returns the format of the config, the sample rate,
+// samples per frame and channels are the ones after SBR and PS.
+func ParseAudioSpecificConfig(data []byte) (*Format, error) {
+	config, err := DecodeAudioSpecificConfig(data)
+	if err != nil {
+		return nil, err
 	}
 
 	format := &Format{
-		SampleRate:      sampleRate,
-		SamplesPerFrame: frameLengthIdToSamplesPerFrame(frameLengthId),
-		Profile:         aotToProfile(profile),
-		Channels:        channelConfigId,
+		SampleRate:      config.OutputSampleRate(),
+		SamplesPerFrame: config.SamplesPerFrame(),
+		Profile:         config.Profile(),
+		Channels:        config.Channels(),
 		MpegVersion:     4,
 		Encapsulation:   EncapsulationNone,
 		Config:          data,
@@ -158,17 +130,6 @@ func ParseAudioSpecificConfig(data []byte) (*Format, error) {
 	return format, nil
 }
 
-func frameLengthIdToSamplesPerFrame(frameLengthId byte) uint32 {
-	switch frameLengthId {
-	case 0:
-		return 1024
-	case 1:
-		return 960
-	default:
-		return 0
-	}
-}
-
 func aotToProfile(aot byte) AACProfile {
 	switch aot {
 	case 1:
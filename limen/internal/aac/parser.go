@@ -8,19 +8,181 @@ import (
 
 const DefaultSamplesPerFrame = 1024
 
+var ErrMissingConfig = errors.New("aac: raw frame parsed before the audio specific config")
+
 type ParserOptions struct {
+	// SamplesPerFrame of ADTS input, which can not signal it, zero means the default
 	SamplesPerFrame     uint32
+	InputEncapsulation  Encapsulation
 	OutputEncapsulation Encapsulation
 }
 
-type parser struct {
+// Parser turns raw access units or an ADTS stream into frames.
+//
+// Raw input needs the audio specific config to be set first, ADTS input
+// brings its own format and may split frames across calls.
+type Parser struct {
 	options ParserOptions
+	format  *Format
+	// header of ADTS output
+	header *ADTSHeader
+
+	// incomplete ADTS frame left from the previous call
+	pending []byte
+	// timestamp of the first frame of contiguous ADTS input
+	// and the number of samples parsed since then
+	baseTimestamp int
+	samples       uint64
+}
+
+func NewParser(options ParserOptions) *Parser {
+	if options.SamplesPerFrame == 0 {
+		options.SamplesPerFrame = DefaultSamplesPerFrame
+	}
+
+	return &Parser{options: options}
+}
+
+// SetConfig sets the AudioSpecificConfig of raw input.
+func (p *Parser) SetConfig(config []byte) error {
+	format, err := ParseAudioSpecificConfig(config)
+	if err != nil {
+		return err
+	}
+
+	return p.setFormat(format)
+}
+
+func (p *Parser) setFormat(format *Format) error {
+	var header *ADTSHeader
+	if p.options.OutputEncapsulation == EncapsulationADTS {
+		var err error
+		if header, err = NewADTSHeader(format); err != nil {
+			return err
+		}
+	}
+
+	p.format = format
+	p.header = header
+
+	return nil
+}
+
+// Format returns the format of the last parsed frame.
+func (p *Parser) Format() *Format {
+	return p.format
+}
+
+// Parse parses the frames of the data, the timestamp in milliseconds is the
+// one of the first frame. Timestamps of the following ADTS frames, including
+// ones completed by the next call, are derived from the number of samples
+// preceding them.
+func (p *Parser) Parse(data []byte, timestamp int) ([]*codec.Frame, error) {
+	if p.options.InputEncapsulation == EncapsulationADTS {
+		return p.parseADTS(data, timestamp)
+	}
+
+	if p.format == nil {
+		return nil, ErrMissingConfig
+	}
+
+	frame, err := p.frame(data, timestamp)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*codec.Frame{frame}, nil
+}
+
+func (p *Parser) parseADTS(data []byte, timestamp int) ([]*codec.Frame, error) {
+	if len(p.pending) > 0 {
+		data = append(p.pending, data...)
+		p.pending = nil
+	} else {
+		p.baseTimestamp = timestamp
+		p.samples = 0
+	}
+
+	var frames []*codec.Frame
+
+	for len(data) >= adtsHeaderSize {
+		header, err := ParseADTSHeader(data)
+		if err != nil {
+			return nil, err
+		}
+
+		if header.RawDataBlocks > 1 {
+			return nil, ErrUnsupportedADTS
+		}
+
+		if header.FrameLength > len(data) {
+			break
+		}
+
+		if p.format == nil || !p.sameFormat(header) {
+			// timestamps continue from the frame the format changes at
+			if p.format != nil {
+				p.baseTimestamp = p.timestamp()
+				p.samples = 0
+			}
+
+			if err := p.setFormat(header.Format(p.options.SamplesPerFrame)); err != nil {
+				return nil, err
+			}
+		}
+
+		var frame *codec.Frame
+		if p.options.OutputEncapsulation == EncapsulationADTS {
+			frame = p.newFrame(data[:header.FrameLength], p.timestamp())
+		} else {
+			frame = p.newFrame(data[header.HeaderLength:header.FrameLength], p.timestamp())
+		}
+
+		frames = append(frames, frame)
+		p.samples += uint64(p.format.SamplesPerFrame)
+		data = data[header.FrameLength:]
+	}
+
+	// the data might get reused by the caller
+	if len(data) > 0 {
+		p.pending = append([]byte(nil), data...)
+	}
+
+	return frames, nil
 }
 
-func NewParser() *parser {
-	return &parser{}
+// sameFormat tells whether the header describes the current format.
+func (p *Parser) sameFormat(header *ADTSHeader) bool {
+	return p.format.Encapsulation == EncapsulationADTS &&
+		p.format.SampleRate == header.SampleRate() &&
+		p.format.Channels == header.Channels &&
+		p.format.Profile == aotToProfile(header.ObjectType) &&
+		p.format.MpegVersion == header.MpegVersion
+}
+
+func (p *Parser) timestamp() int {
+	return p.baseTimestamp + int(p.samples*1000/uint64(p.format.SampleRate))
+}
+
+// frame converts a raw frame into the output encapsulation.
+func (p *Parser) frame(data []byte, timestamp int) (*codec.Frame, error) {
+	if p.header != nil {
+		var err error
+		if data, err = p.header.Encode(data); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.newFrame(data, timestamp), nil
 }
 
-func (p *parser) Parse(data []byte) (*codec.Frame, error) {
-	return nil, errors.New("not Encapsulation")
+func (p *Parser) newFrame(data []byte, timestamp int) *codec.Frame {
+	return &codec.Frame{
+		Metadata: p.format,
+		Data:     data,
+		Dts:      timestamp,
+		Pts:      timestamp,
+		Codec:    codec.CodecTypeAAC,
+		Type:     codec.FrameTypeKey,
+	}
 }
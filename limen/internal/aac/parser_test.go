@@ -0,0 +1,148 @@
+package aac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/codec"
+)
+
+func adtsFrame(t *testing.T, format *Format, payload []byte) []byte {
+	header, err := NewADTSHeader(format)
+	assert.Nil(t, err)
+
+	frame, err := header.Encode(payload)
+	assert.Nil(t, err)
+
+	return frame
+}
+
+func timestamps(frames []*codec.Frame) []int {
+	var out []int
+	for _, frame := range frames {
+		out = append(out, frame.Dts)
+	}
+
+	return out
+}
+
+func TestParserRawToADTS(t *testing.T) {
+	parser := NewParser(ParserOptions{OutputEncapsulation: EncapsulationADTS})
+
+	_, err := parser.Parse([]byte{0x21, 0x00, 0x03}, 0)
+	assert.Equal(t, ErrMissingConfig, err)
+
+	assert.Nil(t, parser.SetConfig([]byte{0x12, 0x10}))
+
+	frames, err := parser.Parse([]byte{0x21, 0x00, 0x03}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []*codec.Frame{{
+		Metadata: parser.Format(),
+		Data:     []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x03},
+		Dts:      100,
+		Pts:      100,
+		Codec:    codec.CodecTypeAAC,
+		Type:     codec.FrameTypeKey,
+	}}, frames)
+
+	_, err = parser.Parse(make([]byte, MaxADTSFrameSize), 123)
+	assert.Equal(t, ErrFrameTooLarge, err)
+
+	// 44000Hz can't be described by ADTS
+	assert.Equal(t, ErrADTSIncompatible, parser.SetConfig([]byte{0x17, 0x80, 0x55, 0xf0, 0x10}))
+}
+
+func TestParserRawPassthrough(t *testing.T) {
+	parser := NewParser(ParserOptions{})
+	assert.Nil(t, parser.SetConfig([]byte{0x12, 0x10}))
+
+	frames, err := parser.Parse([]byte{0x21, 0x00, 0x03}, 100)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x21, 0x00, 0x03}, frames[0].Data)
+	assert.Equal(t, uint32(44100), frames[0].Metadata.(*Format).SampleRate)
+}
+
+func TestParserSplitsADTS(t *testing.T) {
+	parser := NewParser(ParserOptions{InputEncapsulation: EncapsulationADTS})
+	format := &Format{Profile: ProfileLC, SampleRate: 44100, Channels: 2}
+
+	var stream []byte
+	for i := byte(0); i < 3; i++ {
+		stream = append(stream, adtsFrame(t, format, []byte{0x21, i})...)
+	}
+
+	// the second frame gets completed by the next call
+	frames, err := parser.Parse(stream[:12], 1000)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{1000}, timestamps(frames))
+	assert.Equal(t, []byte{0x21, 0x00}, frames[0].Data)
+
+	frames, err = parser.Parse(stream[12:], 5000)
+	assert.Nil(t, err)
+	// 1024 samples at 44100Hz last 23.2ms
+	assert.Equal(t, []int{1023, 1046}, timestamps(frames))
+	assert.Equal(t, []byte{0x21, 0x01}, frames[0].Data)
+	assert.Equal(t, []byte{0x21, 0x02}, frames[1].Data)
+
+	assert.Equal(t, &Format{
+		SampleRate:      44100,
+		SamplesPerFrame: 1024,
+		Profile:         ProfileLC,
+		Channels:        2,
+		MpegVersion:     4,
+		Encapsulation:   EncapsulationADTS,
+		Config:          []byte{0x12, 0x10},
+		ConfigType:      ConfigTypeAudioSpecific,
+	}, parser.Format())
+
+	// a new call without a pending frame starts from its own timestamp
+	frames, err = parser.Parse(stream[:9], 2000)
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2000}, timestamps(frames))
+}
+
+func TestParserADTSFormatChange(t *testing.T) {
+	parser := NewParser(ParserOptions{InputEncapsulation: EncapsulationADTS, OutputEncapsulation: EncapsulationADTS})
+
+	stereo := adtsFrame(t, &Format{Profile: ProfileLC, SampleRate: 44100, Channels: 2}, []byte{0x21, 0x00})
+	mono := adtsFrame(t, &Format{Profile: ProfileLC, SampleRate: 48000, Channels: 1}, []byte{0x21, 0x01})
+
+	var stream []byte
+	for _, frame := range [][]byte{stereo, stereo, mono, mono} {
+		stream = append(stream, frame...)
+	}
+
+	frames, err := parser.Parse(stream, 0)
+	assert.Nil(t, err)
+	// the frames at 48000Hz last 21.3ms
+	assert.Equal(t, []int{0, 23, 46, 67}, timestamps(frames))
+	assert.Equal(t, mono, frames[3].Data)
+	assert.Equal(t, uint32(44100), frames[1].Metadata.(*Format).SampleRate)
+	assert.Equal(t, uint32(48000), frames[2].Metadata.(*Format).SampleRate)
+	assert.Equal(t, uint8(1), parser.Format().Channels)
+}
+
+func TestParserADTSWithCRC(t *testing.T) {
+	parser := NewParser(ParserOptions{InputEncapsulation: EncapsulationADTS, SamplesPerFrame: 960})
+
+	// protection absent flag cleared, followed by the CRC
+	frame := []byte{0xff, 0xf0, 0x50, 0x80, 0x01, 0x7f, 0xfc, 0xaa, 0xbb, 0x21, 0x00}
+
+	frames, err := parser.Parse(append(frame, frame...), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x21, 0x00}, frames[0].Data)
+	// 960 samples at 44100Hz
+	assert.Equal(t, []int{0, 21}, timestamps(frames))
+}
+
+func TestParserADTSErrors(t *testing.T) {
+	parser := NewParser(ParserOptions{InputEncapsulation: EncapsulationADTS})
+
+	_, err := parser.Parse([]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}, 0)
+	assert.Equal(t, ErrInvalidADTS, err)
+
+	// two raw data blocks
+	_, err = parser.Parse([]byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x3f, 0xfd, 0x21}, 0)
+	assert.Equal(t, ErrUnsupportedADTS, err)
+}
@@ -2,8 +2,23 @@ package codec
 
 type CodecType uint8
 
+const (
+	CodecTypeUnknown CodecType = 0
+	CodecTypeH264    CodecType = 1
+	CodecTypeAAC     CodecType = 2
+	CodecTypeH265    CodecType = 3
+)
+
 type FrameType uint8
 
+const (
+	FrameTypeUnknown FrameType = 0
+	// FrameTypeKey frames can be decoded on their own
+	FrameTypeKey FrameType = 1
+	// FrameTypeDelta frames depend on the preceding ones
+	FrameTypeDelta FrameType = 2
+)
+
 type Frame struct {
 	Metadata interface{}
 	Data     []byte
@@ -0,0 +1,136 @@
+package dash
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+type adaptationSet struct {
+	representation *representation
+	// segments within the time shift buffer
+	segments []*Segment
+}
+
+type manifest struct {
+	options Options
+	sets    []adaptationSet
+	// media time the period starts at
+	origin            time.Duration
+	availabilityStart time.Time
+	publishTime       time.Time
+	ended             bool
+}
+
+// renderManifest renders a live profile MPD with a single period, segment
+// times are in milliseconds of the stream relative to the period start.
+//
+// Once the stream ends the manifest turns static, covering the segments
+// which were still in the time shift buffer.
+func renderManifest(m manifest) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	buffer.WriteString(`<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011"`)
+
+	if m.ended {
+		start, end := m.bounds()
+		fmt.Fprintf(&buffer, ` type="static" mediaPresentationDuration="%s"`, duration(end-start))
+	} else {
+		fmt.Fprintf(&buffer, ` type="dynamic" availabilityStartTime="%s" publishTime="%s"`, timestamp(m.availabilityStart), timestamp(m.publishTime))
+		fmt.Fprintf(&buffer, ` minimumUpdatePeriod="%s" timeShiftBufferDepth="%s"`, duration(m.options.TargetDuration), duration(m.options.TimeShiftBufferDepth))
+	}
+
+	fmt.Fprintf(&buffer, ` minBufferTime="%s">`+"\n", duration(m.options.TargetDuration))
+
+	if m.ended {
+		// the period starts with the oldest segment still available
+		start, _ := m.bounds()
+		m.origin = start
+	}
+
+	buffer.WriteString(`  <Period id="0" start="PT0S">` + "\n")
+
+	for _, set := range m.sets {
+		current := set.representation
+
+		if current.id == videoRepresentation {
+			buffer.WriteString(`    <AdaptationSet id="0" contentType="video" mimeType="video/mp4" segmentAlignment="true" startWithSAP="1">` + "\n")
+		} else {
+			buffer.WriteString(`    <AdaptationSet id="1" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" startWithSAP="1">` + "\n")
+		}
+
+		fmt.Fprintf(&buffer, `      <SegmentTemplate timescale="1000" presentationTimeOffset="%d" startNumber="%d" initialization="%s/init.mp4" media="%s/$Number$.m4s">`+"\n",
+			m.origin.Milliseconds(), set.segments[0].Number, current.id, current.id)
+		buffer.WriteString(`        <SegmentTimeline>` + "\n")
+
+		for _, segment := range set.segments {
+			fmt.Fprintf(&buffer, `          <S t="%d" d="%d"/>`+"\n", segment.Start.Milliseconds(), segment.Duration.Milliseconds())
+		}
+
+		buffer.WriteString(`        </SegmentTimeline>` + "\n")
+		buffer.WriteString(`      </SegmentTemplate>` + "\n")
+
+		fmt.Fprintf(&buffer, `      <Representation id="%s" codecs="%s" bandwidth="%d"`, current.id, current.codecs, bandwidth(set.segments))
+
+		if current.id == videoRepresentation {
+			if current.width > 0 {
+				fmt.Fprintf(&buffer, ` width="%d" height="%d"`, current.width, current.height)
+			}
+			buffer.WriteString(`/>` + "\n")
+		} else {
+			fmt.Fprintf(&buffer, ` audioSamplingRate="%d">`+"\n", current.sampleRate)
+			fmt.Fprintf(&buffer, `        <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="%d"/>`+"\n", current.channels)
+			buffer.WriteString(`      </Representation>` + "\n")
+		}
+
+		buffer.WriteString(`    </AdaptationSet>` + "\n")
+	}
+
+	buffer.WriteString(`  </Period>` + "\n")
+	buffer.WriteString(`</MPD>` + "\n")
+
+	return buffer.Bytes()
+}
+
+// bounds returns the media time range covered by all the adaptation sets.
+func (m manifest) bounds() (time.Duration, time.Duration) {
+	start, end := m.sets[0].segments[0].Start, time.Duration(0)
+
+	for _, set := range m.sets {
+		first, last := set.segments[0], set.segments[len(set.segments)-1]
+
+		if first.Start < start {
+			start = first.Start
+		}
+
+		if last.Start+last.Duration > end {
+			end = last.Start + last.Duration
+		}
+	}
+
+	return start, end
+}
+
+// bandwidth estimates the bitrate of the segments in bits per second.
+func bandwidth(segments []*Segment) int64 {
+	var bytes, total int64
+	for _, segment := range segments {
+		bytes += int64(len(segment.Data))
+		total += segment.Duration.Milliseconds()
+	}
+
+	if total == 0 {
+		return 1
+	}
+
+	return bytes*8*1000/total + 1
+}
+
+func duration(value time.Duration) string {
+	return fmt.Sprintf("PT%.3fS", value.Seconds())
+}
+
+func timestamp(value time.Time) string {
+	return value.UTC().Format("2006-01-02T15:04:05.000Z")
+}
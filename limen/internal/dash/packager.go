@@ -0,0 +1,382 @@
+package dash
+
+import (
+	"sync"
+	"time"
+
+	"limen/internal/aac"
+	"limen/internal/flv"
+	"limen/internal/fmp4"
+	"limen/internal/h264"
+	"limen/internal/registry"
+)
+
+const (
+	DefaultTargetDuration       = 2 * time.Second
+	DefaultTimeShiftBufferDepth = 30 * time.Second
+
+	videoRepresentation = "video"
+	audioRepresentation = "audio"
+
+	// segments which dropped out of the time shift buffer stay available
+	// for a while for clients that have just loaded an older manifest
+	retainedSegments = 2
+)
+
+// Segment is a single media segment of one of the representations.
+type Segment struct {
+	Number int
+	// Start is the media time of the stream the segment starts at
+	Start    time.Duration
+	Duration time.Duration
+	Data     []byte
+}
+
+type representation struct {
+	id     string
+	muxer  *fmp4.Muxer
+	codecs string
+	init   []byte
+	// video only, zero when the SPS could not be parsed
+	width  int
+	height int
+	// audio only
+	sampleRate uint32
+	channels   uint8
+
+	segments   []*Segment
+	nextNumber int
+}
+
+// Packager cuts a stream into fMP4 segments with separate video and audio
+// representations and renders the manifest describing them, packets are
+// written by a single goroutine while segments and the manifest can be
+// read concurrently.
+//
+// Segments of both representations are cut at the same time, on the first
+// keyframe past the target duration or on any audio frame for streams
+// without video.
+type Packager struct {
+	options Options
+	now     func() time.Time
+
+	started bool
+	// whether the video was configured when the segment started
+	segmentHasVideo bool
+	// timestamps in milliseconds
+	startDts      int
+	lastDts       int
+	frameDuration int
+
+	mu    sync.Mutex
+	video *representation
+	audio *representation
+	// media time of the first segment and the wall clock time it started at
+	origin            int
+	availabilityStart time.Time
+	ended             bool
+}
+
+func NewPackager(options Options) *Packager {
+	options.setDefaults()
+
+	return &Packager{
+		options: options,
+		now:     time.Now,
+		video:   &representation{id: videoRepresentation, muxer: fmp4.NewMuxer()},
+		audio:   &representation{id: audioRepresentation, muxer: fmp4.NewMuxer()},
+	}
+}
+
+// WritePacket adds a packet to the current segment, packets of unsupported
+// codecs are skipped and reported with fmp4.ErrUnsupportedCodec.
+func (p *Packager) WritePacket(packet *registry.Packet) error {
+	var packetType flv.PacketType
+
+	switch packet.Type {
+	case registry.VideoPacket:
+		packetType = flv.VideoPacket
+	case registry.AudioPacket:
+		packetType = flv.AudioPacket
+	default:
+		return nil
+	}
+
+	decoded, err := flv.DecodeTagData(packetType, packet.Data)
+	if err != nil {
+		return err
+	}
+	decoded.SetTimestamps(int(packet.Timestamp))
+
+	switch decoded.Type {
+	case flv.VideoConfigPacket:
+		return p.configure(p.video, decoded)
+
+	case flv.AudioConfigPacket:
+		return p.configure(p.audio, decoded)
+
+	case flv.VideoSequenceEndPacket, flv.VideoMetadataPacket:
+		// they come only with extended video codecs, which are never muxed
+		return nil
+
+	case flv.VideoPacket:
+		if !p.video.muxer.HasVideo() {
+			return skip(decoded)
+		}
+
+		keyFrame := decoded.CodecParams.(*flv.VideoCodecParams).KeyFrame
+		if keyFrame && (!p.started || !p.segmentHasVideo || p.due(decoded.Dts)) {
+			p.cut(decoded.Dts)
+		}
+
+		// frames preceding the first keyframe of the segment can't be decoded
+		if !p.started || !p.segmentHasVideo {
+			return nil
+		}
+
+		err = p.video.muxer.WritePacket(decoded)
+
+	default:
+		if !p.audio.muxer.HasAudio() {
+			return skip(decoded)
+		}
+
+		if !p.video.muxer.HasVideo() && (!p.started || p.due(decoded.Dts)) {
+			p.cut(decoded.Dts)
+		}
+
+		if !p.started {
+			return nil
+		}
+
+		err = p.audio.muxer.WritePacket(decoded)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if decoded.Dts > p.lastDts {
+		p.frameDuration = decoded.Dts - p.lastDts
+		p.lastDts = decoded.Dts
+	}
+
+	return nil
+}
+
+func (p *Packager) configure(current *representation, packet *flv.Packet) error {
+	if err := current.muxer.WritePacket(packet); err != nil {
+		return err
+	}
+
+	init, err := current.muxer.InitSegment()
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current.init = init
+
+	if packet.Type == flv.VideoConfigPacket {
+		// already validated by the muxer
+		config, _ := h264.ParseDecoderConfigurationRecord(packet.Data)
+		current.codecs = config.Codecs()
+
+		current.width, current.height = 0, 0
+		if sps, err := h264.ParseSPS(config.SPS[0]); err == nil {
+			current.width, current.height = sps.Width, sps.Height
+		}
+
+		return nil
+	}
+
+	// already validated by the muxer
+	config, _ := aac.DecodeAudioSpecificConfig(packet.Data)
+	current.codecs = config.Codecs()
+
+	format, _ := aac.ParseAudioSpecificConfig(packet.Data)
+	current.sampleRate = format.SampleRate
+	current.channels = format.Channels
+
+	return nil
+}
+
+// skip drops frames which arrive ahead of their codec configuration,
+// which never comes for unsupported codecs.
+func skip(packet *flv.Packet) error {
+	if packet.Type == flv.VideoPacket && packet.Codec != flv.VideoCodecH264 ||
+		packet.Type == flv.AudioPacket && packet.Codec != flv.SoundTypeAAC {
+		return fmp4.ErrUnsupportedCodec
+	}
+
+	return nil
+}
+
+func (p *Packager) due(dts int) bool {
+	return time.Duration(dts-p.startDts)*time.Millisecond >= p.options.TargetDuration
+}
+
+// cut finishes the current segment and starts a new one at the given timestamp.
+func (p *Packager) cut(dts int) {
+	if p.started {
+		p.finishSegment(dts)
+	} else {
+		p.mu.Lock()
+		p.origin = dts
+		p.availabilityStart = p.now()
+		p.mu.Unlock()
+	}
+
+	p.started = true
+	p.segmentHasVideo = p.video.muxer.HasVideo()
+	p.startDts = dts
+	p.lastDts = dts
+}
+
+func (p *Packager) finishSegment(endDts int) {
+	video := p.video.muxer.Fragment(endDts)
+	audio := p.audio.muxer.Fragment(endDts)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, fragment := range []struct {
+		representation *representation
+		data           []byte
+	}{{p.video, video}, {p.audio, audio}} {
+		// representations without any samples in the segment get a gap
+		if fragment.data == nil {
+			continue
+		}
+
+		current := fragment.representation
+		current.segments = append(current.segments, &Segment{
+			Number:   current.nextNumber,
+			Start:    time.Duration(p.startDts) * time.Millisecond,
+			Duration: time.Duration(endDts-p.startDts) * time.Millisecond,
+			Data:     fragment.data,
+		})
+		current.nextNumber++
+
+		current.segments = current.segments[p.firstRetained(current.segments):]
+	}
+}
+
+// firstRetained returns the index of the oldest segment which is either within
+// the time shift buffer or just dropped out of it.
+func (p *Packager) firstRetained(segments []*Segment) int {
+	first := p.firstAvailable(segments) - retainedSegments
+	if first < 0 {
+		return 0
+	}
+
+	return first
+}
+
+// firstAvailable returns the index of the oldest segment within the time shift buffer.
+func (p *Packager) firstAvailable(segments []*Segment) int {
+	if len(segments) == 0 {
+		return 0
+	}
+
+	last := segments[len(segments)-1]
+	end := last.Start + last.Duration
+
+	for i, segment := range segments {
+		if end-segment.Start <= p.options.TimeShiftBufferDepth {
+			return i
+		}
+	}
+
+	return len(segments) - 1
+}
+
+// End finishes the last segment and turns the manifest into a static one.
+func (p *Packager) End() {
+	if p.started {
+		p.finishSegment(p.lastDts + p.frameDuration)
+		p.started = false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ended = true
+}
+
+// InitSegment returns the initialization segment of the "video" or "audio" representation.
+func (p *Packager) InitSegment(representation string) ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := p.representation(representation)
+	if current == nil || current.init == nil {
+		return nil, false
+	}
+
+	return current.init, true
+}
+
+// Segment returns the segment of the "video" or "audio" representation
+// with the given number if it is still retained.
+func (p *Packager) Segment(representation string, number int) (*Segment, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	current := p.representation(representation)
+	if current == nil {
+		return nil, false
+	}
+
+	for _, segment := range current.segments {
+		if segment.Number == number {
+			return segment, true
+		}
+	}
+
+	return nil, false
+}
+
+// Manifest renders the MPD, it returns false until the first segment is complete.
+func (p *Packager) Manifest() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var sets []adaptationSet
+	for _, current := range []*representation{p.video, p.audio} {
+		if current.init == nil || len(current.segments) == 0 {
+			continue
+		}
+
+		sets = append(sets, adaptationSet{
+			representation: current,
+			segments:       current.segments[p.firstAvailable(current.segments):],
+		})
+	}
+
+	if len(sets) == 0 {
+		return nil, false
+	}
+
+	return renderManifest(manifest{
+		options:           p.options,
+		sets:              sets,
+		origin:            time.Duration(p.origin) * time.Millisecond,
+		availabilityStart: p.availabilityStart,
+		publishTime:       p.now(),
+		ended:             p.ended,
+	}), true
+}
+
+func (p *Packager) representation(id string) *representation {
+	switch id {
+	case videoRepresentation:
+		return p.video
+	case audioRepresentation:
+		return p.audio
+	}
+
+	return nil
+}
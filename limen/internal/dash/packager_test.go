@@ -0,0 +1,166 @@
+package dash
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/fmp4"
+	"limen/internal/packaging/packagingtest"
+	"limen/internal/registry"
+)
+
+var availabilityStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// newPackager returns a packager with a clock stopped at availabilityStart,
+// the returned pointer moves it.
+func newPackager(options Options) (*Packager, *time.Time) {
+	packager := NewPackager(options)
+
+	now := availabilityStart
+	packager.now = func() time.Time { return now }
+
+	return packager, &now
+}
+
+func TestPackagerDynamicManifest(t *testing.T) {
+	packager, now := newPackager(Options{TargetDuration: time.Second})
+
+	_, ok := packager.Manifest()
+	assert.False(t, ok)
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: packagingtest.AACConfigTag}))
+
+	// the stream starts at 5s of media time
+	for timestamp := uint32(5000); timestamp < 7100; timestamp += 100 {
+		assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: timestamp, Data: packagingtest.VideoTag(timestamp%1000 == 0, 0)}))
+		assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Timestamp: timestamp, Data: packagingtest.AACFrameTag}))
+	}
+	*now = availabilityStart.Add(2100 * time.Millisecond)
+
+	manifest, ok := packager.Manifest()
+	assert.True(t, ok)
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" profiles="urn:mpeg:dash:profile:isoff-live:2011" type="dynamic" availabilityStartTime="2024-05-01T12:00:00.000Z" publishTime="2024-05-01T12:00:02.100Z" minimumUpdatePeriod="PT1.000S" timeShiftBufferDepth="PT30.000S" minBufferTime="PT1.000S">
+  <Period id="0" start="PT0S">
+    <AdaptationSet id="0" contentType="video" mimeType="video/mp4" segmentAlignment="true" startWithSAP="1">
+      <SegmentTemplate timescale="1000" presentationTimeOffset="5000" startNumber="0" initialization="video/init.mp4" media="video/$Number$.m4s">
+        <SegmentTimeline>
+          <S t="5000" d="1000"/>
+          <S t="6000" d="1000"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="video" codecs="avc1.42c01e" bandwidth="`+bitrate(packager, videoRepresentation)+`" width="1280" height="720"/>
+    </AdaptationSet>
+    <AdaptationSet id="1" contentType="audio" mimeType="audio/mp4" segmentAlignment="true" startWithSAP="1">
+      <SegmentTemplate timescale="1000" presentationTimeOffset="5000" startNumber="0" initialization="audio/init.mp4" media="audio/$Number$.m4s">
+        <SegmentTimeline>
+          <S t="5000" d="1000"/>
+          <S t="6000" d="1000"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+      <Representation id="audio" codecs="mp4a.40.2" bandwidth="`+bitrate(packager, audioRepresentation)+`" audioSamplingRate="44100">
+        <AudioChannelConfiguration schemeIdUri="urn:mpeg:dash:23003:3:audio_channel_configuration:2011" value="2"/>
+      </Representation>
+    </AdaptationSet>
+  </Period>
+</MPD>
+`, string(manifest))
+
+	init, ok := packager.InitSegment(videoRepresentation)
+	assert.True(t, ok)
+	assert.Equal(t, "ftyp", string(init[4:8]))
+
+	segment, ok := packager.Segment(audioRepresentation, 1)
+	assert.True(t, ok)
+	assert.Equal(t, 6*time.Second, segment.Start)
+	assert.Equal(t, "moof", string(segment.Data[4:8]))
+
+	_, ok = packager.Segment(audioRepresentation, 2)
+	assert.False(t, ok)
+
+	_, ok = packager.InitSegment("subtitles")
+	assert.False(t, ok)
+}
+
+// bitrate returns the bandwidth the manifest is expected to announce.
+func bitrate(packager *Packager, representation string) string {
+	var segments []*Segment
+	for number := 0; ; number++ {
+		segment, ok := packager.Segment(representation, number)
+		if !ok {
+			break
+		}
+		segments = append(segments, segment)
+	}
+
+	return strconv.FormatInt(bandwidth(segments), 10)
+}
+
+func TestPackagerTimeShiftBuffer(t *testing.T) {
+	packager, _ := newPackager(Options{TargetDuration: time.Second, TimeShiftBufferDepth: 3 * time.Second})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	packagingtest.WriteVideo(t, packager, 0, 8100)
+
+	manifest, ok := packager.Manifest()
+	assert.True(t, ok)
+
+	// segments 0-7 are complete, the last three make up the buffer
+	assert.Contains(t, string(manifest), `startNumber="5"`)
+	assert.Contains(t, string(manifest), "<SegmentTimeline>\n"+
+		`          <S t="5000" d="1000"/>`+"\n"+
+		`          <S t="6000" d="1000"/>`+"\n"+
+		`          <S t="7000" d="1000"/>`+"\n"+
+		"        </SegmentTimeline>")
+
+	// segments which just left the buffer are still served
+	for number, retained := range map[int]bool{2: false, 3: true, 4: true, 7: true} {
+		_, ok := packager.Segment(videoRepresentation, number)
+		assert.Equal(t, retained, ok, number)
+	}
+}
+
+func TestPackagerStaticManifestAfterEnd(t *testing.T) {
+	packager, _ := newPackager(Options{TargetDuration: time.Second})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	packagingtest.WriteVideo(t, packager, 1000, 2500)
+	packager.End()
+
+	manifest, ok := packager.Manifest()
+	assert.True(t, ok)
+	assert.Contains(t, string(manifest), `type="static" mediaPresentationDuration="PT1.500S" minBufferTime="PT1.000S">`)
+	assert.NotContains(t, string(manifest), "availabilityStartTime")
+	assert.Contains(t, string(manifest), `presentationTimeOffset="1000" startNumber="0"`)
+	assert.Contains(t, string(manifest), `<S t="2000" d="500"/>`)
+	assert.NotContains(t, string(manifest), `contentType="audio"`)
+}
+
+func TestPackagerAudioOnly(t *testing.T) {
+	packager, _ := newPackager(Options{TargetDuration: time.Second})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: packagingtest.AACConfigTag}))
+	for timestamp := uint32(0); timestamp < 2100; timestamp += 100 {
+		assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Timestamp: timestamp, Data: packagingtest.AACFrameTag}))
+	}
+
+	manifest, ok := packager.Manifest()
+	assert.True(t, ok)
+	assert.NotContains(t, string(manifest), `contentType="video"`)
+	assert.Contains(t, string(manifest), `<S t="1000" d="1000"/>`)
+
+	_, ok = packager.InitSegment(videoRepresentation)
+	assert.False(t, ok)
+}
+
+func TestPackagerUnsupportedCodec(t *testing.T) {
+	packager, _ := newPackager(Options{})
+
+	// MP3
+	err := packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: []byte{0x2f, 0xff, 0xfb}})
+	assert.Equal(t, fmp4.ErrUnsupportedCodec, err)
+}
@@ -0,0 +1,172 @@
+package dash
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"limen/internal/packaging"
+	"limen/internal/registry"
+)
+
+type Options struct {
+	// TargetDuration is the duration after which segments get cut
+	// on the next keyframe, zero means the default.
+	TargetDuration time.Duration
+	// TimeShiftBufferDepth is how far behind the live edge clients
+	// can seek, zero means the default.
+	TimeShiftBufferDepth time.Duration
+	// Retention is how long the manifest of an ended stream stays
+	// available, zero means the default.
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+func (o *Options) setDefaults() {
+	if o.TargetDuration <= 0 {
+		o.TargetDuration = DefaultTargetDuration
+	}
+
+	if o.TimeShiftBufferDepth <= 0 {
+		o.TimeShiftBufferDepth = DefaultTimeShiftBufferDepth
+	}
+}
+
+// Server packages every published stream and serves it over HTTP as
+// "/{app}/{name}/manifest.mpd" with the init segments and media segments
+// of the representations under "/{app}/{name}/video/" and "/{app}/{name}/audio/".
+type Server struct {
+	outputs *packaging.Manager
+}
+
+func NewServer(streams *registry.Registry, options Options) *Server {
+	options.setDefaults()
+
+	newPackager := func() packaging.Packager {
+		return NewPackager(options)
+	}
+
+	return &Server{
+		outputs: packaging.NewManager(streams, newPackager, packaging.Options{
+			Format:    "DASH",
+			Retention: options.Retention,
+			Logger:    options.Logger,
+		}),
+	}
+}
+
+// Start begins packaging the live and future streams for DASH.
+func (s *Server) Start() {
+	s.outputs.Start()
+}
+
+// Close stops packaging, it returns once all packagers have ended.
+func (s *Server) Close() {
+	s.outputs.Close()
+}
+
+func (s *Server) packager(key registry.Key) (*Packager, bool) {
+	packager, ok := s.outputs.Packager(key)
+	if !ok {
+		return nil, false
+	}
+
+	return packager.(*Packager), true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// players are usually served from a different origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	// the manifest is in the stream directory, segments one level deeper
+	file := parts[len(parts)-1]
+	var representation string
+	if file != "manifest.mpd" {
+		if len(parts) < 4 {
+			http.NotFound(w, r)
+			return
+		}
+
+		representation = parts[len(parts)-2]
+		parts = parts[:len(parts)-1]
+	}
+
+	key := registry.Key{App: strings.Join(parts[:len(parts)-2], "/"), Name: parts[len(parts)-2]}
+
+	packager, ok := s.packager(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	var contentType string
+	switch representation {
+	case videoRepresentation:
+		contentType = "video/mp4"
+	case audioRepresentation:
+		contentType = "audio/mp4"
+	}
+
+	switch {
+	case file == "manifest.mpd":
+		manifest, ok := packager.Manifest()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/dash+xml")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(manifest)
+
+	case contentType == "":
+		http.NotFound(w, r)
+
+	case file == "init.mp4":
+		init, ok := packager.InitSegment(representation)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// the configuration changes once the stream is published again
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(init)
+
+	case strings.HasSuffix(file, ".m4s"):
+		number, err := strconv.Atoi(strings.TrimSuffix(file, ".m4s"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		segment, ok := packager.Segment(representation, number)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// segment names get reused once the stream is published again
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(segment.Data)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,105 @@
+package dash
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/packaging/packagingtest"
+	"limen/internal/registry"
+)
+
+func TestServerServesPublishedStreams(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	dash := NewServer(streams, Options{TargetDuration: time.Second})
+	dash.Start()
+	defer dash.Close()
+
+	server := httptest.NewServer(dash)
+	defer server.Close()
+
+	status, _, _ := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag})
+	stream.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: packagingtest.AACConfigTag})
+	for timestamp := uint32(0); timestamp <= 1000; timestamp += 100 {
+		stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: timestamp, Data: packagingtest.VideoTag(timestamp%1000 == 0, 0)})
+		stream.WritePacket(&registry.Packet{Type: registry.AudioPacket, Timestamp: timestamp, Data: packagingtest.AACFrameTag})
+	}
+
+	assert.Eventually(t, func() bool {
+		status, _, _ := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+		return status == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	status, manifest, header := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "application/dash+xml", header.Get("Content-Type"))
+	assert.Equal(t, "*", header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, manifest, `type="dynamic"`)
+	assert.Contains(t, manifest, `media="video/$Number$.m4s"`)
+
+	for path, contentType := range map[string]string{
+		"/live/key/video/init.mp4": "video/mp4",
+		"/live/key/audio/init.mp4": "audio/mp4",
+		"/live/key/video/0.m4s":    "video/mp4",
+		"/live/key/audio/0.m4s":    "audio/mp4",
+	} {
+		status, _, header := packagingtest.Get(t, server, path)
+		assert.Equal(t, http.StatusOK, status, path)
+		assert.Equal(t, contentType, header.Get("Content-Type"), path)
+	}
+
+	for _, path := range []string{"/live/key/video/1.m4s", "/live/key/video/x.m4s", "/live/key/text/init.mp4", "/live/other/manifest.mpd", "/live/key/index.m3u8", "/key"} {
+		status, _, _ = packagingtest.Get(t, server, path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+
+	stream.Unpublish()
+
+	// manifests of ended streams stay available
+	assert.Eventually(t, func() bool {
+		_, manifest, _ := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+		return strings.Contains(manifest, `type="static"`)
+	}, time.Second, 10*time.Millisecond)
+
+	response, err := http.Post(server.URL+"/live/key/manifest.mpd", "text/plain", nil)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func TestServerDropsEndedStreamsAfterRetention(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	dash := NewServer(streams, Options{TargetDuration: time.Second, Retention: 200 * time.Millisecond})
+	dash.Start()
+	defer dash.Close()
+
+	server := httptest.NewServer(dash)
+	defer server.Close()
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag})
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: 0, Data: packagingtest.VideoTag(true, 0)})
+	stream.Unpublish()
+
+	assert.Eventually(t, func() bool {
+		_, manifest, _ := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+		return strings.Contains(manifest, `type="static"`)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		status, _, _ := packagingtest.Get(t, server, "/live/key/manifest.mpd")
+		return status == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
@@ -126,6 +126,12 @@ func (d *decoder) decodeBody(buffer *bufio.Reader) (*Packet, error) {
 	}
 }
 
+// DecodeTagData decodes the data of a single audio or video FLV tag
+// (the same as the payload of an RTMP audio or video message).
+func DecodeTagData(packetType PacketType, data []byte) (*Packet, error) {
+	return (&decoder{}).decodePayload(packetType, data)
+}
+
 func (d *decoder) decodePayload(packetType PacketType, payload []byte) (*Packet, error) {
 	switch packetType {
 	case AudioPacket, AudioConfigPacket:
@@ -198,6 +204,10 @@ func (d *decoder) decodeAudioPacket(payload []byte) (*Packet, error) {
 }
 
 func (d *decoder) decodeVideoPacket(payload []byte) (*Packet, error) {
+	if len(payload) > 0 && payload[0]&0x80 > 0 {
+		return d.decodeExtVideoPacket(payload)
+	}
+
 	if len(payload) < 6 {
 		return nil, ErrMalformedPacket
 	}
@@ -211,10 +221,6 @@ func (d *decoder) decodeVideoPacket(payload []byte) (*Packet, error) {
 		return nil, ErrInvalidPacketPayloadType
 	}
 
-	if frameType&0x08 > 0 {
-		return nil, ErrExtFormatUnsupported
-	}
-
 	var configPacketType PacketType
 	if packetType == 0 {
 		configPacketType = VideoConfigPacket
@@ -237,6 +243,69 @@ func (d *decoder) decodeVideoPacket(payload []byte) (*Packet, error) {
 	return packet, nil
 }
 
+// decodeExtVideoPacket decodes a video packet of enhanced RTMP, where the
+// lower bits of the first byte are the packet type followed by the FourCC
+// of the codec instead of the codec id.
+func (d *decoder) decodeExtVideoPacket(payload []byte) (*Packet, error) {
+	if len(payload) < 5 {
+		return nil, ErrMalformedPacket
+	}
+
+	frameType := (payload[0] >> 4) & 0x07
+	packetType := payload[0] & 0x0f
+
+	var fourCc ExtVideoCodec
+	copy(fourCc[:], payload[1:5])
+
+	codec, ok := extVideoCodecId(fourCc)
+	if !ok {
+		return nil, ErrExtFormatUnsupported
+	}
+
+	params := &VideoCodecParams{KeyFrame: frameType == 1}
+	packet := &Packet{
+		Data:        payload[5:],
+		Codec:       codec,
+		CodecParams: params,
+	}
+
+	switch packetType {
+	case ExtPacketTypeSequenceStart:
+		packet.Type = VideoConfigPacket
+
+	case ExtPacketTypeMPEG2TSSequenceStart:
+		packet.Type = VideoConfigPacket
+		params.Descriptor = true
+
+	case ExtPacketTypeCodedFrames:
+		packet.Type = VideoPacket
+
+		// only HEVC carries the composition time, CodedFramesX is sent when it is 0
+		if codec == VideoCodecHEVC {
+			if len(packet.Data) < 3 {
+				return nil, ErrMalformedPacket
+			}
+
+			params.CompositionTime = decodeInt24(packet.Data[:3])
+			packet.Data = packet.Data[3:]
+		}
+
+	case ExtPacketTypeCodedFramesX:
+		packet.Type = VideoPacket
+
+	case ExtPacketTypeSequenceEnd:
+		packet.Type = VideoSequenceEndPacket
+
+	case ExtPacketTypeMetadata:
+		packet.Type = VideoMetadataPacket
+
+	default:
+		return nil, ErrInvalidPacketPayloadType
+	}
+
+	return packet, nil
+}
+
 func (d *decoder) resolvedPacketType(packetType uint8) PacketType {
 	switch packetType {
 	case 8:
@@ -256,3 +325,12 @@ func decodeUint24(data []byte) uint32 {
 	size[0] = 0
 	return binary.BigEndian.Uint32(size[:])
 }
+
+func decodeInt24(data []byte) int {
+	value := int(decodeUint24(data))
+	if value&0x800000 > 0 {
+		value -= 1 << 24
+	}
+
+	return value
+}
@@ -177,7 +177,7 @@ func TestDecodeExtVideoPacket(t *testing.T) {
 		// flags
 		0x9,
 		// data size
-		0x0, 0x0, 0x7,
+		0x0, 0x0, 0xa,
 		// timestamp
 		0x0, 0x0, 0x1,
 		// timestamp extended
@@ -185,10 +185,10 @@ func TestDecodeExtVideoPacket(t *testing.T) {
 		// stream id
 		0x0, 0x0, 0x0,
 		// payload
-		// frame type: 4, codec type: 4
-		0x80 | (1 << 4) | (VideoCodecH264 & 0x0f),
-		// packet type
-		0x1,
+		// ex header: 1, frame type: 1, packet type: 1 (coded frames)
+		0x80 | (1 << 4) | ExtPacketTypeCodedFrames,
+		// fourcc
+		'h', 'v', 'c', '1',
 		// composite time
 		0x0, 0x0, 0x1,
 		// payload
@@ -196,6 +196,73 @@ func TestDecodeExtVideoPacket(t *testing.T) {
 	}
 
 	reader.Reset(bytes.NewBuffer(payload))
-	_, err = decoder.Decode(reader)
-	assert.Equal(t, ErrExtFormatUnsupported, err)
+	packet, err := decoder.Decode(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, packet.Dts)
+	assert.Equal(t, 2, packet.Pts)
+	assert.Equal(t, []byte{0xff, 0xff}, packet.Data)
+	assert.Equal(t, VideoCodecHEVC, packet.Codec)
+	assert.Equal(t, VideoPacket, packet.Type)
+	assert.True(t, packet.CodecParams.(*VideoCodecParams).KeyFrame)
+}
+
+func TestDecodeExtVideoPacketTypes(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		payload []byte
+		packet  *Packet
+	}{
+		{
+			"sequence start",
+			[]byte{0x90 | ExtPacketTypeSequenceStart, 'h', 'v', 'c', '1', 0x01, 0x02},
+			&Packet{Type: VideoConfigPacket, Codec: VideoCodecHEVC, Data: []byte{0x01, 0x02}, CodecParams: &VideoCodecParams{KeyFrame: true}},
+		},
+		{
+			"negative composition time",
+			[]byte{0xa0 | ExtPacketTypeCodedFrames, 'h', 'v', 'c', '1', 0xff, 0xff, 0xfe, 0x01},
+			&Packet{Type: VideoPacket, Codec: VideoCodecHEVC, Data: []byte{0x01}, CodecParams: &VideoCodecParams{CompositionTime: -2}},
+		},
+		{
+			"coded frames without composition time",
+			[]byte{0xa0 | ExtPacketTypeCodedFramesX, 'h', 'v', 'c', '1', 0x01},
+			&Packet{Type: VideoPacket, Codec: VideoCodecHEVC, Data: []byte{0x01}, CodecParams: &VideoCodecParams{}},
+		},
+		{
+			"AV1 coded frames",
+			[]byte{0x90 | ExtPacketTypeCodedFrames, 'a', 'v', '0', '1', 0x12, 0x00},
+			&Packet{Type: VideoPacket, Codec: VideoCodecAV1, Data: []byte{0x12, 0x00}, CodecParams: &VideoCodecParams{KeyFrame: true}},
+		},
+		{
+			"MPEG-2 TS sequence start",
+			[]byte{0x90 | ExtPacketTypeMPEG2TSSequenceStart, 'a', 'v', '0', '1', 0x80},
+			&Packet{Type: VideoConfigPacket, Codec: VideoCodecAV1, Data: []byte{0x80}, CodecParams: &VideoCodecParams{KeyFrame: true, Descriptor: true}},
+		},
+		{
+			"sequence end",
+			[]byte{0x90 | ExtPacketTypeSequenceEnd, 'v', 'p', '0', '9'},
+			&Packet{Type: VideoSequenceEndPacket, Codec: VideoCodecVP9, Data: []byte{}, CodecParams: &VideoCodecParams{KeyFrame: true}},
+		},
+		{
+			"metadata",
+			[]byte{0xd0 | ExtPacketTypeMetadata, 'h', 'v', 'c', '1', 0x02},
+			&Packet{Type: VideoMetadataPacket, Codec: VideoCodecHEVC, Data: []byte{0x02}, CodecParams: &VideoCodecParams{}},
+		},
+	} {
+		packet, err := DecodeTagData(VideoPacket, test.payload)
+		assert.Nil(t, err, test.name)
+		assert.Equal(t, test.packet, packet, test.name)
+	}
+
+	for _, test := range []struct {
+		payload []byte
+		err     error
+	}{
+		{[]byte{0x90, 'h', 'v', 'c'}, ErrMalformedPacket},
+		{[]byte{0x90 | ExtPacketTypeCodedFrames, 'h', 'v', 'c', '1', 0x00}, ErrMalformedPacket},
+		{[]byte{0x90, 'v', 'v', 'c', '1'}, ErrExtFormatUnsupported},
+		{[]byte{0x90 | 0x06, 'h', 'v', 'c', '1'}, ErrInvalidPacketPayloadType},
+	} {
+		_, err := DecodeTagData(VideoPacket, test.payload)
+		assert.Equal(t, test.err, err, test.payload)
+	}
 }
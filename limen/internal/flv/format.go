@@ -39,6 +39,42 @@ func ExtVideoCodecHEVC() [4]byte { return [4]byte{'h', 'v', 'c', '1'} }
 
 type ExtVideoCodec = [4]byte
 
+// Codecs of extended video packets, which are identified by a FourCC
+// instead of a codec id, placed past the range of codec ids.
+const (
+	VideoCodecHEVC uint8 = 0x10
+	VideoCodecAV1  uint8 = 0x11
+	VideoCodecVP9  uint8 = 0x12
+)
+
+// ExtVideoCodecs returns the FourCCs of the supported extended video codecs.
+func ExtVideoCodecs() []ExtVideoCodec {
+	return []ExtVideoCodec{ExtVideoCodecHEVC(), ExtVideoCodecAV1(), ExtVideoCodecVP9()}
+}
+
+func extVideoCodecId(fourCc ExtVideoCodec) (uint8, bool) {
+	switch fourCc {
+	case ExtVideoCodecHEVC():
+		return VideoCodecHEVC, true
+	case ExtVideoCodecAV1():
+		return VideoCodecAV1, true
+	case ExtVideoCodecVP9():
+		return VideoCodecVP9, true
+	}
+
+	return 0, false
+}
+
+// Packet types of extended video packets.
+const (
+	ExtPacketTypeSequenceStart        uint8 = 0
+	ExtPacketTypeCodedFrames          uint8 = 1
+	ExtPacketTypeSequenceEnd          uint8 = 2
+	ExtPacketTypeCodedFramesX         uint8 = 3
+	ExtPacketTypeMetadata             uint8 = 4
+	ExtPacketTypeMPEG2TSSequenceStart uint8 = 5
+)
+
 func ValidateVideoCodec(videoCodec uint8) bool {
 	return videoCodec <= 7 && videoCodec != 1
 }
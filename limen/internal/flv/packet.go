@@ -11,6 +11,10 @@ const (
 	ScriptDataPacket  PacketType = 2
 	AudioConfigPacket PacketType = 3
 	VideoConfigPacket PacketType = 4
+	// VideoSequenceEndPacket and VideoMetadataPacket come only from
+	// extended video packets
+	VideoSequenceEndPacket PacketType = 5
+	VideoMetadataPacket    PacketType = 6
 )
 
 const (
@@ -31,6 +35,9 @@ type Packet struct {
 type VideoCodecParams struct {
 	KeyFrame        bool
 	CompositionTime int
+	// Descriptor tells that the data of a config packet is the MPEG-2 TS
+	// descriptor of the codec rather than its decoder configuration record
+	Descriptor bool
 }
 
 type AudioCodecParams struct {
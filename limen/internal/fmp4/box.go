@@ -0,0 +1,70 @@
+package fmp4
+
+import "encoding/binary"
+
+// box builds an ISO-BMFF box out of its payload parts.
+func box(boxType string, parts ...[]byte) []byte {
+	size := 8
+	for _, part := range parts {
+		size += len(part)
+	}
+
+	out := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(out, uint32(size))
+	copy(out[4:], boxType)
+
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+
+	return out
+}
+
+// fullBox builds a box prefixed with a version and flags.
+func fullBox(boxType string, version uint8, flags uint32, parts ...[]byte) []byte {
+	header := []byte{version, byte(flags >> 16), byte(flags >> 8), byte(flags)}
+
+	return box(boxType, append([][]byte{header}, parts...)...)
+}
+
+// writer appends big endian fields of a box payload.
+type writer struct {
+	data []byte
+}
+
+func (w *writer) u8(value uint8) *writer {
+	w.data = append(w.data, value)
+	return w
+}
+
+func (w *writer) u16(value uint16) *writer {
+	w.data = binary.BigEndian.AppendUint16(w.data, value)
+	return w
+}
+
+func (w *writer) u32(value uint32) *writer {
+	w.data = binary.BigEndian.AppendUint32(w.data, value)
+	return w
+}
+
+func (w *writer) u64(value uint64) *writer {
+	w.data = binary.BigEndian.AppendUint64(w.data, value)
+	return w
+}
+
+func (w *writer) zeros(count int) *writer {
+	w.data = append(w.data, make([]byte, count)...)
+	return w
+}
+
+func (w *writer) bytes(value []byte) *writer {
+	w.data = append(w.data, value...)
+	return w
+}
+
+// matrix writes the identity transformation matrix.
+func (w *writer) matrix() *writer {
+	return w.u32(0x00010000).u32(0).u32(0).
+		u32(0).u32(0x00010000).u32(0).
+		u32(0).u32(0).u32(0x40000000)
+}
@@ -0,0 +1,110 @@
+package fmp4
+
+const (
+	tfhdDefaultBaseIsMoof = 0x020000
+
+	trunDataOffset       = 0x000001
+	trunSampleDuration   = 0x000100
+	trunSampleSize       = 0x000200
+	trunSampleFlags      = 0x000400
+	trunCompositionShift = 0x000800
+
+	// depends on other samples and is not a sync sample
+	sampleFlagsNonSync = 0x01010000
+	// does not depend on other samples
+	sampleFlagsSync = 0x02000000
+)
+
+// buildFragment builds the moof with a traf per track followed by
+// the mdat holding the samples of all the tracks one after another.
+func buildFragment(sequence uint32, tracks []*track, endDts int) []byte {
+	mfhd := fullBox("mfhd", 0, 0, (&writer{}).u32(sequence).data)
+
+	// the data offsets depend on the size of the moof itself, which
+	// does not depend on their values so it can be measured first
+	offsets := make([]uint32, len(tracks))
+	moof := box("moof", append([][]byte{mfhd}, trafs(tracks, endDts, offsets)...)...)
+
+	offset := uint32(len(moof)) + 8
+	for i, track := range tracks {
+		offsets[i] = offset
+		for _, sample := range track.samples {
+			offset += uint32(len(sample.data))
+		}
+	}
+	moof = box("moof", append([][]byte{mfhd}, trafs(tracks, endDts, offsets)...)...)
+
+	var mdat [][]byte
+	for _, track := range tracks {
+		for _, sample := range track.samples {
+			mdat = append(mdat, sample.data)
+		}
+	}
+
+	return append(moof, box("mdat", mdat...)...)
+}
+
+func trafs(tracks []*track, endDts int, offsets []uint32) [][]byte {
+	out := make([][]byte, 0, len(tracks))
+
+	for i, track := range tracks {
+		tfhd := fullBox("tfhd", 0, tfhdDefaultBaseIsMoof, (&writer{}).u32(track.id).data)
+		tfdt := fullBox("tfdt", 1, 0, (&writer{}).u64(track.samples[0].dts).data)
+
+		flags := uint32(trunDataOffset | trunSampleDuration | trunSampleSize | trunSampleFlags)
+		if track.handler == handlerVideo {
+			flags |= trunCompositionShift
+		}
+
+		entries := (&writer{}).
+			u32(uint32(len(track.samples))).
+			u32(offsets[i])
+
+		durations := track.durations(endDts)
+		for j, sample := range track.samples {
+			entries.u32(durations[j]).u32(uint32(len(sample.data)))
+
+			if sample.keyFrame {
+				entries.u32(sampleFlagsSync)
+			} else {
+				entries.u32(sampleFlagsNonSync)
+			}
+
+			if flags&trunCompositionShift != 0 {
+				entries.u32(uint32(sample.compositionShift))
+			}
+		}
+
+		// version 1 allows for negative composition offsets
+		trun := fullBox("trun", 1, flags, entries.data)
+
+		out = append(out, box("traf", tfhd, tfdt, trun))
+	}
+
+	return out
+}
+
+// durations of the samples follow from the decode time of the next sample,
+// the last audio frame has the fixed frame duration while the last video
+// sample lasts until the end of the fragment or as long as the one before.
+func (t *track) durations(endDts int) []uint32 {
+	durations := make([]uint32, len(t.samples))
+
+	for i := 0; i+1 < len(t.samples); i++ {
+		if next, current := t.samples[i+1].dts, t.samples[i].dts; next > current {
+			durations[i] = uint32(next - current)
+		}
+	}
+
+	last := len(t.samples) - 1
+	switch {
+	case t.frameDuration > 0:
+		durations[last] = t.frameDuration
+	case t.toTimescale(endDts) > t.samples[last].dts:
+		durations[last] = uint32(t.toTimescale(endDts) - t.samples[last].dts)
+	case last > 0:
+		durations[last] = durations[last-1]
+	}
+
+	return durations
+}
@@ -0,0 +1,178 @@
+package fmp4
+
+const movieTimescale = 1000
+
+// initSegment builds the ftyp and moov boxes describing the tracks,
+// the movie has no samples of its own as they all come in fragments.
+func initSegment(tracks []*track) []byte {
+	ftyp := box("ftyp", (&writer{}).
+		bytes([]byte("iso6")).
+		u32(1).
+		bytes([]byte("iso6cmfcdashmp41")).data)
+
+	mvhd := fullBox("mvhd", 0, 0, (&writer{}).
+		// creation and modification time
+		u32(0).u32(0).
+		u32(movieTimescale).
+		// unknown duration
+		u32(0).
+		// rate and volume
+		u32(0x00010000).u16(0x0100).
+		zeros(10).
+		matrix().
+		zeros(24).
+		u32(tracks[len(tracks)-1].id+1).data)
+
+	parts := [][]byte{mvhd}
+	var trex [][]byte
+
+	for _, track := range tracks {
+		parts = append(parts, trak(track))
+
+		trex = append(trex, fullBox("trex", 0, 0, (&writer{}).
+			u32(track.id).
+			// default sample description index, duration, size and flags
+			u32(1).u32(0).u32(0).u32(0).data))
+	}
+
+	parts = append(parts, box("mvex", trex...))
+
+	return append(ftyp, box("moov", parts...)...)
+}
+
+func trak(track *track) []byte {
+	volume := uint16(0)
+	if track.handler == handlerAudio {
+		volume = 0x0100
+	}
+
+	tkhd := fullBox("tkhd", 0, 0x000003, (&writer{}).
+		// creation and modification time
+		u32(0).u32(0).
+		u32(track.id).
+		u32(0).
+		// unknown duration
+		u32(0).
+		zeros(8).
+		// layer and alternate group
+		u16(0).u16(0).
+		u16(volume).u16(0).
+		matrix().
+		u32(uint32(track.width)<<16).
+		u32(uint32(track.height)<<16).data)
+
+	mdhd := fullBox("mdhd", 0, 0, (&writer{}).
+		// creation and modification time
+		u32(0).u32(0).
+		u32(track.timescale).
+		// unknown duration
+		u32(0).
+		// packed "und" language
+		u16(0x55c4).u16(0).data)
+
+	name := "VideoHandler"
+	if track.handler == handlerAudio {
+		name = "SoundHandler"
+	}
+
+	hdlr := fullBox("hdlr", 0, 0, (&writer{}).
+		u32(0).
+		bytes([]byte(track.handler)).
+		zeros(12).
+		bytes(append([]byte(name), 0)).data)
+
+	var mediaHeader []byte
+	if track.handler == handlerAudio {
+		// balance
+		mediaHeader = fullBox("smhd", 0, 0, (&writer{}).u16(0).u16(0).data)
+	} else {
+		// graphics mode and opcolor
+		mediaHeader = fullBox("vmhd", 0, 1, (&writer{}).zeros(8).data)
+	}
+
+	dinf := box("dinf", fullBox("dref", 0, 0, (&writer{}).u32(1).data,
+		// the media is in the same file
+		fullBox("url ", 0, 1)))
+
+	stbl := box("stbl",
+		fullBox("stsd", 0, 0, (&writer{}).u32(1).data, track.sampleEntry),
+		fullBox("stts", 0, 0, (&writer{}).u32(0).data),
+		fullBox("stsc", 0, 0, (&writer{}).u32(0).data),
+		fullBox("stsz", 0, 0, (&writer{}).u32(0).u32(0).data),
+		fullBox("stco", 0, 0, (&writer{}).u32(0).data),
+	)
+
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", mediaHeader, dinf, stbl)))
+}
+
+func avc1SampleEntry(config []byte, width, height uint16) []byte {
+	return box("avc1", (&writer{}).
+		zeros(6).
+		// data reference index
+		u16(1).
+		zeros(16).
+		u16(width).u16(height).
+		// 72 dpi resolution
+		u32(0x00480000).u32(0x00480000).
+		u32(0).
+		// frame count
+		u16(1).
+		// compressor name
+		zeros(32).
+		// depth and pre defined
+		u16(0x0018).u16(0xffff).data,
+		box("avcC", config))
+}
+
+func mp4aSampleEntry(config []byte, channels uint16, sampleRate uint32) []byte {
+	// DecoderSpecificInfo carrying the AudioSpecificConfig
+	specificInfo := descriptor(0x05, config)
+
+	decoderConfig := descriptor(0x04, (&writer{}).
+		// MPEG-4 audio
+		u8(0x40).
+		// audio stream
+		u8(0x15).
+		// buffer size, max and average bitrate
+		u8(0).u16(0).u32(0).u32(0).
+		bytes(specificInfo).data)
+
+	esDescriptor := descriptor(0x03, (&writer{}).
+		// ES id and flags
+		u16(0).u8(0).
+		bytes(decoderConfig).
+		// SLConfigDescriptor with the predefined MP4 setup
+		bytes(descriptor(0x06, []byte{0x02})).data)
+
+	rate := sampleRate << 16
+	if sampleRate > 0xffff {
+		rate = 0
+	}
+
+	return box("mp4a", (&writer{}).
+		zeros(6).
+		// data reference index
+		u16(1).
+		zeros(8).
+		u16(channels).
+		// sample size
+		u16(16).
+		zeros(4).
+		u32(rate).data,
+		fullBox("esds", 0, 0, esDescriptor))
+}
+
+// descriptor encodes an MPEG-4 descriptor with its size in the expandable form.
+func descriptor(tag byte, payload []byte) []byte {
+	size := len(payload)
+
+	out := []byte{tag}
+	for shift := 21; shift > 0; shift -= 7 {
+		if size >= 1<<shift {
+			out = append(out, byte(size>>shift)&0x7f|0x80)
+		}
+	}
+	out = append(out, byte(size&0x7f))
+
+	return append(out, payload...)
+}
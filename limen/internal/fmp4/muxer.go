@@ -0,0 +1,220 @@
+package fmp4
+
+import (
+	"errors"
+
+	"limen/internal/aac"
+	"limen/internal/flv"
+	"limen/internal/h264"
+)
+
+const (
+	videoTrackId = 1
+	audioTrackId = 2
+
+	videoTimescale = 90000
+
+	handlerVideo = "vide"
+	handlerAudio = "soun"
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("fmp4: unsupported codec, only H.264 and AAC can be muxed")
+	ErrMissingConfig    = errors.New("fmp4: frame written before the codec configuration")
+	ErrInvalidAVCConfig = errors.New("fmp4: invalid AVC decoder configuration record")
+	ErrInvalidAACConfig = errors.New("fmp4: invalid AAC audio specific config")
+)
+
+type track struct {
+	id        uint32
+	handler   string
+	timescale uint32
+	width     uint16
+	height    uint16
+	// stsd entry holding the codec configuration
+	sampleEntry []byte
+	// duration of a single audio frame, the duration of the
+	// last video sample is known only once the fragment ends
+	frameDuration uint32
+	samples       []*sample
+}
+
+type sample struct {
+	// decode time in the timescale of the track
+	dts              uint64
+	compositionShift int32
+	keyFrame         bool
+	data             []byte
+}
+
+// Muxer turns FLV packets into a fragmented MP4, the init segment describes
+// the tracks whose configuration packets were written and every fragment
+// carries the samples buffered since the previous one.
+//
+// Using one muxer per track gives the separate audio and video renditions
+// that DASH expects, while a single muxer produces multiplexed fragments.
+type Muxer struct {
+	video    *track
+	audio    *track
+	sequence uint32
+}
+
+func NewMuxer() *Muxer {
+	return &Muxer{}
+}
+
+func (m *Muxer) HasVideo() bool {
+	return m.video != nil
+}
+
+func (m *Muxer) HasAudio() bool {
+	return m.audio != nil
+}
+
+// WritePacket buffers a frame for the next fragment, configuration
+// packets set up the track of the stream and change the init segment.
+func (m *Muxer) WritePacket(packet *flv.Packet) error {
+	switch packet.Type {
+	case flv.VideoConfigPacket, flv.VideoPacket:
+		if packet.Codec != flv.VideoCodecH264 {
+			return ErrUnsupportedCodec
+		}
+	case flv.AudioConfigPacket, flv.AudioPacket:
+		if packet.Codec != flv.SoundTypeAAC {
+			return ErrUnsupportedCodec
+		}
+	default:
+		return ErrUnsupportedCodec
+	}
+
+	switch packet.Type {
+	case flv.VideoConfigPacket:
+		config, err := h264.ParseDecoderConfigurationRecord(packet.Data)
+		if err != nil || len(config.SPS) == 0 {
+			return ErrInvalidAVCConfig
+		}
+
+		// the dimensions are informative, decoders take them from the SPS
+		var width, height uint16
+		if sps, err := h264.ParseSPS(config.SPS[0]); err == nil {
+			width, height = uint16(sps.Width), uint16(sps.Height)
+		}
+
+		m.video = &track{
+			id:          videoTrackId,
+			handler:     handlerVideo,
+			timescale:   videoTimescale,
+			width:       width,
+			height:      height,
+			sampleEntry: avc1SampleEntry(packet.Data, width, height),
+		}
+
+	case flv.AudioConfigPacket:
+		format, err := aac.ParseAudioSpecificConfig(packet.Data)
+		if err != nil || format.SampleRate == 0 || format.SamplesPerFrame == 0 {
+			return ErrInvalidAACConfig
+		}
+
+		// object types other than AAC don't tell their channels
+		channels := uint16(format.Channels)
+		if channels == 0 {
+			channels = 2
+		}
+
+		m.audio = &track{
+			id:            audioTrackId,
+			handler:       handlerAudio,
+			timescale:     format.SampleRate,
+			sampleEntry:   mp4aSampleEntry(packet.Data, channels, format.SampleRate),
+			frameDuration: format.SamplesPerFrame,
+		}
+
+	case flv.VideoPacket:
+		if m.video == nil {
+			return ErrMissingConfig
+		}
+
+		params, _ := packet.CodecParams.(*flv.VideoCodecParams)
+		current := &sample{dts: m.video.toTimescale(packet.Dts), data: packet.Data}
+		if params != nil {
+			current.keyFrame = params.KeyFrame
+			current.compositionShift = m.video.offsetToTimescale(params.CompositionTime)
+		}
+
+		m.video.samples = append(m.video.samples, current)
+
+	case flv.AudioPacket:
+		if m.audio == nil {
+			return ErrMissingConfig
+		}
+
+		m.audio.samples = append(m.audio.samples, &sample{dts: m.audio.toTimescale(packet.Dts), keyFrame: true, data: packet.Data})
+	}
+
+	return nil
+}
+
+// InitSegment returns the ftyp and moov boxes for the configured tracks.
+func (m *Muxer) InitSegment() ([]byte, error) {
+	tracks := m.tracks()
+	if len(tracks) == 0 {
+		return nil, ErrMissingConfig
+	}
+
+	return initSegment(tracks), nil
+}
+
+// Fragment returns a moof and mdat pair with the buffered samples or nil
+// if there are none. The fragment ends at the given decode time in
+// milliseconds, usually the one of the keyframe starting the next fragment,
+// which determines the duration of the last video sample.
+func (m *Muxer) Fragment(endDts int) []byte {
+	var tracks []*track
+	for _, track := range m.tracks() {
+		if len(track.samples) > 0 {
+			tracks = append(tracks, track)
+		}
+	}
+
+	if len(tracks) == 0 {
+		return nil
+	}
+
+	m.sequence++
+	fragment := buildFragment(m.sequence, tracks, endDts)
+
+	for _, track := range tracks {
+		track.samples = nil
+	}
+
+	return fragment
+}
+
+func (m *Muxer) tracks() []*track {
+	var tracks []*track
+
+	if m.video != nil {
+		tracks = append(tracks, m.video)
+	}
+
+	if m.audio != nil {
+		tracks = append(tracks, m.audio)
+	}
+
+	return tracks
+}
+
+// toTimescale converts milliseconds into the timescale of the track.
+func (t *track) toTimescale(milliseconds int) uint64 {
+	if milliseconds < 0 {
+		return 0
+	}
+
+	return uint64(milliseconds) * uint64(t.timescale) / 1000
+}
+
+// offsetToTimescale converts a signed offset in milliseconds, such as
+// a composition time, into the timescale of the track.
+func (t *track) offsetToTimescale(milliseconds int) int32 {
+	return int32(int64(milliseconds) * int64(t.timescale) / 1000)
+}
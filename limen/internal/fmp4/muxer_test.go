@@ -0,0 +1,285 @@
+package fmp4
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/flv"
+)
+
+var (
+	avcConfigRecord = []byte{
+		0x01, 0x42, 0xc0, 0x1e, 0xff,
+		// Baseline 3.0, 1280x720
+		0xe1, 0x00, 0x18, 0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0x50, 0x05, 0xba, 0x10, 0x00, 0x00,
+		0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x62, 0xe4, 0x80,
+		0x01, 0x00, 0x04, 0x68, 0xce, 0x3c, 0x80,
+	}
+	// AAC LC, 44100Hz, stereo
+	audioSpecificConfig = []byte{0x12, 0x10}
+)
+
+type parsedBox struct {
+	boxType  string
+	payload  []byte
+	children []*parsedBox
+}
+
+var containers = map[string]bool{"moov": true, "trak": true, "mdia": true, "minf": true, "dinf": true, "stbl": true, "mvex": true, "moof": true, "traf": true}
+
+func parseBoxes(t *testing.T, data []byte) []*parsedBox {
+	var boxes []*parsedBox
+
+	for len(data) > 0 {
+		if !assert.GreaterOrEqual(t, len(data), 8) {
+			return nil
+		}
+
+		size := int(binary.BigEndian.Uint32(data))
+		if !assert.GreaterOrEqual(t, len(data), size) {
+			return nil
+		}
+
+		parsed := &parsedBox{boxType: string(data[4:8]), payload: data[8:size]}
+		if containers[parsed.boxType] {
+			parsed.children = parseBoxes(t, parsed.payload)
+		}
+
+		boxes = append(boxes, parsed)
+		data = data[size:]
+	}
+
+	return boxes
+}
+
+// find returns the first box under the path of box types.
+func find(boxes []*parsedBox, path ...string) *parsedBox {
+	for _, candidate := range boxes {
+		if candidate.boxType != path[0] {
+			continue
+		}
+
+		if len(path) == 1 {
+			return candidate
+		}
+
+		if found := find(candidate.children, path[1:]...); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func types(boxes []*parsedBox) []string {
+	var out []string
+	for _, parsed := range boxes {
+		out = append(out, parsed.boxType)
+	}
+
+	return out
+}
+
+func configuredMuxer(t *testing.T) *Muxer {
+	muxer := NewMuxer()
+	assert.Nil(t, muxer.WritePacket(&flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecH264, Data: avcConfigRecord}))
+	assert.Nil(t, muxer.WritePacket(&flv.Packet{Type: flv.AudioConfigPacket, Codec: flv.SoundTypeAAC, Data: audioSpecificConfig}))
+
+	return muxer
+}
+
+func videoPacket(dts int, compositionTime int, keyFrame bool, data []byte) *flv.Packet {
+	return &flv.Packet{
+		Type:        flv.VideoPacket,
+		Codec:       flv.VideoCodecH264,
+		Data:        data,
+		Dts:         dts,
+		Pts:         dts + compositionTime,
+		CodecParams: &flv.VideoCodecParams{KeyFrame: keyFrame, CompositionTime: compositionTime},
+	}
+}
+
+func audioPacket(dts int, data []byte) *flv.Packet {
+	return &flv.Packet{Type: flv.AudioPacket, Codec: flv.SoundTypeAAC, Data: data, Dts: dts, Pts: dts}
+}
+
+func TestInitSegment(t *testing.T) {
+	_, err := NewMuxer().InitSegment()
+	assert.Equal(t, ErrMissingConfig, err)
+
+	init, err := configuredMuxer(t).InitSegment()
+	assert.Nil(t, err)
+
+	boxes := parseBoxes(t, init)
+	assert.Equal(t, []string{"ftyp", "moov"}, types(boxes))
+	assert.Equal(t, []byte("iso6\x00\x00\x00\x01iso6cmfcdashmp41"), boxes[0].payload)
+
+	moov := boxes[1]
+	assert.Equal(t, []string{"mvhd", "trak", "trak", "mvex"}, types(moov.children))
+	assert.Equal(t, []string{"trex", "trex"}, types(find(boxes, "moov", "mvex").children))
+
+	video, audio := moov.children[1], moov.children[2]
+	assert.Equal(t, []string{"tkhd", "mdia"}, types(video.children))
+	assert.Equal(t, []string{"mdhd", "hdlr", "minf"}, types(find(video.children, "mdia").children))
+	assert.Equal(t, []string{"vmhd", "dinf", "stbl"}, types(find(video.children, "mdia", "minf").children))
+	assert.Equal(t, []string{"smhd", "dinf", "stbl"}, types(find(audio.children, "mdia", "minf").children))
+	assert.Equal(t, []string{"stsd", "stts", "stsc", "stsz", "stco"}, types(find(video.children, "mdia", "minf", "stbl").children))
+
+	// track ids
+	assert.Equal(t, uint32(videoTrackId), binary.BigEndian.Uint32(find(video.children, "tkhd").payload[12:16]))
+	assert.Equal(t, uint32(audioTrackId), binary.BigEndian.Uint32(find(audio.children, "tkhd").payload[12:16]))
+
+	// dimensions from the SPS
+	assert.Equal(t, []byte{0x05, 0x00, 0x00, 0x00, 0x02, 0xd0, 0x00, 0x00}, find(video.children, "tkhd").payload[76:84])
+
+	// timescales
+	assert.Equal(t, uint32(90000), binary.BigEndian.Uint32(find(video.children, "mdia", "mdhd").payload[12:16]))
+	assert.Equal(t, uint32(44100), binary.BigEndian.Uint32(find(audio.children, "mdia", "mdhd").payload[12:16]))
+
+	assert.Equal(t, "vide", string(find(video.children, "mdia", "hdlr").payload[8:12]))
+	assert.Equal(t, "soun", string(find(audio.children, "mdia", "hdlr").payload[8:12]))
+
+	// sample entries end with the codec configuration
+	videoEntry := find(video.children, "mdia", "minf", "stbl", "stsd").payload[8:]
+	assert.Equal(t, "avc1", string(videoEntry[4:8]))
+	assert.Equal(t, []byte{0x05, 0x00, 0x02, 0xd0}, videoEntry[8+24:8+28])
+	avcC := parseBoxes(t, videoEntry[8+78:])
+	assert.Equal(t, []string{"avcC"}, types(avcC))
+	assert.Equal(t, avcConfigRecord, avcC[0].payload)
+
+	audioEntry := find(audio.children, "mdia", "minf", "stbl", "stsd").payload[8:]
+	assert.Equal(t, "mp4a", string(audioEntry[4:8]))
+	// channels, sample size and rate
+	assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x10}, audioEntry[8+16:8+20])
+	assert.Equal(t, uint32(44100<<16), binary.BigEndian.Uint32(audioEntry[8+24:8+28]))
+
+	esds := parseBoxes(t, audioEntry[8+28:])
+	assert.Equal(t, []string{"esds"}, types(esds))
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x00,
+		// ES descriptor
+		0x03, 0x19, 0x00, 0x00, 0x00,
+		// decoder config descriptor for MPEG-4 audio
+		0x04, 0x11, 0x40, 0x15, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// decoder specific info
+		0x05, 0x02, 0x12, 0x10,
+		// SL config descriptor
+		0x06, 0x01, 0x02,
+	}, esds[0].payload)
+}
+
+func TestFragment(t *testing.T) {
+	muxer := configuredMuxer(t)
+
+	assert.Nil(t, muxer.Fragment(0))
+
+	assert.Nil(t, muxer.WritePacket(videoPacket(1000, 80, true, []byte{0x00, 0x00, 0x00, 0x01, 0x65})))
+	assert.Nil(t, muxer.WritePacket(audioPacket(1000, []byte{0x21, 0x01})))
+	assert.Nil(t, muxer.WritePacket(videoPacket(1040, 0, false, []byte{0x00, 0x00, 0x00, 0x01, 0x41})))
+	assert.Nil(t, muxer.WritePacket(audioPacket(1023, []byte{0x21, 0x02, 0x03})))
+
+	fragment := muxer.Fragment(1100)
+	boxes := parseBoxes(t, fragment)
+	assert.Equal(t, []string{"moof", "mdat"}, types(boxes))
+	assert.Equal(t, []string{"mfhd", "traf", "traf"}, types(boxes[0].children))
+
+	// sequence number
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, find(boxes, "moof", "mfhd").payload)
+
+	video, audio := boxes[0].children[1], boxes[0].children[2]
+	assert.Equal(t, []string{"tfhd", "tfdt", "trun"}, types(video.children))
+
+	assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01}, find(video.children, "tfhd").payload)
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x5f, 0x90}, find(video.children, "tfdt").payload)
+
+	moofSize := uint32(len(boxes[0].payload) + 8)
+
+	videoRun := (&writer{}).
+		u8(1).u8(0x00).u8(0x0f).u8(0x01).
+		u32(2).
+		u32(moofSize + 8).
+		// 40ms with 80ms of composition offset for the keyframe
+		u32(3600).u32(5).u32(sampleFlagsSync).u32(7200).
+		// lasting until the end of the fragment
+		u32(5400).u32(5).u32(sampleFlagsNonSync).u32(0).data
+	assert.Equal(t, videoRun, find(video.children, "trun").payload)
+
+	// 1000ms at 44100Hz
+	assert.Equal(t, []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xac, 0x44}, find(audio.children, "tfdt").payload)
+
+	audioRun := (&writer{}).
+		u8(1).u8(0x00).u8(0x07).u8(0x01).
+		u32(2).
+		u32(moofSize + 8 + 10).
+		u32(1014).u32(2).u32(sampleFlagsSync).
+		// a full frame
+		u32(1024).u32(3).u32(sampleFlagsSync).data
+	assert.Equal(t, audioRun, find(audio.children, "trun").payload)
+
+	assert.Equal(t, []byte{
+		0x00, 0x00, 0x00, 0x01, 0x65,
+		0x00, 0x00, 0x00, 0x01, 0x41,
+		0x21, 0x01,
+		0x21, 0x02, 0x03,
+	}, boxes[1].payload)
+
+	// buffered samples are gone
+	assert.Nil(t, muxer.Fragment(2000))
+
+	assert.Nil(t, muxer.WritePacket(audioPacket(1046, []byte{0x21})))
+	boxes = parseBoxes(t, muxer.Fragment(2000))
+
+	// tracks without samples are left out
+	assert.Equal(t, []string{"mfhd", "traf"}, types(boxes[0].children))
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}, find(boxes, "moof", "mfhd").payload)
+	assert.Equal(t, []byte{0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02}, find(boxes, "moof", "traf", "tfhd").payload)
+}
+
+func TestNegativeCompositionTime(t *testing.T) {
+	muxer := configuredMuxer(t)
+
+	// B-frames of enhanced RTMP and legacy FLV can be presented before they are decoded
+	assert.Nil(t, muxer.WritePacket(videoPacket(1000, 0, true, []byte{0x65})))
+	assert.Nil(t, muxer.WritePacket(videoPacket(1040, -40, false, []byte{0x41})))
+
+	boxes := parseBoxes(t, muxer.Fragment(1080))
+	trun := find(boxes, "moof", "traf", "trun").payload
+
+	// the composition offset of the second sample, -40ms at 90kHz
+	assert.Equal(t, int32(-3600), int32(binary.BigEndian.Uint32(trun[len(trun)-4:])))
+}
+
+func TestSingleTrackMuxer(t *testing.T) {
+	muxer := NewMuxer()
+	assert.Nil(t, muxer.WritePacket(&flv.Packet{Type: flv.AudioConfigPacket, Codec: flv.SoundTypeAAC, Data: audioSpecificConfig}))
+	assert.False(t, muxer.HasVideo())
+	assert.True(t, muxer.HasAudio())
+
+	init, err := muxer.InitSegment()
+	assert.Nil(t, err)
+
+	boxes := parseBoxes(t, init)
+	assert.Equal(t, []string{"mvhd", "trak", "mvex"}, types(boxes[1].children))
+	assert.Equal(t, uint32(audioTrackId), binary.BigEndian.Uint32(find(boxes, "moov", "mvex", "trex").payload[4:8]))
+}
+
+func TestMuxerErrors(t *testing.T) {
+	muxer := NewMuxer()
+
+	assert.Equal(t, ErrMissingConfig, muxer.WritePacket(videoPacket(0, 0, true, []byte{0x65})))
+	assert.Equal(t, ErrMissingConfig, muxer.WritePacket(audioPacket(0, []byte{0x21})))
+
+	assert.Equal(t, ErrUnsupportedCodec, muxer.WritePacket(&flv.Packet{Type: flv.AudioPacket, Codec: flv.SoundFormatMP3}))
+	assert.Equal(t, ErrUnsupportedCodec, muxer.WritePacket(&flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecVP6}))
+
+	assert.Equal(t, ErrInvalidAVCConfig, muxer.WritePacket(&flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecH264, Data: []byte{0x00}}))
+	assert.Equal(t, ErrInvalidAACConfig, muxer.WritePacket(&flv.Packet{Type: flv.AudioConfigPacket, Codec: flv.SoundTypeAAC, Data: []byte{0x12}}))
+}
+
+func TestDescriptorSize(t *testing.T) {
+	assert.Equal(t, []byte{0x05, 0x7f}, descriptor(0x05, make([]byte, 127))[:2])
+	assert.Equal(t, []byte{0x05, 0x81, 0x00}, descriptor(0x05, make([]byte, 128))[:3])
+	assert.Equal(t, []byte{0x05, 0x81, 0x80, 0x00}, descriptor(0x05, make([]byte, 16384))[:4])
+}
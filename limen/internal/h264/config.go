@@ -0,0 +1,153 @@
+package h264
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// DecoderConfigurationRecord is the AVCDecoderConfigurationRecord carried by
+// FLV sequence headers and the avcC box of MP4.
+type DecoderConfigurationRecord struct {
+	Profile       uint8
+	Compatibility uint8
+	Level         uint8
+	// LengthSize is the size of the NAL unit length prefixes
+	LengthSize int
+	SPS        [][]byte
+	PPS        [][]byte
+
+	// HasExtension tells whether the record carries the chroma format and
+	// bit depths of the high profiles, encoders commonly leave it out
+	HasExtension   bool
+	ChromaFormat   uint8
+	BitDepthLuma   uint8
+	BitDepthChroma uint8
+	SPSExt         [][]byte
+}
+
+// all profiles but Baseline, Main and Extended may carry the extension of the record
+func hasRecordExtension(profile uint8) bool {
+	return profile != 66 && profile != 77 && profile != 88
+}
+
+func ParseDecoderConfigurationRecord(data []byte) (*DecoderConfigurationRecord, error) {
+	if len(data) < 6 || data[0] != 1 {
+		return nil, ErrInvalidConfig
+	}
+
+	record := &DecoderConfigurationRecord{
+		Profile:       data[1],
+		Compatibility: data[2],
+		Level:         data[3],
+		LengthSize:    int(data[4]&0x03) + 1,
+	}
+
+	if record.LengthSize == 3 {
+		return nil, ErrInvalidConfig
+	}
+
+	sets, rest, err := readParameterSets(data[6:], int(data[5]&0x1f))
+	if err != nil {
+		return nil, err
+	}
+	record.SPS = sets
+
+	if len(rest) < 1 {
+		return nil, ErrInvalidConfig
+	}
+
+	sets, rest, err = readParameterSets(rest[1:], int(rest[0]))
+	if err != nil {
+		return nil, err
+	}
+	record.PPS = sets
+
+	if !hasRecordExtension(record.Profile) || len(rest) < 4 {
+		return record, nil
+	}
+
+	record.HasExtension = true
+	record.ChromaFormat = rest[0] & 0x03
+	record.BitDepthLuma = rest[1]&0x07 + 8
+	record.BitDepthChroma = rest[2]&0x07 + 8
+
+	record.SPSExt, _, err = readParameterSets(rest[4:], int(rest[3]))
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func readParameterSets(data []byte, count int) ([][]byte, []byte, error) {
+	sets := make([][]byte, 0, count)
+
+	for i := 0; i < count; i++ {
+		if len(data) < 2 {
+			return nil, nil, ErrInvalidConfig
+		}
+
+		length := int(binary.BigEndian.Uint16(data))
+		if length == 0 || len(data) < 2+length {
+			return nil, nil, ErrInvalidConfig
+		}
+
+		sets = append(sets, data[2:2+length])
+		data = data[2+length:]
+	}
+
+	return sets, data, nil
+}
+
+// Marshal serializes the record, the extension is written only if present.
+func (r *DecoderConfigurationRecord) Marshal() ([]byte, error) {
+	if len(r.SPS) > 0x1f || len(r.PPS) > 0xff || len(r.SPSExt) > 0xff {
+		return nil, ErrInvalidConfig
+	}
+
+	if r.LengthSize != 1 && r.LengthSize != 2 && r.LengthSize != 4 {
+		return nil, ErrInvalidLengthSize
+	}
+
+	out := []byte{1, r.Profile, r.Compatibility, r.Level, 0xfc | byte(r.LengthSize-1), 0xe0 | byte(len(r.SPS))}
+
+	out, err := writeParameterSets(out, r.SPS)
+	if err != nil {
+		return nil, err
+	}
+
+	out = append(out, byte(len(r.PPS)))
+	if out, err = writeParameterSets(out, r.PPS); err != nil {
+		return nil, err
+	}
+
+	if !r.HasExtension {
+		return out, nil
+	}
+
+	out = append(out,
+		0xfc|r.ChromaFormat&0x03,
+		0xf8|(r.BitDepthLuma-8)&0x07,
+		0xf8|(r.BitDepthChroma-8)&0x07,
+		byte(len(r.SPSExt)))
+
+	return writeParameterSets(out, r.SPSExt)
+}
+
+func writeParameterSets(out []byte, sets [][]byte) ([]byte, error) {
+	for _, set := range sets {
+		if len(set) == 0 || len(set) > 0xffff {
+			return nil, ErrInvalidConfig
+		}
+
+		out = binary.BigEndian.AppendUint16(out, uint16(len(set)))
+		out = append(out, set...)
+	}
+
+	return out, nil
+}
+
+// Codecs returns the RFC 6381 codecs parameter, e.g. "avc1.64001f".
+func (r *DecoderConfigurationRecord) Codecs() string {
+	return fmt.Sprintf("avc1.%02x%02x%02x", r.Profile, r.Compatibility, r.Level)
+}
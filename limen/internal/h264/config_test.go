@@ -0,0 +1,88 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func configRecord(extension ...byte) []byte {
+	record := []byte{0x01, 0x42, 0xc0, 0x1e, 0xff, 0xe1, 0x00, byte(len(spsUnit))}
+	record = append(record, spsUnit...)
+	record = append(record, 0x01, 0x00, byte(len(ppsUnit)))
+	record = append(record, ppsUnit...)
+
+	return append(record, extension...)
+}
+
+func TestParseDecoderConfigurationRecord(t *testing.T) {
+	record, err := ParseDecoderConfigurationRecord(configRecord())
+	assert.Nil(t, err)
+	assert.Equal(t, &DecoderConfigurationRecord{
+		Profile:       0x42,
+		Compatibility: 0xc0,
+		Level:         0x1e,
+		LengthSize:    4,
+		SPS:           [][]byte{spsUnit},
+		PPS:           [][]byte{ppsUnit},
+	}, record)
+	assert.Equal(t, "avc1.42c01e", record.Codecs())
+
+	data, err := record.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, configRecord(), data)
+}
+
+func TestDecoderConfigurationRecordExtension(t *testing.T) {
+	// 4:2:2, 10 bit luma, 8 bit chroma with a single SPS extension
+	extension := []byte{0xfe, 0xfa, 0xf8, 0x01, 0x00, 0x02, 0x6d, 0x80}
+
+	data := configRecord(extension...)
+
+	// High 4:2:2, High 4:4:4 Predictive and CAVLC 4:4:4 Intra
+	for _, profile := range []uint8{122, 244, 44} {
+		data[1] = profile
+
+		record, err := ParseDecoderConfigurationRecord(data)
+		assert.Nil(t, err, profile)
+		assert.True(t, record.HasExtension, profile)
+		assert.Equal(t, uint8(2), record.ChromaFormat, profile)
+		assert.Equal(t, uint8(10), record.BitDepthLuma, profile)
+		assert.Equal(t, uint8(8), record.BitDepthChroma, profile)
+		assert.Equal(t, [][]byte{{0x6d, 0x80}}, record.SPSExt, profile)
+
+		out, err := record.Marshal()
+		assert.Nil(t, err, profile)
+		assert.Equal(t, data, out, profile)
+	}
+
+	// ignored for Baseline, Main and Extended
+	for _, profile := range []uint8{66, 77, 88} {
+		data[1] = profile
+
+		record, err := ParseDecoderConfigurationRecord(data)
+		assert.Nil(t, err, profile)
+		assert.False(t, record.HasExtension, profile)
+	}
+}
+
+func TestParseInvalidDecoderConfigurationRecord(t *testing.T) {
+	valid := configRecord()
+
+	for _, data := range [][]byte{
+		nil,
+		// wrong version
+		append([]byte{0x02}, valid[1:]...),
+		// truncated SPS
+		valid[:12],
+		// missing PPS count
+		valid[:8+len(spsUnit)],
+		// truncated PPS
+		valid[:len(valid)-1],
+		// 3 byte lengths
+		append([]byte{0x01, 0x42, 0xc0, 0x1e, 0xfe}, valid[5:]...),
+	} {
+		_, err := ParseDecoderConfigurationRecord(data)
+		assert.Equal(t, ErrInvalidConfig, err, data)
+	}
+}
@@ -0,0 +1,192 @@
+package h264
+
+import (
+	"bytes"
+	"errors"
+)
+
+type NALUnitType uint8
+
+const (
+	NALUnitTypeSlice NALUnitType = 1
+	NALUnitTypeIDR   NALUnitType = 5
+	NALUnitTypeSEI   NALUnitType = 6
+	NALUnitTypeSPS   NALUnitType = 7
+	NALUnitTypePPS   NALUnitType = 8
+	NALUnitTypeAUD   NALUnitType = 9
+)
+
+var (
+	ErrInvalidNALUnit    = errors.New("h264: invalid NAL unit")
+	ErrInvalidConfig     = errors.New("h264: invalid AVC decoder configuration record")
+	ErrInvalidSPS        = errors.New("h264: invalid sequence parameter set")
+	ErrInvalidPPS        = errors.New("h264: invalid picture parameter set")
+	ErrMissingConfig     = errors.New("h264: frame parsed before the decoder configuration")
+	ErrInvalidLengthSize = errors.New("h264: NAL unit length size must be 1, 2 or 4")
+)
+
+var startCode = []byte{0x00, 0x00, 0x00, 0x01}
+
+// UnitType returns the type of a NAL unit given with its header.
+func UnitType(unit []byte) NALUnitType {
+	if len(unit) == 0 {
+		return 0
+	}
+
+	return NALUnitType(unit[0] & 0x1f)
+}
+
+// SplitAVCC splits length prefixed NAL units, as carried by FLV and MP4,
+// the units reference the given data.
+func SplitAVCC(data []byte, lengthSize int) ([][]byte, error) {
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return nil, ErrInvalidLengthSize
+	}
+
+	var units [][]byte
+
+	for len(data) > 0 {
+		if len(data) < lengthSize {
+			return nil, ErrInvalidNALUnit
+		}
+
+		length := 0
+		for _, b := range data[:lengthSize] {
+			length = length<<8 | int(b)
+		}
+		data = data[lengthSize:]
+
+		if length == 0 || length > len(data) {
+			return nil, ErrInvalidNALUnit
+		}
+
+		units = append(units, data[:length])
+		data = data[length:]
+	}
+
+	return units, nil
+}
+
+// JoinAVCC prefixes every NAL unit with its length.
+func JoinAVCC(units [][]byte, lengthSize int) ([]byte, error) {
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return nil, ErrInvalidLengthSize
+	}
+
+	size := 0
+	for _, unit := range units {
+		if len(unit) == 0 || uint64(len(unit)) >= 1<<(8*lengthSize) {
+			return nil, ErrInvalidNALUnit
+		}
+
+		size += lengthSize + len(unit)
+	}
+
+	out := make([]byte, 0, size)
+	for _, unit := range units {
+		for shift := 8 * (lengthSize - 1); shift >= 0; shift -= 8 {
+			out = append(out, byte(len(unit)>>shift))
+		}
+		out = append(out, unit...)
+	}
+
+	return out, nil
+}
+
+// SplitAnnexB splits a byte stream on three and four byte start codes,
+// the units reference the given data and data before the first start
+// code is ignored.
+func SplitAnnexB(data []byte) [][]byte {
+	var units [][]byte
+
+	start := -1
+	for i := 0; i+3 <= len(data); {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			i++
+			continue
+		}
+
+		if start >= 0 {
+			units = appendUnit(units, data[start:i])
+		}
+
+		i += 3
+		start = i
+	}
+
+	if start >= 0 {
+		units = appendUnit(units, data[start:])
+	}
+
+	return units
+}
+
+// appendUnit drops the trailing zero bytes, which either belong to a
+// four byte start code or are padding between the units.
+func appendUnit(units [][]byte, unit []byte) [][]byte {
+	unit = bytes.TrimRight(unit, "\x00")
+	if len(unit) == 0 {
+		return units
+	}
+
+	return append(units, unit)
+}
+
+// JoinAnnexB prefixes every NAL unit with a four byte start code.
+func JoinAnnexB(units [][]byte) []byte {
+	size := 0
+	for _, unit := range units {
+		size += len(startCode) + len(unit)
+	}
+
+	out := make([]byte, 0, size)
+	for _, unit := range units {
+		out = append(out, startCode...)
+		out = append(out, unit...)
+	}
+
+	return out
+}
+
+// AVCCToAnnexB converts length prefixed NAL units into a byte stream.
+func AVCCToAnnexB(data []byte, lengthSize int) ([]byte, error) {
+	units, err := SplitAVCC(data, lengthSize)
+	if err != nil {
+		return nil, err
+	}
+
+	return JoinAnnexB(units), nil
+}
+
+// AnnexBToAVCC converts a byte stream into length prefixed NAL units.
+func AnnexBToAVCC(data []byte, lengthSize int) ([]byte, error) {
+	return JoinAVCC(SplitAnnexB(data), lengthSize)
+}
+
+// unescape removes the emulation prevention bytes of a NAL unit payload.
+func Unescape(data []byte) []byte {
+	// most units carry none, avoid copying them
+	if !bytes.Contains(data, []byte{0x00, 0x00, 0x03}) {
+		return data
+	}
+
+	out := make([]byte, 0, len(data))
+	zeros := 0
+
+	for _, b := range data {
+		if zeros >= 2 && b == 0x03 {
+			zeros = 0
+			continue
+		}
+
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+
+		out = append(out, b)
+	}
+
+	return out
+}
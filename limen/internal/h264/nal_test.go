@@ -0,0 +1,80 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	spsUnit = []byte{0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0x50, 0x05, 0xba, 0x10, 0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x62, 0xe4, 0x80}
+	ppsUnit = []byte{0x68, 0xce, 0x3c, 0x80}
+	idrUnit = []byte{0x65, 0x88, 0x84, 0x00, 0x33}
+)
+
+func TestAVCCConversion(t *testing.T) {
+	avcc := []byte{
+		0x00, 0x00, 0x00, 0x04, 0x68, 0xce, 0x3c, 0x80,
+		0x00, 0x00, 0x00, 0x05, 0x65, 0x88, 0x84, 0x00, 0x33,
+	}
+	annexB := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80,
+		0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x33,
+	}
+
+	units, err := SplitAVCC(avcc, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{ppsUnit, idrUnit}, units)
+
+	out, err := AVCCToAnnexB(avcc, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, annexB, out)
+
+	out, err = AnnexBToAVCC(annexB, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, avcc, out)
+
+	out, err = JoinAVCC([][]byte{ppsUnit, idrUnit}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x04, 0x68, 0xce, 0x3c, 0x80, 0x00, 0x05, 0x65, 0x88, 0x84, 0x00, 0x33}, out)
+}
+
+func TestSplitAVCCErrors(t *testing.T) {
+	for _, data := range [][]byte{
+		// truncated length
+		{0x00, 0x00, 0x01},
+		// length past the data
+		{0x00, 0x00, 0x00, 0x05, 0x65, 0x88},
+		// empty unit
+		{0x00, 0x00, 0x00, 0x00},
+	} {
+		_, err := SplitAVCC(data, 4)
+		assert.Equal(t, ErrInvalidNALUnit, err, data)
+	}
+
+	_, err := SplitAVCC(idrUnit, 3)
+	assert.Equal(t, ErrInvalidLengthSize, err)
+
+	// a unit does not fit a single byte length
+	_, err = JoinAVCC([][]byte{make([]byte, 256)}, 1)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+}
+
+func TestSplitAnnexB(t *testing.T) {
+	data := []byte{
+		// leading garbage and a three byte start code
+		0xff, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80,
+		// trailing zeros before a four byte start code
+		0x00, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x33,
+		// empty unit
+		0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x09, 0xf0,
+	}
+
+	assert.Equal(t, [][]byte{ppsUnit, idrUnit, {0x09, 0xf0}}, SplitAnnexB(data))
+	assert.Nil(t, SplitAnnexB([]byte{0x65, 0x88}))
+}
+
+func TestUnescape(t *testing.T) {
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x00, 0x01, 0x03}, Unescape([]byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x01, 0x03}))
+	assert.Equal(t, idrUnit, Unescape(idrUnit))
+}
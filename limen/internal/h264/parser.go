@@ -0,0 +1,158 @@
+package h264
+
+import "limen/internal/codec"
+
+type Encapsulation uint8
+
+const (
+	// EncapsulationAVCC prefixes NAL units with their length
+	EncapsulationAVCC Encapsulation = 0
+	// EncapsulationAnnexB separates NAL units with start codes
+	EncapsulationAnnexB Encapsulation = 1
+)
+
+type ParserOptions struct {
+	OutputEncapsulation Encapsulation
+}
+
+// Metadata describes the stream a frame belongs to, it is shared by the
+// frames parsed until the parameter sets change.
+type Metadata struct {
+	Config *DecoderConfigurationRecord
+	SPS    *SPS
+	PPS    *PPS
+}
+
+// Parser turns length prefixed access units into frames, the decoder
+// configuration has to be set before the first frame.
+type Parser struct {
+	options  ParserOptions
+	metadata *Metadata
+}
+
+func NewParser(options ParserOptions) *Parser {
+	return &Parser{options: options}
+}
+
+// SetConfig sets the AVCDecoderConfigurationRecord of the following frames.
+func (p *Parser) SetConfig(data []byte) error {
+	config, err := ParseDecoderConfigurationRecord(data)
+	if err != nil {
+		return err
+	}
+
+	if len(config.SPS) == 0 || len(config.PPS) == 0 {
+		return ErrInvalidConfig
+	}
+
+	sps, err := ParseSPS(config.SPS[0])
+	if err != nil {
+		return err
+	}
+
+	pps, err := ParsePPS(config.PPS[0])
+	if err != nil {
+		return err
+	}
+
+	p.metadata = &Metadata{Config: config, SPS: sps, PPS: pps}
+
+	return nil
+}
+
+func (p *Parser) Metadata() *Metadata {
+	return p.metadata
+}
+
+// Parse parses an access unit with the decode and presentation timestamps.
+//
+// Parameter sets repeated within the access unit replace the configured
+// ones. Annex B output carries the parameter sets on every keyframe so that
+// the stream can be joined at any of them.
+func (p *Parser) Parse(data []byte, dts, pts int) (*codec.Frame, error) {
+	if p.metadata == nil {
+		return nil, ErrMissingConfig
+	}
+
+	units, err := SplitAVCC(data, p.metadata.Config.LengthSize)
+	if err != nil {
+		return nil, err
+	}
+
+	frameType := codec.FrameTypeDelta
+	var sps, pps []byte
+
+	for _, unit := range units {
+		switch UnitType(unit) {
+		case NALUnitTypeIDR:
+			frameType = codec.FrameTypeKey
+		case NALUnitTypeSPS:
+			sps = unit
+		case NALUnitTypePPS:
+			pps = unit
+		}
+	}
+
+	if err := p.update(sps, pps); err != nil {
+		return nil, err
+	}
+
+	frame := &codec.Frame{
+		Metadata: p.metadata,
+		Data:     data,
+		Dts:      dts,
+		Pts:      pts,
+		Codec:    codec.CodecTypeH264,
+		Type:     frameType,
+	}
+
+	if p.options.OutputEncapsulation == EncapsulationAnnexB {
+		if frameType == codec.FrameTypeKey && sps == nil {
+			config := p.metadata.Config
+			units = append(append(append([][]byte{}, config.SPS...), config.PPS...), units...)
+		}
+
+		frame.Data = JoinAnnexB(units)
+	}
+
+	return frame, nil
+}
+
+// update replaces the metadata with in-band parameter sets.
+func (p *Parser) update(spsUnit, ppsUnit []byte) error {
+	if spsUnit == nil && ppsUnit == nil {
+		return nil
+	}
+
+	metadata := *p.metadata
+	config := *metadata.Config
+
+	if spsUnit != nil {
+		sps, err := ParseSPS(spsUnit)
+		if err != nil {
+			return err
+		}
+
+		// the unit references the frame which might get reused
+		spsUnit = append([]byte(nil), spsUnit...)
+
+		metadata.SPS = sps
+		config.SPS = [][]byte{spsUnit}
+		config.Profile, config.Compatibility, config.Level = spsUnit[1], spsUnit[2], spsUnit[3]
+	}
+
+	if ppsUnit != nil {
+		pps, err := ParsePPS(ppsUnit)
+		if err != nil {
+			return err
+		}
+
+		metadata.PPS = pps
+		config.PPS = [][]byte{append([]byte(nil), ppsUnit...)}
+	}
+
+	metadata.Config = &config
+	p.metadata = &metadata
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package h264
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/codec"
+)
+
+func avcc(units ...[]byte) []byte {
+	data, _ := JoinAVCC(units, 4)
+	return data
+}
+
+func TestParser(t *testing.T) {
+	parser := NewParser(ParserOptions{})
+
+	_, err := parser.Parse(avcc(idrUnit), 0, 0)
+	assert.Equal(t, ErrMissingConfig, err)
+
+	assert.Nil(t, parser.SetConfig(configRecord()))
+	assert.Equal(t, 1280, parser.Metadata().SPS.Width)
+
+	frame, err := parser.Parse(avcc(idrUnit), 40, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, &codec.Frame{
+		Metadata: parser.Metadata(),
+		Data:     avcc(idrUnit),
+		Dts:      40,
+		Pts:      80,
+		Codec:    codec.CodecTypeH264,
+		Type:     codec.FrameTypeKey,
+	}, frame)
+
+	frame, err = parser.Parse(avcc([]byte{0x41, 0x9a, 0x02}), 80, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, codec.FrameTypeDelta, frame.Type)
+
+	_, err = parser.Parse([]byte{0x00, 0x00, 0x00, 0x09, 0x41}, 120, 120)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+}
+
+func TestParserAnnexBOutput(t *testing.T) {
+	parser := NewParser(ParserOptions{OutputEncapsulation: EncapsulationAnnexB})
+	assert.Nil(t, parser.SetConfig(configRecord()))
+
+	// keyframes get the parameter sets of the configuration
+	frame, err := parser.Parse(avcc(idrUnit), 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{spsUnit, ppsUnit, idrUnit}), frame.Data)
+
+	slice := []byte{0x41, 0x9a, 0x02}
+	frame, err = parser.Parse(avcc(slice), 40, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{slice}), frame.Data)
+}
+
+func TestParserInBandParameterSets(t *testing.T) {
+	parser := NewParser(ParserOptions{OutputEncapsulation: EncapsulationAnnexB})
+	assert.Nil(t, parser.SetConfig(configRecord()))
+	initial := parser.Metadata()
+
+	// the 1080p High profile SPS replaces the configured one
+	sps := decodeHex(t, "67640028acd940780227e5c044000003000400000300f03c60c658")
+	data := avcc(sps, ppsUnit, idrUnit)
+
+	frame, err := parser.Parse(data, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{sps, ppsUnit, idrUnit}), frame.Data)
+
+	metadata := frame.Metadata.(*Metadata)
+	assert.Equal(t, 1920, metadata.SPS.Width)
+	assert.Equal(t, "avc1.640028", metadata.Config.Codecs())
+	assert.Equal(t, [][]byte{sps}, metadata.Config.SPS)
+
+	// frames parsed before keep their metadata
+	assert.Equal(t, 1280, initial.SPS.Width)
+	assert.Equal(t, "avc1.42c01e", initial.Config.Codecs())
+
+	// a later keyframe gets the new parameter sets
+	frame, err = parser.Parse(avcc(idrUnit), 40, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{sps, ppsUnit, idrUnit}), frame.Data)
+
+	_, err = parser.Parse(avcc([]byte{0x67, 0x64}, idrUnit), 80, 80)
+	assert.Equal(t, ErrInvalidSPS, err)
+}
@@ -0,0 +1,96 @@
+package h264
+
+import (
+	"math/bits"
+
+	"limen/internal/util"
+)
+
+// PPS holds the leading fields of a picture parameter set.
+type PPS struct {
+	Id                         uint32
+	SpsId                      uint32
+	EntropyCodingModeFlag      bool
+	BottomFieldPicOrderInFrame bool
+	NumSliceGroups             uint32
+	NumRefIdxL0DefaultActive   uint32
+	NumRefIdxL1DefaultActive   uint32
+	WeightedPred               bool
+	WeightedBipredIdc          uint32
+	PicInitQp                  int32
+	PicInitQs                  int32
+	ChromaQpIndexOffset        int32
+	DeblockingFilterControl    bool
+	ConstrainedIntraPred       bool
+	RedundantPicCntPresent     bool
+}
+
+// ParsePPS parses a picture parameter set NAL unit including its header.
+func ParsePPS(unit []byte) (*PPS, error) {
+	if len(unit) < 2 || UnitType(unit) != NALUnitTypePPS {
+		return nil, ErrInvalidPPS
+	}
+
+	r := util.NewFieldReader(Unescape(unit[1:]), ErrInvalidPPS)
+
+	pps := &PPS{
+		Id:                         r.UE(),
+		SpsId:                      r.UE(),
+		EntropyCodingModeFlag:      r.Flag(),
+		BottomFieldPicOrderInFrame: r.Flag(),
+		NumSliceGroups:             r.UE() + 1,
+	}
+
+	if pps.Id > 255 || pps.SpsId > 31 || pps.NumSliceGroups > 8 {
+		return nil, ErrInvalidPPS
+	}
+
+	if pps.NumSliceGroups > 1 {
+		skipSliceGroups(r, pps.NumSliceGroups)
+	}
+
+	pps.NumRefIdxL0DefaultActive = r.UE() + 1
+	pps.NumRefIdxL1DefaultActive = r.UE() + 1
+	pps.WeightedPred = r.Flag()
+	pps.WeightedBipredIdc = r.Bits(2)
+	pps.PicInitQp = r.SE() + 26
+	pps.PicInitQs = r.SE() + 26
+	pps.ChromaQpIndexOffset = r.SE()
+	pps.DeblockingFilterControl = r.Flag()
+	pps.ConstrainedIntraPred = r.Flag()
+	pps.RedundantPicCntPresent = r.Flag()
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	return pps, nil
+}
+
+// skipSliceGroups skips the slice group map of the flexible macroblock ordering.
+func skipSliceGroups(r *util.FieldReader, groups uint32) {
+	switch r.UE() {
+	case 0:
+		for i := uint32(0); i < groups; i++ {
+			// run_length_minus1
+			r.UE()
+		}
+	case 2:
+		for i := uint32(0); i+1 < groups; i++ {
+			// top_left and bottom_right
+			r.UE()
+			r.UE()
+		}
+	case 3, 4, 5:
+		// slice_group_change_direction_flag and slice_group_change_rate_minus1
+		r.Flag()
+		r.UE()
+	case 6:
+		units := r.UE() + 1
+		size := bits.Len32(groups - 1)
+
+		for i := uint32(0); i < units && r.Err() == nil; i++ {
+			r.Bits(size)
+		}
+	}
+}
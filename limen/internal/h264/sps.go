@@ -0,0 +1,262 @@
+package h264
+
+import "limen/internal/util"
+
+// SPS holds the fields of a sequence parameter set describing the picture,
+// fields past the ones needed for the resolution and timing are skipped.
+type SPS struct {
+	Id              uint32
+	Profile         uint8
+	ConstraintFlags uint8
+	Level           uint8
+	// 0 monochrome, 1 4:2:0, 2 4:2:2, 3 4:4:4
+	ChromaFormat        uint32
+	SeparateColourPlane bool
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+
+	Log2MaxFrameNum       uint32
+	PicOrderCntType       uint32
+	Log2MaxPicOrderCntLsb uint32
+	MaxNumRefFrames       uint32
+	FrameMbsOnly          bool
+
+	// Width and Height of the picture after cropping
+	Width  int
+	Height int
+
+	// sample aspect ratio, zero when not signalled
+	SarWidth  uint32
+	SarHeight uint32
+
+	// timing of the VUI, zero when not signalled
+	NumUnitsInTick uint32
+	TimeScale      uint32
+	FixedFrameRate bool
+}
+
+// FrameRate returns the frame rate signalled in the VUI or zero, the time
+// scale counts fields so two ticks make up a frame.
+func (s *SPS) FrameRate() float64 {
+	if s.NumUnitsInTick == 0 || s.TimeScale == 0 {
+		return 0
+	}
+
+	return float64(s.TimeScale) / float64(2*s.NumUnitsInTick)
+}
+
+// profiles which signal the chroma format and bit depths
+func hasChromaInfo(profile uint8) bool {
+	switch profile {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		return true
+	}
+
+	return false
+}
+
+// ParseSPS parses a sequence parameter set NAL unit including its header.
+func ParseSPS(unit []byte) (*SPS, error) {
+	if len(unit) < 4 || UnitType(unit) != NALUnitTypeSPS {
+		return nil, ErrInvalidSPS
+	}
+
+	r := util.NewFieldReader(Unescape(unit[1:]), ErrInvalidSPS)
+
+	sps := &SPS{
+		Profile:         uint8(r.Bits(8)),
+		ConstraintFlags: uint8(r.Bits(8)),
+		Level:           uint8(r.Bits(8)),
+		Id:              r.UE(),
+		ChromaFormat:    1,
+		BitDepthLuma:    8,
+		BitDepthChroma:  8,
+	}
+
+	if hasChromaInfo(sps.Profile) {
+		sps.ChromaFormat = r.UE()
+		if sps.ChromaFormat > 3 {
+			return nil, ErrInvalidSPS
+		}
+
+		if sps.ChromaFormat == 3 {
+			sps.SeparateColourPlane = r.Flag()
+		}
+
+		sps.BitDepthLuma = r.UE() + 8
+		sps.BitDepthChroma = r.UE() + 8
+		// qpprime_y_zero_transform_bypass_flag
+		r.Flag()
+
+		if r.Flag() {
+			lists := 8
+			if sps.ChromaFormat == 3 {
+				lists = 12
+			}
+
+			for i := 0; i < lists; i++ {
+				if !r.Flag() {
+					continue
+				}
+
+				if i < 6 {
+					skipScalingList(r, 16)
+				} else {
+					skipScalingList(r, 64)
+				}
+			}
+		}
+	}
+
+	sps.Log2MaxFrameNum = r.UE() + 4
+	sps.PicOrderCntType = r.UE()
+
+	switch sps.PicOrderCntType {
+	case 0:
+		sps.Log2MaxPicOrderCntLsb = r.UE() + 4
+	case 1:
+		// delta_pic_order_always_zero_flag, offset_for_non_ref_pic, offset_for_top_to_bottom_field
+		r.Flag()
+		r.SE()
+		r.SE()
+
+		cycle := r.UE()
+		if cycle > 255 {
+			return nil, ErrInvalidSPS
+		}
+
+		for i := uint32(0); i < cycle; i++ {
+			r.SE()
+		}
+	case 2:
+	default:
+		return nil, ErrInvalidSPS
+	}
+
+	sps.MaxNumRefFrames = r.UE()
+	// gaps_in_frame_num_value_allowed_flag
+	r.Flag()
+
+	widthInMbs := int(r.UE()) + 1
+	heightInMapUnits := int(r.UE()) + 1
+
+	sps.FrameMbsOnly = r.Flag()
+	if !sps.FrameMbsOnly {
+		// mb_adaptive_frame_field_flag
+		r.Flag()
+	}
+	// direct_8x8_inference_flag
+	r.Flag()
+
+	var cropLeft, cropRight, cropTop, cropBottom int
+	if r.Flag() {
+		cropLeft, cropRight, cropTop, cropBottom = int(r.UE()), int(r.UE()), int(r.UE()), int(r.UE())
+	}
+
+	if r.Flag() {
+		parseVUI(r, sps)
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	frameHeightFactor := 1
+	if !sps.FrameMbsOnly {
+		frameHeightFactor = 2
+	}
+
+	// the cropping is expressed in chroma samples
+	cropUnitX, cropUnitY := 1, frameHeightFactor
+	if sps.ChromaFormat != 0 && !sps.SeparateColourPlane {
+		if sps.ChromaFormat == 1 || sps.ChromaFormat == 2 {
+			cropUnitX = 2
+		}
+
+		if sps.ChromaFormat == 1 {
+			cropUnitY *= 2
+		}
+	}
+
+	sps.Width = widthInMbs*16 - cropUnitX*(cropLeft+cropRight)
+	sps.Height = frameHeightFactor*heightInMapUnits*16 - cropUnitY*(cropTop+cropBottom)
+
+	if sps.Width <= 0 || sps.Height <= 0 {
+		return nil, ErrInvalidSPS
+	}
+
+	return sps, nil
+}
+
+func skipScalingList(r *util.FieldReader, size int) {
+	last, next := int32(8), int32(8)
+
+	for i := 0; i < size; i++ {
+		if next != 0 {
+			next = (last + r.SE() + 256) % 256
+		}
+
+		if next != 0 {
+			last = next
+		}
+	}
+}
+
+const extendedSar = 255
+
+// sample aspect ratios indexed by aspect_ratio_idc
+var sampleAspectRatios = [][2]uint32{
+	{0, 0}, {1, 1}, {12, 11}, {10, 11}, {16, 11}, {40, 33}, {24, 11}, {20, 11},
+	{32, 11}, {80, 33}, {18, 11}, {15, 11}, {64, 33}, {160, 99}, {4, 3}, {3, 2}, {2, 1},
+}
+
+// ReadSampleAspectRatio reads aspect_ratio_idc and the explicit ratio following
+// it, H.265 shares the syntax and the table. Unknown indexes return zeros.
+func ReadSampleAspectRatio(r *util.FieldReader) (uint32, uint32) {
+	aspectRatio := r.Bits(8)
+
+	switch {
+	case aspectRatio == extendedSar:
+		width := r.Bits(16)
+		return width, r.Bits(16)
+	case int(aspectRatio) < len(sampleAspectRatios):
+		return sampleAspectRatios[aspectRatio][0], sampleAspectRatios[aspectRatio][1]
+	}
+
+	return 0, 0
+}
+
+// parseVUI reads the VUI parameters up to the timing information.
+func parseVUI(r *util.FieldReader, sps *SPS) {
+	if r.Flag() {
+		sps.SarWidth, sps.SarHeight = ReadSampleAspectRatio(r)
+	}
+
+	// overscan_info_present_flag, overscan_appropriate_flag
+	if r.Flag() {
+		r.Flag()
+	}
+
+	// video_signal_type_present_flag
+	if r.Flag() {
+		// video_format, video_full_range_flag
+		r.Bits(4)
+
+		// colour primaries, transfer characteristics and matrix coefficients
+		if r.Flag() {
+			r.Bits(24)
+		}
+	}
+
+	// chroma_loc_info_present_flag
+	if r.Flag() {
+		r.UE()
+		r.UE()
+	}
+
+	if r.Flag() {
+		sps.NumUnitsInTick = r.Bits(32)
+		sps.TimeScale = r.Bits(32)
+		sps.FixedFrameRate = r.Flag()
+	}
+}
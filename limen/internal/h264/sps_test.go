@@ -0,0 +1,188 @@
+package h264
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/util"
+)
+
+func decodeHex(t *testing.T, value string) []byte {
+	data, err := hex.DecodeString(value)
+	assert.Nil(t, err)
+
+	return data
+}
+
+// bitWriter builds parameter sets which encoders rarely produce.
+type bitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *bitWriter) u(n int, value uint32) *bitWriter {
+	for i := n - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+
+		w.data[len(w.data)-1] |= byte(value>>i&1) << (7 - w.bits%8)
+		w.bits++
+	}
+
+	return w
+}
+
+func (w *bitWriter) ue(value uint32) *bitWriter {
+	value++
+
+	size := 0
+	for v := value; v > 1; v >>= 1 {
+		size++
+	}
+
+	return w.u(size, 0).u(size+1, value)
+}
+
+func (w *bitWriter) se(value int32) *bitWriter {
+	if value > 0 {
+		return w.ue(uint32(2*value - 1))
+	}
+
+	return w.ue(uint32(-2 * value))
+}
+
+// trailing stop bit of the RBSP
+func (w *bitWriter) bytes() []byte {
+	w.u(1, 1)
+	return w.data
+}
+
+func TestParseSPS(t *testing.T) {
+	// x264, High 4.0, 1920x1080 cropped from 1088 lines, 30fps
+	sps, err := ParseSPS(decodeHex(t, "67640028acd940780227e5c044000003000400000300f03c60c658"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(100), sps.Profile)
+	assert.Equal(t, uint8(40), sps.Level)
+	assert.Equal(t, uint32(1), sps.ChromaFormat)
+	assert.Equal(t, uint32(8), sps.BitDepthLuma)
+	assert.Equal(t, uint32(4), sps.MaxNumRefFrames)
+	assert.True(t, sps.FrameMbsOnly)
+	assert.Equal(t, 1920, sps.Width)
+	assert.Equal(t, 1080, sps.Height)
+	assert.Equal(t, [2]uint32{1, 1}, [2]uint32{sps.SarWidth, sps.SarHeight})
+	assert.Equal(t, 30.0, sps.FrameRate())
+
+	// Baseline 3.0, 1280x720
+	sps, err = ParseSPS(decodeHex(t, "6742c01ed9005005ba10000003001000000303c0f162e480"))
+	assert.Nil(t, err)
+	assert.Equal(t, uint8(66), sps.Profile)
+	assert.Equal(t, uint8(0xc0), sps.ConstraintFlags)
+	assert.Equal(t, 1280, sps.Width)
+	assert.Equal(t, 720, sps.Height)
+	assert.Equal(t, 30.0, sps.FrameRate())
+}
+
+func TestParseInterlacedSPS(t *testing.T) {
+	// High 4:2:2, interlaced 720x576 with cropping, a scaling matrix,
+	// picture order count type 1 and no VUI
+	w := (&bitWriter{}).u(8, 0x67).u(8, 122).u(8, 0).u(8, 30).ue(0).
+		// 4:2:2, 10 bit luma and chroma, no transform bypass
+		ue(2).ue(2).ue(2).u(1, 0).
+		// scaling matrix with only the first list present
+		u(1, 1).u(1, 1)
+	for i := 0; i < 16; i++ {
+		w.se(1)
+	}
+	w.u(7, 0)
+
+	// frame num, poc type 1 with a two frame cycle
+	w.ue(0).ue(1).u(1, 0).se(-2).se(0).ue(2).se(1).se(3)
+	// reference frames, gaps, 45x18 macroblocks in field pairs
+	w.ue(4).u(1, 0).ue(44).ue(17).u(1, 0).u(1, 0).u(1, 1)
+	// cropping 4 chroma samples on the right and 2 on the bottom, no VUI
+	w.u(1, 1).ue(0).ue(4).ue(0).ue(2).u(1, 0)
+
+	sps, err := ParseSPS(w.bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(2), sps.ChromaFormat)
+	assert.Equal(t, uint32(10), sps.BitDepthLuma)
+	assert.Equal(t, uint32(10), sps.BitDepthChroma)
+	assert.Equal(t, uint32(1), sps.PicOrderCntType)
+	assert.False(t, sps.FrameMbsOnly)
+	assert.Equal(t, 720-2*4, sps.Width)
+	assert.Equal(t, 576-2*2, sps.Height)
+	assert.Equal(t, 0.0, sps.FrameRate())
+}
+
+func TestParseInvalidSPS(t *testing.T) {
+	valid := decodeHex(t, "6742c01ed9005005ba10000003001000000303c0f162e480")
+
+	for _, data := range [][]byte{
+		nil,
+		// not an SPS
+		{0x68, 0xeb, 0xe3, 0xcb},
+		// truncated before the resolution
+		valid[:5],
+		// truncated within the VUI
+		valid[:14],
+	} {
+		_, err := ParseSPS(data)
+		assert.Equal(t, ErrInvalidSPS, err, data)
+	}
+}
+
+func TestReadSampleAspectRatio(t *testing.T) {
+	for _, test := range []struct {
+		data          []byte
+		width, height uint32
+	}{
+		{[]byte{14}, 4, 3},
+		// Extended_SAR
+		{[]byte{255, 0x00, 0x40, 0x00, 0x21}, 64, 33},
+		// reserved
+		{[]byte{17}, 0, 0},
+	} {
+		r := util.NewFieldReader(test.data, ErrInvalidSPS)
+
+		width, height := ReadSampleAspectRatio(r)
+		assert.Nil(t, r.Err())
+		assert.Equal(t, test.width, width)
+		assert.Equal(t, test.height, height)
+	}
+}
+
+func TestParsePPS(t *testing.T) {
+	pps, err := ParsePPS([]byte{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0})
+	assert.Nil(t, err)
+	assert.Equal(t, &PPS{
+		EntropyCodingModeFlag:    true,
+		NumSliceGroups:           1,
+		NumRefIdxL0DefaultActive: 3,
+		NumRefIdxL1DefaultActive: 1,
+		WeightedPred:             true,
+		WeightedBipredIdc:        2,
+		PicInitQp:                23,
+		PicInitQs:                26,
+		ChromaQpIndexOffset:      -2,
+		DeblockingFilterControl:  true,
+	}, pps)
+
+	// slice groups with an explicit map of 4 units
+	w := (&bitWriter{}).u(8, 0x68).ue(1).ue(2).u(1, 0).u(1, 0).ue(2).
+		ue(6).ue(3).u(2, 0).u(2, 1).u(2, 2).u(2, 0).
+		ue(0).ue(0).u(1, 0).u(2, 0).se(4).se(0).se(0).u(1, 1).u(1, 0).u(1, 0)
+
+	pps, err = ParsePPS(w.bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), pps.Id)
+	assert.Equal(t, uint32(2), pps.SpsId)
+	assert.Equal(t, uint32(3), pps.NumSliceGroups)
+	assert.Equal(t, int32(30), pps.PicInitQp)
+	assert.True(t, pps.DeblockingFilterControl)
+
+	_, err = ParsePPS([]byte{0x68, 0xeb})
+	assert.Equal(t, ErrInvalidPPS, err)
+}
@@ -0,0 +1,203 @@
+package h265
+
+import "encoding/binary"
+
+// DecoderConfigurationRecord is the HEVCDecoderConfigurationRecord carried by
+// FLV sequence headers and the hvcC box of MP4.
+type DecoderConfigurationRecord struct {
+	ProfileTierLevel ProfileTierLevel
+
+	MinSpatialSegmentation uint16
+	// 0 unknown, 1 slices, 2 tiles, 3 wavefront parallel decoding
+	ParallelismType uint8
+	ChromaFormat    uint8
+	BitDepthLuma    uint8
+	BitDepthChroma  uint8
+	// AvgFrameRate is in frames per 256 seconds, zero when unspecified
+	AvgFrameRate      uint16
+	ConstantFrameRate uint8
+	NumTemporalLayers uint8
+	TemporalIdNested  bool
+	// LengthSize is the size of the NAL unit length prefixes
+	LengthSize int
+
+	Arrays []NALUnitArray
+}
+
+// NALUnitArray holds the parameter sets or SEI units of a single type.
+type NALUnitArray struct {
+	// Complete tells that all units of the type are in the array
+	// and none of them are carried in-band
+	Complete bool
+	Type     NALUnitType
+	Units    [][]byte
+}
+
+const configHeaderSize = 23
+
+func ParseDecoderConfigurationRecord(data []byte) (*DecoderConfigurationRecord, error) {
+	if len(data) < configHeaderSize || data[0] != 1 {
+		return nil, ErrInvalidConfig
+	}
+
+	record := &DecoderConfigurationRecord{
+		ProfileTierLevel: ProfileTierLevel{
+			ProfileSpace:       data[1] >> 6,
+			HighTier:           data[1]&0x20 != 0,
+			Profile:            data[1] & 0x1f,
+			CompatibilityFlags: binary.BigEndian.Uint32(data[2:6]),
+			ConstraintFlags:    uint64(binary.BigEndian.Uint16(data[6:8]))<<32 | uint64(binary.BigEndian.Uint32(data[8:12])),
+			Level:              data[12],
+		},
+		MinSpatialSegmentation: binary.BigEndian.Uint16(data[13:15]) & 0x0fff,
+		ParallelismType:        data[15] & 0x03,
+		ChromaFormat:           data[16] & 0x03,
+		BitDepthLuma:           data[17]&0x07 + 8,
+		BitDepthChroma:         data[18]&0x07 + 8,
+		AvgFrameRate:           binary.BigEndian.Uint16(data[19:21]),
+		ConstantFrameRate:      data[21] >> 6,
+		NumTemporalLayers:      (data[21] >> 3) & 0x07,
+		TemporalIdNested:       data[21]&0x04 != 0,
+		LengthSize:             int(data[21]&0x03) + 1,
+	}
+
+	if record.LengthSize == 3 {
+		return nil, ErrInvalidConfig
+	}
+
+	arrays := int(data[22])
+	data = data[configHeaderSize:]
+
+	for i := 0; i < arrays; i++ {
+		if len(data) < 3 {
+			return nil, ErrInvalidConfig
+		}
+
+		array := NALUnitArray{
+			Complete: data[0]&0x80 != 0,
+			Type:     NALUnitType(data[0] & 0x3f),
+		}
+
+		units := int(binary.BigEndian.Uint16(data[1:3]))
+		data = data[3:]
+
+		for j := 0; j < units; j++ {
+			if len(data) < 2 {
+				return nil, ErrInvalidConfig
+			}
+
+			length := int(binary.BigEndian.Uint16(data))
+			if length == 0 || len(data) < 2+length {
+				return nil, ErrInvalidConfig
+			}
+
+			array.Units = append(array.Units, data[2:2+length])
+			data = data[2+length:]
+		}
+
+		record.Arrays = append(record.Arrays, array)
+	}
+
+	return record, nil
+}
+
+// Units returns the units of the given type from all the arrays.
+func (r *DecoderConfigurationRecord) Units(unitType NALUnitType) [][]byte {
+	var units [][]byte
+	for _, array := range r.Arrays {
+		if array.Type == unitType {
+			units = append(units, array.Units...)
+		}
+	}
+
+	return units
+}
+
+func (r *DecoderConfigurationRecord) VPS() [][]byte {
+	return r.Units(NALUnitTypeVPS)
+}
+
+func (r *DecoderConfigurationRecord) SPS() [][]byte {
+	return r.Units(NALUnitTypeSPS)
+}
+
+func (r *DecoderConfigurationRecord) PPS() [][]byte {
+	return r.Units(NALUnitTypePPS)
+}
+
+// ParameterSets returns the VPS, SPS and PPS units in decoding order.
+func (r *DecoderConfigurationRecord) ParameterSets() [][]byte {
+	var units [][]byte
+	for _, unitType := range []NALUnitType{NALUnitTypeVPS, NALUnitTypeSPS, NALUnitTypePPS} {
+		units = append(units, r.Units(unitType)...)
+	}
+
+	return units
+}
+
+// Marshal serializes the record.
+func (r *DecoderConfigurationRecord) Marshal() ([]byte, error) {
+	if len(r.Arrays) > 0xff {
+		return nil, ErrInvalidConfig
+	}
+
+	if r.LengthSize != 1 && r.LengthSize != 2 && r.LengthSize != 4 {
+		return nil, ErrInvalidLengthSize
+	}
+
+	ptl := r.ProfileTierLevel
+
+	profile := ptl.ProfileSpace<<6 | ptl.Profile&0x1f
+	if ptl.HighTier {
+		profile |= 0x20
+	}
+
+	out := []byte{1, profile}
+	out = binary.BigEndian.AppendUint32(out, ptl.CompatibilityFlags)
+	out = binary.BigEndian.AppendUint16(out, uint16(ptl.ConstraintFlags>>32))
+	out = binary.BigEndian.AppendUint32(out, uint32(ptl.ConstraintFlags))
+	out = append(out, ptl.Level)
+	out = binary.BigEndian.AppendUint16(out, 0xf000|r.MinSpatialSegmentation&0x0fff)
+	out = append(out,
+		0xfc|r.ParallelismType&0x03,
+		0xfc|r.ChromaFormat&0x03,
+		0xf8|(r.BitDepthLuma-8)&0x07,
+		0xf8|(r.BitDepthChroma-8)&0x07)
+	out = binary.BigEndian.AppendUint16(out, r.AvgFrameRate)
+
+	layers := r.ConstantFrameRate<<6 | (r.NumTemporalLayers&0x07)<<3 | byte(r.LengthSize-1)
+	if r.TemporalIdNested {
+		layers |= 0x04
+	}
+	out = append(out, layers, byte(len(r.Arrays)))
+
+	for _, array := range r.Arrays {
+		if len(array.Units) > 0xffff {
+			return nil, ErrInvalidConfig
+		}
+
+		header := byte(array.Type & 0x3f)
+		if array.Complete {
+			header |= 0x80
+		}
+
+		out = append(out, header)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(array.Units)))
+
+		for _, unit := range array.Units {
+			if len(unit) == 0 || len(unit) > 0xffff {
+				return nil, ErrInvalidConfig
+			}
+
+			out = binary.BigEndian.AppendUint16(out, uint16(len(unit)))
+			out = append(out, unit...)
+		}
+	}
+
+	return out, nil
+}
+
+// Codecs returns the RFC 6381 codecs parameter, e.g. "hvc1.1.6.L93.B0".
+func (r *DecoderConfigurationRecord) Codecs() string {
+	return "hvc1." + r.ProfileTierLevel.codecs()
+}
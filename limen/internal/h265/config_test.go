@@ -0,0 +1,88 @@
+package h265
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func configRecord() []byte {
+	record := []byte{
+		0x01, 0x01, 0x60, 0x00, 0x00, 0x00, 0x90, 0x00, 0x00, 0x00, 0x00, 0x00, 0x5d,
+		0xf0, 0x00, 0xfc, 0xfd, 0xf8, 0xf8, 0x00, 0x00, 0x0f, 0x03,
+	}
+
+	for _, unit := range [][]byte{vpsUnit, spsUnit, ppsUnit} {
+		record = append(record, 0x80|unit[0]>>1, 0x00, 0x01, 0x00, byte(len(unit)))
+		record = append(record, unit...)
+	}
+
+	return record
+}
+
+func TestParseDecoderConfigurationRecord(t *testing.T) {
+	record, err := ParseDecoderConfigurationRecord(configRecord())
+	assert.Nil(t, err)
+	assert.Equal(t, &DecoderConfigurationRecord{
+		ProfileTierLevel: ProfileTierLevel{
+			Profile:            ProfileMain,
+			CompatibilityFlags: 0x60000000,
+			ConstraintFlags:    0x900000000000,
+			Level:              93,
+		},
+		ChromaFormat:      1,
+		BitDepthLuma:      8,
+		BitDepthChroma:    8,
+		NumTemporalLayers: 1,
+		TemporalIdNested:  true,
+		LengthSize:        4,
+		Arrays: []NALUnitArray{
+			{Complete: true, Type: NALUnitTypeVPS, Units: [][]byte{vpsUnit}},
+			{Complete: true, Type: NALUnitTypeSPS, Units: [][]byte{spsUnit}},
+			{Complete: true, Type: NALUnitTypePPS, Units: [][]byte{ppsUnit}},
+		},
+	}, record)
+	assert.Equal(t, "hvc1.1.6.L93.90", record.Codecs())
+	assert.Equal(t, [][]byte{vpsUnit, spsUnit, ppsUnit}, record.ParameterSets())
+
+	data, err := record.Marshal()
+	assert.Nil(t, err)
+	assert.Equal(t, configRecord(), data)
+}
+
+func TestCodecs(t *testing.T) {
+	for _, test := range []struct {
+		ptl    ProfileTierLevel
+		codecs string
+	}{
+		{ProfileTierLevel{Profile: ProfileMain10, CompatibilityFlags: 0x20000000, ConstraintFlags: 0xb00000000000, HighTier: true, Level: 120}, "2.4.H120.B0"},
+		{ProfileTierLevel{Profile: ProfileRExt, CompatibilityFlags: 0x08000000, ConstraintFlags: 0x9c2000000000, Level: 153}, "4.10.L153.9C.20"},
+		{ProfileTierLevel{ProfileSpace: 1, Profile: ProfileMain, CompatibilityFlags: 0x40000000, Level: 90}, "A1.2.L90"},
+	} {
+		assert.Equal(t, test.codecs, test.ptl.codecs())
+	}
+}
+
+func TestParseInvalidDecoderConfigurationRecord(t *testing.T) {
+	record := configRecord()
+
+	// length size of 3 bytes
+	invalidLength := append([]byte(nil), record...)
+	invalidLength[21] = 0x0e
+
+	for _, data := range [][]byte{
+		nil,
+		record[:configHeaderSize-1],
+		// truncated unit
+		record[:len(record)-1],
+		// version 0
+		append([]byte{0x00}, record[1:]...),
+		invalidLength,
+	} {
+		_, err := ParseDecoderConfigurationRecord(data)
+		assert.Equal(t, ErrInvalidConfig, err)
+	}
+
+	_, err := (&DecoderConfigurationRecord{LengthSize: 3}).Marshal()
+	assert.Equal(t, ErrInvalidLengthSize, err)
+}
@@ -0,0 +1,110 @@
+package h265
+
+import (
+	"errors"
+
+	"limen/internal/h264"
+)
+
+type NALUnitType uint8
+
+const (
+	NALUnitTypeTrailN    NALUnitType = 0
+	NALUnitTypeTrailR    NALUnitType = 1
+	NALUnitTypeBLAWLP    NALUnitType = 16
+	NALUnitTypeBLAWRADL  NALUnitType = 17
+	NALUnitTypeBLANLP    NALUnitType = 18
+	NALUnitTypeIDRWRADL  NALUnitType = 19
+	NALUnitTypeIDRNLP    NALUnitType = 20
+	NALUnitTypeCRA       NALUnitType = 21
+	NALUnitTypeVPS       NALUnitType = 32
+	NALUnitTypeSPS       NALUnitType = 33
+	NALUnitTypePPS       NALUnitType = 34
+	NALUnitTypeAUD       NALUnitType = 35
+	NALUnitTypeEOS       NALUnitType = 36
+	NALUnitTypeEOB       NALUnitType = 37
+	NALUnitTypeFD        NALUnitType = 38
+	NALUnitTypePrefixSEI NALUnitType = 39
+	NALUnitTypeSuffixSEI NALUnitType = 40
+
+	// the range reserved for IRAP pictures goes past CRA
+	irapReservedLast NALUnitType = 23
+)
+
+var (
+	ErrInvalidNALUnit    = errors.New("h265: invalid NAL unit")
+	ErrInvalidConfig     = errors.New("h265: invalid HEVC decoder configuration record")
+	ErrInvalidVPS        = errors.New("h265: invalid video parameter set")
+	ErrInvalidSPS        = errors.New("h265: invalid sequence parameter set")
+	ErrInvalidPPS        = errors.New("h265: invalid picture parameter set")
+	ErrMissingConfig     = errors.New("h265: frame parsed before the decoder configuration")
+	ErrInvalidLengthSize = errors.New("h265: NAL unit length size must be 1, 2 or 4")
+)
+
+// nalUnitHeaderSize is the size of the header preceding the payload of a unit
+const nalUnitHeaderSize = 2
+
+// UnitType returns the type of a NAL unit given with its header.
+func UnitType(unit []byte) NALUnitType {
+	if len(unit) == 0 {
+		return 0
+	}
+
+	return NALUnitType(unit[0]>>1) & 0x3f
+}
+
+// IsIRAP tells whether the unit is a slice of an intra random access point
+// picture, which decoding can start at.
+func (t NALUnitType) IsIRAP() bool {
+	return t >= NALUnitTypeBLAWLP && t <= irapReservedLast
+}
+
+// The framing of NAL units is the same as the one of H.264, the functions
+// below only translate the errors.
+
+// SplitHVCC splits length prefixed NAL units, as carried by FLV and MP4,
+// the units reference the given data.
+func SplitHVCC(data []byte, lengthSize int) ([][]byte, error) {
+	units, err := h264.SplitAVCC(data, lengthSize)
+	return units, framingError(err)
+}
+
+// JoinHVCC prefixes every NAL unit with its length.
+func JoinHVCC(units [][]byte, lengthSize int) ([]byte, error) {
+	data, err := h264.JoinAVCC(units, lengthSize)
+	return data, framingError(err)
+}
+
+// SplitAnnexB splits a byte stream on three and four byte start codes,
+// the units reference the given data.
+func SplitAnnexB(data []byte) [][]byte {
+	return h264.SplitAnnexB(data)
+}
+
+// JoinAnnexB prefixes every NAL unit with a four byte start code.
+func JoinAnnexB(units [][]byte) []byte {
+	return h264.JoinAnnexB(units)
+}
+
+// HVCCToAnnexB converts length prefixed NAL units into a byte stream.
+func HVCCToAnnexB(data []byte, lengthSize int) ([]byte, error) {
+	out, err := h264.AVCCToAnnexB(data, lengthSize)
+	return out, framingError(err)
+}
+
+// AnnexBToHVCC converts a byte stream into length prefixed NAL units.
+func AnnexBToHVCC(data []byte, lengthSize int) ([]byte, error) {
+	out, err := h264.AnnexBToAVCC(data, lengthSize)
+	return out, framingError(err)
+}
+
+func framingError(err error) error {
+	switch err {
+	case nil:
+		return nil
+	case h264.ErrInvalidLengthSize:
+		return ErrInvalidLengthSize
+	}
+
+	return ErrInvalidNALUnit
+}
@@ -0,0 +1,82 @@
+package h265
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	// parameter sets of a 1080p30 Main profile stream encoded by x265
+	vpsUnit = []byte{
+		0x40, 0x01, 0x0c, 0x01, 0xff, 0xff, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03,
+		0x00, 0x00, 0x03, 0x00, 0x5d, 0x95, 0x98, 0x09,
+	}
+	spsUnit = []byte{
+		0x42, 0x01, 0x01, 0x01, 0x60, 0x00, 0x00, 0x03, 0x00, 0x90, 0x00, 0x00, 0x03, 0x00, 0x00, 0x03,
+		0x00, 0x5d, 0xa0, 0x03, 0xc0, 0x80, 0x10, 0xe5, 0x96, 0x56, 0x69, 0x24, 0xca, 0xe0, 0x10, 0x00,
+		0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x01, 0xe0, 0x80,
+	}
+	ppsUnit = []byte{0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40}
+	// IDR_W_RADL and TRAIL_R slices
+	idrUnit   = []byte{0x26, 0x01, 0xaf, 0x1d, 0x80}
+	trailUnit = []byte{0x02, 0x01, 0xd0, 0x2f}
+)
+
+func TestUnitType(t *testing.T) {
+	assert.Equal(t, NALUnitTypeVPS, UnitType(vpsUnit))
+	assert.Equal(t, NALUnitTypeSPS, UnitType(spsUnit))
+	assert.Equal(t, NALUnitTypePPS, UnitType(ppsUnit))
+	assert.Equal(t, NALUnitTypeIDRWRADL, UnitType(idrUnit))
+	assert.Equal(t, NALUnitTypeTrailR, UnitType(trailUnit))
+	assert.Equal(t, NALUnitType(0), UnitType(nil))
+
+	for _, unitType := range []NALUnitType{NALUnitTypeBLAWLP, NALUnitTypeIDRWRADL, NALUnitTypeIDRNLP, NALUnitTypeCRA, 23} {
+		assert.True(t, unitType.IsIRAP(), unitType)
+	}
+
+	for _, unitType := range []NALUnitType{NALUnitTypeTrailN, NALUnitTypeTrailR, 15, 24, NALUnitTypeVPS, NALUnitTypePrefixSEI} {
+		assert.False(t, unitType.IsIRAP(), unitType)
+	}
+}
+
+func TestHVCCConversion(t *testing.T) {
+	hvcc := []byte{
+		0x00, 0x00, 0x00, 0x07, 0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40,
+		0x00, 0x00, 0x00, 0x05, 0x26, 0x01, 0xaf, 0x1d, 0x80,
+	}
+	annexB := []byte{
+		0x00, 0x00, 0x00, 0x01, 0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40,
+		0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xaf, 0x1d, 0x80,
+	}
+
+	units, err := SplitHVCC(hvcc, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, [][]byte{ppsUnit, idrUnit}, units)
+
+	out, err := HVCCToAnnexB(hvcc, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, annexB, out)
+
+	out, err = AnnexBToHVCC(annexB, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, hvcc, out)
+
+	assert.Equal(t, [][]byte{ppsUnit, idrUnit}, SplitAnnexB(annexB))
+	assert.Equal(t, annexB, JoinAnnexB([][]byte{ppsUnit, idrUnit}))
+
+	out, err = JoinHVCC([][]byte{ppsUnit}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x00, 0x07, 0x44, 0x01, 0xc1, 0x72, 0xb4, 0x62, 0x40}, out)
+}
+
+func TestHVCCErrors(t *testing.T) {
+	_, err := SplitHVCC([]byte{0x00, 0x00, 0x00, 0x09, 0x26}, 4)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+
+	_, err = SplitHVCC(nil, 3)
+	assert.Equal(t, ErrInvalidLengthSize, err)
+
+	_, err = JoinHVCC([][]byte{make([]byte, 0x100)}, 1)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+}
@@ -0,0 +1,208 @@
+package h265
+
+import "limen/internal/codec"
+
+type Encapsulation uint8
+
+const (
+	// EncapsulationHVCC prefixes NAL units with their length
+	EncapsulationHVCC Encapsulation = 0
+	// EncapsulationAnnexB separates NAL units with start codes
+	EncapsulationAnnexB Encapsulation = 1
+)
+
+type ParserOptions struct {
+	OutputEncapsulation Encapsulation
+}
+
+// Metadata describes the stream a frame belongs to, it is shared by the
+// frames parsed until the parameter sets change.
+type Metadata struct {
+	Config *DecoderConfigurationRecord
+	VPS    *VPS
+	SPS    *SPS
+	PPS    *PPS
+}
+
+// Parser turns length prefixed access units into frames, the decoder
+// configuration has to be set before the first frame.
+type Parser struct {
+	options  ParserOptions
+	metadata *Metadata
+}
+
+func NewParser(options ParserOptions) *Parser {
+	return &Parser{options: options}
+}
+
+// SetConfig sets the HEVCDecoderConfigurationRecord of the following frames.
+func (p *Parser) SetConfig(data []byte) error {
+	config, err := ParseDecoderConfigurationRecord(data)
+	if err != nil {
+		return err
+	}
+
+	if len(config.VPS()) == 0 || len(config.SPS()) == 0 || len(config.PPS()) == 0 {
+		return ErrInvalidConfig
+	}
+
+	vps, err := ParseVPS(config.VPS()[0])
+	if err != nil {
+		return err
+	}
+
+	sps, err := ParseSPS(config.SPS()[0])
+	if err != nil {
+		return err
+	}
+
+	pps, err := ParsePPS(config.PPS()[0])
+	if err != nil {
+		return err
+	}
+
+	p.metadata = &Metadata{Config: config, VPS: vps, SPS: sps, PPS: pps}
+
+	return nil
+}
+
+func (p *Parser) Metadata() *Metadata {
+	return p.metadata
+}
+
+// Parse parses an access unit with the decode and presentation timestamps.
+//
+// Frames holding IRAP pictures are keyframes. Parameter sets repeated within
+// the access unit replace the configured ones. Annex B output carries the
+// parameter sets on every keyframe so that the stream can be joined at any
+// of them.
+func (p *Parser) Parse(data []byte, dts, pts int) (*codec.Frame, error) {
+	if p.metadata == nil {
+		return nil, ErrMissingConfig
+	}
+
+	units, err := SplitHVCC(data, p.metadata.Config.LengthSize)
+	if err != nil {
+		return nil, err
+	}
+
+	frameType := codec.FrameTypeDelta
+	var vps, sps, pps []byte
+
+	for _, unit := range units {
+		if len(unit) < nalUnitHeaderSize {
+			return nil, ErrInvalidNALUnit
+		}
+
+		switch unitType := UnitType(unit); {
+		case unitType.IsIRAP():
+			frameType = codec.FrameTypeKey
+		case unitType == NALUnitTypeVPS:
+			vps = unit
+		case unitType == NALUnitTypeSPS:
+			sps = unit
+		case unitType == NALUnitTypePPS:
+			pps = unit
+		}
+	}
+
+	if err := p.update(vps, sps, pps); err != nil {
+		return nil, err
+	}
+
+	frame := &codec.Frame{
+		Metadata: p.metadata,
+		Data:     data,
+		Dts:      dts,
+		Pts:      pts,
+		Codec:    codec.CodecTypeH265,
+		Type:     frameType,
+	}
+
+	if p.options.OutputEncapsulation == EncapsulationAnnexB {
+		if frameType == codec.FrameTypeKey && sps == nil {
+			units = append(p.metadata.Config.ParameterSets(), units...)
+		}
+
+		frame.Data = JoinAnnexB(units)
+	}
+
+	return frame, nil
+}
+
+// update replaces the metadata with in-band parameter sets.
+func (p *Parser) update(vpsUnit, spsUnit, ppsUnit []byte) error {
+	if vpsUnit == nil && spsUnit == nil && ppsUnit == nil {
+		return nil
+	}
+
+	metadata := *p.metadata
+	config := *metadata.Config
+
+	if vpsUnit != nil {
+		vps, err := ParseVPS(vpsUnit)
+		if err != nil {
+			return err
+		}
+
+		metadata.VPS = vps
+		config.replaceUnit(NALUnitTypeVPS, vpsUnit)
+	}
+
+	if spsUnit != nil {
+		sps, err := ParseSPS(spsUnit)
+		if err != nil {
+			return err
+		}
+
+		metadata.SPS = sps
+		config.replaceUnit(NALUnitTypeSPS, spsUnit)
+		config.ProfileTierLevel = sps.ProfileTierLevel
+		config.ChromaFormat = uint8(sps.ChromaFormat)
+		config.BitDepthLuma = uint8(sps.BitDepthLuma)
+		config.BitDepthChroma = uint8(sps.BitDepthChroma)
+	}
+
+	if ppsUnit != nil {
+		pps, err := ParsePPS(ppsUnit)
+		if err != nil {
+			return err
+		}
+
+		metadata.PPS = pps
+		config.replaceUnit(NALUnitTypePPS, ppsUnit)
+	}
+
+	metadata.Config = &config
+	p.metadata = &metadata
+
+	return nil
+}
+
+// replaceUnit makes the unit the only one of its type.
+func (r *DecoderConfigurationRecord) replaceUnit(unitType NALUnitType, unit []byte) {
+	// the unit references the frame which might get reused
+	units := [][]byte{append([]byte(nil), unit...)}
+
+	arrays := make([]NALUnitArray, 0, len(r.Arrays)+1)
+	replaced := false
+
+	for _, array := range r.Arrays {
+		if array.Type != unitType {
+			arrays = append(arrays, array)
+			continue
+		}
+
+		if !replaced {
+			array.Units = units
+			arrays = append(arrays, array)
+			replaced = true
+		}
+	}
+
+	if !replaced {
+		arrays = append(arrays, NALUnitArray{Complete: true, Type: unitType, Units: units})
+	}
+
+	r.Arrays = arrays
+}
@@ -0,0 +1,102 @@
+package h265
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/codec"
+)
+
+func hvcc(units ...[]byte) []byte {
+	data, _ := JoinHVCC(units, 4)
+	return data
+}
+
+func TestParser(t *testing.T) {
+	parser := NewParser(ParserOptions{})
+
+	_, err := parser.Parse(hvcc(idrUnit), 0, 0)
+	assert.Equal(t, ErrMissingConfig, err)
+
+	assert.Nil(t, parser.SetConfig(configRecord()))
+	assert.Equal(t, 1920, parser.Metadata().SPS.Width)
+	assert.Equal(t, 1080, parser.Metadata().SPS.Height)
+
+	frame, err := parser.Parse(hvcc(idrUnit), 40, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, &codec.Frame{
+		Metadata: parser.Metadata(),
+		Data:     hvcc(idrUnit),
+		Dts:      40,
+		Pts:      80,
+		Codec:    codec.CodecTypeH265,
+		Type:     codec.FrameTypeKey,
+	}, frame)
+
+	frame, err = parser.Parse(hvcc(trailUnit), 80, 80)
+	assert.Nil(t, err)
+	assert.Equal(t, codec.FrameTypeDelta, frame.Type)
+
+	_, err = parser.Parse(hvcc([]byte{0x26}), 120, 120)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+
+	_, err = parser.Parse([]byte{0x00, 0x00, 0x00, 0x09, 0x26}, 120, 120)
+	assert.Equal(t, ErrInvalidNALUnit, err)
+}
+
+func TestParserSetInvalidConfig(t *testing.T) {
+	parser := NewParser(ParserOptions{})
+
+	// without a PPS
+	record := configRecord()
+	record[22] = 2
+	assert.Equal(t, ErrInvalidConfig, parser.SetConfig(record[:len(record)-len(ppsUnit)-5]))
+	assert.Nil(t, parser.Metadata())
+}
+
+func TestParserAnnexBOutput(t *testing.T) {
+	parser := NewParser(ParserOptions{OutputEncapsulation: EncapsulationAnnexB})
+	assert.Nil(t, parser.SetConfig(configRecord()))
+
+	// keyframes get the parameter sets of the configuration
+	frame, err := parser.Parse(hvcc(idrUnit), 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{vpsUnit, spsUnit, ppsUnit, idrUnit}), frame.Data)
+
+	frame, err = parser.Parse(hvcc(trailUnit), 40, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{trailUnit}), frame.Data)
+}
+
+func TestParserInBandParameterSets(t *testing.T) {
+	parser := NewParser(ParserOptions{OutputEncapsulation: EncapsulationAnnexB})
+	assert.Nil(t, parser.SetConfig(configRecord()))
+	initial := parser.Metadata()
+
+	// the Main 10 SPS replaces the configured one
+	sps := main10SPS()
+	data := hvcc(sps, ppsUnit, idrUnit)
+
+	frame, err := parser.Parse(data, 0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{sps, ppsUnit, idrUnit}), frame.Data)
+
+	metadata := frame.Metadata.(*Metadata)
+	assert.Equal(t, uint32(10), metadata.SPS.BitDepthLuma)
+	assert.Equal(t, uint8(10), metadata.Config.BitDepthLuma)
+	assert.Equal(t, "hvc1.2.4.H120.B0", metadata.Config.Codecs())
+	assert.Equal(t, [][]byte{vpsUnit, sps, ppsUnit}, metadata.Config.ParameterSets())
+
+	// frames parsed before keep their metadata
+	assert.Equal(t, uint32(8), initial.SPS.BitDepthLuma)
+	assert.Equal(t, "hvc1.1.6.L93.90", initial.Config.Codecs())
+
+	// a later keyframe gets the new parameter sets
+	frame, err = parser.Parse(hvcc(idrUnit), 40, 40)
+	assert.Nil(t, err)
+	assert.Equal(t, JoinAnnexB([][]byte{vpsUnit, sps, ppsUnit, idrUnit}), frame.Data)
+
+	_, err = parser.Parse(hvcc([]byte{0x42, 0x01}, idrUnit), 80, 80)
+	assert.Equal(t, ErrInvalidSPS, err)
+}
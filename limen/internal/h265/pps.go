@@ -0,0 +1,109 @@
+package h265
+
+import (
+	"limen/internal/h264"
+	"limen/internal/util"
+)
+
+// PPS holds the leading fields of a picture parameter set.
+type PPS struct {
+	Id                            uint32
+	SpsId                         uint32
+	DependentSliceSegmentsEnabled bool
+	OutputFlagPresent             bool
+	NumExtraSliceHeaderBits       uint32
+	SignDataHidingEnabled         bool
+	CabacInitPresent              bool
+	NumRefIdxL0DefaultActive      uint32
+	NumRefIdxL1DefaultActive      uint32
+	InitQp                        int32
+	ConstrainedIntraPred          bool
+	TransformSkipEnabled          bool
+	CuQpDeltaEnabled              bool
+	DiffCuQpDeltaDepth            uint32
+	CbQpOffset                    int32
+	CrQpOffset                    int32
+	SliceChromaQpOffsetsPresent   bool
+	WeightedPred                  bool
+	WeightedBipred                bool
+	TransquantBypassEnabled       bool
+	TilesEnabled                  bool
+	EntropyCodingSyncEnabled      bool
+	NumTileColumns                uint32
+	NumTileRows                   uint32
+	UniformSpacing                bool
+	LoopFilterAcrossTilesEnabled  bool
+}
+
+// maximum number of tile columns and rows of the highest level
+const (
+	maxTileColumns = 20
+	maxTileRows    = 22
+)
+
+// ParsePPS parses a picture parameter set NAL unit including its header.
+func ParsePPS(unit []byte) (*PPS, error) {
+	if len(unit) < nalUnitHeaderSize+1 || UnitType(unit) != NALUnitTypePPS {
+		return nil, ErrInvalidPPS
+	}
+
+	r := util.NewFieldReader(h264.Unescape(unit[nalUnitHeaderSize:]), ErrInvalidPPS)
+
+	pps := &PPS{
+		Id:                            r.UE(),
+		SpsId:                         r.UE(),
+		DependentSliceSegmentsEnabled: r.Flag(),
+		OutputFlagPresent:             r.Flag(),
+		NumExtraSliceHeaderBits:       r.Bits(3),
+		SignDataHidingEnabled:         r.Flag(),
+		CabacInitPresent:              r.Flag(),
+		NumRefIdxL0DefaultActive:      r.UE() + 1,
+		NumRefIdxL1DefaultActive:      r.UE() + 1,
+		InitQp:                        r.SE() + 26,
+		ConstrainedIntraPred:          r.Flag(),
+		TransformSkipEnabled:          r.Flag(),
+	}
+
+	if pps.Id > 63 || pps.SpsId > 15 {
+		return nil, ErrInvalidPPS
+	}
+
+	if pps.CuQpDeltaEnabled = r.Flag(); pps.CuQpDeltaEnabled {
+		pps.DiffCuQpDeltaDepth = r.UE()
+	}
+
+	pps.CbQpOffset = r.SE()
+	pps.CrQpOffset = r.SE()
+	pps.SliceChromaQpOffsetsPresent = r.Flag()
+	pps.WeightedPred = r.Flag()
+	pps.WeightedBipred = r.Flag()
+	pps.TransquantBypassEnabled = r.Flag()
+	pps.TilesEnabled = r.Flag()
+	pps.EntropyCodingSyncEnabled = r.Flag()
+
+	pps.NumTileColumns, pps.NumTileRows = 1, 1
+	if pps.TilesEnabled {
+		pps.NumTileColumns = r.UE() + 1
+		pps.NumTileRows = r.UE() + 1
+
+		if pps.NumTileColumns > maxTileColumns || pps.NumTileRows > maxTileRows {
+			return nil, ErrInvalidPPS
+		}
+
+		pps.UniformSpacing = r.Flag()
+		if !pps.UniformSpacing {
+			// column_width_minus1 and row_height_minus1 but the last ones
+			for i := uint32(1); i < pps.NumTileColumns+pps.NumTileRows-1; i++ {
+				r.UE()
+			}
+		}
+
+		pps.LoopFilterAcrossTilesEnabled = r.Flag()
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	return pps, nil
+}
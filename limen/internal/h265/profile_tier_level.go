@@ -0,0 +1,105 @@
+package h265
+
+import (
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"limen/internal/util"
+)
+
+// ProfileTierLevel holds the general profile, tier and level of a stream,
+// the ones of the sub layers are skipped.
+type ProfileTierLevel struct {
+	ProfileSpace uint8
+	HighTier     bool
+	Profile      uint8
+	// CompatibilityFlags has the flag of profile 0 as the most significant bit
+	CompatibilityFlags uint32
+	// ConstraintFlags are the 48 bits following the compatibility flags,
+	// starting with general_progressive_source_flag
+	ConstraintFlags uint64
+	Level           uint8
+}
+
+const (
+	ProfileMain             = 1
+	ProfileMain10           = 2
+	ProfileMainStillPicture = 3
+	ProfileRExt             = 4
+)
+
+// maximum number of temporal sub layers
+const maxSubLayers = 7
+
+func parseProfileTierLevel(r *util.FieldReader, maxSubLayersMinus1 uint32) ProfileTierLevel {
+	ptl := ProfileTierLevel{
+		ProfileSpace:       uint8(r.Bits(2)),
+		HighTier:           r.Flag(),
+		Profile:            uint8(r.Bits(5)),
+		CompatibilityFlags: r.Bits(32),
+		ConstraintFlags:    uint64(r.Bits(16))<<32 | uint64(r.Bits(32)),
+		Level:              uint8(r.Bits(8)),
+	}
+
+	profilePresent := make([]bool, maxSubLayersMinus1)
+	levelPresent := make([]bool, maxSubLayersMinus1)
+
+	for i := range profilePresent {
+		profilePresent[i] = r.Flag()
+		levelPresent[i] = r.Flag()
+	}
+
+	// the flags are padded to 8 sub layers
+	if maxSubLayersMinus1 > 0 {
+		r.Bits(2 * int(8-maxSubLayersMinus1))
+	}
+
+	for i := range profilePresent {
+		if profilePresent[i] {
+			// profile space, tier, profile, compatibility and constraint flags
+			r.Bits(24)
+			r.Bits(32)
+			r.Bits(32)
+		}
+
+		if levelPresent[i] {
+			r.Bits(8)
+		}
+	}
+
+	return ptl
+}
+
+// codecs formats the profile, tier and level the way of the RFC 6381
+// codecs parameter of ISO/IEC 14496-15, e.g. "1.6.L93.B0".
+func (p *ProfileTierLevel) codecs() string {
+	var builder strings.Builder
+
+	if p.ProfileSpace > 0 {
+		builder.WriteByte('A' + p.ProfileSpace - 1)
+	}
+
+	tier := 'L'
+	if p.HighTier {
+		tier = 'H'
+	}
+
+	fmt.Fprintf(&builder, "%d.%X.%c%d", p.Profile, bits.Reverse32(p.CompatibilityFlags), tier, p.Level)
+
+	// the constraint bytes, trailing zero bytes are left out
+	constraints := make([]byte, 6)
+	for i := range constraints {
+		constraints[i] = byte(p.ConstraintFlags >> (40 - 8*i))
+	}
+
+	for len(constraints) > 0 && constraints[len(constraints)-1] == 0 {
+		constraints = constraints[:len(constraints)-1]
+	}
+
+	for _, b := range constraints {
+		fmt.Fprintf(&builder, ".%X", b)
+	}
+
+	return builder.String()
+}
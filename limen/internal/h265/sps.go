@@ -0,0 +1,310 @@
+package h265
+
+import (
+	"limen/internal/h264"
+	"limen/internal/util"
+)
+
+// SPS holds the fields of a sequence parameter set describing the picture,
+// fields past the ones needed for the resolution and timing are skipped.
+type SPS struct {
+	VpsId             uint32
+	Id                uint32
+	MaxSubLayers      uint32
+	TemporalIdNesting bool
+	ProfileTierLevel  ProfileTierLevel
+	// 0 monochrome, 1 4:2:0, 2 4:2:2, 3 4:4:4
+	ChromaFormat        uint32
+	SeparateColourPlane bool
+	BitDepthLuma        uint32
+	BitDepthChroma      uint32
+
+	Log2MaxPicOrderCntLsb uint32
+
+	// Width and Height of the picture after the conformance window
+	Width  int
+	Height int
+
+	// sample aspect ratio, zero when not signalled
+	SarWidth  uint32
+	SarHeight uint32
+
+	// timing of the VUI, zero when not signalled
+	NumUnitsInTick uint32
+	TimeScale      uint32
+}
+
+// FrameRate returns the frame rate signalled in the VUI or zero.
+func (s *SPS) FrameRate() float64 {
+	if s.NumUnitsInTick == 0 || s.TimeScale == 0 {
+		return 0
+	}
+
+	return float64(s.TimeScale) / float64(s.NumUnitsInTick)
+}
+
+const (
+	maxShortTermRefPicSets = 64
+	maxLongTermRefPics     = 32
+	// maximum number of pictures of a short term reference picture set
+	maxDeltaPocs = 16
+)
+
+// ParseSPS parses a sequence parameter set NAL unit including its header.
+func ParseSPS(unit []byte) (*SPS, error) {
+	if len(unit) < nalUnitHeaderSize+1 || UnitType(unit) != NALUnitTypeSPS {
+		return nil, ErrInvalidSPS
+	}
+
+	r := util.NewFieldReader(h264.Unescape(unit[nalUnitHeaderSize:]), ErrInvalidSPS)
+
+	sps := &SPS{
+		VpsId:        r.Bits(4),
+		MaxSubLayers: r.Bits(3) + 1,
+	}
+
+	if sps.MaxSubLayers > maxSubLayers {
+		return nil, ErrInvalidSPS
+	}
+
+	sps.TemporalIdNesting = r.Flag()
+	sps.ProfileTierLevel = parseProfileTierLevel(r, sps.MaxSubLayers-1)
+
+	sps.Id = r.UE()
+	sps.ChromaFormat = r.UE()
+	if sps.Id > 15 || sps.ChromaFormat > 3 {
+		return nil, ErrInvalidSPS
+	}
+
+	if sps.ChromaFormat == 3 {
+		sps.SeparateColourPlane = r.Flag()
+	}
+
+	width, height := int(r.UE()), int(r.UE())
+
+	var windowLeft, windowRight, windowTop, windowBottom int
+	if r.Flag() {
+		windowLeft, windowRight, windowTop, windowBottom = int(r.UE()), int(r.UE()), int(r.UE()), int(r.UE())
+	}
+
+	sps.BitDepthLuma = r.UE() + 8
+	sps.BitDepthChroma = r.UE() + 8
+	sps.Log2MaxPicOrderCntLsb = r.UE() + 4
+
+	if sps.BitDepthLuma > 16 || sps.BitDepthChroma > 16 || sps.Log2MaxPicOrderCntLsb > 16 {
+		return nil, ErrInvalidSPS
+	}
+
+	// sps_sub_layer_ordering_info_present_flag
+	first := sps.MaxSubLayers - 1
+	if r.Flag() {
+		first = 0
+	}
+
+	for i := first; i < sps.MaxSubLayers; i++ {
+		// max_dec_pic_buffering_minus1, max_num_reorder_pics, max_latency_increase_plus1
+		r.UE()
+		r.UE()
+		r.UE()
+	}
+
+	// sizes of the coding and transform blocks and depths of the transform hierarchy
+	for i := 0; i < 6; i++ {
+		r.UE()
+	}
+
+	// scaling_list_enabled_flag, sps_scaling_list_data_present_flag
+	if r.Flag() && r.Flag() {
+		skipScalingListData(r)
+	}
+
+	// amp_enabled_flag, sample_adaptive_offset_enabled_flag
+	r.Flag()
+	r.Flag()
+
+	// pcm_enabled_flag
+	if r.Flag() {
+		// bit depths of the luma and chroma samples, sizes of the coding blocks
+		r.Bits(8)
+		r.UE()
+		r.UE()
+		// pcm_loop_filter_disabled_flag
+		r.Flag()
+	}
+
+	sets := r.UE()
+	if sets > maxShortTermRefPicSets {
+		return nil, ErrInvalidSPS
+	}
+
+	deltaPocs := make([]uint32, 0, sets)
+	for i := uint32(0); i < sets && r.Err() == nil; i++ {
+		count, ok := skipShortTermRefPicSet(r, deltaPocs)
+		if !ok {
+			return nil, ErrInvalidSPS
+		}
+
+		deltaPocs = append(deltaPocs, count)
+	}
+
+	// long_term_ref_pics_present_flag
+	if r.Flag() {
+		pics := r.UE()
+		if pics > maxLongTermRefPics {
+			return nil, ErrInvalidSPS
+		}
+
+		for i := uint32(0); i < pics; i++ {
+			// lt_ref_pic_poc_lsb_sps, used_by_curr_pic_lt_sps_flag
+			r.Bits(int(sps.Log2MaxPicOrderCntLsb))
+			r.Flag()
+		}
+	}
+
+	// sps_temporal_mvp_enabled_flag, strong_intra_smoothing_enabled_flag
+	r.Flag()
+	r.Flag()
+
+	if r.Flag() {
+		parseVUI(r, sps)
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	// the conformance window is expressed in chroma samples
+	cropUnitX, cropUnitY := 1, 1
+	if !sps.SeparateColourPlane {
+		if sps.ChromaFormat == 1 || sps.ChromaFormat == 2 {
+			cropUnitX = 2
+		}
+
+		if sps.ChromaFormat == 1 {
+			cropUnitY = 2
+		}
+	}
+
+	sps.Width = width - cropUnitX*(windowLeft+windowRight)
+	sps.Height = height - cropUnitY*(windowTop+windowBottom)
+
+	if sps.Width <= 0 || sps.Height <= 0 {
+		return nil, ErrInvalidSPS
+	}
+
+	return sps, nil
+}
+
+// skipScalingListData skips the scaling lists of every size and matrix.
+func skipScalingListData(r *util.FieldReader) {
+	for size := 0; size < 4; size++ {
+		step := 1
+		if size == 3 {
+			step = 3
+		}
+
+		for matrix := 0; matrix < 6; matrix += step {
+			// scaling_list_pred_mode_flag
+			if !r.Flag() {
+				// scaling_list_pred_matrix_id_delta
+				r.UE()
+				continue
+			}
+
+			coefficients := 64
+			if size == 0 {
+				coefficients = 16
+			}
+
+			if size > 1 {
+				// scaling_list_dc_coef_minus8
+				r.SE()
+			}
+
+			for i := 0; i < coefficients; i++ {
+				r.SE()
+			}
+		}
+	}
+}
+
+// skipShortTermRefPicSet skips the reference picture set following the
+// given ones and returns its number of pictures, which the next set may be
+// predicted from.
+func skipShortTermRefPicSet(r *util.FieldReader, deltaPocs []uint32) (uint32, bool) {
+	// inter_ref_pic_set_prediction_flag
+	if len(deltaPocs) > 0 && r.Flag() {
+		// delta_rps_sign, abs_delta_rps_minus1
+		r.Flag()
+		r.UE()
+
+		// sets of the SPS are predicted from the preceding one, the entries
+		// of its pictures are followed by one of the picture it belongs to
+		var count uint32
+		for i := uint32(0); i <= deltaPocs[len(deltaPocs)-1]; i++ {
+			// used_by_curr_pic_flag, otherwise use_delta_flag
+			if r.Flag() || r.Flag() {
+				count++
+			}
+		}
+
+		return count, count <= maxDeltaPocs
+	}
+
+	negative, positive := r.UE(), r.UE()
+	if negative > maxDeltaPocs || positive > maxDeltaPocs-negative {
+		return 0, false
+	}
+
+	for i := uint32(0); i < negative+positive; i++ {
+		// delta_poc_minus1, used_by_curr_pic_flag
+		r.UE()
+		r.Flag()
+	}
+
+	return negative + positive, true
+}
+
+// parseVUI reads the VUI parameters up to the timing information.
+func parseVUI(r *util.FieldReader, sps *SPS) {
+	if r.Flag() {
+		sps.SarWidth, sps.SarHeight = h264.ReadSampleAspectRatio(r)
+	}
+
+	// overscan_info_present_flag, overscan_appropriate_flag
+	if r.Flag() {
+		r.Flag()
+	}
+
+	// video_signal_type_present_flag
+	if r.Flag() {
+		// video_format, video_full_range_flag
+		r.Bits(4)
+
+		// colour primaries, transfer characteristics and matrix coefficients
+		if r.Flag() {
+			r.Bits(24)
+		}
+	}
+
+	// chroma_loc_info_present_flag
+	if r.Flag() {
+		r.UE()
+		r.UE()
+	}
+
+	// neutral_chroma_indication_flag, field_seq_flag, frame_field_info_present_flag
+	r.Bits(3)
+
+	// default_display_window_flag
+	if r.Flag() {
+		for i := 0; i < 4; i++ {
+			r.UE()
+		}
+	}
+
+	if r.Flag() {
+		sps.NumUnitsInTick = r.Bits(32)
+		sps.TimeScale = r.Bits(32)
+	}
+}
@@ -0,0 +1,262 @@
+package h265
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/util"
+)
+
+// bitWriter builds parameter sets which encoders rarely produce.
+type bitWriter struct {
+	util.BitWriter
+}
+
+func (w *bitWriter) u(n int, value uint32) *bitWriter {
+	w.WriteBits(n, uint64(value))
+	return w
+}
+
+func (w *bitWriter) ue(value uint32) *bitWriter {
+	value++
+
+	size := 0
+	for v := value; v > 1; v >>= 1 {
+		size++
+	}
+
+	return w.u(size, 0).u(size+1, value)
+}
+
+func (w *bitWriter) se(value int32) *bitWriter {
+	if value > 0 {
+		return w.ue(uint32(2*value - 1))
+	}
+
+	return w.ue(uint32(-2 * value))
+}
+
+// trailing stop bit of the RBSP
+func (w *bitWriter) bytes() []byte {
+	w.u(1, 1)
+	return w.Data
+}
+
+func TestParseSPS(t *testing.T) {
+	sps, err := ParseSPS(spsUnit)
+	assert.Nil(t, err)
+	assert.Equal(t, &SPS{
+		MaxSubLayers:      1,
+		TemporalIdNesting: true,
+		ProfileTierLevel: ProfileTierLevel{
+			Profile:            ProfileMain,
+			CompatibilityFlags: 0x60000000,
+			ConstraintFlags:    0x900000000000,
+			Level:              93,
+		},
+		ChromaFormat:          1,
+		BitDepthLuma:          8,
+		BitDepthChroma:        8,
+		Log2MaxPicOrderCntLsb: 8,
+		Width:                 1920,
+		Height:                1080,
+		NumUnitsInTick:        1,
+		TimeScale:             30,
+	}, sps)
+	assert.Equal(t, float64(30), sps.FrameRate())
+}
+
+// Main 10 with two temporal sub layers, scaling lists, PCM, predicted
+// reference picture sets, long term references and a cropped height.
+func main10SPS() []byte {
+	w := &bitWriter{}
+	w.u(16, 0x4201)
+
+	// vps id, two sub layers, temporal id nesting
+	w.u(4, 0).u(3, 1).u(1, 1)
+	// high tier Main 10 at level 4, the sub layer signals only its level
+	w.u(2, 0).u(1, 1).u(5, 2).u(32, 0x20000000).u(16, 0xb000).u(32, 0).u(8, 120)
+	w.u(1, 0).u(1, 1).u(14, 0).u(8, 90)
+
+	// id, 4:2:0, 1920x1088 cropped by 4 chroma rows at the bottom
+	w.ue(0).ue(1).ue(1920).ue(1088)
+	w.u(1, 1).ue(0).ue(0).ue(0).ue(4)
+	// bit depths, log2_max_pic_order_cnt_lsb_minus4
+	w.ue(2).ue(2).ue(4)
+	// ordering info of both sub layers
+	w.u(1, 1).ue(4).ue(2).ue(0).ue(4).ue(2).ue(0)
+	// block sizes and transform hierarchy depths
+	w.ue(0).ue(3).ue(0).ue(3).ue(2).ue(2)
+
+	// explicit 4x4 and 16x16 lists, the rest copied
+	w.u(1, 1).u(1, 1)
+	for size := 0; size < 4; size++ {
+		for matrix := 0; matrix < 6; matrix++ {
+			if size == 3 && matrix%3 != 0 {
+				continue
+			}
+
+			switch {
+			case size == 0 && matrix == 0:
+				w.u(1, 1)
+				for i := 0; i < 16; i++ {
+					w.se(1)
+				}
+			case size == 2 && matrix == 0:
+				w.u(1, 1).se(-3)
+				for i := 0; i < 64; i++ {
+					w.se(0)
+				}
+			default:
+				w.u(1, 0).ue(0)
+			}
+		}
+	}
+
+	// amp, sao, pcm
+	w.u(1, 1).u(1, 1)
+	w.u(1, 1).u(4, 7).u(4, 7).ue(0).ue(1).u(1, 1)
+
+	// three short term sets, the last two predicted from the preceding one
+	w.ue(3)
+	w.ue(2).ue(1).ue(0).u(1, 1).ue(1).u(1, 1).ue(0).u(1, 0)
+	w.u(1, 1).u(1, 0).ue(0).u(1, 1).u(1, 0).u(1, 1).u(1, 0).u(1, 0).u(1, 1)
+	w.u(1, 1).u(1, 1).ue(1).u(1, 1).u(1, 1).u(1, 1).u(1, 1)
+
+	// a long term reference
+	w.u(1, 1).ue(1).u(8, 17).u(1, 1)
+	// temporal mvp, strong intra smoothing
+	w.u(1, 1).u(1, 1)
+
+	// VUI with 4:3 pixels, BT.709 colours and 59.94 frames per second
+	w.u(1, 1)
+	w.u(1, 1).u(8, 14)
+	w.u(1, 0)
+	w.u(1, 1).u(3, 5).u(1, 0).u(1, 1).u(8, 1).u(8, 1).u(8, 1)
+	w.u(1, 0)
+	w.u(3, 0)
+	w.u(1, 0)
+	w.u(1, 1).u(32, 1001).u(32, 60000)
+	// vui_poc_proportional_to_timing_flag, vui_hrd_parameters_present_flag,
+	// bitstream_restriction_flag, sps_extension_present_flag
+	w.u(4, 0)
+
+	return w.bytes()
+}
+
+func TestParseMain10SPS(t *testing.T) {
+	sps, err := ParseSPS(main10SPS())
+	assert.Nil(t, err)
+	assert.Equal(t, &SPS{
+		MaxSubLayers:      2,
+		TemporalIdNesting: true,
+		ProfileTierLevel: ProfileTierLevel{
+			HighTier:           true,
+			Profile:            ProfileMain10,
+			CompatibilityFlags: 0x20000000,
+			ConstraintFlags:    0xb00000000000,
+			Level:              120,
+		},
+		ChromaFormat:          1,
+		BitDepthLuma:          10,
+		BitDepthChroma:        10,
+		Log2MaxPicOrderCntLsb: 8,
+		Width:                 1920,
+		Height:                1080,
+		SarWidth:              4,
+		SarHeight:             3,
+		NumUnitsInTick:        1001,
+		TimeScale:             60000,
+	}, sps)
+	assert.InDelta(t, 59.94, sps.FrameRate(), 0.01)
+}
+
+func TestParseInvalidSPS(t *testing.T) {
+	for _, unit := range [][]byte{
+		nil,
+		spsUnit[:20],
+		// not an SPS
+		ppsUnit,
+		// 8 sub layers
+		append([]byte{0x42, 0x01, 0x0f}, spsUnit[3:]...),
+		// chroma format 4
+		(&bitWriter{}).u(16, 0x4201).u(8, 0x01).u(96, 0).ue(0).ue(4).bytes(),
+	} {
+		_, err := ParseSPS(unit)
+		assert.Equal(t, ErrInvalidSPS, err, unit)
+	}
+}
+
+func TestParseVPS(t *testing.T) {
+	vps, err := ParseVPS(vpsUnit)
+	assert.Nil(t, err)
+	assert.Equal(t, &VPS{
+		MaxLayers:         1,
+		MaxSubLayers:      1,
+		TemporalIdNesting: true,
+		ProfileTierLevel: ProfileTierLevel{
+			Profile:            ProfileMain,
+			CompatibilityFlags: 0x60000000,
+			ConstraintFlags:    0x900000000000,
+			Level:              93,
+		},
+	}, vps)
+
+	for _, unit := range [][]byte{
+		vpsUnit[:12],
+		// reserved bits other than 0xffff
+		append([]byte{0x40, 0x01, 0x0c, 0x01, 0xff, 0xfe}, vpsUnit[6:]...),
+		spsUnit,
+	} {
+		_, err := ParseVPS(unit)
+		assert.Equal(t, ErrInvalidVPS, err, unit)
+	}
+}
+
+func TestParsePPS(t *testing.T) {
+	pps, err := ParsePPS(ppsUnit)
+	assert.Nil(t, err)
+	assert.Equal(t, &PPS{
+		SignDataHidingEnabled:    true,
+		NumRefIdxL0DefaultActive: 1,
+		NumRefIdxL1DefaultActive: 1,
+		InitQp:                   26,
+		CuQpDeltaEnabled:         true,
+		DiffCuQpDeltaDepth:       1,
+		WeightedPred:             true,
+		EntropyCodingSyncEnabled: true,
+		NumTileColumns:           1,
+		NumTileRows:              1,
+	}, pps)
+
+	// 3x2 tiles of explicit sizes
+	w := &bitWriter{}
+	w.u(16, 0x4401)
+	w.ue(1).ue(2).u(1, 0).u(1, 0).u(3, 0).u(1, 0).u(1, 0).ue(0).ue(0).se(-4).u(1, 0).u(1, 0)
+	w.u(1, 0).se(1).se(-1).u(1, 0).u(1, 0).u(1, 0).u(1, 0)
+	w.u(1, 1).u(1, 0)
+	w.ue(2).ue(1).u(1, 0).ue(9).ue(9).ue(7).u(1, 1)
+
+	pps, err = ParsePPS(w.bytes())
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(1), pps.Id)
+	assert.Equal(t, uint32(2), pps.SpsId)
+	assert.Equal(t, int32(22), pps.InitQp)
+	assert.Equal(t, int32(1), pps.CbQpOffset)
+	assert.Equal(t, int32(-1), pps.CrQpOffset)
+	assert.True(t, pps.TilesEnabled)
+	assert.Equal(t, uint32(3), pps.NumTileColumns)
+	assert.Equal(t, uint32(2), pps.NumTileRows)
+	assert.True(t, pps.LoopFilterAcrossTilesEnabled)
+
+	for _, unit := range [][]byte{
+		{0x44, 0x01},
+		ppsUnit[:3],
+		// pps id 64
+		(&bitWriter{}).u(16, 0x4401).ue(64).ue(0).bytes(),
+	} {
+		_, err := ParsePPS(unit)
+		assert.Equal(t, ErrInvalidPPS, err, unit)
+	}
+}
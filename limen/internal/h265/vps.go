@@ -0,0 +1,83 @@
+package h265
+
+import (
+	"limen/internal/h264"
+	"limen/internal/util"
+)
+
+// VPS holds the fields of a video parameter set up to its timing,
+// the HRD parameters and extensions are skipped.
+type VPS struct {
+	Id                uint32
+	MaxLayers         uint32
+	MaxSubLayers      uint32
+	TemporalIdNesting bool
+	ProfileTierLevel  ProfileTierLevel
+
+	// timing, zero when not signalled
+	NumUnitsInTick uint32
+	TimeScale      uint32
+}
+
+// maximum number of layer sets
+const maxLayerSets = 1024
+
+// ParseVPS parses a video parameter set NAL unit including its header.
+func ParseVPS(unit []byte) (*VPS, error) {
+	if len(unit) < nalUnitHeaderSize+4 || UnitType(unit) != NALUnitTypeVPS {
+		return nil, ErrInvalidVPS
+	}
+
+	r := util.NewFieldReader(h264.Unescape(unit[nalUnitHeaderSize:]), ErrInvalidVPS)
+
+	vps := &VPS{Id: r.Bits(4)}
+
+	// vps_base_layer_internal_flag, vps_base_layer_available_flag
+	r.Bits(2)
+
+	vps.MaxLayers = r.Bits(6) + 1
+	vps.MaxSubLayers = r.Bits(3) + 1
+	vps.TemporalIdNesting = r.Flag()
+
+	// vps_reserved_0xffff_16bits
+	if r.Bits(16) != 0xffff || vps.MaxSubLayers > maxSubLayers {
+		return nil, ErrInvalidVPS
+	}
+
+	vps.ProfileTierLevel = parseProfileTierLevel(r, vps.MaxSubLayers-1)
+
+	// vps_sub_layer_ordering_info_present_flag
+	first := vps.MaxSubLayers - 1
+	if r.Flag() {
+		first = 0
+	}
+
+	for i := first; i < vps.MaxSubLayers; i++ {
+		// max_dec_pic_buffering_minus1, max_num_reorder_pics, max_latency_increase_plus1
+		r.UE()
+		r.UE()
+		r.UE()
+	}
+
+	maxLayerId := int(r.Bits(6))
+	layerSets := r.UE() + 1
+	if layerSets > maxLayerSets {
+		return nil, ErrInvalidVPS
+	}
+
+	for i := uint32(1); i < layerSets; i++ {
+		// layer_id_included_flag of every layer
+		r.Bits(maxLayerId + 1)
+	}
+
+	if r.Flag() {
+		vps.NumUnitsInTick = r.Bits(32)
+		vps.TimeScale = r.Bits(32)
+	}
+
+	if err := r.Err(); err != nil {
+		return nil, err
+	}
+
+	return vps, nil
+}
@@ -0,0 +1,257 @@
+package hls
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"limen/internal/flv"
+	"limen/internal/mpegts"
+	"limen/internal/registry"
+)
+
+const (
+	DefaultTargetDuration = 4 * time.Second
+	DefaultPlaylistSize   = 6
+
+	// segments which dropped out of the live playlist stay available
+	// for a while for clients that have just loaded an older playlist
+	retainedSegments = 2
+)
+
+// Segment is a single MPEG-TS file of a stream.
+type Segment struct {
+	Sequence int
+	Duration time.Duration
+	Data     []byte
+}
+
+// Packager cuts a stream into MPEG-TS segments and keeps the playlists
+// listing them, packets are written by a single goroutine while segments
+// and playlists can be read concurrently.
+//
+// Segments start with a keyframe, the current segment gets cut on the first
+// keyframe past the target duration, streams without video are cut on
+// any audio frame instead.
+type Packager struct {
+	options Options
+
+	buffer  bytes.Buffer
+	muxer   *mpegts.Muxer
+	started bool
+	// whether the video stream was part of the program at the segment start
+	segmentHasVideo bool
+	// timestamps in milliseconds
+	startDts      int
+	lastDts       int
+	frameDuration int
+
+	mu           sync.Mutex
+	segments     []*Segment
+	nextSequence int
+	ended        bool
+	// target duration of the playlists, it covers the longest segment
+	// so far as segments get cut on keyframes only, and never drops
+	targetDuration time.Duration
+}
+
+func NewPackager(options Options) *Packager {
+	options.setDefaults()
+
+	packager := &Packager{options: options, targetDuration: options.TargetDuration}
+	packager.muxer = mpegts.NewMuxer(&packager.buffer, mpegts.Options{})
+
+	return packager
+}
+
+// WritePacket adds a packet to the current segment, packets of unsupported
+// codecs are skipped and reported with mpegts.ErrUnsupportedCodec.
+func (p *Packager) WritePacket(packet *registry.Packet) error {
+	var packetType flv.PacketType
+
+	switch packet.Type {
+	case registry.VideoPacket:
+		packetType = flv.VideoPacket
+	case registry.AudioPacket:
+		packetType = flv.AudioPacket
+	default:
+		return nil
+	}
+
+	decoded, err := flv.DecodeTagData(packetType, packet.Data)
+	if err != nil {
+		return err
+	}
+	decoded.SetTimestamps(int(packet.Timestamp))
+
+	switch decoded.Type {
+	case flv.VideoConfigPacket, flv.AudioConfigPacket:
+		return p.muxer.WritePacket(decoded)
+
+	case flv.VideoSequenceEndPacket, flv.VideoMetadataPacket:
+		// they come only with extended video codecs, which are never muxed
+		return nil
+
+	case flv.VideoPacket:
+		if !p.muxer.HasVideo() {
+			return p.skip(decoded)
+		}
+
+		keyFrame := decoded.CodecParams.(*flv.VideoCodecParams).KeyFrame
+		if keyFrame && (!p.started || !p.segmentHasVideo || p.due(decoded.Dts)) {
+			if err := p.cut(decoded.Dts); err != nil {
+				return err
+			}
+		}
+
+		// frames preceding the first keyframe of the segment can't be decoded
+		if !p.started || !p.segmentHasVideo {
+			return nil
+		}
+
+	default:
+		if !p.muxer.HasAudio() {
+			return p.skip(decoded)
+		}
+
+		if !p.muxer.HasVideo() && (!p.started || p.due(decoded.Dts)) {
+			if err := p.cut(decoded.Dts); err != nil {
+				return err
+			}
+		}
+
+		if !p.started {
+			return nil
+		}
+	}
+
+	if err := p.muxer.WritePacket(decoded); err != nil {
+		return err
+	}
+
+	if decoded.Dts > p.lastDts {
+		p.frameDuration = decoded.Dts - p.lastDts
+		p.lastDts = decoded.Dts
+	}
+
+	return nil
+}
+
+// skip drops frames which arrive ahead of their codec configuration,
+// which never comes for unsupported codecs.
+func (p *Packager) skip(packet *flv.Packet) error {
+	if packet.Type == flv.VideoPacket && packet.Codec != flv.VideoCodecH264 ||
+		packet.Type == flv.AudioPacket && packet.Codec != flv.SoundTypeAAC {
+		return mpegts.ErrUnsupportedCodec
+	}
+
+	return nil
+}
+
+func (p *Packager) due(dts int) bool {
+	return time.Duration(dts-p.startDts)*time.Millisecond >= p.options.TargetDuration
+}
+
+// cut finishes the current segment and starts a new one at the given timestamp.
+func (p *Packager) cut(dts int) error {
+	if p.started {
+		p.finishSegment(dts - p.startDts)
+	}
+
+	p.started = true
+	p.segmentHasVideo = p.muxer.HasVideo()
+	p.startDts = dts
+	p.lastDts = dts
+
+	return p.muxer.WriteTables()
+}
+
+func (p *Packager) finishSegment(duration int) {
+	data := make([]byte, p.buffer.Len())
+	copy(data, p.buffer.Bytes())
+	p.buffer.Reset()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	segment := &Segment{
+		Sequence: p.nextSequence,
+		Duration: time.Duration(duration) * time.Millisecond,
+		Data:     data,
+	}
+
+	p.segments = append(p.segments, segment)
+	p.nextSequence++
+
+	if segment.Duration > p.targetDuration {
+		p.targetDuration = segment.Duration
+	}
+
+	if limit := p.options.PlaylistSize + retainedSegments; !p.options.VOD && len(p.segments) > limit {
+		p.segments = append([]*Segment(nil), p.segments[len(p.segments)-limit:]...)
+	}
+}
+
+// End finishes the last segment and marks the playlists as complete.
+func (p *Packager) End() {
+	if p.started {
+		p.finishSegment(p.lastDts - p.startDts + p.frameDuration)
+		p.started = false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ended = true
+}
+
+// Segment returns the segment with the given sequence number if it is still retained.
+func (p *Packager) Segment(sequence int) (*Segment, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, segment := range p.segments {
+		if segment.Sequence == sequence {
+			return segment, true
+		}
+	}
+
+	return nil, false
+}
+
+// Playlist renders the live media playlist with the most recent segments,
+// it returns false until the first segment is complete.
+func (p *Packager) Playlist() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.segments) == 0 {
+		return nil, false
+	}
+
+	segments := p.segments
+	if len(segments) > p.options.PlaylistSize {
+		segments = segments[len(segments)-p.options.PlaylistSize:]
+	}
+
+	return renderPlaylist(segments, p.targetDuration, "", p.ended), true
+}
+
+// VODPlaylist renders the playlist of all segments of the stream, it is
+// only available with the VOD option and once the first segment is complete.
+func (p *Packager) VODPlaylist() ([]byte, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.options.VOD || len(p.segments) == 0 {
+		return nil, false
+	}
+
+	// segments only get appended to the playlist until the stream ends
+	playlistType := "EVENT"
+	if p.ended {
+		playlistType = "VOD"
+	}
+
+	return renderPlaylist(p.segments, p.targetDuration, playlistType, p.ended), true
+}
@@ -0,0 +1,153 @@
+package hls
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/mpegts"
+	"limen/internal/packaging/packagingtest"
+	"limen/internal/registry"
+)
+
+func TestPackagerCutsSegmentsOnKeyframes(t *testing.T) {
+	packager := NewPackager(Options{TargetDuration: 1500 * time.Millisecond})
+
+	_, ok := packager.Playlist()
+	assert.False(t, ok)
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	packagingtest.WriteVideo(t, packager, 0, 4500)
+	packager.End()
+
+	var durations []time.Duration
+	for sequence := 0; sequence < 3; sequence++ {
+		segment, ok := packager.Segment(sequence)
+		assert.True(t, ok)
+		durations = append(durations, segment.Duration)
+	}
+
+	// the target is passed on the keyframes at 2s and 4s
+	assert.Equal(t, []time.Duration{2 * time.Second, 2 * time.Second, 500 * time.Millisecond}, durations)
+
+	playlist, ok := packager.Playlist()
+	assert.True(t, ok)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:2\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXTINF:2.000,\n0.ts\n"+
+		"#EXTINF:2.000,\n1.ts\n"+
+		"#EXTINF:0.500,\n2.ts\n"+
+		"#EXT-X-ENDLIST\n", string(playlist))
+
+	// not kept without the VOD option
+	_, ok = packager.VODPlaylist()
+	assert.False(t, ok)
+}
+
+func TestPackagerSlidingWindow(t *testing.T) {
+	packager := NewPackager(Options{TargetDuration: time.Second, PlaylistSize: 2})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	packagingtest.WriteVideo(t, packager, 0, 6100)
+
+	playlist, ok := packager.Playlist()
+	assert.True(t, ok)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:4\n"+
+		"#EXTINF:1.000,\n4.ts\n"+
+		"#EXTINF:1.000,\n5.ts\n", string(playlist))
+
+	// recently removed segments are still served
+	_, ok = packager.Segment(2)
+	assert.True(t, ok)
+	_, ok = packager.Segment(1)
+	assert.False(t, ok)
+}
+
+func TestPackagerTargetDurationNeverDrops(t *testing.T) {
+	packager := NewPackager(Options{TargetDuration: time.Second, PlaylistSize: 2})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+
+	// a 3 second GOP followed by 1 second ones
+	for timestamp := uint32(0); timestamp < 6100; timestamp += 100 {
+		keyFrame := timestamp == 0 || timestamp >= 3000 && timestamp%1000 == 0
+		err := packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: timestamp, Data: packagingtest.VideoTag(keyFrame, 0)})
+		assert.Nil(t, err)
+	}
+
+	// the long segment has left the window but still sets the target
+	playlist, ok := packager.Playlist()
+	assert.True(t, ok)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:3\n"+
+		"#EXT-X-MEDIA-SEQUENCE:2\n"+
+		"#EXTINF:1.000,\n2.ts\n"+
+		"#EXTINF:1.000,\n3.ts\n", string(playlist))
+}
+
+func TestPackagerVODPlaylist(t *testing.T) {
+	packager := NewPackager(Options{TargetDuration: time.Second, PlaylistSize: 1, VOD: true})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag}))
+	packagingtest.WriteVideo(t, packager, 0, 2100)
+
+	playlist, ok := packager.VODPlaylist()
+	assert.True(t, ok)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-PLAYLIST-TYPE:EVENT\n"+
+		"#EXTINF:1.000,\n0.ts\n"+
+		"#EXTINF:1.000,\n1.ts\n", string(playlist))
+
+	packager.End()
+
+	playlist, ok = packager.VODPlaylist()
+	assert.True(t, ok)
+	assert.Equal(t, "#EXTM3U\n"+
+		"#EXT-X-VERSION:3\n"+
+		"#EXT-X-TARGETDURATION:1\n"+
+		"#EXT-X-MEDIA-SEQUENCE:0\n"+
+		"#EXT-X-PLAYLIST-TYPE:VOD\n"+
+		"#EXTINF:1.000,\n0.ts\n"+
+		"#EXTINF:1.000,\n1.ts\n"+
+		"#EXTINF:0.100,\n2.ts\n"+
+		"#EXT-X-ENDLIST\n", string(playlist))
+
+	_, ok = packager.Segment(0)
+	assert.True(t, ok)
+}
+
+func TestPackagerAudioOnly(t *testing.T) {
+	packager := NewPackager(Options{TargetDuration: time.Second})
+
+	assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: packagingtest.AACConfigTag}))
+	for timestamp := uint32(0); timestamp < 1500; timestamp += 23 {
+		assert.Nil(t, packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Timestamp: timestamp, Data: packagingtest.AACFrameTag}))
+	}
+	packager.End()
+
+	segment, ok := packager.Segment(0)
+	assert.True(t, ok)
+	assert.Equal(t, 1012*time.Millisecond, segment.Duration)
+
+	// segments start with the PAT
+	assert.Equal(t, []byte{0x47, 0x40, 0x00}, segment.Data[:3])
+	assert.Equal(t, 0, len(segment.Data)%mpegts.PacketSize)
+}
+
+func TestPackagerUnsupportedCodec(t *testing.T) {
+	packager := NewPackager(Options{})
+
+	// MP3
+	err := packager.WritePacket(&registry.Packet{Type: registry.AudioPacket, Data: []byte{0x2f, 0xff, 0xfb}})
+	assert.Equal(t, mpegts.ErrUnsupportedCodec, err)
+}
@@ -0,0 +1,34 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"time"
+)
+
+// renderPlaylist renders a version 3 media playlist, the target duration
+// must not change between reloads of the playlist (RFC 8216 6.2.1).
+func renderPlaylist(segments []*Segment, targetDuration time.Duration, playlistType string, ended bool) []byte {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXTM3U\n")
+	buffer.WriteString("#EXT-X-VERSION:3\n")
+	fmt.Fprintf(&buffer, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration.Seconds())))
+	fmt.Fprintf(&buffer, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].Sequence)
+
+	if playlistType != "" {
+		fmt.Fprintf(&buffer, "#EXT-X-PLAYLIST-TYPE:%s\n", playlistType)
+	}
+
+	for _, segment := range segments {
+		fmt.Fprintf(&buffer, "#EXTINF:%.3f,\n", segment.Duration.Seconds())
+		fmt.Fprintf(&buffer, "%d.ts\n", segment.Sequence)
+	}
+
+	if ended {
+		buffer.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return buffer.Bytes()
+}
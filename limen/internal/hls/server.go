@@ -0,0 +1,146 @@
+package hls
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"limen/internal/packaging"
+	"limen/internal/registry"
+)
+
+type Options struct {
+	// TargetDuration is the duration after which segments get cut
+	// on the next keyframe, zero means the default.
+	TargetDuration time.Duration
+	// PlaylistSize is the number of segments in the live playlist,
+	// zero means the default.
+	PlaylistSize int
+	// VOD keeps every segment of a stream in memory and serves
+	// them in a playlist covering the whole stream.
+	VOD bool
+	// Retention is how long the playlists of an ended stream stay
+	// available, zero means the default.
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+func (o *Options) setDefaults() {
+	if o.TargetDuration <= 0 {
+		o.TargetDuration = DefaultTargetDuration
+	}
+
+	if o.PlaylistSize <= 0 {
+		o.PlaylistSize = DefaultPlaylistSize
+	}
+}
+
+// Server packages every published stream and serves it over HTTP as
+// "/{app}/{name}/index.m3u8" with segments next to the playlist,
+// the VOD playlist is served as "/{app}/{name}/vod.m3u8".
+type Server struct {
+	outputs *packaging.Manager
+}
+
+func NewServer(streams *registry.Registry, options Options) *Server {
+	options.setDefaults()
+
+	newPackager := func() packaging.Packager {
+		return NewPackager(options)
+	}
+
+	return &Server{
+		outputs: packaging.NewManager(streams, newPackager, packaging.Options{
+			Format:    "HLS",
+			Retention: options.Retention,
+			Logger:    options.Logger,
+		}),
+	}
+}
+
+// Start begins packaging the live and future streams for HLS.
+func (s *Server) Start() {
+	s.outputs.Start()
+}
+
+// Close stops packaging, it returns once all packagers have ended.
+func (s *Server) Close() {
+	s.outputs.Close()
+}
+
+func (s *Server) packager(key registry.Key) (*Packager, bool) {
+	packager, ok := s.outputs.Packager(key)
+	if !ok {
+		return nil, false
+	}
+
+	return packager.(*Packager), true
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	// players are usually served from a different origin
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) < 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := registry.Key{App: strings.Join(parts[:len(parts)-2], "/"), Name: parts[len(parts)-2]}
+	file := parts[len(parts)-1]
+
+	packager, ok := s.packager(key)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case file == "index.m3u8" || file == "vod.m3u8":
+		var playlist []byte
+		if file == "index.m3u8" {
+			playlist, ok = packager.Playlist()
+		} else {
+			playlist, ok = packager.VODPlaylist()
+		}
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(playlist)
+
+	case strings.HasSuffix(file, ".ts"):
+		sequence, err := strconv.Atoi(strings.TrimSuffix(file, ".ts"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		segment, ok := packager.Segment(sequence)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		// segment names get reused once the stream is published again
+		w.Header().Set("Content-Type", "video/mp2t")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Write(segment.Data)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -0,0 +1,98 @@
+package hls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/mpegts"
+	"limen/internal/packaging/packagingtest"
+	"limen/internal/registry"
+)
+
+func TestServerServesPublishedStreams(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	hls := NewServer(streams, Options{TargetDuration: time.Second, VOD: true})
+	hls.Start()
+	defer hls.Close()
+
+	server := httptest.NewServer(hls)
+	defer server.Close()
+
+	status, _, _ := packagingtest.Get(t, server, "/live/key/index.m3u8")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag})
+	for timestamp := uint32(0); timestamp <= 1000; timestamp += 100 {
+		stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: timestamp, Data: packagingtest.VideoTag(timestamp%1000 == 0, 0)})
+	}
+
+	assert.Eventually(t, func() bool {
+		status, _, _ := packagingtest.Get(t, server, "/live/key/index.m3u8")
+		return status == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	status, playlist, header := packagingtest.Get(t, server, "/live/key/index.m3u8")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "application/vnd.apple.mpegurl", header.Get("Content-Type"))
+	assert.Equal(t, "*", header.Get("Access-Control-Allow-Origin"))
+	assert.Contains(t, playlist, "#EXTINF:1.000,\n0.ts\n")
+	assert.NotContains(t, playlist, "#EXT-X-ENDLIST")
+
+	status, segment, header := packagingtest.Get(t, server, "/live/key/0.ts")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "video/mp2t", header.Get("Content-Type"))
+	assert.Equal(t, 0, len(segment)%mpegts.PacketSize)
+
+	for _, path := range []string{"/live/key/1.ts", "/live/key/x.ts", "/live/other/index.m3u8", "/live/key/index.mpd", "/key"} {
+		status, _, _ = packagingtest.Get(t, server, path)
+		assert.Equal(t, http.StatusNotFound, status, path)
+	}
+
+	stream.Unpublish()
+
+	// playlists of ended streams stay available
+	assert.Eventually(t, func() bool {
+		_, playlist, _ := packagingtest.Get(t, server, "/live/key/vod.m3u8")
+		return strings.HasSuffix(playlist, "#EXTINF:0.100,\n1.ts\n#EXT-X-ENDLIST\n")
+	}, time.Second, 10*time.Millisecond)
+
+	response, err := http.Post(server.URL+"/live/key/index.m3u8", "text/plain", nil)
+	assert.Nil(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func TestServerDropsEndedStreamsAfterRetention(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	hls := NewServer(streams, Options{TargetDuration: time.Second, Retention: 200 * time.Millisecond})
+	hls.Start()
+	defer hls.Close()
+
+	server := httptest.NewServer(hls)
+	defer server.Close()
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.AVCConfigTag})
+	stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: 0, Data: packagingtest.VideoTag(true, 0)})
+	stream.Unpublish()
+
+	assert.Eventually(t, func() bool {
+		_, playlist, _ := packagingtest.Get(t, server, "/live/key/index.m3u8")
+		return strings.HasSuffix(playlist, "#EXT-X-ENDLIST\n")
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		status, _, _ := packagingtest.Get(t, server, "/live/key/index.m3u8")
+		return status == http.StatusNotFound
+	}, time.Second, 10*time.Millisecond)
+}
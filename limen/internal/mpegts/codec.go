@@ -0,0 +1,41 @@
+package mpegts
+
+import (
+	"limen/internal/h264"
+)
+
+// access unit delimiter allowing any slice type
+var accessUnitDelimiter = []byte{byte(h264.NALUnitTypeAUD), 0xf0}
+
+// annexB converts a length prefixed access unit into the Annex B format.
+//
+// Every access unit starts with a delimiter, keyframes get the parameter
+// sets inserted after it unless they carry their own.
+func annexB(config *h264.DecoderConfigurationRecord, data []byte, keyFrame bool) ([]byte, error) {
+	units, err := h264.SplitAVCC(data, config.LengthSize)
+	if err != nil {
+		return nil, ErrInvalidNALUnit
+	}
+
+	out := [][]byte{accessUnitDelimiter}
+	hasParameterSets := false
+
+	for _, unit := range units {
+		switch h264.UnitType(unit) {
+		case h264.NALUnitTypeSPS, h264.NALUnitTypePPS:
+			hasParameterSets = true
+		case h264.NALUnitTypeAUD:
+			// replaced by the leading delimiter
+			continue
+		}
+
+		out = append(out, unit)
+	}
+
+	if keyFrame && !hasParameterSets {
+		sets := append(append([][]byte{}, config.SPS...), config.PPS...)
+		out = append(out[:1], append(sets, out[1:]...)...)
+	}
+
+	return h264.JoinAnnexB(out), nil
+}
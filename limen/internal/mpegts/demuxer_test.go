@@ -0,0 +1,221 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// demuxer reads back what the muxer writes, it validates the packet
+// structure, continuity counters and section CRCs along the way.
+type demuxer struct {
+	pmtPid  uint16
+	pcrPid  uint16
+	streams map[uint16]byte
+	// versions of every PMT seen in order
+	pmtVersions []uint8
+	pcrs        []uint64
+	pes         []*pesPacket
+
+	continuity map[uint16]uint8
+	pending    map[uint16]*pesPacket
+}
+
+type pesPacket struct {
+	pid          uint16
+	streamId     byte
+	length       int
+	pts          uint64
+	dts          uint64
+	randomAccess bool
+	data         []byte
+}
+
+func demux(data []byte) (*demuxer, error) {
+	d := &demuxer{
+		streams:    make(map[uint16]byte),
+		continuity: make(map[uint16]uint8),
+		pending:    make(map[uint16]*pesPacket),
+	}
+
+	if len(data)%PacketSize != 0 {
+		return nil, errors.New("truncated packet")
+	}
+
+	for ; len(data) > 0; data = data[PacketSize:] {
+		if err := d.readPacket(data[:PacketSize]); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pid := range []uint16{videoPid, audioPid} {
+		if err := d.finishPES(pid); err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+func (d *demuxer) readPacket(packet []byte) error {
+	if packet[0] != 0x47 {
+		return errors.New("missing sync byte")
+	}
+
+	pid := binary.BigEndian.Uint16(packet[1:3]) & 0x1fff
+	unitStart := packet[1]&0x40 != 0
+	counter := packet[3] & 0x0f
+
+	if expected, ok := d.continuity[pid]; ok && expected != counter {
+		return fmt.Errorf("continuity counter of pid %d is %d instead of %d", pid, counter, expected)
+	}
+	d.continuity[pid] = (counter + 1) & 0x0f
+
+	if packet[3]&0x10 == 0 {
+		return errors.New("packet without payload")
+	}
+
+	payload := packet[4:]
+	randomAccess := false
+
+	if packet[3]&0x20 != 0 {
+		length := int(payload[0])
+		if length > 0 {
+			field := payload[1 : 1+length]
+			randomAccess = field[0]&0x40 != 0
+
+			if field[0]&0x10 != 0 {
+				pcr := uint64(field[1])<<25 | uint64(field[2])<<17 | uint64(field[3])<<9 | uint64(field[4])<<1 | uint64(field[5]>>7)
+				d.pcrs = append(d.pcrs, pcr)
+			}
+
+			for _, b := range field[1:] {
+				if field[0]&0x10 == 0 && b != 0xff {
+					return errors.New("invalid stuffing")
+				}
+			}
+		}
+
+		payload = payload[1+length:]
+	}
+
+	switch {
+	case pid == patPid:
+		section, err := readSection(payload, 0x00)
+		if err != nil {
+			return err
+		}
+
+		d.pmtPid = binary.BigEndian.Uint16(section[5:7]) & 0x1fff
+
+	case pid == d.pmtPid:
+		section, err := readSection(payload, 0x02)
+		if err != nil {
+			return err
+		}
+
+		d.pmtVersions = append(d.pmtVersions, section[0]>>1&0x1f)
+		d.pcrPid = binary.BigEndian.Uint16(section[3:5]) & 0x1fff
+		d.streams = make(map[uint16]byte)
+
+		for entries := section[7:]; len(entries) >= 5; entries = entries[5:] {
+			d.streams[binary.BigEndian.Uint16(entries[1:3])&0x1fff] = entries[0]
+		}
+
+	default:
+		if _, ok := d.streams[pid]; !ok {
+			return fmt.Errorf("pid %d is not in the program", pid)
+		}
+
+		if unitStart {
+			if err := d.finishPES(pid); err != nil {
+				return err
+			}
+
+			return d.startPES(pid, payload, randomAccess)
+		}
+
+		current, ok := d.pending[pid]
+		if !ok {
+			return errors.New("continuation without a PES start")
+		}
+		current.data = append(current.data, payload...)
+	}
+
+	return nil
+}
+
+// readSection returns the section from the version byte on without the CRC.
+func readSection(payload []byte, tableId byte) ([]byte, error) {
+	section := payload[1+int(payload[0]):]
+	if section[0] != tableId {
+		return nil, fmt.Errorf("unexpected table %d", section[0])
+	}
+
+	length := int(binary.BigEndian.Uint16(section[1:3]) & 0x0fff)
+	section = section[:3+length]
+
+	if crc32(section[:len(section)-4]) != binary.BigEndian.Uint32(section[len(section)-4:]) {
+		return nil, errors.New("invalid section CRC")
+	}
+
+	return section[5 : len(section)-4], nil
+}
+
+func (d *demuxer) startPES(pid uint16, payload []byte, randomAccess bool) error {
+	if payload[0] != 0x00 || payload[1] != 0x00 || payload[2] != 0x01 {
+		return errors.New("missing PES start code")
+	}
+
+	current := &pesPacket{
+		pid:          pid,
+		streamId:     payload[3],
+		length:       int(binary.BigEndian.Uint16(payload[4:6])),
+		randomAccess: randomAccess,
+	}
+
+	headerLength := int(payload[8])
+	switch payload[7] >> 6 {
+	case 0x2:
+		current.pts = readTimestamp(payload[9:14])
+		current.dts = current.pts
+	case 0x3:
+		current.pts = readTimestamp(payload[9:14])
+		current.dts = readTimestamp(payload[14:19])
+	default:
+		return errors.New("PES without timestamps")
+	}
+
+	current.data = append([]byte(nil), payload[9+headerLength:]...)
+	d.pending[pid] = current
+	// kept in the order of their start
+	d.pes = append(d.pes, current)
+
+	return nil
+}
+
+func (d *demuxer) finishPES(pid uint16) error {
+	current, ok := d.pending[pid]
+	if !ok {
+		return nil
+	}
+	delete(d.pending, pid)
+
+	if current.length != 0 && current.length != 3+len(current.data)+headerExtension(current) {
+		return errors.New("PES length mismatch")
+	}
+
+	return nil
+}
+
+func headerExtension(packet *pesPacket) int {
+	if packet.pts != packet.dts {
+		return 10
+	}
+
+	return 5
+}
+
+func readTimestamp(data []byte) uint64 {
+	return uint64(data[0]>>1&0x07)<<30 | uint64(data[1])<<22 | uint64(data[2]>>1)<<15 | uint64(data[3])<<7 | uint64(data[4]>>1)
+}
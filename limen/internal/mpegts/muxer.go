@@ -0,0 +1,408 @@
+package mpegts
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"limen/internal/aac"
+	"limen/internal/flv"
+	"limen/internal/h264"
+)
+
+const (
+	PacketSize = 188
+
+	headerSize  = 4
+	payloadSize = PacketSize - headerSize
+
+	patPid   = 0x0000
+	pmtPid   = 0x1000
+	videoPid = 0x0100
+	audioPid = 0x0101
+
+	programNumber = 0x0001
+
+	streamTypeH264 = 0x1b
+	streamTypeAAC  = 0x0f
+
+	streamIdVideo = 0xe0
+	streamIdAudio = 0xc0
+
+	// timestamps are delayed against the PCR so that the decoder
+	// receives frames before they are due, 700ms in the 90kHz clock
+	timestampDelay = 63000
+
+	timestampMask = 0x1ffffffff
+)
+
+var (
+	ErrUnsupportedCodec = errors.New("mpegts: unsupported codec, only H.264 and AAC can be muxed")
+	ErrMissingConfig    = errors.New("mpegts: frame written before the codec configuration")
+	ErrInvalidAVCConfig = errors.New("mpegts: invalid AVC decoder configuration record")
+	ErrInvalidAACConfig = errors.New("mpegts: invalid AAC audio specific config")
+	ErrInvalidNALUnit   = errors.New("mpegts: invalid NAL unit length")
+	ErrFrameTooLarge    = errors.New("mpegts: AAC frame too large for ADTS")
+)
+
+type Options struct {
+	// TablesInterval repeats the PAT and the PMT once the given stream time
+	// passes, zero writes them ahead of the first frame and whenever the
+	// program changes only, WriteTables repeats them on demand.
+	TablesInterval time.Duration
+}
+
+// Muxer writes H.264 and AAC packets as a single program transport stream.
+//
+// The program consists of the streams whose configuration packets were
+// written, the PCR is carried by the video stream if there is one.
+type Muxer struct {
+	writer  io.Writer
+	options Options
+
+	video *h264.DecoderConfigurationRecord
+	audio *aac.ADTSHeader
+
+	continuity    map[uint16]uint8
+	pmtVersion    uint8
+	tablesWritten bool
+	// stream time of the last tables in milliseconds
+	tablesDts int
+	buffer    []byte
+}
+
+func NewMuxer(writer io.Writer, options Options) *Muxer {
+	return &Muxer{
+		writer:     writer,
+		options:    options,
+		continuity: make(map[uint16]uint8),
+	}
+}
+
+func (m *Muxer) HasVideo() bool {
+	return m.video != nil
+}
+
+func (m *Muxer) HasAudio() bool {
+	return m.audio != nil
+}
+
+// WritePacket writes a single decoded FLV packet, configuration packets
+// add the stream to the program or replace its configuration.
+func (m *Muxer) WritePacket(packet *flv.Packet) error {
+	switch packet.Type {
+	case flv.VideoConfigPacket, flv.VideoPacket:
+		if packet.Codec != flv.VideoCodecH264 {
+			return ErrUnsupportedCodec
+		}
+	case flv.AudioConfigPacket, flv.AudioPacket:
+		if packet.Codec != flv.SoundTypeAAC {
+			return ErrUnsupportedCodec
+		}
+	default:
+		return ErrUnsupportedCodec
+	}
+
+	switch packet.Type {
+	case flv.VideoConfigPacket:
+		config, err := h264.ParseDecoderConfigurationRecord(packet.Data)
+		if err != nil {
+			return ErrInvalidAVCConfig
+		}
+
+		m.updateProgram(m.video == nil)
+		m.video = config
+		return nil
+
+	case flv.AudioConfigPacket:
+		format, err := aac.ParseAudioSpecificConfig(packet.Data)
+		if err != nil {
+			return ErrInvalidAACConfig
+		}
+
+		// AAC is carried in ADTS frames
+		config, err := aac.NewADTSHeader(format)
+		if err != nil {
+			return ErrInvalidAACConfig
+		}
+
+		m.updateProgram(m.audio == nil)
+		m.audio = config
+		return nil
+
+	case flv.VideoPacket:
+		if m.video == nil {
+			return ErrMissingConfig
+		}
+
+		keyFrame := false
+		if params, ok := packet.CodecParams.(*flv.VideoCodecParams); ok {
+			keyFrame = params.KeyFrame
+		}
+
+		data, err := annexB(m.video, packet.Data, keyFrame)
+		if err != nil {
+			return err
+		}
+
+		m.writeTablesIfDue(packet.Dts)
+		m.writePES(videoPid, streamIdVideo, packet.Pts, packet.Dts, keyFrame, data)
+
+	default:
+		if m.audio == nil {
+			return ErrMissingConfig
+		}
+
+		data, err := m.audio.Encode(packet.Data)
+		if err != nil {
+			return ErrFrameTooLarge
+		}
+
+		m.writeTablesIfDue(packet.Dts)
+		m.writePES(audioPid, streamIdAudio, packet.Pts, packet.Dts, false, data)
+	}
+
+	return m.flush()
+}
+
+// WriteTables writes the PAT and the PMT, e.g. at the start of a segment
+// which has to be decodable on its own.
+func (m *Muxer) WriteTables() error {
+	m.writeTables()
+	return m.flush()
+}
+
+// updateProgram makes the next frame carry new tables when a stream gets added.
+func (m *Muxer) updateProgram(added bool) {
+	if added && m.tablesWritten {
+		m.pmtVersion = (m.pmtVersion + 1) & 0x1f
+		m.tablesWritten = false
+	}
+}
+
+func (m *Muxer) writeTablesIfDue(dts int) {
+	interval := int(m.options.TablesInterval / time.Millisecond)
+
+	if !m.tablesWritten || (interval > 0 && dts-m.tablesDts >= interval) {
+		m.writeTables()
+		m.tablesDts = dts
+	}
+}
+
+func (m *Muxer) flush() error {
+	if len(m.buffer) == 0 {
+		return nil
+	}
+
+	_, err := m.writer.Write(m.buffer)
+	m.buffer = m.buffer[:0]
+
+	return err
+}
+
+func (m *Muxer) pcrPid() uint16 {
+	if m.video != nil {
+		return videoPid
+	}
+
+	return audioPid
+}
+
+func (m *Muxer) writeTables() {
+	pat := []byte{
+		byte(programNumber >> 8), byte(programNumber),
+		// reserved bits and the PMT pid
+		0xe0 | pmtPid>>8, pmtPid & 0xff,
+	}
+	m.writeSection(patPid, 0x00, 0x0001, 0, pat)
+
+	pmt := []byte{
+		// reserved bits and the PCR pid
+		0xe0 | byte(m.pcrPid()>>8), byte(m.pcrPid()),
+		// reserved bits and no program info
+		0xf0, 0x00,
+	}
+
+	if m.video != nil {
+		pmt = append(pmt, streamTypeH264, 0xe0|videoPid>>8, videoPid&0xff, 0xf0, 0x00)
+	}
+
+	if m.audio != nil {
+		pmt = append(pmt, streamTypeAAC, 0xe0|audioPid>>8, audioPid&0xff, 0xf0, 0x00)
+	}
+
+	m.writeSection(pmtPid, 0x02, programNumber, m.pmtVersion, pmt)
+	m.tablesWritten = true
+}
+
+// writeSection writes a PSI section which has to fit in a single packet.
+func (m *Muxer) writeSection(pid uint16, tableId byte, tableIdExtension uint16, version uint8, data []byte) {
+	// everything following the section length plus the CRC
+	length := 5 + len(data) + 4
+
+	section := make([]byte, 0, 3+length)
+	section = append(section,
+		tableId,
+		// section syntax indicator, reserved bits and the length
+		0xb0|byte(length>>8), byte(length),
+		byte(tableIdExtension>>8), byte(tableIdExtension),
+		// reserved bits, version and the current flag
+		0xc1|version<<1,
+		// section number and last section number
+		0x00, 0x00,
+	)
+	section = append(section, data...)
+	section = binary.BigEndian.AppendUint32(section, crc32(section))
+
+	packet := m.nextPacket()
+	m.writeHeader(packet, pid, true, false)
+	// pointer field
+	packet[4] = 0x00
+	n := copy(packet[5:], section)
+	for i := 5 + n; i < PacketSize; i++ {
+		packet[i] = 0xff
+	}
+}
+
+// writePES writes a single access unit split into as many transport
+// packets as needed, timestamps are in milliseconds.
+func (m *Muxer) writePES(pid uint16, streamId byte, pts, dts int, keyFrame bool, data []byte) {
+	pcr := toClock(dts)
+	dtsClock := (pcr + timestampDelay) & timestampMask
+	ptsClock := (toClock(pts) + timestampDelay) & timestampMask
+
+	header := []byte{0x00, 0x00, 0x01, streamId, 0x00, 0x00, 0x80}
+	if pts != dts {
+		header = append(header, 0xc0, 10)
+		header = appendTimestamp(header, 0x3, ptsClock)
+		header = appendTimestamp(header, 0x1, dtsClock)
+	} else {
+		header = append(header, 0x80, 5)
+		header = appendTimestamp(header, 0x2, ptsClock)
+	}
+
+	// video PES packets may have an unbounded length
+	if length := len(header) - 6 + len(data); length <= 0xffff && streamId != streamIdVideo {
+		binary.BigEndian.PutUint16(header[4:6], uint16(length))
+	}
+
+	payload := append(header, data...)
+	withPcr := pid == m.pcrPid()
+
+	for first := true; len(payload) > 0; first = false {
+		packet := m.nextPacket()
+
+		adaptationSize := 0
+		if first && (withPcr || keyFrame) {
+			adaptationSize = 2
+			if withPcr {
+				adaptationSize += 6
+			}
+		}
+
+		// the last packet gets padded with stuffing bytes
+		if remaining := payloadSize - adaptationSize; len(payload) < remaining {
+			adaptationSize += remaining - len(payload)
+		}
+
+		m.writeHeader(packet, pid, first, adaptationSize > 0)
+
+		if adaptationSize > 0 {
+			writeAdaptationField(packet[headerSize:headerSize+adaptationSize], first && withPcr, pcr, first && keyFrame)
+		}
+
+		n := copy(packet[headerSize+adaptationSize:], payload)
+		payload = payload[n:]
+	}
+}
+
+// nextPacket appends a packet to the buffer and returns it for filling in.
+func (m *Muxer) nextPacket() []byte {
+	m.buffer = append(m.buffer, make([]byte, PacketSize)...)
+	return m.buffer[len(m.buffer)-PacketSize:]
+}
+
+func (m *Muxer) writeHeader(packet []byte, pid uint16, unitStart bool, adaptation bool) {
+	packet[0] = 0x47
+	packet[1] = byte(pid >> 8)
+	if unitStart {
+		packet[1] |= 0x40
+	}
+	packet[2] = byte(pid)
+
+	counter := m.continuity[pid]
+	m.continuity[pid] = (counter + 1) & 0x0f
+
+	// payload only or adaptation field followed by payload
+	packet[3] = 0x10 | counter
+	if adaptation {
+		packet[3] |= 0x20
+	}
+}
+
+// writeAdaptationField fills the whole field with stuffing after the flags,
+// a single byte long field consists of its length only.
+func writeAdaptationField(field []byte, withPcr bool, pcr uint64, randomAccess bool) {
+	field[0] = byte(len(field) - 1)
+	if len(field) == 1 {
+		return
+	}
+
+	field[1] = 0x00
+	offset := 2
+
+	if randomAccess {
+		field[1] |= 0x40
+	}
+
+	if withPcr {
+		field[1] |= 0x10
+
+		field[2] = byte(pcr >> 25)
+		field[3] = byte(pcr >> 17)
+		field[4] = byte(pcr >> 9)
+		field[5] = byte(pcr >> 1)
+		// reserved bits and a zero extension
+		field[6] = byte(pcr<<7) | 0x7e
+		field[7] = 0x00
+		offset = 8
+	}
+
+	for i := offset; i < len(field); i++ {
+		field[i] = 0xff
+	}
+}
+
+// toClock converts milliseconds into the 33 bit wide 90kHz clock.
+func toClock(milliseconds int) uint64 {
+	return uint64(int64(milliseconds)*90) & timestampMask
+}
+
+func appendTimestamp(data []byte, prefix byte, timestamp uint64) []byte {
+	return append(data,
+		prefix<<4|byte(timestamp>>29)&0x0e|0x01,
+		byte(timestamp>>22),
+		byte(timestamp>>14)|0x01,
+		byte(timestamp>>7),
+		byte(timestamp<<1)|0x01,
+	)
+}
+
+// crc32 is the MPEG-2 variant used by PSI sections.
+func crc32(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
@@ -0,0 +1,235 @@
+package mpegts
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/aac"
+	"limen/internal/flv"
+)
+
+var (
+	avcConfigRecord = []byte{
+		// version, profile, compatibility, level, 4 byte lengths
+		0x01, 0x64, 0x00, 0x1f, 0xff,
+		// single SPS
+		0xe1, 0x00, 0x04, 0x67, 0x64, 0x00, 0x1f,
+		// single PPS
+		0x01, 0x00, 0x02, 0x68, 0xee,
+	}
+	// AAC LC, 44100Hz, stereo
+	audioSpecificConfig = []byte{0x12, 0x10}
+)
+
+func videoConfigPacket() *flv.Packet {
+	return &flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecH264, Data: avcConfigRecord, CodecParams: &flv.VideoCodecParams{KeyFrame: true}}
+}
+
+func audioConfigPacket() *flv.Packet {
+	return &flv.Packet{Type: flv.AudioConfigPacket, Codec: flv.SoundTypeAAC, Data: audioSpecificConfig}
+}
+
+func videoPacket(dts, pts int, keyFrame bool, units ...[]byte) *flv.Packet {
+	var data []byte
+	for _, unit := range units {
+		data = append(data, byte(len(unit)>>24), byte(len(unit)>>16), byte(len(unit)>>8), byte(len(unit)))
+		data = append(data, unit...)
+	}
+
+	return &flv.Packet{
+		Type:        flv.VideoPacket,
+		Codec:       flv.VideoCodecH264,
+		Data:        data,
+		Dts:         dts,
+		Pts:         pts,
+		CodecParams: &flv.VideoCodecParams{KeyFrame: keyFrame, CompositionTime: pts - dts},
+	}
+}
+
+func audioPacket(timestamp int, data []byte) *flv.Packet {
+	return &flv.Packet{Type: flv.AudioPacket, Codec: flv.SoundTypeAAC, Data: data, Dts: timestamp, Pts: timestamp}
+}
+
+func TestMuxVideoAndAudio(t *testing.T) {
+	var output bytes.Buffer
+	muxer := NewMuxer(&output, Options{})
+
+	assert.False(t, muxer.HasVideo())
+	assert.Nil(t, muxer.WritePacket(videoConfigPacket()))
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.True(t, muxer.HasVideo())
+	assert.True(t, muxer.HasAudio())
+
+	// configuration alone doesn't produce any output
+	assert.Equal(t, 0, output.Len())
+
+	assert.Nil(t, muxer.WritePacket(videoPacket(1000, 1080, true, []byte{0x65, 0x88})))
+	assert.Nil(t, muxer.WritePacket(audioPacket(1010, []byte{0x21, 0x00, 0x03})))
+	// the delimiter of the encoder gets replaced
+	assert.Nil(t, muxer.WritePacket(videoPacket(1040, 1040, false, []byte{0x09, 0x30}, []byte{0x41, 0x9a})))
+
+	demuxed, err := demux(output.Bytes())
+	assert.Nil(t, err)
+
+	assert.Equal(t, uint16(pmtPid), demuxed.pmtPid)
+	assert.Equal(t, uint16(videoPid), demuxed.pcrPid)
+	assert.Equal(t, map[uint16]byte{videoPid: streamTypeH264, audioPid: streamTypeAAC}, demuxed.streams)
+	// the PCR is sent with every video frame and it runs ahead of the timestamps
+	assert.Equal(t, []uint64{1000 * 90, 1040 * 90}, demuxed.pcrs)
+
+	assert.Equal(t, []*pesPacket{
+		{
+			pid:          videoPid,
+			streamId:     streamIdVideo,
+			pts:          1080*90 + timestampDelay,
+			dts:          1000*90 + timestampDelay,
+			randomAccess: true,
+			data: []byte{
+				0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+				0x00, 0x00, 0x00, 0x01, 0x67, 0x64, 0x00, 0x1f,
+				0x00, 0x00, 0x00, 0x01, 0x68, 0xee,
+				0x00, 0x00, 0x00, 0x01, 0x65, 0x88,
+			},
+		},
+		{
+			pid:      audioPid,
+			streamId: streamIdAudio,
+			length:   18,
+			pts:      1010*90 + timestampDelay,
+			dts:      1010*90 + timestampDelay,
+			data:     []byte{0xff, 0xf1, 0x50, 0x80, 0x01, 0x5f, 0xfc, 0x21, 0x00, 0x03},
+		},
+		{
+			pid:      videoPid,
+			streamId: streamIdVideo,
+			pts:      1040*90 + timestampDelay,
+			dts:      1040*90 + timestampDelay,
+			data: []byte{
+				0x00, 0x00, 0x00, 0x01, 0x09, 0xf0,
+				0x00, 0x00, 0x00, 0x01, 0x41, 0x9a,
+			},
+		},
+	}, demuxed.pes)
+}
+
+func TestMuxStuffing(t *testing.T) {
+	var output bytes.Buffer
+	muxer := NewMuxer(&output, Options{})
+
+	assert.Nil(t, muxer.WritePacket(videoConfigPacket()))
+
+	// cover every possible remainder of the last packet, both with and without the PCR
+	var frames [][]byte
+	for size := 150; size < 600; size++ {
+		frame := append([]byte{0x41}, bytes.Repeat([]byte{byte(size)}, size)...)
+		frames = append(frames, frame)
+
+		assert.Nil(t, muxer.WritePacket(videoPacket(size, size, size%2 == 0, frame)))
+	}
+
+	demuxed, err := demux(output.Bytes())
+	assert.Nil(t, err)
+	assert.Len(t, demuxed.pes, len(frames))
+
+	for i, pes := range demuxed.pes {
+		assert.Equal(t, frames[i], pes.data[len(pes.data)-len(frames[i]):])
+	}
+}
+
+func TestMuxAudioOnly(t *testing.T) {
+	var output bytes.Buffer
+	muxer := NewMuxer(&output, Options{})
+
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.Nil(t, muxer.WritePacket(audioPacket(0, []byte{0x21})))
+
+	demuxed, err := demux(output.Bytes())
+	assert.Nil(t, err)
+
+	// the audio stream carries the PCR instead
+	assert.Equal(t, uint16(audioPid), demuxed.pcrPid)
+	assert.Equal(t, map[uint16]byte{audioPid: streamTypeAAC}, demuxed.streams)
+	assert.Equal(t, []uint64{0}, demuxed.pcrs)
+}
+
+func TestMuxTimestampWrap(t *testing.T) {
+	var output bytes.Buffer
+	muxer := NewMuxer(&output, Options{})
+
+	// 2^33 ticks of the 90kHz clock are a little over 26.5 hours
+	timestamp := int((1<<33)/90) + 10
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.Nil(t, muxer.WritePacket(audioPacket(timestamp, []byte{0x21})))
+
+	demuxed, err := demux(output.Bytes())
+	assert.Nil(t, err)
+
+	expected := uint64(timestamp)*90 - 1<<33
+	assert.Equal(t, []uint64{expected}, demuxed.pcrs)
+	assert.Equal(t, expected+timestampDelay, demuxed.pes[0].pts)
+}
+
+func TestMuxRepeatsTables(t *testing.T) {
+	var output bytes.Buffer
+	muxer := NewMuxer(&output, Options{TablesInterval: 100 * time.Millisecond})
+
+	assert.Nil(t, muxer.WritePacket(videoConfigPacket()))
+	for timestamp := 0; timestamp < 300; timestamp += 40 {
+		assert.Nil(t, muxer.WritePacket(videoPacket(timestamp, timestamp, false, []byte{0x41})))
+	}
+
+	// a stream added later updates the program
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.Nil(t, muxer.WritePacket(audioPacket(300, []byte{0x21})))
+
+	assert.Nil(t, muxer.WriteTables())
+
+	demuxed, err := demux(output.Bytes())
+	assert.Nil(t, err)
+
+	// at 0, 120, 240, the new program at 300 and on demand
+	assert.Equal(t, []uint8{0, 0, 0, 1, 1}, demuxed.pmtVersions)
+	assert.Equal(t, map[uint16]byte{videoPid: streamTypeH264, audioPid: streamTypeAAC}, demuxed.streams)
+}
+
+func TestMuxErrors(t *testing.T) {
+	muxer := NewMuxer(&bytes.Buffer{}, Options{})
+
+	assert.Equal(t, ErrMissingConfig, muxer.WritePacket(videoPacket(0, 0, true, []byte{0x65})))
+	assert.Equal(t, ErrMissingConfig, muxer.WritePacket(audioPacket(0, []byte{0x21})))
+
+	assert.Equal(t, ErrUnsupportedCodec, muxer.WritePacket(&flv.Packet{Type: flv.AudioPacket, Codec: flv.SoundFormatMP3}))
+	assert.Equal(t, ErrUnsupportedCodec, muxer.WritePacket(&flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecVP6}))
+
+	assert.Equal(t, ErrInvalidAVCConfig, muxer.WritePacket(&flv.Packet{Type: flv.VideoConfigPacket, Codec: flv.VideoCodecH264, Data: avcConfigRecord[:8]}))
+	// explicit sample rate
+	assert.Equal(t, ErrInvalidAACConfig, muxer.WritePacket(&flv.Packet{Type: flv.AudioConfigPacket, Codec: flv.SoundTypeAAC, Data: []byte{0x17, 0x80}}))
+
+	assert.Nil(t, muxer.WritePacket(videoConfigPacket()))
+	packet := videoPacket(0, 0, true, []byte{0x65})
+	packet.Data = packet.Data[:4]
+	assert.Equal(t, ErrInvalidNALUnit, muxer.WritePacket(packet))
+
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.Equal(t, ErrFrameTooLarge, muxer.WritePacket(audioPacket(0, make([]byte, aac.MaxADTSFrameSize))))
+}
+
+type failingWriter struct{}
+
+var errWriteFailed = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errWriteFailed
+}
+
+func TestMuxWriteError(t *testing.T) {
+	muxer := NewMuxer(failingWriter{}, Options{})
+
+	assert.Nil(t, muxer.WritePacket(audioConfigPacket()))
+	assert.Equal(t, errWriteFailed, muxer.WritePacket(audioPacket(0, []byte{0x21})))
+	assert.Equal(t, errWriteFailed, muxer.WriteTables())
+}
@@ -0,0 +1,185 @@
+package packaging
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"limen/internal/registry"
+)
+
+const DefaultRetention = time.Minute
+
+// Packager turns the packets of a single stream into an output format,
+// End gets called once the stream is over.
+type Packager interface {
+	WritePacket(packet *registry.Packet) error
+	End()
+}
+
+type Options struct {
+	// Format names the output in logs.
+	Format string
+	// Retention is how long the packager of an ended stream stays
+	// available, zero means the default.
+	Retention time.Duration
+	Logger    *slog.Logger
+}
+
+func (o *Options) setDefaults() {
+	if o.Retention <= 0 {
+		o.Retention = DefaultRetention
+	}
+
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+}
+
+// Manager runs a packager for every stream published in the registry,
+// the packager of an ended stream stays available for the retention.
+type Manager struct {
+	options     Options
+	registry    *registry.Registry
+	newPackager func() Packager
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	outputs map[registry.Key]*output
+	running sync.WaitGroup
+	unwatch func()
+}
+
+type output struct {
+	stream   *registry.Stream
+	packager Packager
+}
+
+func NewManager(streams *registry.Registry, newPackager func() Packager, options Options) *Manager {
+	options.setDefaults()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Manager{
+		options:     options,
+		registry:    streams,
+		newPackager: newPackager,
+		ctx:         ctx,
+		cancel:      cancel,
+		outputs:     make(map[registry.Key]*output),
+	}
+}
+
+// Start packages streams published from now on, streams which
+// are already live are packaged as well.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	m.unwatch = m.registry.Watch(func(event registry.Event) {
+		if event.Type == registry.StreamPublished {
+			m.add(event.Stream)
+		}
+	})
+	m.mu.Unlock()
+
+	for _, key := range m.registry.Keys() {
+		if stream, ok := m.registry.Lookup(key); ok {
+			m.add(stream)
+		}
+	}
+}
+
+// Close stops packaging and waits for all packagers to finish.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	if m.unwatch != nil {
+		m.unwatch()
+		m.unwatch = nil
+	}
+	m.mu.Unlock()
+
+	m.cancel()
+	m.running.Wait()
+}
+
+// Packager returns the packager of a live or recently ended stream.
+func (m *Manager) Packager(key registry.Key) (Packager, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current, ok := m.outputs[key]
+	if !ok {
+		return nil, false
+	}
+
+	return current.packager, true
+}
+
+func (m *Manager) add(stream *registry.Stream) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx.Err() != nil {
+		return
+	}
+
+	// the stream might get reported by both Start and the watcher
+	if current, ok := m.outputs[stream.Key]; ok && current.stream == stream {
+		return
+	}
+
+	// packaging must neither keep pulled streams alive nor hold back the publisher
+	subscription, err := stream.Subscribe(registry.SubscribeOptions{Policy: registry.DropUntilKeyframe, Passive: true})
+	if err != nil {
+		return
+	}
+
+	current := &output{stream: stream, packager: m.newPackager()}
+	m.outputs[stream.Key] = current
+	m.running.Add(1)
+
+	go func() {
+		defer m.running.Done()
+
+		m.run(subscription, current.packager)
+
+		select {
+		case <-time.After(m.options.Retention):
+		case <-m.ctx.Done():
+		}
+
+		m.mu.Lock()
+		if m.outputs[stream.Key] == current {
+			delete(m.outputs, stream.Key)
+		}
+		m.mu.Unlock()
+	}()
+}
+
+func (m *Manager) run(subscription *registry.Subscription, packager Packager) {
+	defer packager.End()
+
+	logger := m.options.Logger.With("stream", subscription.Stream().Key.String())
+	reported := false
+
+	for {
+		select {
+		case packet, ok := <-subscription.Packets():
+			if !ok {
+				return
+			}
+
+			// the same error would usually repeat for every packet
+			if err := packager.WritePacket(packet); err != nil && !reported {
+				logger.Warn("Failed to package stream for "+m.options.Format, "error", err)
+				reported = true
+			}
+
+		case <-m.ctx.Done():
+			subscription.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package packaging
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/packaging/packagingtest"
+	"limen/internal/registry"
+)
+
+type fakePackager struct {
+	mu      sync.Mutex
+	packets int
+	ended   bool
+}
+
+func (p *fakePackager) WritePacket(packet *registry.Packet) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.packets++
+	return nil
+}
+
+func (p *fakePackager) End() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ended = true
+}
+
+func (p *fakePackager) state() (int, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.packets, p.ended
+}
+
+func newFakePackager() Packager {
+	return &fakePackager{}
+}
+
+func TestManagerPackagesLiveAndFutureStreams(t *testing.T) {
+	streams := registry.New(registry.Options{})
+
+	live, err := streams.Publish(registry.Key{App: "live", Name: "before"})
+	assert.Nil(t, err)
+
+	manager := NewManager(streams, newFakePackager, Options{Format: "test"})
+	manager.Start()
+	defer manager.Close()
+
+	future, err := streams.Publish(registry.Key{App: "live", Name: "after"})
+	assert.Nil(t, err)
+
+	for _, stream := range []*registry.Stream{live, future} {
+		packager, ok := manager.Packager(stream.Key)
+		assert.True(t, ok, stream.Key.String())
+
+		stream.WritePacket(&registry.Packet{Type: registry.VideoPacket, Data: packagingtest.VideoTag(true, 0)})
+		assert.Eventually(t, func() bool {
+			packets, _ := packager.(*fakePackager).state()
+			return packets == 1
+		}, time.Second, 10*time.Millisecond)
+	}
+
+	_, ok := manager.Packager(registry.Key{App: "live", Name: "other"})
+	assert.False(t, ok)
+}
+
+func TestManagerDropsEndedStreamsAfterRetention(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	manager := NewManager(streams, newFakePackager, Options{Format: "test", Retention: 200 * time.Millisecond})
+	manager.Start()
+	defer manager.Close()
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	packager, ok := manager.Packager(stream.Key)
+	assert.True(t, ok)
+
+	stream.Unpublish()
+
+	assert.Eventually(t, func() bool {
+		_, ended := packager.(*fakePackager).state()
+		return ended
+	}, time.Second, 10*time.Millisecond)
+
+	// the packager of the ended stream is still served for the retention
+	_, ok = manager.Packager(stream.Key)
+	assert.True(t, ok)
+
+	assert.Eventually(t, func() bool {
+		_, ok := manager.Packager(stream.Key)
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestManagerCloseEndsPackagers(t *testing.T) {
+	streams := registry.New(registry.Options{})
+	manager := NewManager(streams, newFakePackager, Options{Format: "test"})
+	manager.Start()
+
+	stream, err := streams.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	packager, ok := manager.Packager(stream.Key)
+	assert.True(t, ok)
+
+	manager.Close()
+
+	_, ended := packager.(*fakePackager).state()
+	assert.True(t, ended)
+
+	_, ok = manager.Packager(stream.Key)
+	assert.False(t, ok)
+}
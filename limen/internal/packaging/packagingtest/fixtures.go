@@ -0,0 +1,66 @@
+// Package packagingtest provides the FLV tags and helpers shared by the
+// tests of the packagers and of the servers delivering their output.
+package packagingtest
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/registry"
+)
+
+var (
+	AVCConfigTag = []byte{
+		// keyframe, AVC, sequence header, composition time
+		0x17, 0x00, 0x00, 0x00, 0x00,
+		// version, profile, compatibility, level, 4 byte lengths
+		0x01, 0x42, 0xc0, 0x1e, 0xff,
+		// single SPS, Baseline 3.0, 1280x720
+		0xe1, 0x00, 0x18, 0x67, 0x42, 0xc0, 0x1e, 0xd9, 0x00, 0x50, 0x05, 0xba, 0x10, 0x00, 0x00,
+		0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x62, 0xe4, 0x80,
+		// single PPS
+		0x01, 0x00, 0x04, 0x68, 0xce, 0x3c, 0x80,
+	}
+	// AAC LC, 44100Hz, stereo
+	AACConfigTag = []byte{0xaf, 0x00, 0x12, 0x10}
+	AACFrameTag  = []byte{0xaf, 0x01, 0x21, 0x00, 0x03}
+)
+
+// VideoTag returns an AVC frame with a single NAL unit.
+func VideoTag(keyFrame bool, compositionTime byte) []byte {
+	if keyFrame {
+		return []byte{0x17, 0x01, 0x00, 0x00, compositionTime, 0x00, 0x00, 0x00, 0x02, 0x65, 0x88}
+	}
+
+	return []byte{0x27, 0x01, 0x00, 0x00, compositionTime, 0x00, 0x00, 0x00, 0x02, 0x41, 0x9a}
+}
+
+type PacketWriter interface {
+	WritePacket(packet *registry.Packet) error
+}
+
+// WriteVideo writes frames every 100ms with a keyframe every second.
+func WriteVideo(t *testing.T, writer PacketWriter, from, to uint32) {
+	for timestamp := from; timestamp < to; timestamp += 100 {
+		err := writer.WritePacket(&registry.Packet{Type: registry.VideoPacket, Timestamp: timestamp, Data: VideoTag(timestamp%1000 == 0, 0)})
+		assert.Nil(t, err)
+	}
+}
+
+// Get requests the path from the server and returns the status, body and headers.
+func Get(t *testing.T, server *httptest.Server, path string) (int, string, http.Header) {
+	response, err := http.Get(server.URL + path)
+	if !assert.Nil(t, err) {
+		return 0, "", nil
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+
+	return response.StatusCode, string(body), response.Header
+}
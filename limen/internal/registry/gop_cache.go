@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"time"
+)
+
+const (
+	DefaultGopCacheMaxBytes    = 8 * 1024 * 1024
+	DefaultGopCacheMaxDuration = 10 * time.Second
+)
+
+// gopCache retains what a new subscriber needs to start decoding
+// the stream right away: the metadata, codec sequence headers and
+// all the media since the most recent keyframe.
+//
+// Streams without video can start on any audio frame, for them the
+// cache holds the latest audio frames within the limits instead.
+type gopCache struct {
+	maxBytes      int
+	maxDuration   uint32
+	enabled       bool
+	hasVideo      bool
+	metadata      *Packet
+	videoConfig   *Packet
+	audioConfig   *Packet
+	packets       []*Packet
+	size          int
+	lastTimestamp uint32
+}
+
+func newGopCache(maxBytes int, maxDuration time.Duration) *gopCache {
+	if maxBytes == 0 {
+		maxBytes = DefaultGopCacheMaxBytes
+	}
+
+	if maxDuration == 0 {
+		maxDuration = DefaultGopCacheMaxDuration
+	}
+
+	return &gopCache{
+		maxBytes:    maxBytes,
+		maxDuration: uint32(maxDuration.Milliseconds()),
+		enabled:     maxBytes > 0 && maxDuration > 0,
+	}
+}
+
+func (c *gopCache) add(packet *Packet, kind packetKind) {
+	if packet.Type == MetadataPacket {
+		c.metadata = packet
+		return
+	}
+
+	c.lastTimestamp = packet.Timestamp
+
+	if packet.Type == VideoPacket && !c.hasVideo {
+		// the audio cached so far doesn't lead to a keyframe
+		c.hasVideo = true
+		c.reset()
+	}
+
+	if kind == kindSequenceHeader {
+		if packet.Type == VideoPacket {
+			c.videoConfig = packet
+		} else {
+			c.audioConfig = packet
+
+			// frames of the previous configuration are no longer decodable
+			if !c.hasVideo {
+				c.reset()
+			}
+		}
+
+		return
+	}
+
+	if !c.enabled {
+		return
+	}
+
+	if !c.hasVideo {
+		c.addAudio(packet)
+		return
+	}
+
+	if kind == kindKeyFrame {
+		c.reset()
+	} else if len(c.packets) == 0 {
+		// nothing is being cached until a keyframe arrives
+		return
+	}
+
+	c.packets = append(c.packets, packet)
+	c.size += len(packet.Data)
+
+	// an incomplete GOP is useless, drop it and wait for the next keyframe
+	if c.size > c.maxBytes || packet.Timestamp-c.packets[0].Timestamp > c.maxDuration {
+		c.reset()
+	}
+}
+
+// addAudio caches a frame of a stream without video, the oldest frames
+// are dropped to stay within the limits as any of them can start playback.
+func (c *gopCache) addAudio(packet *Packet) {
+	c.packets = append(c.packets, packet)
+	c.size += len(packet.Data)
+
+	for len(c.packets) > 0 && (c.size > c.maxBytes || packet.Timestamp-c.packets[0].Timestamp > c.maxDuration) {
+		c.size -= len(c.packets[0].Data)
+		c.packets = c.packets[1:]
+	}
+}
+
+func (c *gopCache) reset() {
+	c.packets = nil
+	c.size = 0
+}
+
+// snapshot returns packets that should be sent to a new subscriber before
+// any live packets. Metadata and sequence headers get the timestamp of
+// the first cached packet so that subscribers' timelines stay continuous.
+func (c *gopCache) snapshot() []*Packet {
+	timestamp := c.lastTimestamp
+	if len(c.packets) > 0 {
+		timestamp = c.packets[0].Timestamp
+	}
+
+	packets := make([]*Packet, 0, 3+len(c.packets))
+
+	for _, packet := range []*Packet{c.metadata, c.videoConfig, c.audioConfig} {
+		if packet != nil {
+			packets = append(packets, &Packet{Type: packet.Type, Timestamp: timestamp, Data: packet.Data})
+		}
+	}
+
+	return append(packets, c.packets...)
+}
@@ -0,0 +1,202 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func videoPacket(timestamp uint32, keyFrame bool, config bool) *Packet {
+	frameType := byte(2)
+	if keyFrame {
+		frameType = 1
+	}
+
+	avcPacketType := byte(1)
+	if config {
+		avcPacketType = 0
+	}
+
+	return &Packet{
+		Type:      VideoPacket,
+		Timestamp: timestamp,
+		Data:      []byte{frameType<<4 | 7, avcPacketType, 0x0, 0x0, 0x0, 0xff, 0xff},
+	}
+}
+
+func audioPacket(timestamp uint32, config bool) *Packet {
+	aacPacketType := byte(1)
+	if config {
+		aacPacketType = 0
+	}
+
+	return &Packet{
+		Type:      AudioPacket,
+		Timestamp: timestamp,
+		Data:      []byte{0xaf, aacPacketType, 0xff, 0xff},
+	}
+}
+
+func TestNewSubscriberStartsOnKeyframe(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	metadata := &Packet{Type: MetadataPacket, Data: []byte{0x02}}
+	videoConfig := videoPacket(0, true, true)
+	audioConfig := audioPacket(0, true)
+
+	stream.SetMetadata(metadata)
+	stream.WritePacket(videoConfig)
+	stream.WritePacket(audioConfig)
+
+	stream.WritePacket(videoPacket(1000, true, false))
+	stream.WritePacket(videoPacket(1033, false, false))
+
+	keyFrame := videoPacket(2000, true, false)
+	interFrame := videoPacket(2033, false, false)
+	audio := audioPacket(2040, false)
+
+	stream.WritePacket(keyFrame)
+	stream.WritePacket(interFrame)
+	stream.WritePacket(audio)
+
+	sub, err := stream.Subscribe(SubscribeOptions{})
+	assert.Nil(t, err)
+
+	expected := []*Packet{
+		{Type: MetadataPacket, Timestamp: 2000, Data: metadata.Data},
+		{Type: VideoPacket, Timestamp: 2000, Data: videoConfig.Data},
+		{Type: AudioPacket, Timestamp: 2000, Data: audioConfig.Data},
+		keyFrame,
+		interFrame,
+		audio,
+	}
+
+	for _, packet := range expected {
+		assert.Equal(t, packet, <-sub.Packets())
+	}
+
+	live := videoPacket(2066, false, false)
+	stream.WritePacket(live)
+	assert.Equal(t, live, <-sub.Packets())
+}
+
+func TestExtendedVideoIsCached(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	// enhanced RTMP packets of HEVC: sequence start, coded frames of a keyframe
+	// and of an inter frame
+	config := &Packet{Type: VideoPacket, Data: []byte{0x90, 'h', 'v', 'c', '1', 0x01}}
+	keyFrame := &Packet{Type: VideoPacket, Timestamp: 1000, Data: []byte{0x93, 'h', 'v', 'c', '1', 0xff}}
+	interFrame := &Packet{Type: VideoPacket, Timestamp: 1033, Data: []byte{0xa3, 'h', 'v', 'c', '1', 0xff}}
+
+	stream.WritePacket(config)
+	stream.WritePacket(&Packet{Type: VideoPacket, Timestamp: 500, Data: interFrame.Data})
+	stream.WritePacket(keyFrame)
+	stream.WritePacket(interFrame)
+
+	sub, err := stream.Subscribe(SubscribeOptions{})
+	assert.Nil(t, err)
+
+	for _, packet := range []*Packet{
+		{Type: VideoPacket, Timestamp: 1000, Data: config.Data},
+		keyFrame,
+		interFrame,
+	} {
+		assert.Equal(t, packet, <-sub.Packets())
+	}
+}
+
+func TestExtendedVideoSequenceEndIsNotAKeyframe(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	config := &Packet{Type: VideoPacket, Data: []byte{0x90, 'h', 'v', 'c', '1', 0x01}}
+	keyFrame := &Packet{Type: VideoPacket, Timestamp: 1000, Data: []byte{0x93, 'h', 'v', 'c', '1', 0xff}}
+	// enhanced RTMP sequence end, flagged as a keyframe
+	sequenceEnd := &Packet{Type: VideoPacket, Timestamp: 1033, Data: []byte{0x92, 'h', 'v', 'c', '1'}}
+
+	stream.WritePacket(config)
+	stream.WritePacket(keyFrame)
+	stream.WritePacket(sequenceEnd)
+
+	assert.Equal(t, kindOther, classifyPacket(sequenceEnd))
+
+	sub, err := stream.Subscribe(SubscribeOptions{})
+	assert.Nil(t, err)
+
+	for _, packet := range []*Packet{
+		{Type: VideoPacket, Timestamp: 1000, Data: config.Data},
+		keyFrame,
+		sequenceEnd,
+	} {
+		assert.Equal(t, packet, <-sub.Packets())
+	}
+}
+
+func TestAudioOnlyStreamIsCached(t *testing.T) {
+	r := New(Options{GopCacheMaxDuration: time.Second})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	stream.WritePacket(audioPacket(0, false))
+	audioConfig := audioPacket(0, true)
+	stream.WritePacket(audioConfig)
+
+	var frames []*Packet
+	for timestamp := uint32(0); timestamp <= 1500; timestamp += 500 {
+		frame := audioPacket(timestamp, false)
+		frames = append(frames, frame)
+		stream.WritePacket(frame)
+	}
+
+	sub, err := stream.Subscribe(SubscribeOptions{})
+	assert.Nil(t, err)
+
+	// the frames older than the limit are dropped one by one
+	expected := append([]*Packet{{Type: AudioPacket, Timestamp: 500, Data: audioConfig.Data}}, frames[1:]...)
+	assert.Equal(t, len(expected), len(sub.Packets()))
+	for _, packet := range expected {
+		assert.Equal(t, packet, <-sub.Packets())
+	}
+
+	// once video shows up the cache waits for a keyframe
+	stream.WritePacket(videoPacket(2000, false, false))
+	stream.WritePacket(audioPacket(2010, false))
+
+	sub, _ = stream.Subscribe(SubscribeOptions{})
+	assert.Equal(t, 1, len(sub.Packets()))
+}
+
+func TestGopCacheIsDroppedWhenExceedingLimits(t *testing.T) {
+	r := New(Options{GopCacheMaxDuration: time.Second})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	stream.WritePacket(videoPacket(0, true, true))
+	stream.WritePacket(videoPacket(0, true, false))
+	stream.WritePacket(videoPacket(1500, false, false))
+
+	sub, _ := stream.Subscribe(SubscribeOptions{})
+	assert.Equal(t, 1, len(sub.Packets()))
+
+	r = New(Options{GopCacheMaxBytes: 10})
+	stream, _ = r.Publish(Key{Name: "key"})
+
+	stream.WritePacket(videoPacket(0, true, false))
+	stream.WritePacket(videoPacket(33, false, false))
+
+	sub, _ = stream.Subscribe(SubscribeOptions{})
+	assert.Equal(t, 0, len(sub.Packets()))
+}
+
+func TestDisabledGopCacheKeepsSequenceHeaders(t *testing.T) {
+	r := New(Options{GopCacheMaxBytes: -1})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	stream.WritePacket(videoPacket(0, true, true))
+	stream.WritePacket(videoPacket(0, true, false))
+
+	sub, _ := stream.Subscribe(SubscribeOptions{})
+	assert.Equal(t, 1, len(sub.Packets()))
+}
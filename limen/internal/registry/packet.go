@@ -0,0 +1,62 @@
+package registry
+
+import "limen/internal/flv"
+
+type PacketType uint8
+
+const (
+	AudioPacket    PacketType = 0
+	VideoPacket    PacketType = 1
+	MetadataPacket PacketType = 2
+)
+
+// Packet is a single media message of a stream.
+//
+// Data holds the FLV tag body (the same as the RTMP message payload),
+// consumers must treat it as read only as it is shared between all of them.
+type Packet struct {
+	Type      PacketType
+	Timestamp uint32
+	Data      []byte
+}
+
+type packetKind uint8
+
+const (
+	kindOther          packetKind = 0
+	kindSequenceHeader packetKind = 1
+	kindKeyFrame       packetKind = 2
+	kindInterFrame     packetKind = 3
+)
+
+func classifyPacket(packet *Packet) packetKind {
+	switch packet.Type {
+	case AudioPacket:
+		decoded, err := flv.DecodeTagData(flv.AudioPacket, packet.Data)
+		if err == nil && decoded.Type == flv.AudioConfigPacket && decoded.Codec == flv.SoundTypeAAC {
+			return kindSequenceHeader
+		}
+
+	case VideoPacket:
+		decoded, err := flv.DecodeTagData(flv.VideoPacket, packet.Data)
+		if err != nil {
+			return kindInterFrame
+		}
+
+		switch decoded.Type {
+		case flv.VideoConfigPacket:
+			return kindSequenceHeader
+		case flv.VideoSequenceEndPacket, flv.VideoMetadataPacket:
+			// they carry the keyframe flag without being frames
+			return kindOther
+		}
+
+		if decoded.CodecParams.(*flv.VideoCodecParams).KeyFrame {
+			return kindKeyFrame
+		}
+
+		return kindInterFrame
+	}
+
+	return kindOther
+}
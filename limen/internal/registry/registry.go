@@ -0,0 +1,216 @@
+package registry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const DefaultSubscriberQueueSize = 1024
+
+var (
+	ErrStreamAlreadyPublished = errors.New("stream already published")
+	ErrStreamNotPublished     = errors.New("stream not published")
+	ErrRegistryClosed         = errors.New("registry closed")
+)
+
+// PublishPolicy decides what happens when a stream key which is already
+// live gets published for the second time.
+type PublishPolicy uint8
+
+const (
+	// RejectDuplicate keeps the current publisher and rejects the new one.
+	RejectDuplicate PublishPolicy = 0
+	// TakeOverDuplicate unpublishes the current publisher in favour of the new one.
+	TakeOverDuplicate PublishPolicy = 1
+)
+
+type Options struct {
+	PublishPolicy       PublishPolicy
+	SubscriberQueueSize int
+	// GopCacheMaxBytes and GopCacheMaxDuration cap the media retained since
+	// the last keyframe, zero means the default, a negative value disables the cache.
+	GopCacheMaxBytes    int
+	GopCacheMaxDuration time.Duration
+}
+
+// Key identifies a published stream.
+type Key struct {
+	App  string
+	Name string
+}
+
+func (k Key) String() string {
+	return k.App + "/" + k.Name
+}
+
+type EventType uint8
+
+const (
+	StreamPublished       EventType = 0
+	StreamUnpublished     EventType = 1
+	StreamMetadataChanged EventType = 2
+)
+
+type Event struct {
+	Type   EventType
+	Key    Key
+	Stream *Stream
+}
+
+// Registry keeps track of all streams published on the server
+// and lets consumers subscribe to their media.
+type Registry struct {
+	options       Options
+	mu            sync.Mutex
+	streams       map[Key]*Stream
+	watchers      map[int]func(Event)
+	nextWatcherId int
+	closed        bool
+}
+
+func New(options Options) *Registry {
+	if options.SubscriberQueueSize <= 0 {
+		options.SubscriberQueueSize = DefaultSubscriberQueueSize
+	}
+
+	return &Registry{
+		options:  options,
+		streams:  make(map[Key]*Stream),
+		watchers: make(map[int]func(Event)),
+	}
+}
+
+// Publish registers a new live stream under the given key.
+//
+// Depending on the PublishPolicy an already published stream either causes
+// ErrStreamAlreadyPublished or gets unpublished (its Done channel gets closed).
+func (r *Registry) Publish(key Key) (*Stream, error) {
+	return r.PublishFrom(key, "")
+}
+
+// PublishFrom registers a live stream relayed from the origin server,
+// it behaves the same as Publish otherwise.
+func (r *Registry) PublishFrom(key Key, origin string) (*Stream, error) {
+	r.mu.Lock()
+
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRegistryClosed
+	}
+
+	previous, ok := r.streams[key]
+	if ok && r.options.PublishPolicy == RejectDuplicate {
+		r.mu.Unlock()
+		return nil, ErrStreamAlreadyPublished
+	}
+
+	stream := newStream(r, key)
+	stream.Origin = origin
+	r.streams[key] = stream
+
+	r.mu.Unlock()
+
+	if previous != nil {
+		previous.close(true)
+		r.notify(Event{Type: StreamUnpublished, Key: key, Stream: previous})
+	}
+
+	r.notify(Event{Type: StreamPublished, Key: key, Stream: stream})
+
+	return stream, nil
+}
+
+// Lookup returns a currently published stream.
+func (r *Registry) Lookup(key Key) (*Stream, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stream, ok := r.streams[key]
+	return stream, ok
+}
+
+// Subscribe attaches a new consumer to a currently published stream.
+func (r *Registry) Subscribe(key Key, options SubscribeOptions) (*Subscription, error) {
+	stream, ok := r.Lookup(key)
+	if !ok {
+		return nil, ErrStreamNotPublished
+	}
+
+	return stream.Subscribe(options)
+}
+
+// Keys returns keys of all currently published streams.
+func (r *Registry) Keys() []Key {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]Key, 0, len(r.streams))
+	for key := range r.streams {
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+// Watch registers a callback receiving lifecycle events of all streams.
+//
+// Callbacks are invoked synchronously from the publisher's goroutine,
+// any long running work should be moved to a separate goroutine.
+func (r *Registry) Watch(callback func(Event)) (unwatch func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := r.nextWatcherId
+	r.nextWatcherId += 1
+	r.watchers[id] = callback
+
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		delete(r.watchers, id)
+	}
+}
+
+// Close unpublishes all streams, which ends all subscriptions,
+// and rejects any further publishing.
+func (r *Registry) Close() {
+	r.mu.Lock()
+	r.closed = true
+	streams := make([]*Stream, 0, len(r.streams))
+	for _, stream := range r.streams {
+		streams = append(streams, stream)
+	}
+	r.mu.Unlock()
+
+	for _, stream := range streams {
+		stream.Unpublish()
+	}
+}
+
+func (r *Registry) unpublish(stream *Stream) {
+	r.mu.Lock()
+	current := r.streams[stream.Key] == stream
+	if current {
+		delete(r.streams, stream.Key)
+	}
+	r.mu.Unlock()
+
+	if current && stream.close(false) {
+		r.notify(Event{Type: StreamUnpublished, Key: stream.Key, Stream: stream})
+	}
+}
+
+func (r *Registry) notify(event Event) {
+	r.mu.Lock()
+	watchers := make([]func(Event), 0, len(r.watchers))
+	for _, watcher := range r.watchers {
+		watchers = append(watchers, watcher)
+	}
+	r.mu.Unlock()
+
+	for _, watcher := range watchers {
+		watcher(event)
+	}
+}
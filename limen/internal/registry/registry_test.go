@@ -0,0 +1,187 @@
+package registry
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishAndSubscribe(t *testing.T) {
+	r := New(Options{})
+	key := Key{App: "live", Name: "key"}
+
+	_, err := r.Subscribe(key, SubscribeOptions{})
+	assert.Equal(t, ErrStreamNotPublished, err)
+
+	stream, err := r.Publish(key)
+	assert.Nil(t, err)
+
+	sub, err := r.Subscribe(key, SubscribeOptions{})
+	assert.Nil(t, err)
+
+	// the same name within a different app is a different stream
+	_, err = r.Subscribe(Key{App: "other", Name: "key"}, SubscribeOptions{})
+	assert.Equal(t, ErrStreamNotPublished, err)
+
+	packet := &Packet{Type: VideoPacket, Timestamp: 10, Data: []byte{0x17}}
+	stream.WritePacket(packet)
+
+	assert.Equal(t, packet, <-sub.Packets())
+
+	stream.Unpublish()
+
+	_, ok := <-sub.Packets()
+	assert.False(t, ok)
+	assert.Equal(t, ReasonUnpublished, sub.Reason())
+
+	_, ok = r.Lookup(key)
+	assert.False(t, ok)
+}
+
+func TestRejectDuplicatePublish(t *testing.T) {
+	r := New(Options{PublishPolicy: RejectDuplicate})
+	key := Key{App: "live", Name: "key"}
+
+	stream, err := r.Publish(key)
+	assert.Nil(t, err)
+
+	_, err = r.Publish(key)
+	assert.Equal(t, ErrStreamAlreadyPublished, err)
+
+	current, ok := r.Lookup(key)
+	assert.True(t, ok)
+	assert.Equal(t, stream, current)
+}
+
+func TestTakeOverDuplicatePublish(t *testing.T) {
+	r := New(Options{PublishPolicy: TakeOverDuplicate})
+	key := Key{App: "live", Name: "key"}
+
+	events := []Event{}
+	r.Watch(func(event Event) {
+		events = append(events, event)
+	})
+
+	first, err := r.Publish(key)
+	assert.Nil(t, err)
+
+	sub, _ := first.Subscribe(SubscribeOptions{})
+
+	second, err := r.Publish(key)
+	assert.Nil(t, err)
+
+	<-first.Done()
+	assert.True(t, first.TakenOver())
+
+	_, ok := <-sub.Packets()
+	assert.False(t, ok)
+
+	// unpublishing a stream that has been taken over leaves the new one intact
+	first.Unpublish()
+
+	current, ok := r.Lookup(key)
+	assert.True(t, ok)
+	assert.Equal(t, second, current)
+
+	assert.Equal(t, []EventType{StreamPublished, StreamUnpublished, StreamPublished}, eventTypes(events))
+}
+
+func TestCloseEndsAllStreams(t *testing.T) {
+	r := New(Options{})
+
+	first, _ := r.Publish(Key{App: "live", Name: "first"})
+	second, _ := r.Publish(Key{App: "live", Name: "second"})
+
+	sub, err := first.Subscribe(SubscribeOptions{})
+	assert.Nil(t, err)
+
+	r.Close()
+
+	_, ok := <-sub.Packets()
+	assert.False(t, ok)
+	assert.Equal(t, ReasonUnpublished, sub.Reason())
+
+	<-second.Done()
+	assert.Empty(t, r.Keys())
+
+	_, err = r.Publish(Key{App: "live", Name: "third"})
+	assert.Equal(t, ErrRegistryClosed, err)
+}
+
+func TestLifecycleEvents(t *testing.T) {
+	r := New(Options{})
+	key := Key{App: "live", Name: "key"}
+
+	events := []Event{}
+	unwatch := r.Watch(func(event Event) {
+		events = append(events, event)
+	})
+
+	stream, _ := r.Publish(key)
+	stream.SetMetadata(&Packet{Type: MetadataPacket})
+	stream.Unpublish()
+	stream.Unpublish()
+
+	unwatch()
+	_, _ = r.Publish(key)
+
+	assert.Equal(t, []EventType{StreamPublished, StreamMetadataChanged, StreamUnpublished}, eventTypes(events))
+	assert.Equal(t, key, events[0].Key)
+}
+
+func TestSlowSubscriberGetsDisconnected(t *testing.T) {
+	r := New(Options{SubscriberQueueSize: 2})
+
+	stream, _ := r.Publish(Key{Name: "key"})
+	slow, _ := stream.Subscribe(SubscribeOptions{})
+
+	for i := 0; i < 3; i++ {
+		stream.WritePacket(&Packet{Type: AudioPacket})
+	}
+
+	for range slow.Packets() {
+	}
+
+	assert.Equal(t, ReasonOverflow, slow.Reason())
+}
+
+func TestConcurrentSubscribers(t *testing.T) {
+	r := New(Options{})
+	key := Key{Name: "key"}
+
+	stream, _ := r.Publish(key)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 16; j++ {
+				sub, err := r.Subscribe(key, SubscribeOptions{})
+				if err != nil {
+					return
+				}
+
+				sub.Close()
+			}
+		}()
+	}
+
+	for i := 0; i < 256; i++ {
+		stream.WritePacket(&Packet{Type: VideoPacket})
+	}
+
+	wg.Wait()
+	stream.Unpublish()
+}
+
+func eventTypes(events []Event) []EventType {
+	types := make([]EventType, 0, len(events))
+	for _, event := range events {
+		types = append(types, event.Type)
+	}
+
+	return types
+}
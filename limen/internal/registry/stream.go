@@ -0,0 +1,219 @@
+package registry
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Stats contains delivery counters of a stream,
+// ActiveSubscribers excludes the passive subscribers.
+type Stats struct {
+	Subscribers             int
+	ActiveSubscribers       int
+	DroppedAudioPackets     uint64
+	DroppedVideoPackets     uint64
+	DroppedOtherPackets     uint64
+	DisconnectedSubscribers uint64
+}
+
+// Stream is a live stream published in the registry.
+type Stream struct {
+	Key Key
+	// Origin is the url of the server the stream is relayed from,
+	// it is empty for streams published by clients
+	Origin        string
+	registry      *Registry
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	metadata      *Packet
+	cache         *gopCache
+	closed        bool
+	takenOver     bool
+	done          chan struct{}
+
+	droppedAudio atomic.Uint64
+	droppedVideo atomic.Uint64
+	droppedOther atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+func newStream(registry *Registry, key Key) *Stream {
+	return &Stream{
+		Key:           key,
+		registry:      registry,
+		subscriptions: make(map[*Subscription]struct{}),
+		cache:         newGopCache(registry.options.GopCacheMaxBytes, registry.options.GopCacheMaxDuration),
+		done:          make(chan struct{}),
+	}
+}
+
+// WritePacket delivers the packet to all subscribers according to their
+// delivery policies. Only subscribers with the BlockPublisher policy can
+// make the call wait.
+func (s *Stream) WritePacket(packet *Packet) {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+
+	kind := classifyPacket(packet)
+	s.cache.add(packet, kind)
+
+	subscriptions := make([]*Subscription, 0, len(s.subscriptions))
+	for sub := range s.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+
+	s.mu.Unlock()
+
+	for _, sub := range subscriptions {
+		if !sub.deliver(packet, kind) {
+			s.disconnected.Add(1)
+			s.removeSubscription(sub, ReasonOverflow)
+		}
+	}
+}
+
+// SetMetadata stores the stream metadata, so that it can be sent to
+// subscribers joining later, and delivers it to the current subscribers.
+func (s *Stream) SetMetadata(packet *Packet) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.metadata = packet
+	s.mu.Unlock()
+
+	s.WritePacket(packet)
+
+	s.registry.notify(Event{Type: StreamMetadataChanged, Key: s.Key, Stream: s})
+}
+
+func (s *Stream) Metadata() *Packet {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.metadata
+}
+
+// Subscribe attaches a new consumer to the stream.
+//
+// The subscription starts with the stream metadata, sequence headers and
+// the media since the last keyframe, followed by live packets.
+func (s *Stream) Subscribe(options SubscribeOptions) (*Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, ErrStreamNotPublished
+	}
+
+	queueSize := options.QueueSize
+	if queueSize <= 0 {
+		queueSize = s.registry.options.SubscriberQueueSize
+	}
+
+	cached := s.cache.snapshot()
+
+	sub := newSubscription(s, options.Policy, queueSize+len(cached))
+	sub.passive = options.Passive
+
+	for _, packet := range cached {
+		sub.packets <- packet
+	}
+
+	s.subscriptions[sub] = struct{}{}
+
+	return sub, nil
+}
+
+// Stats returns delivery counters of the stream.
+func (s *Stream) Stats() Stats {
+	s.mu.Lock()
+	subscribers := len(s.subscriptions)
+	active := 0
+	for sub := range s.subscriptions {
+		if !sub.passive {
+			active++
+		}
+	}
+	s.mu.Unlock()
+
+	return Stats{
+		Subscribers:             subscribers,
+		ActiveSubscribers:       active,
+		DroppedAudioPackets:     s.droppedAudio.Load(),
+		DroppedVideoPackets:     s.droppedVideo.Load(),
+		DroppedOtherPackets:     s.droppedOther.Load(),
+		DisconnectedSubscribers: s.disconnected.Load(),
+	}
+}
+
+// Unpublish removes the stream from the registry and ends all subscriptions.
+func (s *Stream) Unpublish() {
+	s.registry.unpublish(s)
+}
+
+// Done gets closed once the stream has been unpublished.
+func (s *Stream) Done() <-chan struct{} {
+	return s.done
+}
+
+// TakenOver tells whether the stream got unpublished by another publisher
+// of the same key.
+func (s *Stream) TakenOver() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.takenOver
+}
+
+func (s *Stream) close(takenOver bool) bool {
+	s.mu.Lock()
+
+	if s.closed {
+		s.mu.Unlock()
+		return false
+	}
+
+	s.closed = true
+	s.takenOver = takenOver
+
+	subscriptions := s.subscriptions
+	s.subscriptions = make(map[*Subscription]struct{})
+
+	close(s.done)
+
+	s.mu.Unlock()
+
+	for sub := range subscriptions {
+		sub.end(ReasonUnpublished)
+	}
+
+	return true
+}
+
+func (s *Stream) removeSubscription(sub *Subscription, reason CloseReason) {
+	s.mu.Lock()
+	_, ok := s.subscriptions[sub]
+	delete(s.subscriptions, sub)
+	s.mu.Unlock()
+
+	if ok {
+		sub.end(reason)
+	}
+}
+
+func (s *Stream) countDropped(packet *Packet) {
+	switch packet.Type {
+	case AudioPacket:
+		s.droppedAudio.Add(1)
+	case VideoPacket:
+		s.droppedVideo.Add(1)
+	default:
+		s.droppedOther.Add(1)
+	}
+}
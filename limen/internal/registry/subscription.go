@@ -0,0 +1,158 @@
+package registry
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+type CloseReason uint8
+
+const (
+	ReasonNone         CloseReason = 0
+	ReasonUnpublished  CloseReason = 1
+	ReasonUnsubscribed CloseReason = 2
+	ReasonOverflow     CloseReason = 3
+)
+
+// DeliveryPolicy decides what happens when a subscriber's queue is full.
+type DeliveryPolicy uint8
+
+const (
+	// DisconnectSlowSubscriber ends the subscription with ReasonOverflow.
+	DisconnectSlowSubscriber DeliveryPolicy = 0
+	// BlockPublisher makes the publisher wait until there is space in the queue.
+	BlockPublisher DeliveryPolicy = 1
+	// DropUntilKeyframe drops packets that don't fit and skips video
+	// until the next keyframe so that the decoder never sees a broken GOP.
+	DropUntilKeyframe DeliveryPolicy = 2
+)
+
+type SubscribeOptions struct {
+	Policy DeliveryPolicy
+	// QueueSize of zero uses the registry's SubscriberQueueSize
+	QueueSize int
+	// Passive subscribers, e.g. analyzers, are not counted as the stream's
+	// audience, streams pulled on demand end when only those are left.
+	Passive bool
+}
+
+// Subscription receives packets of a single stream.
+type Subscription struct {
+	stream    *Stream
+	policy    DeliveryPolicy
+	passive   bool
+	packets   chan *Packet
+	closing   chan struct{}
+	closeOnce sync.Once
+	reason    CloseReason
+	dropped   atomic.Uint64
+
+	// guards sending to and closing the packets channel
+	sendMu             sync.Mutex
+	closed             bool
+	waitingForKeyframe bool
+}
+
+func newSubscription(stream *Stream, policy DeliveryPolicy, queueSize int) *Subscription {
+	return &Subscription{
+		stream:  stream,
+		policy:  policy,
+		packets: make(chan *Packet, queueSize),
+		closing: make(chan struct{}),
+	}
+}
+
+// Packets returns the channel of stream packets, it gets closed
+// when the subscription ends.
+func (s *Subscription) Packets() <-chan *Packet {
+	return s.packets
+}
+
+func (s *Subscription) Stream() *Stream {
+	return s.stream
+}
+
+// Reason tells why the subscription has ended,
+// it is valid only after the packets channel has been closed.
+func (s *Subscription) Reason() CloseReason {
+	return s.reason
+}
+
+// Dropped returns the number of packets dropped for this subscriber.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close detaches the subscription from the stream.
+func (s *Subscription) Close() {
+	s.stream.removeSubscription(s, ReasonUnsubscribed)
+}
+
+// deliver queues the packet according to the delivery policy,
+// returns false when the subscriber should be disconnected.
+func (s *Subscription) deliver(packet *Packet, kind packetKind) bool {
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
+
+	if s.closed {
+		return true
+	}
+
+	switch s.policy {
+	case BlockPublisher:
+		select {
+		case s.packets <- packet:
+		case <-s.closing:
+		}
+
+		return true
+
+	case DropUntilKeyframe:
+		if s.waitingForKeyframe && kind == kindInterFrame {
+			s.drop(packet)
+			return true
+		}
+
+		select {
+		case s.packets <- packet:
+			if kind == kindKeyFrame {
+				s.waitingForKeyframe = false
+			}
+		default:
+			s.drop(packet)
+
+			if packet.Type == VideoPacket {
+				s.waitingForKeyframe = true
+			}
+		}
+
+		return true
+
+	default:
+		select {
+		case s.packets <- packet:
+			return true
+		default:
+			return false
+		}
+	}
+}
+
+func (s *Subscription) drop(packet *Packet) {
+	s.dropped.Add(1)
+	s.stream.countDropped(packet)
+}
+
+func (s *Subscription) end(reason CloseReason) {
+	s.closeOnce.Do(func() {
+		// wakes up a publisher blocked on delivery
+		close(s.closing)
+
+		s.sendMu.Lock()
+		defer s.sendMu.Unlock()
+
+		s.reason = reason
+		s.closed = true
+		close(s.packets)
+	})
+}
@@ -0,0 +1,115 @@
+package registry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDropUntilKeyframePolicy(t *testing.T) {
+	r := New(Options{GopCacheMaxBytes: -1})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	sub, _ := stream.Subscribe(SubscribeOptions{Policy: DropUntilKeyframe, QueueSize: 2})
+
+	first := videoPacket(0, true, false)
+	second := videoPacket(33, false, false)
+
+	stream.WritePacket(first)
+	stream.WritePacket(second)
+
+	// queue is full, the frame gets dropped and so do the following ones until a keyframe
+	stream.WritePacket(videoPacket(66, false, false))
+
+	assert.Equal(t, first, <-sub.Packets())
+	assert.Equal(t, second, <-sub.Packets())
+
+	stream.WritePacket(videoPacket(100, false, false))
+
+	audio := audioPacket(110, false)
+	stream.WritePacket(audio)
+
+	keyFrame := videoPacket(133, true, false)
+	stream.WritePacket(keyFrame)
+
+	assert.Equal(t, audio, <-sub.Packets())
+	assert.Equal(t, keyFrame, <-sub.Packets())
+
+	stats := stream.Stats()
+	assert.Equal(t, uint64(2), sub.Dropped())
+	assert.Equal(t, uint64(2), stats.DroppedVideoPackets)
+	assert.Equal(t, uint64(0), stats.DroppedAudioPackets)
+	assert.Equal(t, 1, stats.Subscribers)
+}
+
+func TestBlockPublisherPolicy(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	sub, _ := stream.Subscribe(SubscribeOptions{Policy: BlockPublisher, QueueSize: 1})
+
+	stream.WritePacket(audioPacket(0, false))
+
+	written := make(chan struct{})
+	go func() {
+		stream.WritePacket(audioPacket(23, false))
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("publisher should be blocked by the subscriber")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-sub.Packets()
+	<-written
+
+	// closing the subscription releases a blocked publisher
+	released := make(chan struct{})
+	go func() {
+		stream.WritePacket(audioPacket(69, false))
+		close(released)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	sub.Close()
+	<-released
+
+	assert.Equal(t, ReasonUnsubscribed, sub.Reason())
+	assert.Equal(t, uint64(0), sub.Dropped())
+}
+
+func TestDisconnectSlowSubscriberPolicy(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	sub, _ := stream.Subscribe(SubscribeOptions{QueueSize: 1})
+
+	stream.WritePacket(audioPacket(0, false))
+	stream.WritePacket(audioPacket(23, false))
+
+	<-sub.Packets()
+	_, ok := <-sub.Packets()
+	assert.False(t, ok)
+	assert.Equal(t, ReasonOverflow, sub.Reason())
+	assert.Equal(t, uint64(1), stream.Stats().DisconnectedSubscribers)
+}
+
+func TestPassiveSubscribersAreNotActive(t *testing.T) {
+	r := New(Options{})
+	stream, _ := r.Publish(Key{Name: "key"})
+
+	passive, _ := stream.Subscribe(SubscribeOptions{Passive: true})
+	assert.Equal(t, 1, stream.Stats().Subscribers)
+	assert.Equal(t, 0, stream.Stats().ActiveSubscribers)
+
+	active, _ := stream.Subscribe(SubscribeOptions{})
+	assert.Equal(t, 2, stream.Stats().Subscribers)
+	assert.Equal(t, 1, stream.Stats().ActiveSubscribers)
+
+	active.Close()
+	passive.Close()
+	assert.Equal(t, 0, stream.Stats().Subscribers)
+}
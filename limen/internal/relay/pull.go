@@ -0,0 +1,307 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp"
+)
+
+const (
+	DefaultIdleTimeout = 10 * time.Second
+
+	idleCheckInterval = time.Second
+)
+
+var (
+	ErrNoOrigin        = errors.New("relay: no origin configured for the stream")
+	ErrPullerClosed    = errors.New("relay: puller closed")
+	ErrInvalidPullRule = errors.New("relay: invalid pull rule")
+)
+
+// PullRule plays streams requested under the app and name from the origin,
+// empty app or name match any value.
+//
+// Origin is an rtmp url in which "{app}" and "{name}" get replaced
+// with the app and the name of the requested stream.
+type PullRule struct {
+	App    string
+	Name   string
+	Origin string
+}
+
+func (r PullRule) matches(key registry.Key) bool {
+	return (r.App == "" || r.App == key.App) && (r.Name == "" || r.Name == key.Name)
+}
+
+// ParsePullRule parses a rule in the form of "app[/name]=url",
+// a "*" app or name matches any value.
+func ParsePullRule(value string) (PullRule, error) {
+	rule, err := ParsePushRule(value)
+	if err != nil {
+		return PullRule{}, ErrInvalidPullRule
+	}
+
+	return PullRule{App: rule.App, Name: rule.Name, Origin: rule.Targets[0]}, nil
+}
+
+type PullOptions struct {
+	Rules  []PullRule
+	Logger *slog.Logger
+	// IdleTimeout is how long a pulled stream stays alive without
+	// any active subscribers, zero means the default.
+	IdleTimeout time.Duration
+}
+
+// PullStatus describes a stream pulled from an origin.
+type PullStatus struct {
+	Key     registry.Key
+	URL     string
+	Viewers int
+}
+
+// Puller republishes streams played from origin servers into the registry,
+// all local players of a stream share a single connection to the origin.
+type Puller struct {
+	options  PullOptions
+	registry *registry.Registry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	pulls   map[registry.Key]*pull
+	running sync.WaitGroup
+}
+
+type pull struct {
+	key    registry.Key
+	url    string
+	logger *slog.Logger
+
+	// closed once the stream is published or pulling it failed
+	ready  chan struct{}
+	err    error
+	stream *registry.Stream
+}
+
+func NewPuller(streams *registry.Registry, options PullOptions) *Puller {
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	if options.IdleTimeout <= 0 {
+		options.IdleTimeout = DefaultIdleTimeout
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Puller{
+		options:  options,
+		registry: streams,
+		ctx:      ctx,
+		cancel:   cancel,
+		pulls:    make(map[registry.Key]*pull),
+	}
+}
+
+// Pull makes sure the stream gets published in the registry by playing it from
+// its origin, it returns once the stream is published or pulling it failed.
+//
+// The stream has to be subscribed to within the idle timeout, otherwise it is
+// considered to be idle and it gets unpublished.
+func (p *Puller) Pull(ctx context.Context, key registry.Key) error {
+	p.mu.Lock()
+
+	if p.ctx.Err() != nil {
+		p.mu.Unlock()
+		return ErrPullerClosed
+	}
+
+	current, ok := p.pulls[key]
+	if !ok {
+		url, found := p.origin(key)
+		if !found {
+			p.mu.Unlock()
+			return ErrNoOrigin
+		}
+
+		current = &pull{
+			key:    key,
+			url:    url,
+			logger: p.options.Logger.With("stream", key.String(), "origin", url),
+			ready:  make(chan struct{}),
+		}
+
+		p.pulls[key] = current
+		p.running.Add(1)
+
+		go func() {
+			defer p.running.Done()
+
+			p.run(current)
+
+			p.mu.Lock()
+			delete(p.pulls, key)
+			p.mu.Unlock()
+		}()
+	}
+
+	p.mu.Unlock()
+
+	select {
+	case <-current.ready:
+		return current.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close ends all pulled streams.
+func (p *Puller) Close() {
+	p.cancel()
+	p.running.Wait()
+}
+
+// Status lists the currently pulled streams.
+func (p *Puller) Status() []PullStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]PullStatus, 0, len(p.pulls))
+	for _, pull := range p.pulls {
+		status := PullStatus{Key: pull.key, URL: pull.url}
+
+		select {
+		case <-pull.ready:
+			if pull.stream != nil {
+				status.Viewers = pull.stream.Stats().ActiveSubscribers
+			}
+		default:
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+func (p *Puller) origin(key registry.Key) (string, bool) {
+	for _, rule := range p.options.Rules {
+		if rule.matches(key) {
+			return strings.NewReplacer("{app}", key.App, "{name}", key.Name).Replace(rule.Origin), true
+		}
+	}
+
+	return "", false
+}
+
+// run plays the stream from the origin until either the origin ends it
+// or the local stream becomes idle.
+func (p *Puller) run(pull *pull) {
+	client, err := p.connect(pull)
+	if err != nil {
+		pull.logger.Info("Failed to pull stream", "error", err)
+
+		pull.err = err
+		close(pull.ready)
+		return
+	}
+	defer client.Close()
+
+	stream, err := p.registry.PublishFrom(pull.key, pull.url)
+	if err != nil {
+		// published locally in the meantime
+		pull.err = err
+		close(pull.ready)
+		return
+	}
+	defer stream.Unpublish()
+
+	pull.stream = stream
+	close(pull.ready)
+
+	pull.logger.Info("Pulling stream")
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go p.closeWhenIdle(client, stream, stopped)
+
+	for {
+		data, err := client.ReadMedia()
+		if err != nil {
+			if err != io.EOF && err != rtmp.ErrClientClosed {
+				pull.logger.Info("Pulling stream failed", "error", err)
+			}
+
+			pull.logger.Info("Stopped pulling stream")
+			return
+		}
+
+		packet := &registry.Packet{Type: data.Type, Timestamp: data.Timestamp, Data: data.Data}
+		if packet.Type == registry.MetadataPacket {
+			stream.SetMetadata(packet)
+		} else {
+			stream.WritePacket(packet)
+		}
+	}
+}
+
+func (p *Puller) connect(pull *pull) (*rtmp.Client, error) {
+	ctx, cancel := context.WithTimeout(p.ctx, dialTimeout)
+	defer cancel()
+
+	client, err := rtmp.Dial(ctx, pull.url)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := client.Play(ctx); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// closeWhenIdle closes the client once the stream has no active subscribers
+// for the idle timeout, the local stream gets unpublished or the puller closes.
+func (p *Puller) closeWhenIdle(client *rtmp.Client, stream *registry.Stream, stopped <-chan struct{}) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	if p.options.IdleTimeout < idleCheckInterval {
+		ticker.Reset(p.options.IdleTimeout)
+	}
+
+	idleSince := time.Now()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if stream.Stats().ActiveSubscribers > 0 {
+				idleSince = now
+				continue
+			}
+
+			if now.Sub(idleSince) < p.options.IdleTimeout {
+				continue
+			}
+
+		case <-stream.Done():
+		case <-p.ctx.Done():
+		case <-stopped:
+			return
+		}
+
+		client.Close()
+		return
+	}
+}
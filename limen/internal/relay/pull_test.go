@@ -0,0 +1,183 @@
+package relay
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp"
+)
+
+func startEdge(t *testing.T, puller *Puller, streams *registry.Registry) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	callbacks := &rtmp.HandlerCallabcks{
+		OnAuthorize:    func(streamKey string) bool { return true },
+		OnPlay:         func(streamKey string) bool { return true },
+		OnSetDataFrame: func(message rtmp.SetDataFrameMessage) bool { return true },
+		OnStreamMissing: func(app string, streamKey string) bool {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			return puller.Pull(ctx, registry.Key{App: app, Name: streamKey}) == nil
+		},
+	}
+
+	server := &rtmp.RtmpServer{Logger: discardLogger, Handler: func(ctx context.Context, conn net.Conn) error {
+		return rtmp.NewHandler(conn, discardLogger, callbacks, streams).Run(ctx)
+	}}
+
+	go server.Serve(context.Background(), listener)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	})
+
+	return "rtmp://" + listener.Addr().String()
+}
+
+func play(t *testing.T, url string) (*rtmp.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := rtmp.Dial(ctx, url)
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { client.Close() })
+
+	return client, client.Play(ctx)
+}
+
+func readMedia(t *testing.T, client *rtmp.Client) *rtmp.MediaStreamData {
+	data, err := client.ReadMedia()
+	assert.Nil(t, err)
+
+	return data
+}
+
+func TestPullSharesOriginConnection(t *testing.T) {
+	origin, originAddr := startUpstream(t, func(streamKey string) bool { return true })
+
+	source, err := origin.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+	source.WritePacket(videoPacket(0, true, true))
+	source.WritePacket(videoPacket(0, true, false))
+
+	local := registry.New(registry.Options{})
+	puller := NewPuller(local, PullOptions{
+		Logger:      discardLogger,
+		IdleTimeout: 50 * time.Millisecond,
+		Rules:       []PullRule{{App: "live", Origin: "rtmp://" + originAddr + "/live/{name}"}},
+	})
+	defer puller.Close()
+
+	edge := startEdge(t, puller, local)
+
+	first, err := play(t, edge+"/live/key")
+	assert.Nil(t, err)
+	assert.Equal(t, videoPacket(0, true, true).Data, readMedia(t, first).Data)
+	assert.Equal(t, videoPacket(0, true, false).Data, readMedia(t, first).Data)
+
+	second, err := play(t, edge+"/live/key")
+	assert.Nil(t, err)
+	assert.Equal(t, videoPacket(0, true, true).Data, readMedia(t, second).Data)
+	assert.Equal(t, videoPacket(0, true, false).Data, readMedia(t, second).Data)
+
+	// both players are served by a single connection to the origin
+	assert.Equal(t, 1, source.Stats().ActiveSubscribers)
+	assert.Equal(t, []PullStatus{{
+		Key:     registry.Key{App: "live", Name: "key"},
+		URL:     "rtmp://" + originAddr + "/live/key",
+		Viewers: 2,
+	}}, puller.Status())
+
+	// the pulled stream is not pushed anywhere
+	pulled, _ := local.Lookup(registry.Key{App: "live", Name: "key"})
+	assert.Equal(t, "rtmp://"+originAddr+"/live/key", pulled.Origin)
+
+	source.WritePacket(videoPacket(40, false, false))
+	assert.Equal(t, videoPacket(40, false, false).Data, readMedia(t, first).Data)
+	assert.Equal(t, videoPacket(40, false, false).Data, readMedia(t, second).Data)
+
+	first.Close()
+	second.Close()
+
+	// the origin connection goes away once the stream becomes idle
+	assert.Eventually(t, func() bool {
+		_, published := local.Lookup(registry.Key{App: "live", Name: "key"})
+		return !published && source.Stats().Subscribers == 0 && len(puller.Status()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPullEndsWithOriginStream(t *testing.T) {
+	origin, originAddr := startUpstream(t, func(streamKey string) bool { return true })
+
+	source, err := origin.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+	source.WritePacket(videoPacket(0, true, false))
+
+	local := registry.New(registry.Options{})
+	puller := NewPuller(local, PullOptions{
+		Logger: discardLogger,
+		Rules:  []PullRule{{Origin: "rtmp://" + originAddr + "/{app}/{name}"}},
+	})
+	defer puller.Close()
+
+	player, err := play(t, startEdge(t, puller, local)+"/live/key")
+	assert.Nil(t, err)
+	assert.Equal(t, videoPacket(0, true, false).Data, readMedia(t, player).Data)
+
+	source.Unpublish()
+
+	for {
+		if _, err := player.ReadMedia(); err != nil {
+			assert.Equal(t, "NetStream.Play.UnpublishNotify", player.Status().Code)
+			break
+		}
+	}
+
+	assert.Eventually(t, func() bool {
+		return len(puller.Status()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPullFailures(t *testing.T) {
+	_, originAddr := startUpstream(t, func(streamKey string) bool { return true })
+
+	local := registry.New(registry.Options{})
+	puller := NewPuller(local, PullOptions{
+		Logger: discardLogger,
+		Rules:  []PullRule{{App: "live", Name: "key", Origin: "rtmp://" + originAddr + "/live/key"}},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Equal(t, ErrNoOrigin, puller.Pull(ctx, registry.Key{App: "live", Name: "other"}))
+
+	// the origin does not have the stream either
+	assert.ErrorIs(t, puller.Pull(ctx, registry.Key{App: "live", Name: "key"}), rtmp.ErrCommandRejected)
+
+	_, err := play(t, startEdge(t, puller, local)+"/live/key")
+	assert.ErrorIs(t, err, rtmp.ErrCommandRejected)
+
+	puller.Close()
+	assert.Equal(t, ErrPullerClosed, puller.Pull(ctx, registry.Key{App: "live", Name: "key"}))
+}
+
+func TestParsePullRule(t *testing.T) {
+	rule, err := ParsePullRule("live/*=rtmp://origin/live/{name}")
+	assert.Nil(t, err)
+	assert.Equal(t, PullRule{App: "live", Origin: "rtmp://origin/live/{name}"}, rule)
+
+	_, err = ParsePullRule("live")
+	assert.Equal(t, ErrInvalidPullRule, err)
+}
@@ -0,0 +1,357 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp"
+)
+
+const (
+	DefaultMinBackoff = time.Second
+	DefaultMaxBackoff = 30 * time.Second
+
+	dialTimeout = 10 * time.Second
+)
+
+var (
+	ErrStreamEnded     = errors.New("relay: stream ended")
+	ErrInvalidPushRule = errors.New("relay: invalid push rule")
+)
+
+// PushRule forwards streams published under the app and name
+// to the targets, empty app or name match any value.
+//
+// Targets are rtmp urls in which "{app}" and "{name}" get replaced
+// with the app and the name of the published stream.
+type PushRule struct {
+	App     string
+	Name    string
+	Targets []string
+}
+
+// ParsePushRule parses a rule in the form of "app[/name]=url",
+// a "*" app or name matches any value.
+func ParsePushRule(value string) (PushRule, error) {
+	pattern, target, ok := strings.Cut(value, "=")
+	if !ok || pattern == "" || target == "" {
+		return PushRule{}, ErrInvalidPushRule
+	}
+
+	app, name, _ := strings.Cut(pattern, "/")
+	if app == "*" {
+		app = ""
+	}
+	if name == "*" {
+		name = ""
+	}
+
+	return PushRule{App: app, Name: name, Targets: []string{target}}, nil
+}
+
+func (r PushRule) matches(key registry.Key) bool {
+	return (r.App == "" || r.App == key.App) && (r.Name == "" || r.Name == key.Name)
+}
+
+type PushOptions struct {
+	Rules  []PushRule
+	Logger *slog.Logger
+	// MinBackoff and MaxBackoff bound the exponentially growing delay
+	// between reconnection attempts, zero means the default.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+type TargetState uint8
+
+const (
+	TargetConnecting TargetState = 0
+	TargetPublishing TargetState = 1
+	// TargetRetrying waits before reconnecting after a failure.
+	TargetRetrying TargetState = 2
+)
+
+func (s TargetState) String() string {
+	switch s {
+	case TargetConnecting:
+		return "connecting"
+	case TargetPublishing:
+		return "publishing"
+	case TargetRetrying:
+		return "retrying"
+	default:
+		return "unknown"
+	}
+}
+
+// TargetStatus describes a single outbound session of a relayed stream.
+type TargetStatus struct {
+	Key   registry.Key
+	URL   string
+	State TargetState
+	// Failures counts failed attempts since the last successful publish
+	Failures  int
+	LastError error
+	// Packets counts packets forwarded to the target in total
+	Packets uint64
+}
+
+// Pusher forwards published streams to upstream RTMP servers.
+//
+// Each target gets its own subscription which drops packets when
+// the target can't keep up, a target that is slow or down never
+// affects the local ingest nor the other targets.
+//
+// Streams relayed from an origin, such as the ones of a Puller, are never
+// forwarded, with overlapping rules they would be pushed back to the origin.
+type Pusher struct {
+	options  PushOptions
+	registry *registry.Registry
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	targets map[*pushTarget]struct{}
+	running sync.WaitGroup
+	unwatch func()
+}
+
+type pushTarget struct {
+	pusher *Pusher
+	stream *registry.Stream
+	logger *slog.Logger
+
+	mu     sync.Mutex
+	status TargetStatus
+}
+
+func NewPusher(streams *registry.Registry, options PushOptions) *Pusher {
+	if options.Logger == nil {
+		options.Logger = slog.Default()
+	}
+
+	if options.MinBackoff <= 0 {
+		options.MinBackoff = DefaultMinBackoff
+	}
+
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = DefaultMaxBackoff
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Pusher{
+		options:  options,
+		registry: streams,
+		ctx:      ctx,
+		cancel:   cancel,
+		targets:  make(map[*pushTarget]struct{}),
+	}
+}
+
+// Start forwards streams published from now on, streams which
+// are already live are forwarded as well.
+func (p *Pusher) Start() {
+	p.mu.Lock()
+	p.unwatch = p.registry.Watch(func(event registry.Event) {
+		if event.Type == registry.StreamPublished {
+			p.push(event.Stream)
+		}
+	})
+	p.mu.Unlock()
+
+	for _, key := range p.registry.Keys() {
+		if stream, ok := p.registry.Lookup(key); ok {
+			p.push(stream)
+		}
+	}
+}
+
+// Close stops forwarding and waits for all outbound sessions to end.
+func (p *Pusher) Close() {
+	p.mu.Lock()
+	if p.unwatch != nil {
+		p.unwatch()
+		p.unwatch = nil
+	}
+	p.mu.Unlock()
+
+	p.cancel()
+	p.running.Wait()
+}
+
+// Status lists the targets of all currently relayed streams.
+func (p *Pusher) Status() []TargetStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]TargetStatus, 0, len(p.targets))
+	for target := range p.targets {
+		statuses = append(statuses, target.currentStatus())
+	}
+
+	return statuses
+}
+
+func (p *Pusher) push(stream *registry.Stream) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.ctx.Err() != nil || stream.Origin != "" {
+		return
+	}
+
+	for target := range p.targets {
+		// the stream might get reported by both Start and the watcher
+		if target.stream == stream {
+			return
+		}
+	}
+
+	for _, rule := range p.options.Rules {
+		if !rule.matches(stream.Key) {
+			continue
+		}
+
+		for _, url := range rule.Targets {
+			url = strings.NewReplacer("{app}", stream.Key.App, "{name}", stream.Key.Name).Replace(url)
+
+			target := &pushTarget{
+				pusher: p,
+				stream: stream,
+				logger: p.options.Logger.With("stream", stream.Key.String(), "target", url),
+				status: TargetStatus{Key: stream.Key, URL: url, State: TargetConnecting},
+			}
+
+			p.targets[target] = struct{}{}
+			p.running.Add(1)
+
+			go func() {
+				defer p.running.Done()
+
+				target.run(p.ctx)
+
+				p.mu.Lock()
+				delete(p.targets, target)
+				p.mu.Unlock()
+			}()
+		}
+	}
+}
+
+// run keeps the target published until the stream ends.
+func (t *pushTarget) run(ctx context.Context) {
+	backoff := t.pusher.options.MinBackoff
+
+	for {
+		t.setState(TargetConnecting)
+
+		published, err := t.forward(ctx)
+		if errors.Is(err, ErrStreamEnded) || ctx.Err() != nil {
+			t.logger.Info("Stopped relaying stream")
+			return
+		}
+
+		if published {
+			backoff = t.pusher.options.MinBackoff
+		}
+
+		t.mu.Lock()
+		t.status.State = TargetRetrying
+		t.status.Failures++
+		t.status.LastError = err
+		t.mu.Unlock()
+
+		t.logger.Info("Relaying stream failed, reconnecting", "error", err, "backoff", backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-t.stream.Done():
+			return
+		case <-ctx.Done():
+			return
+		}
+
+		backoff *= 2
+		if backoff > t.pusher.options.MaxBackoff {
+			backoff = t.pusher.options.MaxBackoff
+		}
+	}
+}
+
+// forward publishes the stream to the target and sends its packets
+// until either of them ends, returns whether publishing has started.
+func (t *pushTarget) forward(ctx context.Context) (bool, error) {
+	// a fresh subscription starts with the metadata and sequence headers,
+	// packets published in the meantime wait in its queue until connected
+	subscription, err := t.stream.Subscribe(registry.SubscribeOptions{Policy: registry.DropUntilKeyframe})
+	if err != nil {
+		return false, ErrStreamEnded
+	}
+	defer subscription.Close()
+
+	dialCtx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	client, err := rtmp.Dial(dialCtx, t.currentStatus().URL)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	if err := client.Publish(dialCtx); err != nil {
+		return false, err
+	}
+
+	t.mu.Lock()
+	t.status.State = TargetPublishing
+	t.status.Failures = 0
+	t.status.LastError = nil
+	t.mu.Unlock()
+
+	t.logger.Info("Relaying stream")
+
+	for {
+		select {
+		case packet, ok := <-subscription.Packets():
+			if !ok {
+				return true, ErrStreamEnded
+			}
+
+			err := client.WriteMedia(&rtmp.MediaStreamData{Type: packet.Type, Timestamp: packet.Timestamp, Data: packet.Data})
+			if err != nil {
+				return true, err
+			}
+
+			t.mu.Lock()
+			t.status.Packets++
+			t.mu.Unlock()
+
+		case <-client.Done():
+			return true, client.Err()
+
+		case <-ctx.Done():
+			return true, ctx.Err()
+		}
+	}
+}
+
+func (t *pushTarget) setState(state TargetState) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status.State = state
+}
+
+func (t *pushTarget) currentStatus() TargetStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.status
+}
@@ -0,0 +1,255 @@
+package relay
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func startUpstream(t *testing.T, authorize func(streamKey string) bool) (*registry.Registry, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	streams := registry.New(registry.Options{})
+	callbacks := &rtmp.HandlerCallabcks{
+		OnAuthorize:    authorize,
+		OnPlay:         func(streamKey string) bool { return true },
+		OnSetDataFrame: func(message rtmp.SetDataFrameMessage) bool { return true },
+	}
+
+	server := &rtmp.RtmpServer{Logger: discardLogger, Handler: func(ctx context.Context, conn net.Conn) error {
+		return rtmp.NewHandler(conn, discardLogger, callbacks, streams).Run(ctx)
+	}}
+
+	go server.Serve(context.Background(), listener)
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	})
+
+	return streams, listener.Addr().String()
+}
+
+func videoPacket(timestamp uint32, keyFrame bool, config bool) *registry.Packet {
+	frameType := byte(2)
+	if keyFrame {
+		frameType = 1
+	}
+
+	avcPacketType := byte(1)
+	if config {
+		avcPacketType = 0
+	}
+
+	return &registry.Packet{
+		Type:      registry.VideoPacket,
+		Timestamp: timestamp,
+		Data:      []byte{frameType<<4 | 7, avcPacketType, 0x0, 0x0, 0x0, 0xff, 0xff},
+	}
+}
+
+func waitForStream(t *testing.T, streams *registry.Registry, key registry.Key) *registry.Stream {
+	var stream *registry.Stream
+
+	assert.Eventually(t, func() bool {
+		var ok bool
+		stream, ok = streams.Lookup(key)
+		return ok
+	}, 5*time.Second, 10*time.Millisecond)
+
+	return stream
+}
+
+func readPacket(t *testing.T, subscription *registry.Subscription) *registry.Packet {
+	select {
+	case packet := <-subscription.Packets():
+		return packet
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a packet")
+		return nil
+	}
+}
+
+func TestPushForwardsStream(t *testing.T) {
+	upstream, addr := startUpstream(t, func(streamKey string) bool { return true })
+
+	local := registry.New(registry.Options{})
+	pusher := NewPusher(local, PushOptions{
+		Logger: discardLogger,
+		Rules: []PushRule{
+			{App: "live", Targets: []string{"rtmp://" + addr + "/relayed/{name}"}},
+			{App: "other", Targets: []string{"rtmp://" + addr + "/other/{name}"}},
+		},
+	})
+	pusher.Start()
+	defer pusher.Close()
+
+	stream, err := local.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+
+	metadata := &registry.Packet{Type: registry.MetadataPacket, Data: []byte{0x02, 0x00, 0x0a, 'o', 'n', 'M', 'e', 't', 'a', 'D', 'a', 't', 'a', 0x05}}
+	stream.SetMetadata(metadata)
+	stream.WritePacket(videoPacket(0, true, true))
+	stream.WritePacket(videoPacket(0, true, false))
+
+	relayed := waitForStream(t, upstream, registry.Key{App: "relayed", Name: "key"})
+
+	subscription, err := relayed.Subscribe(registry.SubscribeOptions{})
+	assert.Nil(t, err)
+
+	assert.Eventually(t, func() bool {
+		statuses := pusher.Status()
+		return len(statuses) == 1 && statuses[0].State == TargetPublishing
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the cache of the upstream stream gets filled by the relay asynchronously
+	assert.Eventually(t, func() bool {
+		return relayed.Metadata() != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	stream.WritePacket(videoPacket(40, false, false))
+
+	var received []*registry.Packet
+	for len(received) == 0 || received[len(received)-1].Timestamp != 40 {
+		received = append(received, readPacket(t, subscription))
+	}
+
+	assert.Equal(t, metadata.Data, relayed.Metadata().Data)
+	assert.Equal(t, videoPacket(40, false, false).Data, received[len(received)-1].Data)
+
+	status := pusher.Status()[0]
+	assert.Equal(t, registry.Key{App: "live", Name: "key"}, status.Key)
+	assert.Equal(t, "rtmp://"+addr+"/relayed/key", status.URL)
+	assert.Equal(t, 0, status.Failures)
+
+	stream.Unpublish()
+
+	// ending the local stream ends the upstream one
+	_, ok := <-subscription.Packets()
+	assert.False(t, ok)
+	assert.Eventually(t, func() bool {
+		return len(pusher.Status()) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPushReconnectsToFailingTarget(t *testing.T) {
+	var accepting atomic.Bool
+	upstream, addr := startUpstream(t, func(streamKey string) bool { return accepting.Load() })
+
+	local := registry.New(registry.Options{})
+	pusher := NewPusher(local, PushOptions{
+		Logger:     discardLogger,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+		Rules: []PushRule{
+			{App: "live", Name: "key", Targets: []string{"rtmp://" + addr + "/relayed/key"}},
+		},
+	})
+	pusher.Start()
+	defer pusher.Close()
+
+	stream, err := local.Publish(registry.Key{App: "live", Name: "key"})
+	assert.Nil(t, err)
+	stream.WritePacket(videoPacket(0, true, true))
+
+	assert.Eventually(t, func() bool {
+		statuses := pusher.Status()
+		return len(statuses) == 1 && statuses[0].State == TargetRetrying && statuses[0].Failures > 1 && statuses[0].LastError != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the local ingest keeps going while the target is down
+	for i := 0; i < 2000; i++ {
+		stream.WritePacket(videoPacket(uint32(i), i%100 == 0, false))
+	}
+
+	accepting.Store(true)
+
+	relayed := waitForStream(t, upstream, registry.Key{App: "relayed", Name: "key"})
+	assert.NotNil(t, relayed)
+
+	assert.Eventually(t, func() bool {
+		statuses := pusher.Status()
+		return len(statuses) == 1 && statuses[0].State == TargetPublishing && statuses[0].Failures == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPushIgnoresUnmatchedStreams(t *testing.T) {
+	_, addr := startUpstream(t, func(streamKey string) bool { return true })
+
+	local := registry.New(registry.Options{})
+
+	// streams published before starting get relayed as well
+	_, err := local.Publish(registry.Key{App: "live", Name: "early"})
+	assert.Nil(t, err)
+
+	pusher := NewPusher(local, PushOptions{
+		Logger: discardLogger,
+		Rules:  []PushRule{{App: "live", Name: "early", Targets: []string{"rtmp://" + addr + "/relayed/{name}"}}},
+	})
+	pusher.Start()
+	defer pusher.Close()
+
+	_, err = local.Publish(registry.Key{App: "live", Name: "other"})
+	assert.Nil(t, err)
+
+	statuses := pusher.Status()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "rtmp://"+addr+"/relayed/early", statuses[0].URL)
+}
+
+func TestPushSkipsPulledStreams(t *testing.T) {
+	_, addr := startUpstream(t, func(streamKey string) bool { return true })
+
+	local := registry.New(registry.Options{})
+
+	pusher := NewPusher(local, PushOptions{
+		Logger: discardLogger,
+		Rules:  []PushRule{{Targets: []string{"rtmp://" + addr + "/{app}/{name}"}}},
+	})
+	pusher.Start()
+	defer pusher.Close()
+
+	// pushing the stream back to where it is pulled from would make a loop
+	_, err := local.PublishFrom(registry.Key{App: "live", Name: "pulled"}, "rtmp://"+addr+"/live/pulled")
+	assert.Nil(t, err)
+
+	_, err = local.Publish(registry.Key{App: "live", Name: "local"})
+	assert.Nil(t, err)
+
+	statuses := pusher.Status()
+	assert.Len(t, statuses, 1)
+	assert.Equal(t, "rtmp://"+addr+"/live/local", statuses[0].URL)
+}
+
+func TestParsePushRule(t *testing.T) {
+	rule, err := ParsePushRule("live/key=rtmp://host/app/key")
+	assert.Nil(t, err)
+	assert.Equal(t, PushRule{App: "live", Name: "key", Targets: []string{"rtmp://host/app/key"}}, rule)
+
+	rule, err = ParsePushRule("*=rtmp://host/{app}/{name}?token=a=b")
+	assert.Nil(t, err)
+	assert.Equal(t, PushRule{Targets: []string{"rtmp://host/{app}/{name}?token=a=b"}}, rule)
+
+	rule, err = ParsePushRule("live=rtmp://host/app/{name}")
+	assert.Nil(t, err)
+	assert.Equal(t, PushRule{App: "live", Targets: []string{"rtmp://host/app/{name}"}}, rule)
+
+	for _, value := range []string{"", "live", "=rtmp://host/app/key", "live="} {
+		_, err := ParsePushRule(value)
+		assert.Equal(t, ErrInvalidPushRule, err, value)
+	}
+}
@@ -0,0 +1,28 @@
+package rtmp
+
+import (
+	"encoding/binary"
+)
+
+type AcknowledgementMessage struct {
+	SequenceNumber uint32
+}
+
+func (c *AcknowledgementMessage) Type() uint8 {
+	return AcknowledgementType
+}
+
+func (c *AcknowledgementMessage) Serialize() []byte {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, c.SequenceNumber)
+	return payload
+}
+
+func (c *AcknowledgementMessage) Deserialize(data []byte) error {
+	if len(data) != 4 {
+		return ErrInvalidMessageFormat
+	}
+	c.SequenceNumber = binary.BigEndian.Uint32(data)
+
+	return nil
+}
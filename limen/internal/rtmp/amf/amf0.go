@@ -1,11 +1,71 @@
 package amf
 
+import "sort"
+
 var (
-  NumberType = byte(0x00)
-  BooleanType = byte(0x01)
-  StringType = byte(0x02)
-  KeyValueObjectType = byte(0x03)
-  NullType = byte(0x05)
-  ECMAArrayType = byte(0x08)
-  ObjectEndMarker = [3]byte{0x00, 0x00, 0x09}
+	NumberType         = byte(0x00)
+	BooleanType        = byte(0x01)
+	StringType         = byte(0x02)
+	KeyValueObjectType = byte(0x03)
+	MovieClipType      = byte(0x04)
+	NullType           = byte(0x05)
+	UndefinedType      = byte(0x06)
+	ReferenceType      = byte(0x07)
+	ECMAArrayType      = byte(0x08)
+	ObjectEndType      = byte(0x09)
+	StrictArrayType    = byte(0x0A)
+	DateType           = byte(0x0B)
+	LongStringType     = byte(0x0C)
+	UnsupportedType    = byte(0x0D)
+	RecordSetType      = byte(0x0E)
+	XMLDocumentType    = byte(0x0F)
+	TypedObjectType    = byte(0x10)
+	AVMPlusType        = byte(0x11)
+	ObjectEndMarker    = [3]byte{0x00, 0x00, 0x09}
 )
+
+// Undefined represents the undefined value.
+type Undefined struct{}
+
+// Unsupported represents a value of a type that could not be serialized by the sender.
+type Unsupported struct{}
+
+// XMLDocument holds a serialized XML document.
+type XMLDocument string
+
+// TypedObject is an anonymous object tagged with the name of its class.
+type TypedObject struct {
+	ClassName  string
+	Properties map[string]interface{}
+}
+
+// Reference points to a complex value (an object, typed object, ECMA or strict array)
+// already serialized in the same message, counting from zero in the order of appearance.
+//
+// It is only used for encoding, the decoder resolves references to the referenced values.
+type Reference uint16
+
+// AVMPlus makes the encoder switch to AMF3 for the wrapped value.
+//
+// It is only used for encoding, the decoder returns the wrapped value.
+type AVMPlus struct {
+	Value interface{}
+}
+
+// OrderedObject is an anonymous object serialized with its properties in the given order,
+// maps on the other hand are serialized with their keys sorted.
+//
+// It is only used for encoding, the decoder returns objects as maps.
+type OrderedObject []*KeyValuePair
+
+// sortedProperties lists the properties of the map ordered by their keys.
+func sortedProperties(properties map[string]interface{}) []*KeyValuePair {
+	pairs := make([]*KeyValuePair, 0, len(properties))
+	for key, value := range properties {
+		pairs = append(pairs, &KeyValuePair{Key: key, Value: value})
+	}
+
+	sort.Slice(pairs, func(i, j int) bool { return pairs[i].Key < pairs[j].Key })
+
+	return pairs
+}
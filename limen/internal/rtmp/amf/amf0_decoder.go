@@ -7,6 +7,7 @@ import (
 	"errors"
 	"io"
 	"math"
+	"time"
 )
 
 type KeyValuePair struct {
@@ -18,16 +19,24 @@ var (
 	ErrNotEnoughData     = errors.New("not enough data")
 	ErrUnknownAMF0Marker = errors.New("unknown AMF0 marker")
 	ErrAmfBufferEmpty    = errors.New("amf buffer empty")
+	ErrReservedAMF0Type  = errors.New("reserved AMF0 type")
+	ErrInvalidReference  = errors.New("invalid AMF reference")
 )
 
-type amf0Decoder struct{}
+type amf0Decoder struct {
+	// complex values decoded so far, referenced by the reference type
+	references []interface{}
+}
 
 func NewAMF0Decoder() *amf0Decoder {
 	return &amf0Decoder{}
 }
 
+// Decode reads all values until the end of the buffer,
+// references can only point to values decoded by the same call.
 func (d *amf0Decoder) Decode(buffer *bufio.Reader) ([]interface{}, error) {
 	items := make([]interface{}, 0)
+	d.references = nil
 
 	for {
 		item, err := d.decodeItem(buffer)
@@ -59,8 +68,29 @@ func (d *amf0Decoder) decodeItem(buffer *bufio.Reader) (interface{}, error) {
 		return d.decodeKeyValueObject(buffer)
 	case NullType:
 		return nil, nil
+	case UndefinedType:
+		return Undefined{}, nil
+	case ReferenceType:
+		return d.decodeReference(buffer)
 	case ECMAArrayType:
 		return d.decodeECMAArray(buffer)
+	case StrictArrayType:
+		return d.decodeStrictArray(buffer)
+	case DateType:
+		return d.decodeDate(buffer)
+	case LongStringType:
+		return d.decodeLongString(buffer)
+	case UnsupportedType:
+		return Unsupported{}, nil
+	case XMLDocumentType:
+		xml, err := d.decodeLongString(buffer)
+		return XMLDocument(xml), err
+	case TypedObjectType:
+		return d.decodeTypedObject(buffer)
+	case AVMPlusType:
+		return NewAMF3Decoder().decodeValue(buffer)
+	case MovieClipType, RecordSetType:
+		return nil, ErrReservedAMF0Type
 	default:
 		return nil, ErrUnknownAMF0Marker
 	}
@@ -101,19 +131,90 @@ func (d *amf0Decoder) decodeString(buffer *bufio.Reader) (string, error) {
 	return string(payload), nil
 }
 
+func (d *amf0Decoder) decodeLongString(buffer *bufio.Reader) (string, error) {
+	var buff [4]byte
+	_, err := io.ReadFull(buffer, buff[:])
+	if err != nil {
+		return "", ErrNotEnoughData
+	}
+
+	// the length comes from the peer, the payload grows as the data gets read
+	length := binary.BigEndian.Uint32(buff[:])
+	payload, err := io.ReadAll(io.LimitReader(buffer, int64(length)))
+	if err != nil || len(payload) != int(length) {
+		return "", ErrNotEnoughData
+	}
+
+	return string(payload), nil
+}
+
+func (d *amf0Decoder) decodeDate(buffer *bufio.Reader) (time.Time, error) {
+	milliseconds, err := d.decodeNumber(buffer)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// the time zone is reserved and should be ignored
+	if _, err := buffer.Discard(2); err != nil {
+		return time.Time{}, ErrNotEnoughData
+	}
+
+	return time.UnixMilli(int64(milliseconds)).UTC(), nil
+}
+
+func (d *amf0Decoder) decodeReference(buffer *bufio.Reader) (interface{}, error) {
+	var buff [2]byte
+	_, err := io.ReadFull(buffer, buff[:])
+	if err != nil {
+		return nil, ErrNotEnoughData
+	}
+
+	index := int(binary.BigEndian.Uint16(buff[:]))
+	if index >= len(d.references) {
+		return nil, ErrInvalidReference
+	}
+
+	return d.references[index], nil
+}
+
 func (d *amf0Decoder) decodeKeyValueObject(buffer *bufio.Reader) (map[string]interface{}, error) {
-	pairs, err := d.decodeKeyValuePairs(buffer)
+	payload := make(map[string]interface{})
+	d.references = append(d.references, payload)
+
+	if err := d.decodeProperties(buffer, payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+func (d *amf0Decoder) decodeTypedObject(buffer *bufio.Reader) (*TypedObject, error) {
+	className, err := d.decodeString(buffer)
 	if err != nil {
 		return nil, err
 	}
 
-	payload := make(map[string]interface{})
+	object := &TypedObject{ClassName: className, Properties: make(map[string]interface{})}
+	d.references = append(d.references, object)
+
+	if err := d.decodeProperties(buffer, object.Properties); err != nil {
+		return nil, err
+	}
+
+	return object, nil
+}
+
+func (d *amf0Decoder) decodeProperties(buffer *bufio.Reader, properties map[string]interface{}) error {
+	pairs, err := d.decodeKeyValuePairs(buffer)
+	if err != nil {
+		return err
+	}
 
 	for _, pair := range pairs {
-		payload[pair.Key] = pair.Value
+		properties[pair.Key] = pair.Value
 	}
 
-	return payload, nil
+	return nil
 }
 
 func (d *amf0Decoder) decodeECMAArray(buffer *bufio.Reader) ([]*KeyValuePair, error) {
@@ -123,7 +224,48 @@ func (d *amf0Decoder) decodeECMAArray(buffer *bufio.Reader) ([]*KeyValuePair, er
 		return nil, ErrNotEnoughData
 	}
 
-	return d.decodeKeyValuePairs(buffer)
+	// the slice is not known until all pairs are read
+	index := len(d.references)
+	d.references = append(d.references, nil)
+
+	pairs, err := d.decodeKeyValuePairs(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	d.references[index] = pairs
+
+	return pairs, nil
+}
+
+func (d *amf0Decoder) decodeStrictArray(buffer *bufio.Reader) ([]interface{}, error) {
+	var buff [4]byte
+	_, err := io.ReadFull(buffer, buff[:])
+	if err != nil {
+		return nil, ErrNotEnoughData
+	}
+
+	count := int(binary.BigEndian.Uint32(buff[:]))
+
+	// the count comes from the peer, the slice grows as the items get read
+	index := len(d.references)
+	d.references = append(d.references, nil)
+
+	items := make([]interface{}, 0)
+	for i := 0; i < count; i++ {
+		item, err := d.decodeItem(buffer)
+		if errors.Is(err, ErrAmfBufferEmpty) {
+			return nil, ErrNotEnoughData
+		} else if err != nil {
+			return nil, err
+		}
+
+		items = append(items, item)
+	}
+
+	d.references[index] = items
+
+	return items, nil
 }
 
 func (d *amf0Decoder) decodeKeyValuePairs(buffer *bufio.Reader) ([]*KeyValuePair, error) {
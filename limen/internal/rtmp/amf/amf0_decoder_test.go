@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -188,3 +189,216 @@ func TestDecodeAMF0ECMAArray(t *testing.T) {
 		assert.Equal(t, pairs[0].Value, "world")
 	}
 }
+
+func TestDecodeAMF0Undefined(t *testing.T) {
+	payload := []byte{
+		// type
+		0x06,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{Undefined{}}, decoded)
+}
+
+func TestDecodeAMF0Unsupported(t *testing.T) {
+	payload := []byte{
+		// type
+		0x0D,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{Unsupported{}}, decoded)
+}
+
+func TestDecodeAMF0StrictArray(t *testing.T) {
+	payload := []byte{
+		// type
+		0x0A,
+		// count
+		0x00, 0x00, 0x00, 0x02,
+		// item 1
+		0x01, 0x01,
+		// item 2
+		0x02, 0x00, 0x02, 0x68, 0x69,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{true, "hi"}}, decoded)
+
+	// count larger than the number of items
+	payload = []byte{
+		// type
+		0x0A,
+		// count
+		0x00, 0x00, 0x00, 0x02,
+		// item 1
+		0x01, 0x01,
+	}
+	buffer = bufio.NewReader(bytes.NewReader(payload))
+	_, err = decoder.Decode(buffer)
+	assert.Equal(t, ErrNotEnoughData, err)
+}
+
+func TestDecodeAMF0Date(t *testing.T) {
+	payload := []byte{
+		// type
+		0x0B,
+		// milliseconds since epoch, 1000000000000
+		0x42, 0x6d, 0x1a, 0x94, 0xa2, 0x00, 0x00, 0x00,
+		// time zone
+		0x00, 0x00,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{time.UnixMilli(1000000000000).UTC()}, decoded)
+	assert.Equal(t, 0, buffer.Buffered())
+}
+
+func TestDecodeAMF0LongString(t *testing.T) {
+	payload := []byte{
+		// type
+		0x0C,
+		// length
+		0x00, 0x00, 0x00, 0x05,
+		// payload
+		0x68, 0x65, 0x6c, 0x6c, 0x6f,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{"hello"}, decoded)
+
+	// the length is not trusted before the data arrives
+	payload = []byte{
+		// type
+		0x0C,
+		// length
+		0xff, 0xff, 0xff, 0xff,
+	}
+	buffer = bufio.NewReader(bytes.NewReader(payload))
+	_, err = decoder.Decode(buffer)
+	assert.Equal(t, ErrNotEnoughData, err)
+}
+
+func TestDecodeAMF0XMLDocument(t *testing.T) {
+	payload := []byte{
+		// type
+		0x0F,
+		// length
+		0x00, 0x00, 0x00, 0x04,
+		// payload
+		0x3c, 0x61, 0x2f, 0x3e,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{XMLDocument("<a/>")}, decoded)
+}
+
+func TestDecodeAMF0TypedObject(t *testing.T) {
+	payload := []byte{
+		// type
+		0x10,
+		// class name
+		0x00, 0x03, 0x46, 0x6f, 0x6f,
+		// key 1
+		0x00, 0x01, 0x61,
+		// value 1
+		0x05,
+		// end marker
+		0x00, 0x00, 0x09,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": nil}}}, decoded)
+}
+
+func TestDecodeAMF0Reference(t *testing.T) {
+	payload := []byte{
+		// type - strict array, reference 0
+		0x0A,
+		// count
+		0x00, 0x00, 0x00, 0x02,
+		// item 1 type - object, reference 1
+		0x03,
+		// key 1
+		0x00, 0x01, 0x61,
+		// value 1
+		0x01, 0x01,
+		// end marker
+		0x00, 0x00, 0x09,
+		// item 2 type - reference
+		0x07,
+		// index
+		0x00, 0x01,
+		// type - reference
+		0x07,
+		// index
+		0x00, 0x00,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+
+	object := map[string]interface{}{"a": true}
+	array := []interface{}{object, object}
+	assert.Equal(t, []interface{}{array, array}, decoded)
+
+	// reference to a value which has not been decoded
+	payload = []byte{
+		// type
+		0x07,
+		// index
+		0x00, 0x00,
+	}
+	buffer = bufio.NewReader(bytes.NewReader(payload))
+	_, err = decoder.Decode(buffer)
+	assert.Equal(t, ErrInvalidReference, err)
+}
+
+func TestDecodeAMF0AVMPlus(t *testing.T) {
+	payload := []byte{
+		// type
+		0x11,
+		// AMF3 integer
+		0x04,
+		// value
+		0x81, 0x00,
+		// type
+		0x11,
+		// AMF3 string
+		0x06,
+		// length and inline flag
+		0x05,
+		// payload
+		0x68, 0x69,
+	}
+	decoder := NewAMF0Decoder()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	decoded, err := decoder.Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{float64(128), "hi"}, decoded)
+}
+
+func TestDecodeAMF0ReservedTypes(t *testing.T) {
+	decoder := NewAMF0Decoder()
+
+	for _, marker := range []byte{MovieClipType, RecordSetType} {
+		buffer := bufio.NewReader(bytes.NewReader([]byte{marker}))
+		_, err := decoder.Decode(buffer)
+		assert.Equal(t, ErrReservedAMF0Type, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
+	"time"
 )
 
 var UnsupportedAMFTypeErr = errors.New("unsupported AMF type")
@@ -23,13 +24,38 @@ func (e *amf0Encoder) Encode(value interface{}) ([]byte, error) {
 	case bool:
 		return encodeBool(value), nil
 	case string:
+		if len(value) > math.MaxUint16 {
+			return encodeLongString(LongStringType, value), nil
+		}
 		return encodeString(value), nil
 	case nil:
 		return encodeNil(), nil
+	case Undefined:
+		return []byte{UndefinedType}, nil
+	case Unsupported:
+		return []byte{UnsupportedType}, nil
+	case Reference:
+		return encodeReference(value), nil
+	case time.Time:
+		return encodeDate(value), nil
+	case XMLDocument:
+		return encodeLongString(XMLDocumentType, string(value)), nil
 	case map[string]interface{}:
 		return e.encodeMap(value)
+	case OrderedObject:
+		return e.encodeProperties([]byte{KeyValueObjectType}, value)
+	case *TypedObject:
+		return e.encodeTypedObject(value)
 	case []*KeyValuePair:
 		return e.encodeArray(value)
+	case []interface{}:
+		return e.encodeStrictArray(value)
+	case AVMPlus:
+		encoded, err := NewAMF3Encoder().Encode(value.Value)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{AVMPlusType}, encoded...), nil
 	}
 
 	return nil, UnsupportedAMFTypeErr
@@ -70,22 +96,55 @@ func encodeRawString(value string) []byte {
 	return append(buff, []byte(value)...)
 }
 
+func encodeLongString(marker byte, value string) []byte {
+	buff := make([]byte, 5)
+	buff[0] = marker
+	binary.BigEndian.PutUint32(buff[1:], uint32(len(value)))
+
+	return append(buff, []byte(value)...)
+}
+
+func encodeReference(value Reference) []byte {
+	buff := make([]byte, 3)
+	buff[0] = ReferenceType
+	binary.BigEndian.PutUint16(buff[1:], uint16(value))
+
+	return buff
+}
+
+// encodeDate serializes the time with millisecond precision, the time zone is always zero.
+func encodeDate(value time.Time) []byte {
+	buff := make([]byte, 11)
+	buff[0] = DateType
+	binary.BigEndian.PutUint64(buff[1:], math.Float64bits(float64(value.UnixMilli())))
+
+	return buff
+}
+
 func encodeNil() []byte {
 	return []byte{NullType}
 }
 
 func (e *amf0Encoder) encodeMap(valueMap map[string]interface{}) ([]byte, error) {
+	return e.encodeProperties([]byte{KeyValueObjectType}, sortedProperties(valueMap))
+}
+
+func (e *amf0Encoder) encodeTypedObject(value *TypedObject) ([]byte, error) {
+	return e.encodeProperties(append([]byte{TypedObjectType}, encodeRawString(value.ClassName)...), sortedProperties(value.Properties))
+}
+
+func (e *amf0Encoder) encodeProperties(prefix []byte, properties []*KeyValuePair) ([]byte, error) {
 	buff := new(bytes.Buffer)
 	writer := bufio.NewWriter(buff)
-	writer.WriteByte(KeyValueObjectType)
+	writer.Write(prefix)
 
-	for key, value := range valueMap {
-		_, err := writer.Write(encodeRawString(key))
+	for _, property := range properties {
+		_, err := writer.Write(encodeRawString(property.Key))
 		if err != nil {
 			return nil, err
 		}
 
-		valueBytes, err := e.Encode(value)
+		valueBytes, err := e.Encode(property.Value)
 		if err != nil {
 			return nil, err
 		}
@@ -151,3 +210,26 @@ func (e *amf0Encoder) encodeArray(value []*KeyValuePair) ([]byte, error) {
 
 	return buff.Bytes(), nil
 }
+
+func encodeStrictArrayHeader(count int) []byte {
+	buff := make([]byte, 5)
+	buff[0] = StrictArrayType
+	binary.BigEndian.PutUint32(buff[1:], uint32(count))
+
+	return buff
+}
+
+func (e *amf0Encoder) encodeStrictArray(value []interface{}) ([]byte, error) {
+	buff := encodeStrictArrayHeader(len(value))
+
+	for _, item := range value {
+		itemBytes, err := e.Encode(item)
+		if err != nil {
+			return nil, err
+		}
+
+		buff = append(buff, itemBytes...)
+	}
+
+	return buff, nil
+}
@@ -1,8 +1,11 @@
 package amf
 
 import (
+	"bufio"
 	"bytes"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -107,3 +110,194 @@ func TestEncodeAMF0ECMAArray(t *testing.T) {
 		0x00, 0x00, 0x09,
 	}))
 }
+
+func TestEncodeAMF0Undefined(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(Undefined{})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x06}, encoded)
+
+	encoded, err = encoder.Encode(Unsupported{})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x0D}, encoded)
+}
+
+func TestEncodeAMF0StrictArray(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode([]interface{}{true, "hi"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x0A,
+		// count
+		0x00, 0x00, 0x00, 0x02,
+		// item 1
+		0x01, 0x01,
+		// item 2
+		0x02, 0x00, 0x02, 0x68, 0x69,
+	}, encoded)
+}
+
+func TestEncodeAMF0Date(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(time.UnixMilli(1000000000000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x0B,
+		// milliseconds since epoch
+		0x42, 0x6d, 0x1a, 0x94, 0xa2, 0x00, 0x00, 0x00,
+		// time zone
+		0x00, 0x00,
+	}, encoded)
+}
+
+func TestEncodeAMF0LongString(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	value := strings.Repeat("a", 0x10000)
+	encoded, err := encoder.Encode(value)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x0C,
+		// length
+		0x00, 0x01, 0x00, 0x00,
+	}, encoded[:5])
+	assert.Equal(t, value, string(encoded[5:]))
+
+	encoded, err = encoder.Encode(XMLDocument("<a/>"))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x0F,
+		// length
+		0x00, 0x00, 0x00, 0x04,
+		// payload
+		0x3c, 0x61, 0x2f, 0x3e,
+	}, encoded)
+}
+
+func TestEncodeAMF0TypedObject(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": nil}})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x10,
+		// class name
+		0x00, 0x03, 0x46, 0x6f, 0x6f,
+		// key 1
+		0x00, 0x01, 0x61,
+		// value 1
+		0x05,
+		// end marker
+		0x00, 0x00, 0x09,
+	}, encoded)
+}
+
+func TestEncodeAMF0Reference(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(Reference(1))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x07, 0x00, 0x01}, encoded)
+}
+
+func TestEncodeAMF0AVMPlus(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(AVMPlus{Value: float64(128)})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x11,
+		// AMF3 integer
+		0x04,
+		// value
+		0x81, 0x00,
+	}, encoded)
+
+	encoded, err = encoder.Encode(AVMPlus{Value: 0.5})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x11,
+		// AMF3 double
+		0x05,
+		// value
+		0x3f, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	}, encoded)
+}
+
+func TestEncodeDecodeAMF0RoundTrip(t *testing.T) {
+	values := []interface{}{
+		float64(-1.5),
+		true,
+		"hello",
+		strings.Repeat("b", 0x10001),
+		nil,
+		Undefined{},
+		Unsupported{},
+		XMLDocument("<a/>"),
+		time.UnixMilli(1700000000123).UTC(),
+		[]interface{}{float64(1), "two", []interface{}{}},
+		map[string]interface{}{"nested": map[string]interface{}{"x": float64(1)}},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"list": []interface{}{true}}},
+		[]*KeyValuePair{{Key: "duration", Value: float64(0)}},
+	}
+
+	// AMF3 values decode to the wrapped value
+	wrapped := []interface{}{float64(-268435456), float64(268435455), float64(268435456), "hi", false, nil, Undefined{}}
+
+	encoder := NewAMF0Encoder()
+	var payload []byte
+	for _, value := range values {
+		encoded, err := encoder.Encode(value)
+		assert.Nil(t, err)
+		payload = append(payload, encoded...)
+	}
+	for _, value := range wrapped {
+		encoded, err := encoder.Encode(AVMPlus{Value: value})
+		assert.Nil(t, err)
+		payload = append(payload, encoded...)
+	}
+
+	decoded, err := NewAMF0Decoder().Decode(bufio.NewReader(bytes.NewReader(payload)))
+	assert.Nil(t, err)
+	assert.Equal(t, append(values, wrapped...), decoded)
+}
+
+func TestEncodeAMF0OrderedObject(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(OrderedObject{
+		{Key: "b", Value: true},
+		{Key: "a", Value: nil},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x03,
+		// b: true
+		0x00, 0x01, 'b', 0x01, 0x01,
+		// a: null
+		0x00, 0x01, 'a', 0x05,
+		// object end
+		0x00, 0x00, 0x09,
+	}, encoded)
+}
+
+func TestEncodeAMF0ObjectWithSortedKeys(t *testing.T) {
+	encoder := NewAMF0Encoder()
+	encoded, err := encoder.Encode(map[string]interface{}{"b": true, "c": nil, "a": false})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// type
+		0x03,
+		// a: false
+		0x00, 0x01, 'a', 0x01, 0x00,
+		// b: true
+		0x00, 0x01, 'b', 0x01, 0x01,
+		// c: null
+		0x00, 0x01, 'c', 0x05,
+		// object end
+		0x00, 0x00, 0x09,
+	}, encoded)
+}
@@ -1,11 +1,61 @@
 package amf
 
-type AMF3Decoder struct {
+var (
+	AMF3UndefinedType    = byte(0x00)
+	AMF3NullType         = byte(0x01)
+	AMF3FalseType        = byte(0x02)
+	AMF3TrueType         = byte(0x03)
+	AMF3IntegerType      = byte(0x04)
+	AMF3DoubleType       = byte(0x05)
+	AMF3StringType       = byte(0x06)
+	AMF3XMLDocumentType  = byte(0x07)
+	AMF3DateType         = byte(0x08)
+	AMF3ArrayType        = byte(0x09)
+	AMF3ObjectType       = byte(0x0A)
+	AMF3XMLType          = byte(0x0B)
+	AMF3ByteArrayType    = byte(0x0C)
+	AMF3VectorIntType    = byte(0x0D)
+	AMF3VectorUintType   = byte(0x0E)
+	AMF3VectorDoubleType = byte(0x0F)
+	AMF3VectorObjectType = byte(0x10)
+	AMF3DictionaryType   = byte(0x11)
+)
 
+const (
+	// range of integers representable by the 29 bit integer type
+	amf3IntegerMin = -1 << 28
+	amf3IntegerMax = 1<<28 - 1
+)
+
+// XML holds a serialized E4X XML document.
+type XML string
+
+// Array is an AMF3 array with both associative and dense parts,
+// arrays having only one of them are represented by []*KeyValuePair and []interface{}.
+type Array struct {
+	Associative []*KeyValuePair
+	Dense       []interface{}
 }
 
-type AMF3Encoder struct {
+// ObjectVector is a vector of objects of the given type.
+type ObjectVector struct {
+	TypeName string
+	Items    []interface{}
+}
 
+type DictionaryEntry struct {
+	Key   interface{}
+	Value interface{}
 }
 
+// Dictionary is a map which keys can be of any type.
+type Dictionary struct {
+	WeakKeys bool
+	Entries  []*DictionaryEntry
+}
 
+// externalizable classes whose serialized form is a single AMF3 value
+var externalizableWrappers = map[string]bool{
+	"flex.messaging.io.ArrayCollection": true,
+	"flex.messaging.io.ObjectProxy":     true,
+}
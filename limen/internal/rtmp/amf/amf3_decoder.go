@@ -0,0 +1,559 @@
+package amf
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+var (
+	ErrUnknownAMF3Marker         = errors.New("unknown AMF3 marker")
+	ErrUnsupportedExternalizable = errors.New("unsupported externalizable AMF3 object")
+)
+
+type amf3Traits struct {
+	className      string
+	externalizable bool
+	dynamic        bool
+	members        []string
+}
+
+type amf3Decoder struct {
+	strings []string
+	// objects, arrays, dates, XMLs, byte arrays, vectors and dictionaries
+	objects []interface{}
+	traits  []*amf3Traits
+}
+
+func NewAMF3Decoder() *amf3Decoder {
+	return &amf3Decoder{}
+}
+
+// Decode reads all values until the end of the buffer,
+// references can only point to values decoded by the same call.
+func (d *amf3Decoder) Decode(buffer *bufio.Reader) ([]interface{}, error) {
+	items := make([]interface{}, 0)
+	d.strings = nil
+	d.objects = nil
+	d.traits = nil
+
+	for {
+		item, err := d.decodeItem(buffer)
+
+		if errors.Is(err, ErrAmfBufferEmpty) {
+			return items, nil
+		} else if err != nil {
+			return nil, err
+		} else {
+			items = append(items, item)
+		}
+	}
+}
+
+func (d *amf3Decoder) decodeItem(buffer *bufio.Reader) (interface{}, error) {
+	marker, err := buffer.ReadByte()
+	if err != nil {
+		return nil, ErrAmfBufferEmpty
+	}
+
+	switch marker {
+	case AMF3UndefinedType:
+		return Undefined{}, nil
+	case AMF3NullType:
+		return nil, nil
+	case AMF3FalseType:
+		return false, nil
+	case AMF3TrueType:
+		return true, nil
+	case AMF3IntegerType:
+		return d.decodeInteger(buffer)
+	case AMF3DoubleType:
+		return d.decodeDouble(buffer)
+	case AMF3StringType:
+		return d.decodeString(buffer)
+	case AMF3XMLDocumentType:
+		return d.decodeXML(buffer, func(value string) interface{} { return XMLDocument(value) })
+	case AMF3XMLType:
+		return d.decodeXML(buffer, func(value string) interface{} { return XML(value) })
+	case AMF3DateType:
+		return d.decodeDate(buffer)
+	case AMF3ArrayType:
+		return d.decodeArray(buffer)
+	case AMF3ObjectType:
+		return d.decodeObject(buffer)
+	case AMF3ByteArrayType:
+		return d.decodeByteArray(buffer)
+	case AMF3VectorIntType, AMF3VectorUintType, AMF3VectorDoubleType, AMF3VectorObjectType:
+		return d.decodeVector(buffer, marker)
+	case AMF3DictionaryType:
+		return d.decodeDictionary(buffer)
+	default:
+		return nil, ErrUnknownAMF3Marker
+	}
+}
+
+// decodeValue decodes a value nested in another one, which must be present.
+func (d *amf3Decoder) decodeValue(buffer *bufio.Reader) (interface{}, error) {
+	value, err := d.decodeItem(buffer)
+	if errors.Is(err, ErrAmfBufferEmpty) {
+		return nil, ErrNotEnoughData
+	}
+
+	return value, err
+}
+
+// decodeU29 reads a variable length unsigned 29 bit integer.
+func (d *amf3Decoder) decodeU29(buffer *bufio.Reader) (uint32, error) {
+	var value uint32
+
+	for i := 0; i < 4; i++ {
+		b, err := buffer.ReadByte()
+		if err != nil {
+			return 0, ErrNotEnoughData
+		}
+
+		// the last byte uses all 8 bits
+		if i == 3 {
+			return value<<8 | uint32(b), nil
+		}
+
+		value = value<<7 | uint32(b&0x7f)
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	return value, nil
+}
+
+// decodeHeader reads the U29 header of a value which can be sent by reference,
+// the returned value is either the reference index or the inlined value's length.
+func (d *amf3Decoder) decodeHeader(buffer *bufio.Reader) (uint32, bool, error) {
+	header, err := d.decodeU29(buffer)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return header >> 1, header&0x01 == 0, nil
+}
+
+func (d *amf3Decoder) objectReference(index uint32) (interface{}, error) {
+	if int(index) >= len(d.objects) {
+		return nil, ErrInvalidReference
+	}
+
+	return d.objects[index], nil
+}
+
+// reserveObject adds a placeholder to the objects table for values
+// which can't be referenced until they are fully decoded.
+func (d *amf3Decoder) reserveObject() int {
+	d.objects = append(d.objects, nil)
+	return len(d.objects) - 1
+}
+
+func (d *amf3Decoder) readBytes(buffer *bufio.Reader, length uint32) ([]byte, error) {
+	// the length comes from the peer, the payload grows as the data gets read
+	payload, err := io.ReadAll(io.LimitReader(buffer, int64(length)))
+	if err != nil || len(payload) != int(length) {
+		return nil, ErrNotEnoughData
+	}
+
+	return payload, nil
+}
+
+// decodeInteger returns the integer as float64, the same way AMF0 represents numbers.
+func (d *amf3Decoder) decodeInteger(buffer *bufio.Reader) (float64, error) {
+	value, err := d.decodeU29(buffer)
+	if err != nil {
+		return 0, err
+	}
+
+	// sign extension of the 29 bit integer
+	return float64(int32(value<<3) >> 3), nil
+}
+
+func (d *amf3Decoder) decodeDouble(buffer *bufio.Reader) (float64, error) {
+	var buff [8]byte
+	_, err := io.ReadFull(buffer, buff[:])
+	if err != nil {
+		return 0.0, ErrNotEnoughData
+	}
+
+	return math.Float64frombits(binary.BigEndian.Uint64(buff[:])), nil
+}
+
+// decodeString reads a string which is either inlined or refers to a previous one.
+func (d *amf3Decoder) decodeString(buffer *bufio.Reader) (string, error) {
+	value, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return "", err
+	}
+
+	if reference {
+		if int(value) >= len(d.strings) {
+			return "", ErrInvalidReference
+		}
+
+		return d.strings[value], nil
+	}
+
+	payload, err := d.readBytes(buffer, value)
+	if err != nil {
+		return "", err
+	}
+
+	str := string(payload)
+
+	// empty strings are never sent by reference
+	if str != "" {
+		d.strings = append(d.strings, str)
+	}
+
+	return str, nil
+}
+
+func (d *amf3Decoder) decodeXML(buffer *bufio.Reader, wrap func(string) interface{}) (interface{}, error) {
+	value, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(value)
+	}
+
+	payload, err := d.readBytes(buffer, value)
+	if err != nil {
+		return nil, err
+	}
+
+	xml := wrap(string(payload))
+	d.objects = append(d.objects, xml)
+
+	return xml, nil
+}
+
+func (d *amf3Decoder) decodeDate(buffer *bufio.Reader) (interface{}, error) {
+	value, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(value)
+	}
+
+	milliseconds, err := d.decodeDouble(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	date := time.UnixMilli(int64(milliseconds)).UTC()
+	d.objects = append(d.objects, date)
+
+	return date, nil
+}
+
+func (d *amf3Decoder) decodeArray(buffer *bufio.Reader) (interface{}, error) {
+	denseCount, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(denseCount)
+	}
+
+	index := d.reserveObject()
+
+	associative := make([]*KeyValuePair, 0)
+	for {
+		key, err := d.decodeString(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		if key == "" {
+			break
+		}
+
+		value, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		associative = append(associative, &KeyValuePair{Key: key, Value: value})
+	}
+
+	// the count comes from the peer, the slice grows as the items get read
+	dense := make([]interface{}, 0)
+	for i := uint32(0); i < denseCount; i++ {
+		value, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		dense = append(dense, value)
+	}
+
+	var array interface{}
+	switch {
+	case len(associative) == 0:
+		array = dense
+	case len(dense) == 0:
+		array = associative
+	default:
+		array = &Array{Associative: associative, Dense: dense}
+	}
+
+	d.objects[index] = array
+
+	return array, nil
+}
+
+func (d *amf3Decoder) decodeTraits(buffer *bufio.Reader, header uint32) (*amf3Traits, error) {
+	// header without the object reference bit
+	if header&0x01 == 0 {
+		index := int(header >> 1)
+		if index >= len(d.traits) {
+			return nil, ErrInvalidReference
+		}
+
+		return d.traits[index], nil
+	}
+
+	traits := &amf3Traits{
+		externalizable: header&0x02 != 0,
+		dynamic:        header&0x04 != 0,
+	}
+
+	className, err := d.decodeString(buffer)
+	if err != nil {
+		return nil, err
+	}
+	traits.className = className
+
+	if !traits.externalizable {
+		for i := uint32(0); i < header>>3; i++ {
+			member, err := d.decodeString(buffer)
+			if err != nil {
+				return nil, err
+			}
+
+			traits.members = append(traits.members, member)
+		}
+	}
+
+	d.traits = append(d.traits, traits)
+
+	return traits, nil
+}
+
+func (d *amf3Decoder) decodeObject(buffer *bufio.Reader) (interface{}, error) {
+	header, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(header)
+	}
+
+	traits, err := d.decodeTraits(buffer, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if traits.externalizable {
+		if !externalizableWrappers[traits.className] {
+			return nil, ErrUnsupportedExternalizable
+		}
+
+		index := d.reserveObject()
+
+		value, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		d.objects[index] = value
+
+		return value, nil
+	}
+
+	properties := make(map[string]interface{})
+
+	var object interface{} = properties
+	if traits.className != "" {
+		object = &TypedObject{ClassName: traits.className, Properties: properties}
+	}
+
+	d.objects = append(d.objects, object)
+
+	for _, member := range traits.members {
+		value, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		properties[member] = value
+	}
+
+	if traits.dynamic {
+		for {
+			key, err := d.decodeString(buffer)
+			if err != nil {
+				return nil, err
+			}
+
+			if key == "" {
+				break
+			}
+
+			value, err := d.decodeValue(buffer)
+			if err != nil {
+				return nil, err
+			}
+
+			properties[key] = value
+		}
+	}
+
+	return object, nil
+}
+
+func (d *amf3Decoder) decodeByteArray(buffer *bufio.Reader) (interface{}, error) {
+	length, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(length)
+	}
+
+	payload, err := d.readBytes(buffer, length)
+	if err != nil {
+		return nil, err
+	}
+
+	d.objects = append(d.objects, payload)
+
+	return payload, nil
+}
+
+func (d *amf3Decoder) decodeVector(buffer *bufio.Reader, marker byte) (interface{}, error) {
+	count, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(count)
+	}
+
+	// the fixed length flag has no meaning for the receiver
+	if _, err := buffer.ReadByte(); err != nil {
+		return nil, ErrNotEnoughData
+	}
+
+	index := d.reserveObject()
+
+	var vector interface{}
+
+	switch marker {
+	case AMF3VectorObjectType:
+		typeName, err := d.decodeString(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		items := make([]interface{}, 0)
+		for i := uint32(0); i < count; i++ {
+			item, err := d.decodeValue(buffer)
+			if err != nil {
+				return nil, err
+			}
+
+			items = append(items, item)
+		}
+
+		vector = &ObjectVector{TypeName: typeName, Items: items}
+
+	default:
+		itemSize := uint32(4)
+		if marker == AMF3VectorDoubleType {
+			itemSize = 8
+		}
+
+		payload, err := d.readBytes(buffer, count*itemSize)
+		if err != nil {
+			return nil, err
+		}
+
+		switch marker {
+		case AMF3VectorIntType:
+			items := make([]int32, count)
+			for i := range items {
+				items[i] = int32(binary.BigEndian.Uint32(payload[i*4:]))
+			}
+			vector = items
+		case AMF3VectorUintType:
+			items := make([]uint32, count)
+			for i := range items {
+				items[i] = binary.BigEndian.Uint32(payload[i*4:])
+			}
+			vector = items
+		case AMF3VectorDoubleType:
+			items := make([]float64, count)
+			for i := range items {
+				items[i] = math.Float64frombits(binary.BigEndian.Uint64(payload[i*8:]))
+			}
+			vector = items
+		}
+	}
+
+	d.objects[index] = vector
+
+	return vector, nil
+}
+
+func (d *amf3Decoder) decodeDictionary(buffer *bufio.Reader) (interface{}, error) {
+	count, reference, err := d.decodeHeader(buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	if reference {
+		return d.objectReference(count)
+	}
+
+	weakKeys, err := buffer.ReadByte()
+	if err != nil {
+		return nil, ErrNotEnoughData
+	}
+
+	dictionary := &Dictionary{WeakKeys: weakKeys == 0x01, Entries: make([]*DictionaryEntry, 0)}
+	d.objects = append(d.objects, dictionary)
+
+	for i := uint32(0); i < count; i++ {
+		key, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := d.decodeValue(buffer)
+		if err != nil {
+			return nil, err
+		}
+
+		dictionary.Entries = append(dictionary.Entries, &DictionaryEntry{Key: key, Value: value})
+	}
+
+	return dictionary, nil
+}
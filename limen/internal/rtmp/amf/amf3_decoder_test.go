@@ -0,0 +1,272 @@
+package amf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeAMF3(t *testing.T, payload []byte) []interface{} {
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+
+	decoded, err := NewAMF3Decoder().Decode(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, buffer.Buffered())
+
+	return decoded
+}
+
+func TestDecodeAMF3Scalars(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// undefined
+		0x00,
+		// null
+		0x01,
+		// false
+		0x02,
+		// true
+		0x03,
+		// double
+		0x05, 0x3f, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	})
+
+	assert.Equal(t, []interface{}{Undefined{}, nil, false, true, 0.5}, decoded)
+}
+
+func TestDecodeAMF3Integer(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// 1 byte
+		0x04, 0x7f,
+		// 2 bytes
+		0x04, 0x81, 0x00,
+		// 3 bytes
+		0x04, 0x81, 0x80, 0x00,
+		// 4 bytes, the last one with all 8 bits
+		0x04, 0x80, 0xc0, 0x80, 0x00,
+		// maximal value
+		0x04, 0xbf, 0xff, 0xff, 0xff,
+		// -1
+		0x04, 0xff, 0xff, 0xff, 0xff,
+		// minimal value
+		0x04, 0xc0, 0x80, 0x80, 0x00,
+	})
+
+	assert.Equal(t, []interface{}{
+		float64(127),
+		float64(128),
+		float64(16384),
+		float64(2097152),
+		float64(268435455),
+		float64(-1),
+		float64(-268435456),
+	}, decoded)
+}
+
+func TestDecodeAMF3StringReferences(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// inline string
+		0x06, 0x05, 0x68, 0x69,
+		// empty string, never added to the table
+		0x06, 0x01,
+		// inline string
+		0x06, 0x07, 0x61, 0x62, 0x63,
+		// reference 1
+		0x06, 0x02,
+		// reference 0
+		0x06, 0x00,
+	})
+
+	assert.Equal(t, []interface{}{"hi", "", "abc", "abc", "hi"}, decoded)
+
+	buffer := bufio.NewReader(bytes.NewReader([]byte{0x06, 0x00}))
+	_, err := NewAMF3Decoder().Decode(buffer)
+	assert.Equal(t, ErrInvalidReference, err)
+}
+
+func TestDecodeAMF3Object(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// anonymous dynamic object
+		0x0a, 0x0b,
+		// class name
+		0x01,
+		// key
+		0x03, 0x61,
+		// value
+		0x04, 0x01,
+		// end of dynamic members
+		0x01,
+		// typed object with 2 sealed members
+		0x0a, 0x23,
+		// class name
+		0x07, 0x46, 0x6f, 0x6f,
+		// sealed member names, the first one by reference
+		0x00,
+		0x03, 0x62,
+		// sealed member values
+		0x03,
+		0x02,
+		// object using traits reference 1
+		0x0a, 0x05,
+		// sealed member values
+		0x02,
+		0x03,
+		// object reference 1
+		0x0a, 0x02,
+	})
+
+	typed := &TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": true, "b": false}}
+
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"a": float64(1)},
+		typed,
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": false, "b": true}},
+		typed,
+	}, decoded)
+	assert.Same(t, decoded[1], decoded[3])
+}
+
+func TestDecodeAMF3ExternalizableObject(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// externalizable object
+		0x0a, 0x07,
+		// class name
+		0x43,
+		0x66, 0x6c, 0x65, 0x78, 0x2e, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x69, 0x6e, 0x67, 0x2e,
+		0x69, 0x6f, 0x2e, 0x41, 0x72, 0x72, 0x61, 0x79, 0x43, 0x6f, 0x6c, 0x6c, 0x65, 0x63, 0x74,
+		0x69, 0x6f, 0x6e,
+		// wrapped array
+		0x09, 0x03, 0x01, 0x03,
+	})
+
+	assert.Equal(t, []interface{}{[]interface{}{true}}, decoded)
+
+	buffer := bufio.NewReader(bytes.NewReader([]byte{0x0a, 0x07, 0x03, 0x41}))
+	_, err := NewAMF3Decoder().Decode(buffer)
+	assert.Equal(t, ErrUnsupportedExternalizable, err)
+}
+
+func TestDecodeAMF3Array(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// dense array with 2 items
+		0x09, 0x05,
+		// end of associative part
+		0x01,
+		// items
+		0x03, 0x02,
+		// associative array
+		0x09, 0x01,
+		0x03, 0x61, 0x04, 0x01,
+		0x01,
+		// mixed array
+		0x09, 0x03,
+		0x03, 0x62, 0x01,
+		0x01,
+		0x04, 0x02,
+		// reference to the first array
+		0x09, 0x00,
+	})
+
+	assert.Equal(t, []interface{}{
+		[]interface{}{true, false},
+		[]*KeyValuePair{{Key: "a", Value: float64(1)}},
+		&Array{Associative: []*KeyValuePair{{Key: "b", Value: nil}}, Dense: []interface{}{float64(2)}},
+		[]interface{}{true, false},
+	}, decoded)
+}
+
+func TestDecodeAMF3DateXMLAndByteArray(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// date
+		0x08, 0x01, 0x42, 0x6d, 0x1a, 0x94, 0xa2, 0x00, 0x00, 0x00,
+		// xml document
+		0x07, 0x09, 0x3c, 0x61, 0x2f, 0x3e,
+		// xml
+		0x0b, 0x09, 0x3c, 0x62, 0x2f, 0x3e,
+		// byte array
+		0x0c, 0x05, 0xde, 0xad,
+		// reference to the date
+		0x08, 0x00,
+		// reference to the byte array
+		0x0c, 0x06,
+	})
+
+	date := time.UnixMilli(1000000000000).UTC()
+
+	assert.Equal(t, []interface{}{
+		date,
+		XMLDocument("<a/>"),
+		XML("<b/>"),
+		[]byte{0xde, 0xad},
+		date,
+		[]byte{0xde, 0xad},
+	}, decoded)
+}
+
+func TestDecodeAMF3Vectors(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// int vector
+		0x0d, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x01,
+		// uint vector
+		0x0e, 0x03, 0x01, 0xff, 0xff, 0xff, 0xff,
+		// double vector
+		0x0f, 0x03, 0x00, 0x3f, 0xe0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// object vector
+		0x10, 0x03, 0x00,
+		// type name
+		0x07, 0x46, 0x6f, 0x6f,
+		// items
+		0x01,
+	})
+
+	assert.Equal(t, []interface{}{
+		[]int32{-1, 1},
+		[]uint32{0xffffffff},
+		[]float64{0.5},
+		&ObjectVector{TypeName: "Foo", Items: []interface{}{nil}},
+	}, decoded)
+
+	// the count exceeds the available data
+	buffer := bufio.NewReader(bytes.NewReader([]byte{0x0d, 0xbf, 0xff, 0xff, 0xff, 0x00}))
+	_, err := NewAMF3Decoder().Decode(buffer)
+	assert.Equal(t, ErrNotEnoughData, err)
+}
+
+func TestDecodeAMF3Dictionary(t *testing.T) {
+	decoded := decodeAMF3(t, []byte{
+		// dictionary with 2 entries
+		0x11, 0x05,
+		// weak keys
+		0x01,
+		// entry 1
+		0x04, 0x01, 0x06, 0x03, 0x61,
+		// entry 2
+		0x03, 0x01,
+	})
+
+	assert.Equal(t, []interface{}{
+		&Dictionary{WeakKeys: true, Entries: []*DictionaryEntry{
+			{Key: float64(1), Value: "a"},
+			{Key: true, Value: nil},
+		}},
+	}, decoded)
+}
+
+func TestDecodeAMF3NotEnoughData(t *testing.T) {
+	for _, payload := range [][]byte{
+		// missing array item
+		{0x09, 0x03, 0x01},
+		// missing object value
+		{0x0a, 0x0b, 0x01, 0x03, 0x61},
+		// truncated string
+		{0x06, 0x05, 0x68},
+		// truncated integer
+		{0x04, 0x81},
+	} {
+		buffer := bufio.NewReader(bytes.NewReader(payload))
+		_, err := NewAMF3Decoder().Decode(buffer)
+		assert.Equal(t, ErrNotEnoughData, err)
+	}
+}
@@ -0,0 +1,261 @@
+package amf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"time"
+)
+
+type amf3Encoder struct {
+	strings map[string]int
+	traits  map[string]int
+}
+
+func NewAMF3Encoder() *amf3Encoder {
+	return &amf3Encoder{}
+}
+
+// Encode serializes a single value, references only point to
+// values serialized by the same call.
+//
+// Anonymous objects are encoded as dynamic objects and typed objects as sealed ones,
+// in both cases with properties sorted by name.
+func (e *amf3Encoder) Encode(value interface{}) ([]byte, error) {
+	e.strings = make(map[string]int)
+	e.traits = make(map[string]int)
+
+	buff := new(bytes.Buffer)
+	if err := e.encodeItem(buff, value); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+func (e *amf3Encoder) encodeItem(buff *bytes.Buffer, value interface{}) error {
+	switch value := value.(type) {
+	case Undefined:
+		buff.WriteByte(AMF3UndefinedType)
+	case nil:
+		buff.WriteByte(AMF3NullType)
+	case bool:
+		if value {
+			buff.WriteByte(AMF3TrueType)
+		} else {
+			buff.WriteByte(AMF3FalseType)
+		}
+	case float64:
+		buff.Write(encodeAMF3Number(value))
+	case string:
+		buff.WriteByte(AMF3StringType)
+		buff.Write(e.encodeRawString(value))
+	case XMLDocument:
+		buff.WriteByte(AMF3XMLDocumentType)
+		writeInlineBytes(buff, []byte(value))
+	case XML:
+		buff.WriteByte(AMF3XMLType)
+		writeInlineBytes(buff, []byte(value))
+	case time.Time:
+		buff.WriteByte(AMF3DateType)
+		buff.Write(encodeU29(0x01))
+		binary.Write(buff, binary.BigEndian, float64(value.UnixMilli()))
+	case []interface{}:
+		return e.encodeArray(buff, nil, value)
+	case []*KeyValuePair:
+		return e.encodeArray(buff, value, nil)
+	case *Array:
+		return e.encodeArray(buff, value.Associative, value.Dense)
+	case map[string]interface{}:
+		return e.encodeObject(buff, "", sortedProperties(value))
+	case OrderedObject:
+		return e.encodeObject(buff, "", value)
+	case *TypedObject:
+		return e.encodeObject(buff, value.ClassName, sortedProperties(value.Properties))
+	case []byte:
+		buff.WriteByte(AMF3ByteArrayType)
+		writeInlineBytes(buff, value)
+	case []int32:
+		buff.WriteByte(AMF3VectorIntType)
+		writeVectorHeader(buff, len(value))
+		binary.Write(buff, binary.BigEndian, value)
+	case []uint32:
+		buff.WriteByte(AMF3VectorUintType)
+		writeVectorHeader(buff, len(value))
+		binary.Write(buff, binary.BigEndian, value)
+	case []float64:
+		buff.WriteByte(AMF3VectorDoubleType)
+		writeVectorHeader(buff, len(value))
+		binary.Write(buff, binary.BigEndian, value)
+	case *ObjectVector:
+		buff.WriteByte(AMF3VectorObjectType)
+		writeVectorHeader(buff, len(value.Items))
+		buff.Write(e.encodeRawString(value.TypeName))
+
+		for _, item := range value.Items {
+			if err := e.encodeItem(buff, item); err != nil {
+				return err
+			}
+		}
+	case *Dictionary:
+		return e.encodeDictionary(buff, value)
+	default:
+		return UnsupportedAMFTypeErr
+	}
+
+	return nil
+}
+
+// encodeU29 serializes a variable length unsigned 29 bit integer.
+func encodeU29(value uint32) []byte {
+	value &= 0x1fffffff
+
+	switch {
+	case value < 0x80:
+		return []byte{byte(value)}
+	case value < 0x4000:
+		return []byte{byte(value>>7) | 0x80, byte(value & 0x7f)}
+	case value < 0x200000:
+		return []byte{byte(value>>14) | 0x80, byte(value>>7) | 0x80, byte(value & 0x7f)}
+	default:
+		return []byte{byte(value>>22) | 0x80, byte(value>>15) | 0x80, byte(value>>8) | 0x80, byte(value)}
+	}
+}
+
+// encodeAMF3Number uses the compact integer type whenever the value allows it.
+func encodeAMF3Number(value float64) []byte {
+	isNegativeZero := value == 0 && math.Signbit(value)
+
+	if value == math.Trunc(value) && value >= amf3IntegerMin && value <= amf3IntegerMax && !isNegativeZero {
+		return append([]byte{AMF3IntegerType}, encodeU29(uint32(int32(value)))...)
+	}
+
+	buff := make([]byte, 9)
+	buff[0] = AMF3DoubleType
+	binary.BigEndian.PutUint64(buff[1:], math.Float64bits(value))
+
+	return buff
+}
+
+func (e *amf3Encoder) encodeRawString(value string) []byte {
+	if index, ok := e.strings[value]; ok {
+		return encodeU29(uint32(index) << 1)
+	}
+
+	if value != "" {
+		e.strings[value] = len(e.strings)
+	}
+
+	return append(encodeU29(uint32(len(value))<<1|0x01), []byte(value)...)
+}
+
+func writeInlineBytes(buff *bytes.Buffer, value []byte) {
+	buff.Write(encodeU29(uint32(len(value))<<1 | 0x01))
+	buff.Write(value)
+}
+
+func writeVectorHeader(buff *bytes.Buffer, count int) {
+	buff.Write(encodeU29(uint32(count)<<1 | 0x01))
+	// not a fixed length vector
+	buff.WriteByte(0x00)
+}
+
+func (e *amf3Encoder) encodeArray(buff *bytes.Buffer, associative []*KeyValuePair, dense []interface{}) error {
+	buff.WriteByte(AMF3ArrayType)
+	buff.Write(encodeU29(uint32(len(dense))<<1 | 0x01))
+
+	for _, pair := range associative {
+		buff.Write(e.encodeRawString(pair.Key))
+
+		if err := e.encodeItem(buff, pair.Value); err != nil {
+			return err
+		}
+	}
+
+	// end of the associative part
+	buff.Write(e.encodeRawString(""))
+
+	for _, item := range dense {
+		if err := e.encodeItem(buff, item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *amf3Encoder) encodeObject(buff *bytes.Buffer, className string, properties []*KeyValuePair) error {
+	buff.WriteByte(AMF3ObjectType)
+
+	// anonymous objects carry their properties as dynamic members
+	dynamic := className == ""
+
+	var members []string
+	if !dynamic {
+		members = make([]string, 0, len(properties))
+		for _, property := range properties {
+			members = append(members, property.Key)
+		}
+	}
+
+	// every inlined traits, including the anonymous ones, gets added to the traits table
+	traitsKey := className + "\x00" + strings.Join(members, "\x00")
+
+	if index, ok := e.traits[traitsKey]; ok {
+		buff.Write(encodeU29(uint32(index)<<2 | 0x01))
+	} else {
+		e.traits[traitsKey] = len(e.traits)
+
+		header := uint32(len(members))<<4 | 0x03
+		if dynamic {
+			header |= 0x08
+		}
+
+		buff.Write(encodeU29(header))
+		buff.Write(e.encodeRawString(className))
+
+		for _, member := range members {
+			buff.Write(e.encodeRawString(member))
+		}
+	}
+
+	for _, property := range properties {
+		if dynamic {
+			buff.Write(e.encodeRawString(property.Key))
+		}
+
+		if err := e.encodeItem(buff, property.Value); err != nil {
+			return err
+		}
+	}
+
+	if dynamic {
+		buff.Write(e.encodeRawString(""))
+	}
+
+	return nil
+}
+
+func (e *amf3Encoder) encodeDictionary(buff *bytes.Buffer, value *Dictionary) error {
+	buff.WriteByte(AMF3DictionaryType)
+	buff.Write(encodeU29(uint32(len(value.Entries))<<1 | 0x01))
+
+	if value.WeakKeys {
+		buff.WriteByte(0x01)
+	} else {
+		buff.WriteByte(0x00)
+	}
+
+	for _, entry := range value.Entries {
+		if err := e.encodeItem(buff, entry.Key); err != nil {
+			return err
+		}
+
+		if err := e.encodeItem(buff, entry.Value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package amf
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeAMF3Integer(t *testing.T) {
+	encoder := NewAMF3Encoder()
+
+	for value, expected := range map[float64][]byte{
+		127:        {0x04, 0x7f},
+		128:        {0x04, 0x81, 0x00},
+		16384:      {0x04, 0x81, 0x80, 0x00},
+		2097152:    {0x04, 0x80, 0xc0, 0x80, 0x00},
+		268435455:  {0x04, 0xbf, 0xff, 0xff, 0xff},
+		-1:         {0x04, 0xff, 0xff, 0xff, 0xff},
+		-268435456: {0x04, 0xc0, 0x80, 0x80, 0x00},
+		// out of the integer range
+		268435456: {0x05, 0x41, 0xb0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00},
+	} {
+		encoded, err := encoder.Encode(value)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, encoded)
+	}
+}
+
+func TestEncodeAMF3Object(t *testing.T) {
+	encoder := NewAMF3Encoder()
+
+	encoded, err := encoder.Encode([]interface{}{
+		map[string]interface{}{"b": "a", "a": "b"},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": true}},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": false}},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{
+		// dense array with 3 items
+		0x09, 0x07,
+		// end of associative part
+		0x01,
+		// anonymous dynamic object
+		0x0a, 0x0b,
+		// class name
+		0x01,
+		// key "a" and value "b"
+		0x03, 0x61, 0x06, 0x03, 0x62,
+		// key "b" and value "a", both by reference
+		0x02, 0x06, 0x00,
+		// end of dynamic members
+		0x01,
+		// typed object with 1 sealed member
+		0x0a, 0x13,
+		// class name
+		0x07, 0x46, 0x6f, 0x6f,
+		// sealed member name by reference
+		0x00,
+		// sealed member value
+		0x03,
+		// object using traits reference 1, the anonymous object's traits are 0
+		0x0a, 0x05,
+		// sealed member value
+		0x02,
+	}, encoded)
+
+	decoded, err := NewAMF3Decoder().Decode(bufio.NewReader(bytes.NewReader(encoded)))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{[]interface{}{
+		map[string]interface{}{"b": "a", "a": "b"},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": true}},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"a": false}},
+	}}, decoded)
+}
+
+func TestEncodeAMF3OrderedObject(t *testing.T) {
+	encoder := NewAMF3Encoder()
+
+	encoded, err := encoder.Encode(OrderedObject{
+		{Key: "b", Value: true},
+		{Key: "a", Value: false},
+	})
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{
+		// anonymous dynamic object
+		0x0a, 0x0b,
+		// class name
+		0x01,
+		// key "b" and value true
+		0x03, 0x62, 0x03,
+		// key "a" and value false
+		0x03, 0x61, 0x02,
+		// end of dynamic members
+		0x01,
+	}, encoded)
+}
+
+func TestEncodeAMF3Containers(t *testing.T) {
+	encoder := NewAMF3Encoder()
+
+	encoded, err := encoder.Encode(&Array{
+		Associative: []*KeyValuePair{{Key: "b", Value: nil}},
+		Dense:       []interface{}{float64(2)},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// mixed array
+		0x09, 0x03,
+		0x03, 0x62, 0x01,
+		0x01,
+		0x04, 0x02,
+	}, encoded)
+
+	encoded, err = encoder.Encode(&Dictionary{WeakKeys: true, Entries: []*DictionaryEntry{{Key: float64(1), Value: "a"}}})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// dictionary with 1 entry
+		0x11, 0x03,
+		// weak keys
+		0x01,
+		// entry
+		0x04, 0x01, 0x06, 0x03, 0x61,
+	}, encoded)
+
+	encoded, err = encoder.Encode([]int32{-1, 1})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x0d, 0x05, 0x00, 0xff, 0xff, 0xff, 0xff, 0x00, 0x00, 0x00, 0x01}, encoded)
+
+	encoded, err = encoder.Encode(time.UnixMilli(1000000000000))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x08, 0x01, 0x42, 0x6d, 0x1a, 0x94, 0xa2, 0x00, 0x00, 0x00}, encoded)
+
+	_, err = encoder.Encode(struct{}{})
+	assert.Equal(t, UnsupportedAMFTypeErr, err)
+}
+
+func TestEncodeDecodeAMF3RoundTrip(t *testing.T) {
+	values := []interface{}{
+		Undefined{},
+		nil,
+		true,
+		false,
+		float64(42),
+		-0.25,
+		"hello",
+		"hello",
+		XMLDocument("<a/>"),
+		XML("<b/>"),
+		time.UnixMilli(1700000000123).UTC(),
+		[]interface{}{"hello", float64(1), []interface{}{}},
+		[]*KeyValuePair{{Key: "hello", Value: "world"}},
+		&Array{Associative: []*KeyValuePair{{Key: "x", Value: true}}, Dense: []interface{}{"y"}},
+		map[string]interface{}{"nested": map[string]interface{}{"hello": []byte{0x01}}},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"x": float64(1), "y": "hello"}},
+		&TypedObject{ClassName: "Foo", Properties: map[string]interface{}{"x": float64(2), "y": "world"}},
+		[]byte{0x00, 0xff},
+		[]int32{-5},
+		[]uint32{5},
+		[]float64{1.5},
+		&ObjectVector{TypeName: "Foo", Items: []interface{}{"hello"}},
+		&Dictionary{Entries: []*DictionaryEntry{{Key: map[string]interface{}{}, Value: "hello"}}},
+	}
+
+	encoded, err := NewAMF3Encoder().Encode(values)
+	assert.Nil(t, err)
+
+	decoded, err := NewAMF3Decoder().Decode(bufio.NewReader(bytes.NewReader(encoded)))
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{values}, decoded)
+}
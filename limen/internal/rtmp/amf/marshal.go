@@ -0,0 +1,492 @@
+package amf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var ErrNotSingleValue = errors.New("amf: data does not contain exactly one value")
+
+// UnsupportedTypeError is returned by Marshal for values which have no AMF representation.
+type UnsupportedTypeError struct {
+	Type reflect.Type
+}
+
+func (e *UnsupportedTypeError) Error() string {
+	return "amf: unsupported type: " + e.Type.String()
+}
+
+// InvalidUnmarshalError is returned when the unmarshal target is not a non-nil pointer.
+type InvalidUnmarshalError struct {
+	Type reflect.Type
+}
+
+func (e *InvalidUnmarshalError) Error() string {
+	if e.Type == nil {
+		return "amf: Unmarshal(nil)"
+	}
+
+	if e.Type.Kind() != reflect.Pointer {
+		return "amf: Unmarshal(non-pointer " + e.Type.String() + ")"
+	}
+
+	return "amf: Unmarshal(nil " + e.Type.String() + ")"
+}
+
+// UnmarshalTypeError describes an AMF value which can't be assigned to a Go value.
+type UnmarshalTypeError struct {
+	// AMF type of the value, e.g. "string" or "strict array"
+	Value string
+	Type  reflect.Type
+	// path of the object keys leading to the value, empty for the top level value
+	Field string
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	if e.Field == "" {
+		return "amf: cannot unmarshal " + e.Value + " into Go value of type " + e.Type.String()
+	}
+
+	return "amf: cannot unmarshal " + e.Value + " into Go struct field " + e.Field + " of type " + e.Type.String()
+}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	keyValuePairType = reflect.TypeOf([]*KeyValuePair{})
+	typedObjectType  = reflect.TypeOf(&TypedObject{})
+)
+
+// Marshal returns the AMF0 encoding of v.
+//
+// Structs are encoded as objects with fields in the order of their declaration,
+// the field's tag `amf:"name,omitempty"` changes the property name and omits
+// empty values, a tag of "-" skips the field. Fields of embedded structs are
+// promoted to the outer object.
+//
+// Maps with string keys are encoded as objects with sorted keys, slices and arrays
+// as strict arrays, []*KeyValuePair as ECMA arrays and time.Time as dates.
+// Nil pointers, interfaces, maps and slices are encoded as null.
+func Marshal(v interface{}) ([]byte, error) {
+	buff := new(bytes.Buffer)
+
+	if err := marshalValue(buff, reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+
+	return buff.Bytes(), nil
+}
+
+// Unmarshal decodes a single AMF0 value and stores it in the value pointed to by v,
+// see UnmarshalValue for the conversion rules.
+func Unmarshal(data []byte, v interface{}) error {
+	values, err := NewAMF0Decoder().Decode(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		return err
+	}
+
+	if len(values) != 1 {
+		return ErrNotSingleValue
+	}
+
+	return UnmarshalValue(values[0], v)
+}
+
+// UnmarshalValue stores a value returned by one of the decoders in the value pointed to by v.
+//
+// Objects, typed objects and ECMA arrays can be stored in structs and maps with string keys,
+// properties are matched against field names from tags or, case-insensitively, field names.
+// Unknown properties are ignored. Numbers can be stored in any numeric type
+// as long as they fit without losing precision. Null and undefined set pointers,
+// maps, slices and interfaces to nil and leave other values untouched.
+func UnmarshalValue(value interface{}, v interface{}) error {
+	target := reflect.ValueOf(v)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return &InvalidUnmarshalError{Type: reflect.TypeOf(v)}
+	}
+
+	return unmarshalValue(value, target.Elem(), "")
+}
+
+func marshalValue(buff *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buff.Write(encodeNil())
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType, keyValuePairType, typedObjectType, reflect.TypeOf(OrderedObject{}),
+		reflect.TypeOf(Undefined{}), reflect.TypeOf(Unsupported{}), reflect.TypeOf(XMLDocument("")),
+		reflect.TypeOf(Reference(0)), reflect.TypeOf(AVMPlus{}):
+		if v.Kind() == reflect.Slice && v.IsNil() || v.Kind() == reflect.Pointer && v.IsNil() {
+			buff.Write(encodeNil())
+			return nil
+		}
+
+		encoded, err := NewAMF0Encoder().Encode(v.Interface())
+		if err != nil {
+			return err
+		}
+
+		buff.Write(encoded)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			buff.Write(encodeNil())
+			return nil
+		}
+
+		return marshalValue(buff, v.Elem())
+
+	case reflect.Bool:
+		buff.Write(encodeBool(v.Bool()))
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		buff.Write(encodeFloat(float64(v.Int())))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		buff.Write(encodeFloat(float64(v.Uint())))
+
+	case reflect.Float32, reflect.Float64:
+		buff.Write(encodeFloat(v.Float()))
+
+	case reflect.String:
+		if v.Len() > math.MaxUint16 {
+			buff.Write(encodeLongString(LongStringType, v.String()))
+		} else {
+			buff.Write(encodeString(v.String()))
+		}
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			buff.Write(encodeNil())
+			return nil
+		}
+
+		buff.Write(encodeStrictArrayHeader(v.Len()))
+
+		for i := 0; i < v.Len(); i++ {
+			if err := marshalValue(buff, v.Index(i)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return &UnsupportedTypeError{Type: v.Type()}
+		}
+
+		if v.IsNil() {
+			buff.Write(encodeNil())
+			return nil
+		}
+
+		keys := make([]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			keys = append(keys, key.String())
+		}
+		sort.Strings(keys)
+
+		buff.WriteByte(KeyValueObjectType)
+
+		for _, key := range keys {
+			buff.Write(encodeRawString(key))
+
+			if err := marshalValue(buff, v.MapIndex(reflect.ValueOf(key).Convert(v.Type().Key()))); err != nil {
+				return err
+			}
+		}
+
+		buff.Write(ObjectEndMarker[:])
+
+	case reflect.Struct:
+		buff.WriteByte(KeyValueObjectType)
+
+		for _, field := range structFields(v.Type()) {
+			value := v.FieldByIndex(field.index)
+
+			if field.omitEmpty && value.IsZero() {
+				continue
+			}
+
+			buff.Write(encodeRawString(field.name))
+
+			if err := marshalValue(buff, value); err != nil {
+				return err
+			}
+		}
+
+		buff.Write(ObjectEndMarker[:])
+
+	default:
+		return &UnsupportedTypeError{Type: v.Type()}
+	}
+
+	return nil
+}
+
+func unmarshalValue(value interface{}, target reflect.Value, path string) error {
+	if value == nil || value == (Undefined{}) {
+		switch target.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice:
+			target.Set(reflect.Zero(target.Type()))
+		}
+
+		return nil
+	}
+
+	source := reflect.ValueOf(value)
+	if source.Type().AssignableTo(target.Type()) {
+		target.Set(source)
+		return nil
+	}
+
+	typeError := &UnmarshalTypeError{Value: describe(value), Type: target.Type(), Field: path}
+
+	switch target.Kind() {
+	case reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+
+		return unmarshalValue(value, target.Elem(), path)
+
+	case reflect.Bool:
+		b, ok := value.(bool)
+		if !ok {
+			return typeError
+		}
+		target.SetBool(b)
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) || target.OverflowInt(int64(number)) {
+			return typeError
+		}
+		target.SetInt(int64(number))
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		number, ok := value.(float64)
+		if !ok || number != math.Trunc(number) || number < 0 || target.OverflowUint(uint64(number)) {
+			return typeError
+		}
+		target.SetUint(uint64(number))
+
+	case reflect.Float32, reflect.Float64:
+		number, ok := value.(float64)
+		if !ok || target.OverflowFloat(number) {
+			return typeError
+		}
+		target.SetFloat(number)
+
+	case reflect.String:
+		switch value := value.(type) {
+		case string:
+			target.SetString(value)
+		case XMLDocument:
+			target.SetString(string(value))
+		default:
+			return typeError
+		}
+
+	case reflect.Struct:
+		pairs, ok := properties(value)
+		if !ok || target.Type() == timeType {
+			return typeError
+		}
+
+		fields := structFields(target.Type())
+
+		for _, pair := range pairs {
+			field, ok := findField(fields, pair.Key)
+			if !ok {
+				continue
+			}
+
+			if err := unmarshalValue(pair.Value, target.FieldByIndex(field.index), joinPath(path, pair.Key)); err != nil {
+				return err
+			}
+		}
+
+	case reflect.Map:
+		pairs, ok := properties(value)
+		if !ok || target.Type().Key().Kind() != reflect.String {
+			return typeError
+		}
+
+		if target.IsNil() {
+			target.Set(reflect.MakeMap(target.Type()))
+		}
+
+		for _, pair := range pairs {
+			element := reflect.New(target.Type().Elem()).Elem()
+
+			if err := unmarshalValue(pair.Value, element, joinPath(path, pair.Key)); err != nil {
+				return err
+			}
+
+			target.SetMapIndex(reflect.ValueOf(pair.Key).Convert(target.Type().Key()), element)
+		}
+
+	case reflect.Slice:
+		items, ok := value.([]interface{})
+		if !ok {
+			return typeError
+		}
+
+		slice := reflect.MakeSlice(target.Type(), len(items), len(items))
+		for i, item := range items {
+			if err := unmarshalValue(item, slice.Index(i), path); err != nil {
+				return err
+			}
+		}
+
+		target.Set(slice)
+
+	case reflect.Array:
+		items, ok := value.([]interface{})
+		if !ok || len(items) > target.Len() {
+			return typeError
+		}
+
+		for i, item := range items {
+			if err := unmarshalValue(item, target.Index(i), path); err != nil {
+				return err
+			}
+		}
+
+	default:
+		return typeError
+	}
+
+	return nil
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+// structFields lists the exported fields of a struct in the order of declaration,
+// including the promoted fields of embedded structs.
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag := field.Tag.Get("amf")
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			for _, promoted := range structFields(field.Type) {
+				promoted.index = append([]int{i}, promoted.index...)
+				fields = append(fields, promoted)
+			}
+			continue
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, structField{name: name, index: []int{i}, omitEmpty: options == "omitempty"})
+	}
+
+	return fields
+}
+
+// findField prefers an exact match of the name falling back to a case-insensitive one.
+func findField(fields []structField, name string) (structField, bool) {
+	for _, field := range fields {
+		if field.name == name {
+			return field, true
+		}
+	}
+
+	for _, field := range fields {
+		if strings.EqualFold(field.name, name) {
+			return field, true
+		}
+	}
+
+	return structField{}, false
+}
+
+// properties returns key-value pairs of values which can be unmarshalled into structs and maps.
+func properties(value interface{}) ([]*KeyValuePair, bool) {
+	var object map[string]interface{}
+
+	switch value := value.(type) {
+	case []*KeyValuePair:
+		return value, true
+	case OrderedObject:
+		return value, true
+	case map[string]interface{}:
+		object = value
+	case *TypedObject:
+		object = value.Properties
+	default:
+		return nil, false
+	}
+
+	pairs := make([]*KeyValuePair, 0, len(object))
+	for key, value := range object {
+		pairs = append(pairs, &KeyValuePair{Key: key, Value: value})
+	}
+
+	return pairs, true
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// describe names the AMF type of a decoded value.
+func describe(value interface{}) string {
+	switch value.(type) {
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case map[string]interface{}, OrderedObject:
+		return "object"
+	case *TypedObject:
+		return "typed object"
+	case []*KeyValuePair:
+		return "ECMA array"
+	case []interface{}:
+		return "strict array"
+	case time.Time:
+		return "date"
+	case XMLDocument, XML:
+		return "XML document"
+	case Unsupported:
+		return "unsupported"
+	default:
+		return reflect.TypeOf(value).String()
+	}
+}
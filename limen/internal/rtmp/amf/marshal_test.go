@@ -0,0 +1,202 @@
+package amf
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type marshalInner struct {
+	Codec string `amf:"codec"`
+}
+
+type marshalEmbedded struct {
+	Version float64 `amf:"version"`
+}
+
+type marshalOuter struct {
+	marshalEmbedded
+	Name     string                 `amf:"name"`
+	Count    int                    `amf:"count,omitempty"`
+	Secret   string                 `amf:"-"`
+	Inner    marshalInner           `amf:"inner"`
+	Tags     []string               `amf:"tags"`
+	Extra    map[string]interface{} `amf:"extra,omitempty"`
+	internal string
+}
+
+func TestMarshalStruct(t *testing.T) {
+	encoded, err := Marshal(marshalOuter{
+		marshalEmbedded: marshalEmbedded{Version: 1},
+		Name:            "a",
+		Secret:          "hidden",
+		Inner:           marshalInner{Codec: "b"},
+		Tags:            []string{"c"},
+		internal:        "hidden",
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// object
+		0x03,
+		// version: 1
+		0x00, 0x07, 'v', 'e', 'r', 's', 'i', 'o', 'n',
+		0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// name: "a"
+		0x00, 0x04, 'n', 'a', 'm', 'e',
+		0x02, 0x00, 0x01, 'a',
+		// inner: {codec: "b"}
+		0x00, 0x05, 'i', 'n', 'n', 'e', 'r',
+		0x03,
+		0x00, 0x05, 'c', 'o', 'd', 'e', 'c',
+		0x02, 0x00, 0x01, 'b',
+		0x00, 0x00, 0x09,
+		// tags: ["c"]
+		0x00, 0x04, 't', 'a', 'g', 's',
+		0x0a, 0x00, 0x00, 0x00, 0x01,
+		0x02, 0x00, 0x01, 'c',
+		// object end
+		0x00, 0x00, 0x09,
+	}, encoded)
+}
+
+func TestMarshalMapWithSortedKeys(t *testing.T) {
+	encoded, err := Marshal(map[string]int{"b": 2, "a": 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		// object
+		0x03,
+		// a: 1
+		0x00, 0x01, 'a',
+		0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// b: 2
+		0x00, 0x01, 'b',
+		0x00, 0x40, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// object end
+		0x00, 0x00, 0x09,
+	}, encoded)
+}
+
+func TestMarshalNilValues(t *testing.T) {
+	var pointer *marshalInner
+	var slice []string
+	var object map[string]interface{}
+
+	for _, value := range []interface{}{nil, pointer, slice, object} {
+		encoded, err := Marshal(value)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{0x05}, encoded)
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	_, err := Marshal(map[string]interface{}{"callback": func() {}})
+
+	assert.Equal(t, &UnsupportedTypeError{Type: reflect.TypeOf(func() {})}, err)
+
+	_, err = Marshal(map[int]string{})
+	assert.Equal(t, &UnsupportedTypeError{Type: reflect.TypeOf(map[int]string{})}, err)
+}
+
+func TestMarshalUnmarshalRoundTrip(t *testing.T) {
+	original := marshalOuter{
+		marshalEmbedded: marshalEmbedded{Version: 3},
+		Name:            "stream",
+		Count:           7,
+		Inner:           marshalInner{Codec: "avc1"},
+		Tags:            []string{"live", "hd"},
+		Extra:           map[string]interface{}{"created": time.UnixMilli(1000).UTC()},
+	}
+
+	encoded, err := Marshal(original)
+	assert.Nil(t, err)
+
+	var decoded marshalOuter
+	assert.Nil(t, Unmarshal(encoded, &decoded))
+	assert.Equal(t, original, decoded)
+}
+
+func TestUnmarshalECMAArrayIntoStruct(t *testing.T) {
+	type metadata struct {
+		Width     uint16
+		Framerate float32
+		Stereo    bool   `amf:"stereo"`
+		Encoder   string `amf:"encoder"`
+	}
+
+	var decoded metadata
+	err := UnmarshalValue([]*KeyValuePair{
+		{Key: "width", Value: 1280.0},
+		{Key: "framerate", Value: 30.0},
+		{Key: "stereo", Value: true},
+		{Key: "encoder", Value: "obs"},
+		{Key: "unknown", Value: "ignored"},
+	}, &decoded)
+
+	assert.Nil(t, err)
+	assert.Equal(t, metadata{Width: 1280, Framerate: 30, Stereo: true, Encoder: "obs"}, decoded)
+}
+
+func TestUnmarshalIntoPointersMapsAndInterfaces(t *testing.T) {
+	var decoded struct {
+		Inner  *marshalInner      `amf:"inner"`
+		Counts map[string]int     `amf:"counts"`
+		Any    interface{}        `amf:"any"`
+		Values [2]float64         `amf:"values"`
+		Typed  map[string]float64 `amf:"typed"`
+	}
+
+	err := UnmarshalValue(map[string]interface{}{
+		"inner":  map[string]interface{}{"codec": "mp4a"},
+		"counts": []*KeyValuePair{{Key: "a", Value: 1.0}},
+		"any":    []interface{}{"x"},
+		"values": []interface{}{1.0, 2.0},
+		"typed":  &TypedObject{ClassName: "Size", Properties: map[string]interface{}{"w": 4.0}},
+	}, &decoded)
+
+	assert.Nil(t, err)
+	assert.Equal(t, &marshalInner{Codec: "mp4a"}, decoded.Inner)
+	assert.Equal(t, map[string]int{"a": 1}, decoded.Counts)
+	assert.Equal(t, []interface{}{"x"}, decoded.Any)
+	assert.Equal(t, [2]float64{1, 2}, decoded.Values)
+	assert.Equal(t, map[string]float64{"w": 4}, decoded.Typed)
+
+	assert.Nil(t, UnmarshalValue(map[string]interface{}{"inner": nil}, &decoded))
+	assert.Nil(t, decoded.Inner)
+}
+
+func TestUnmarshalTypeMismatch(t *testing.T) {
+	var decoded marshalOuter
+
+	err := UnmarshalValue(map[string]interface{}{
+		"inner": map[string]interface{}{"codec": 1.0},
+	}, &decoded)
+	assert.Equal(t, &UnmarshalTypeError{Value: "number", Type: reflect.TypeOf(""), Field: "inner.codec"}, err)
+	assert.Equal(t, "amf: cannot unmarshal number into Go struct field inner.codec of type string", err.Error())
+
+	var count uint8
+	assert.Equal(t, &UnmarshalTypeError{Value: "number", Type: reflect.TypeOf(count)}, UnmarshalValue(256.0, &count))
+	assert.Equal(t, &UnmarshalTypeError{Value: "number", Type: reflect.TypeOf(count)}, UnmarshalValue(1.5, &count))
+	assert.Equal(t, &UnmarshalTypeError{Value: "number", Type: reflect.TypeOf(count)}, UnmarshalValue(-1.0, &count))
+
+	var created time.Time
+	assert.Equal(t, &UnmarshalTypeError{Value: "object", Type: reflect.TypeOf(created)}, UnmarshalValue(map[string]interface{}{}, &created))
+}
+
+func TestUnmarshalInvalidTarget(t *testing.T) {
+	var decoded marshalOuter
+
+	assert.Equal(t, &InvalidUnmarshalError{Type: reflect.TypeOf(decoded)}, UnmarshalValue(nil, decoded))
+	assert.Equal(t, &InvalidUnmarshalError{}, UnmarshalValue(nil, nil))
+	assert.Equal(t, &InvalidUnmarshalError{Type: reflect.TypeOf(&decoded)}, UnmarshalValue(nil, (*marshalOuter)(nil)))
+}
+
+func TestUnmarshalRequiresSingleValue(t *testing.T) {
+	var value string
+
+	assert.Equal(t, ErrNotSingleValue, Unmarshal([]byte{}, &value))
+	assert.Equal(t, ErrNotSingleValue, Unmarshal([]byte{0x05, 0x05}, &value))
+}
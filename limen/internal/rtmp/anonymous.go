@@ -51,6 +51,19 @@ func (c *AnonymousMessage) Serialize() []byte {
 	return buff.Bytes()
 }
 
+// SerializeAMF3 encodes the message as the payload of an AMF3 command message,
+// the name and transaction id stay in AMF0 while the properties switch to AMF3.
+func (c *AnonymousMessage) SerializeAMF3() []byte {
+	properties := make([]interface{}, 0, len(c.Properties))
+	for _, p := range c.Properties {
+		properties = append(properties, amf.AVMPlus{Value: p})
+	}
+
+	message := &AnonymousMessage{Name: c.Name, TxId: c.TxId, Properties: properties}
+
+	return append([]byte{0x00}, message.Serialize()...)
+}
+
 func (c *AnonymousMessage) Deserialize(payload interface{}) error {
 	if p, ok := payload.([]interface{}); ok {
 		if len(p) < 3 {
@@ -82,3 +95,12 @@ func (c *AnonymousMessage) Deserialize(payload interface{}) error {
 
 	return nil
 }
+
+// AnonymousDataMessage is an AnonymousMessage sent as AMF data instead of a command.
+type AnonymousDataMessage struct {
+	AnonymousMessage
+}
+
+func (c *AnonymousDataMessage) Type() uint8 {
+	return AmfDataType
+}
@@ -0,0 +1,733 @@
+package rtmp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp/amf"
+)
+
+const (
+	DefaultPort     = 1935
+	ClientChunkSize = 4096
+
+	clientFlashVersion = "FMLE/3.0 (compatible; limen)"
+
+	// responses nobody waits for are dropped once the buffer fills up
+	responseBufferSize = 16
+	mediaBufferSize    = 64
+)
+
+var (
+	ErrInvalidURL      = errors.New("invalid rtmp url")
+	ErrCommandRejected = errors.New("command rejected by the server")
+	ErrClientClosed    = errors.New("rtmp: client closed")
+)
+
+// statuses after which the server no longer sends or accepts media of the stream
+var streamEndCodes = map[string]bool{
+	"NetStream.Play.Stop":            true,
+	"NetStream.Play.UnpublishNotify": true,
+	"NetStream.Unpublish.Success":    true,
+}
+
+// Status is the information object of onStatus commands and command responses.
+type Status struct {
+	Level       string `amf:"level"`
+	Code        string `amf:"code"`
+	Description string `amf:"description"`
+}
+
+// Client is a connection to an RTMP server publishing or playing a single stream.
+//
+// After Dial the client is connected to the application of the url, Publish or Play
+// then starts the stream. Control messages get handled in the background for the
+// whole lifetime of the client.
+type Client struct {
+	logger *slog.Logger
+	conn   net.Conn
+	info   MediaStreamInfo
+	tcUrl  string
+
+	// used only by the reading loop
+	reader        *bufio.Reader
+	messageReader *messageReader
+
+	writeMu       sync.Mutex
+	writer        *bufio.Writer
+	messageWriter *messageWriter
+	flow          *flowControl
+	// last acknowledgement window announced to the peer
+	ackWindowSent uint32
+
+	mu       sync.Mutex
+	txId     float64
+	status   *Status
+	streamId uint32
+
+	responses chan *AnonymousMessage
+	media     chan *MediaStreamData
+
+	closing   chan struct{}
+	closeOnce sync.Once
+	// closed by the reading loop after setting err
+	done chan struct{}
+	err  error
+}
+
+// Dial connects to the server of an rtmp://host[:port]/app/key url,
+// performs the handshake and connects to the application.
+func Dial(ctx context.Context, rawURL string) (*Client, error) {
+	address, tcUrl, info, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	flow := newFlowControl(WindowAcknowledgementSize)
+
+	c := &Client{
+		logger:        slog.Default().With("url", rawURL),
+		conn:          conn,
+		info:          info,
+		tcUrl:         tcUrl,
+		reader:        bufio.NewReader(&countingReader{reader: conn, flow: flow}),
+		messageReader: NewMessageReader(),
+		writer:        bufio.NewWriter(&countingWriter{writer: conn, flow: flow}),
+		messageWriter: NewMessageWriter(),
+		flow:          flow,
+		responses:     make(chan *AnonymousMessage, responseBufferSize),
+		media:         make(chan *MediaStreamData, mediaBufferSize),
+		closing:       make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+
+	c.messageWriter.SetChunkSize(DefaultChunkSize)
+
+	if err := c.handshake(ctx); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+
+	if err := c.connect(ctx); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// parseURL returns the address to dial, the url of the application
+// and the application with the stream key, the port defaults to 1935.
+func parseURL(rawURL string) (string, string, MediaStreamInfo, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "rtmp" || u.Hostname() == "" {
+		return "", "", MediaStreamInfo{}, ErrInvalidURL
+	}
+
+	app, streamKey, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if app == "" || streamKey == "" {
+		return "", "", MediaStreamInfo{}, ErrInvalidURL
+	}
+
+	// tokens are usually passed to the server as a part of the stream key
+	if u.RawQuery != "" {
+		streamKey += "?" + u.RawQuery
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = fmt.Sprint(DefaultPort)
+	}
+
+	address := net.JoinHostPort(u.Hostname(), port)
+	tcUrl := fmt.Sprintf("rtmp://%s/%s", u.Host, app)
+
+	return address, tcUrl, MediaStreamInfo{App: app, StreamKey: streamKey}, nil
+}
+
+func (c *Client) Info() MediaStreamInfo {
+	return c.info
+}
+
+// Status returns the last status received from the server, nil if there was none.
+func (c *Client) Status() *Status {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.status
+}
+
+// Done is closed when the stream or the connection ends, Err tells why.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns io.EOF if the server has ended the stream or closed the connection,
+// ErrClientClosed after Close and other errors if the connection failed.
+// It returns nil while the client is running.
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Publish starts publishing the stream, media is then sent with WriteMedia.
+func (c *Client) Publish(ctx context.Context) error {
+	// responses to those are not needed and some servers don't send any
+	releaseStream := &ReleaseStreamCommand{StreamKey: c.info.StreamKey, TxId: c.nextTxId()}
+	if err := c.sendCommand(0, releaseStream); err != nil {
+		return err
+	}
+
+	fcPublish := &FCPublishCommand{StreamKey: c.info.StreamKey, TxId: c.nextTxId()}
+	if err := c.sendCommand(0, fcPublish); err != nil {
+		return err
+	}
+
+	streamId, err := c.createStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	publish := &PublishCommand{StreamKey: c.info.StreamKey, PublishType: "live", TxId: c.nextTxId()}
+	if err := c.sendCommand(streamId, publish); err != nil {
+		return err
+	}
+
+	_, err = c.waitForStatus(ctx, "NetStream.Publish.Start")
+	return err
+}
+
+// Play starts playing the stream, media is then received with ReadMedia.
+func (c *Client) Play(ctx context.Context) error {
+	streamId, err := c.createStream(ctx)
+	if err != nil {
+		return err
+	}
+
+	play := &PlayCommand{
+		StreamKey: c.info.StreamKey,
+		Start:     PlayStartLive,
+		Duration:  PlayDurationUntilEnd,
+		Reset:     true,
+		TxId:      c.nextTxId(),
+	}
+	if err := c.sendCommand(streamId, play); err != nil {
+		return err
+	}
+
+	_, err = c.waitForStatus(ctx, "NetStream.Play.Start")
+	return err
+}
+
+// ReadMedia returns the next message of the played stream,
+// io.EOF is returned once the stream has ended.
+func (c *Client) ReadMedia() (*MediaStreamData, error) {
+	data, ok := <-c.media
+	if !ok {
+		return nil, c.err
+	}
+
+	return data, nil
+}
+
+// WriteMedia sends a message of the published stream,
+// io.EOF is returned if the server has ended the stream.
+func (c *Client) WriteMedia(data *MediaStreamData) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+
+	var chunkStreamId uint32
+	var msgType uint8
+	payload := data.Data
+
+	switch data.Type {
+	case registry.AudioPacket:
+		chunkStreamId = audioChunkStreamId
+		msgType = AudioType
+	case registry.VideoPacket:
+		chunkStreamId = videoChunkStreamId
+		msgType = VideoType
+	default:
+		chunkStreamId = dataChunkStreamId
+		msgType = AmfDataType
+
+		// servers expect the metadata to be stored with the @setDataFrame prefix
+		prefix, _ := amf.NewAMF0Encoder().Encode("@setDataFrame")
+		payload = append(prefix, data.Data...)
+	}
+
+	if err := c.flow.waitForWindow(writeTimeout); err != nil {
+		return err
+	}
+
+	return c.sendMessage(&Message{
+		Header: &Header{
+			Type:          msgType,
+			ChunkStreamId: chunkStreamId,
+			Timestamp:     data.Timestamp,
+			BodySize:      uint32(len(payload)),
+			StreamId:      c.currentStreamId(),
+		},
+		Payload: payload,
+	})
+}
+
+// Close deletes the stream and closes the connection.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+
+		if streamId := c.currentStreamId(); streamId != 0 {
+			txId := float64(0)
+			deleteStream := &AnonymousMessage{Name: "deleteStream", TxId: &txId, Properties: []interface{}{nil, float64(streamId)}}
+
+			// the connection might already be broken, it is closed either way
+			_ = c.sendCommand(0, deleteStream)
+		}
+
+		c.conn.Close()
+		c.flow.close()
+	})
+
+	<-c.done
+
+	return nil
+}
+
+func (c *Client) handshake(ctx context.Context) error {
+	stop := c.interruptOnCancel(ctx)
+	defer stop()
+
+	if err := c.exchangeHandshake(); err != nil {
+		// failures caused by the interrupted reads and writes
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		return err
+	}
+
+	// the deadline might have been set right after the handshake
+	return c.conn.SetDeadline(time.Time{})
+}
+
+func (c *Client) exchangeHandshake() error {
+	handshake := NewHandshake()
+
+	if _, err := c.writer.Write(handshake.GenerateC0C1()); err != nil {
+		return err
+	}
+
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+
+	if err := handshake.ReceiveS0S1(c.reader); err != nil {
+		return err
+	}
+
+	if _, err := c.writer.Write(handshake.GetC2()); err != nil {
+		return err
+	}
+
+	if err := c.writer.Flush(); err != nil {
+		return err
+	}
+
+	return handshake.ReceiveS2(c.reader)
+}
+
+// interruptOnCancel makes blocked reads and writes fail once the context gets cancelled.
+func (c *Client) interruptOnCancel(ctx context.Context) func() {
+	stopped := make(chan struct{})
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Now())
+		case <-stopped:
+		}
+	}()
+
+	return func() {
+		close(stopped)
+	}
+}
+
+func (c *Client) connect(ctx context.Context) error {
+	connect := &ConnectCommand{
+		App:            c.info.App,
+		Type:           "nonprivate",
+		FlashVer:       clientFlashVersion,
+		TcUrl:          c.tcUrl,
+		ObjectEncoding: ObjectEncodingAMF0,
+		FourCcList:     supportedFourCcs(),
+		TxId:           c.nextTxId(),
+	}
+
+	if _, err := c.call(ctx, connect, connect.TxId); err != nil {
+		return err
+	}
+
+	if err := c.sendMessage(c.controlMessage(&SetChunkSizeMessage{ChunkSize: ClientChunkSize})); err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	c.messageWriter.SetChunkSize(ClientChunkSize)
+	c.writeMu.Unlock()
+
+	return nil
+}
+
+func (c *Client) createStream(ctx context.Context) (uint32, error) {
+	createStream := &CreateStreamCommand{TxId: c.nextTxId()}
+
+	response, err := c.call(ctx, createStream, createStream.TxId)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(response.Properties) == 0 {
+		return 0, ErrInvalidMessageFormat
+	}
+
+	streamId, ok := response.Properties[len(response.Properties)-1].(float64)
+	if !ok {
+		return 0, ErrInvalidMessageFormat
+	}
+
+	c.mu.Lock()
+	c.streamId = uint32(streamId)
+	c.mu.Unlock()
+
+	return uint32(streamId), nil
+}
+
+// call sends a command on the connection's stream and waits for its result.
+func (c *Client) call(ctx context.Context, command interface{ Serialize() []byte }, txId float64) (*AnonymousMessage, error) {
+	if err := c.sendCommand(0, command); err != nil {
+		return nil, err
+	}
+
+	response, err := c.waitFor(ctx, func(msg *AnonymousMessage) bool {
+		return (msg.Name == "_result" || msg.Name == "_error") && msg.TxId != nil && *msg.TxId == txId
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if response.Name == "_error" {
+		return nil, rejectedError(responseStatus(response))
+	}
+
+	return response, nil
+}
+
+// waitForStatus waits for a status with the given code, failing on any error status.
+func (c *Client) waitForStatus(ctx context.Context, code string) (*Status, error) {
+	for {
+		response, err := c.waitFor(ctx, func(msg *AnonymousMessage) bool {
+			return msg.Name == "onStatus"
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		status := responseStatus(response)
+
+		if status.Level == "error" {
+			return nil, rejectedError(status)
+		}
+
+		if status.Code == code {
+			return status, nil
+		}
+	}
+}
+
+func (c *Client) waitFor(ctx context.Context, match func(msg *AnonymousMessage) bool) (*AnonymousMessage, error) {
+	for {
+		select {
+		case msg := <-c.responses:
+			if match(msg) {
+				return msg, nil
+			}
+
+		case <-ctx.Done():
+			return nil, ctx.Err()
+
+		case <-c.done:
+			// responses received right before the connection ended
+			for {
+				select {
+				case msg := <-c.responses:
+					if match(msg) {
+						return msg, nil
+					}
+				default:
+					if c.err == io.EOF {
+						return nil, io.ErrUnexpectedEOF
+					}
+
+					return nil, c.err
+				}
+			}
+		}
+	}
+}
+
+func responseStatus(msg *AnonymousMessage) *Status {
+	status := &Status{}
+
+	if len(msg.Properties) > 0 {
+		// the information object is always the last one
+		_ = amf.UnmarshalValue(msg.Properties[len(msg.Properties)-1], status)
+	}
+
+	return status
+}
+
+func rejectedError(status *Status) error {
+	return fmt.Errorf("%w: %s %s", ErrCommandRejected, status.Code, status.Description)
+}
+
+func (c *Client) nextTxId() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.txId++
+
+	return c.txId
+}
+
+func (c *Client) currentStreamId() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.streamId
+}
+
+// readLoop handles messages coming from the server until the connection or the stream ends.
+func (c *Client) readLoop() {
+	err := c.readMessages()
+
+	select {
+	case <-c.closing:
+		err = ErrClientClosed
+	default:
+	}
+
+	c.err = err
+	c.flow.close()
+	close(c.media)
+	close(c.done)
+}
+
+func (c *Client) readMessages() error {
+	for {
+		rawMsg, err := c.messageReader.ReadMessage(c.reader)
+		if err != nil {
+			return err
+		}
+
+		if sequenceNumber, ok := c.flow.pendingAcknowledgement(); ok {
+			ack := &AcknowledgementMessage{SequenceNumber: sequenceNumber}
+			if err := c.sendMessage(c.controlMessage(ack)); err != nil {
+				return err
+			}
+		}
+
+		if err := c.handleMessage(rawMsg); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *Client) handleMessage(rawMsg *Message) error {
+	switch rawMsg.Header.Type {
+	case AudioType:
+		return c.deliverMedia(&MediaStreamData{Type: registry.AudioPacket, Timestamp: rawMsg.Header.Timestamp, Data: rawMsg.Payload})
+
+	case VideoType:
+		return c.deliverMedia(&MediaStreamData{Type: registry.VideoPacket, Timestamp: rawMsg.Header.Timestamp, Data: rawMsg.Payload})
+
+	case AmfDataType, Amf3DataType:
+		return c.handleData(rawMsg)
+	}
+
+	msg, err := ParseMessage(rawMsg)
+	if err != nil {
+		// servers send plenty of commands we don't care about in all sorts of shapes
+		c.logger.Debug("Ignoring invalid message", "type", rawMsg.Header.Type, "error", err)
+		return nil
+	}
+
+	switch msg := msg.(type) {
+	case *SetChunkSizeMessage:
+		c.messageReader.SetChunkSize(int32(msg.ChunkSize))
+
+	case *AcknowledgementMessage:
+		c.flow.acknowledged(msg.SequenceNumber)
+
+	case *WindowAcknowledgementSizeMessage:
+		c.flow.setAckWindow(msg.Size)
+
+	case *SetPeerBandwidthMessage:
+		return c.handleSetPeerBandwidth(msg)
+
+	case *UserControlMessage:
+		if msg.EventType == UserControlPingRequest {
+			pong := &UserControlMessage{EventType: UserControlPingResponse, Data: msg.Data}
+			return c.sendMessage(c.controlMessage(pong))
+		}
+
+	case *AnonymousMessage:
+		return c.handleCommand(msg)
+	}
+
+	return nil
+}
+
+func (c *Client) handleSetPeerBandwidth(msg *SetPeerBandwidthMessage) error {
+	if !c.flow.setPeerBandwidth(msg.Size, msg.LimitType) {
+		return nil
+	}
+
+	if msg.Size == c.ackWindowSent {
+		return nil
+	}
+
+	c.ackWindowSent = msg.Size
+
+	return c.sendMessage(c.controlMessage(&WindowAcknowledgementSizeMessage{Size: msg.Size}))
+}
+
+func (c *Client) handleCommand(msg *AnonymousMessage) error {
+	if msg.Name != "_result" && msg.Name != "_error" && msg.Name != "onStatus" {
+		c.logger.Debug("Ignoring unsupported command", "name", msg.Name)
+		return nil
+	}
+
+	select {
+	case c.responses <- msg:
+	default:
+		c.logger.Debug("Dropping unexpected response", "name", msg.Name)
+	}
+
+	if msg.Name != "onStatus" {
+		return nil
+	}
+
+	status := responseStatus(msg)
+
+	c.mu.Lock()
+	c.status = status
+	c.mu.Unlock()
+
+	if streamEndCodes[status.Code] {
+		return io.EOF
+	}
+
+	return nil
+}
+
+// handleData passes the stream's metadata, other data messages are ignored.
+func (c *Client) handleData(rawMsg *Message) error {
+	payload := rawMsg.Payload
+	if rawMsg.Header.Type == Amf3DataType {
+		if len(payload) < 1 {
+			return nil
+		}
+
+		payload = payload[1:]
+	}
+
+	values, err := amf.NewAMF0Decoder().Decode(bufio.NewReader(bytes.NewReader(payload)))
+	if err != nil || len(values) == 0 || values[0] != "onMetaData" {
+		return nil
+	}
+
+	return c.deliverMedia(&MediaStreamData{Type: registry.MetadataPacket, Timestamp: rawMsg.Header.Timestamp, Data: payload})
+}
+
+func (c *Client) deliverMedia(data *MediaStreamData) error {
+	select {
+	case c.media <- data:
+		return nil
+	case <-c.closing:
+		return ErrClientClosed
+	}
+}
+
+func (c *Client) sendCommand(streamId uint32, command interface{ Serialize() []byte }) error {
+	payload := command.Serialize()
+
+	return c.sendMessage(&Message{
+		Header: &Header{
+			Type:          AmfCommandType,
+			ChunkStreamId: responseChunkStreamId,
+			BodySize:      uint32(len(payload)),
+			StreamId:      streamId,
+		},
+		Payload: payload,
+	})
+}
+
+func (c *Client) controlMessage(msg MessageSerializer) *Message {
+	payload := msg.Serialize()
+
+	return &Message{
+		Header: &Header{
+			Type:          msg.Type(),
+			ChunkStreamId: controlChunkStreamId,
+			BodySize:      uint32(len(payload)),
+		},
+		Payload: payload,
+	}
+}
+
+// sendMessage is safe to be called both from the reading loop and the user's goroutines.
+func (c *Client) sendMessage(message *Message) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	payload, err := c.messageWriter.Write(message)
+	if err != nil {
+		return err
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
+	if _, err := c.writer.Write(payload); err != nil {
+		return err
+	}
+
+	return c.writer.Flush()
+}
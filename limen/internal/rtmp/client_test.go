@@ -0,0 +1,263 @@
+package rtmp
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/registry"
+)
+
+func startStreamingServer(t *testing.T, callbacks *HandlerCallabcks) (*RtmpServer, *registry.Registry, string) {
+	streams := registry.New(registry.Options{PublishPolicy: registry.RejectDuplicate})
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	server, addr, _ := startServer(t, func(ctx context.Context, conn net.Conn) error {
+		return NewHandler(conn, logger, callbacks, streams).Run(ctx)
+	})
+
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		server.Shutdown(ctx)
+	})
+
+	return server, streams, "rtmp://" + addr + "/live/key"
+}
+
+func allowAllCallbacks() *HandlerCallabcks {
+	return &HandlerCallabcks{
+		OnAuthorize:    func(streamKey string) bool { return true },
+		OnPlay:         func(streamKey string) bool { return true },
+		OnSetDataFrame: func(message SetDataFrameMessage) bool { return true },
+	}
+}
+
+func dialClient(t *testing.T, url string) *Client {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, url)
+	assert.Nil(t, err)
+
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func startPublisher(t *testing.T, url string) *Client {
+	client := dialClient(t, url)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, client.Publish(ctx))
+
+	return client
+}
+
+func startPlayer(t *testing.T, url string) *Client {
+	client := dialClient(t, url)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, client.Play(ctx))
+
+	return client
+}
+
+func readMedia(t *testing.T, client *Client) *MediaStreamData {
+	result := make(chan *MediaStreamData, 1)
+
+	go func() {
+		data, _ := client.ReadMedia()
+		result <- data
+	}()
+
+	select {
+	case data := <-result:
+		return data
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for media")
+		return nil
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	address, tcUrl, info, err := parseURL("rtmp://localhost/live/key")
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:1935", address)
+	assert.Equal(t, "rtmp://localhost/live", tcUrl)
+	assert.Equal(t, MediaStreamInfo{App: "live", StreamKey: "key"}, info)
+
+	address, tcUrl, info, err = parseURL("rtmp://127.0.0.1:1936/live/key/sub?token=abc")
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:1936", address)
+	assert.Equal(t, "rtmp://127.0.0.1:1936/live", tcUrl)
+	assert.Equal(t, MediaStreamInfo{App: "live", StreamKey: "key/sub?token=abc"}, info)
+
+	for _, url := range []string{"http://localhost/live/key", "rtmp://localhost/live", "rtmp:///live/key", "rtmp://localhost//key"} {
+		_, _, _, err := parseURL(url)
+		assert.Equal(t, ErrInvalidURL, err, url)
+	}
+}
+
+func TestClientPublishAndPlay(t *testing.T) {
+	_, _, url := startStreamingServer(t, allowAllCallbacks())
+
+	publisher := startPublisher(t, url)
+
+	metadata := marshalCommand("onMetaData", &SetDataFrameMessage{Width: 1280, Height: 720})
+	videoConfig := []byte{0x17, 0x00, 0x00, 0x00, 0x00, 0x01}
+	keyFrame := []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0xff, 0xff}
+	interFrame := []byte{0x27, 0x01, 0x00, 0x00, 0x00, 0xff}
+	audioConfig := []byte{0xaf, 0x00, 0x12, 0x10}
+
+	for _, data := range []*MediaStreamData{
+		{Type: registry.MetadataPacket, Timestamp: 0, Data: metadata},
+		{Type: registry.VideoPacket, Timestamp: 0, Data: videoConfig},
+		{Type: registry.AudioPacket, Timestamp: 0, Data: audioConfig},
+		{Type: registry.VideoPacket, Timestamp: 1000, Data: keyFrame},
+	} {
+		assert.Nil(t, publisher.WriteMedia(data))
+	}
+
+	// the stream is only visible to players once the server handles the messages
+	assert.Eventually(t, func() bool {
+		player := dialClient(t, url)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := player.Play(ctx); err != nil {
+			return false
+		}
+
+		assert.Equal(t, &MediaStreamData{Type: registry.MetadataPacket, Timestamp: 0, Data: metadata}, readMedia(t, player))
+		assert.Equal(t, &MediaStreamData{Type: registry.VideoPacket, Timestamp: 0, Data: videoConfig}, readMedia(t, player))
+		assert.Equal(t, &MediaStreamData{Type: registry.AudioPacket, Timestamp: 0, Data: audioConfig}, readMedia(t, player))
+		// the player's timeline starts at the cached key frame
+		assert.Equal(t, &MediaStreamData{Type: registry.VideoPacket, Timestamp: 0, Data: keyFrame}, readMedia(t, player))
+
+		assert.Nil(t, publisher.WriteMedia(&MediaStreamData{Type: registry.VideoPacket, Timestamp: 1040, Data: interFrame}))
+		assert.Equal(t, &MediaStreamData{Type: registry.VideoPacket, Timestamp: 40, Data: interFrame}, readMedia(t, player))
+
+		assert.Nil(t, publisher.Close())
+
+		_, err := player.ReadMedia()
+		assert.Equal(t, io.EOF, err)
+		assert.Equal(t, "NetStream.Play.UnpublishNotify", player.Status().Code)
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestClientPublishRejected(t *testing.T) {
+	callbacks := allowAllCallbacks()
+	callbacks.OnAuthorize = func(streamKey string) bool { return streamKey == "key" }
+
+	_, _, url := startStreamingServer(t, callbacks)
+
+	startPublisher(t, url)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the stream is already being published
+	duplicate := dialClient(t, url)
+	assert.ErrorIs(t, duplicate.Publish(ctx), ErrCommandRejected)
+	assert.Equal(t, "NetStream.Publish.BadName", duplicate.Status().Code)
+
+	// the server closes connections of unauthorized publishers
+	unauthorized := dialClient(t, url[:len(url)-len("key")]+"other")
+	assert.Equal(t, io.ErrUnexpectedEOF, unauthorized.Publish(ctx))
+}
+
+func TestClientPlayStreamNotFound(t *testing.T) {
+	_, _, url := startStreamingServer(t, allowAllCallbacks())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	player := dialClient(t, url)
+	assert.ErrorIs(t, player.Play(ctx), ErrCommandRejected)
+	assert.Equal(t, "NetStream.Play.StreamNotFound", player.Status().Code)
+}
+
+func TestShutdownNotifiesClients(t *testing.T) {
+	server, _, url := startStreamingServer(t, allowAllCallbacks())
+
+	publisher := startPublisher(t, url)
+	assert.Nil(t, publisher.WriteMedia(&MediaStreamData{Type: registry.VideoPacket, Data: []byte{0x17, 0x01, 0x00, 0x00, 0x00}}))
+
+	var player *Client
+	assert.Eventually(t, func() bool {
+		player = dialClient(t, url)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return player.Play(ctx) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, server.Shutdown(ctx))
+
+	<-publisher.Done()
+	assert.Equal(t, io.EOF, publisher.Err())
+	assert.Equal(t, "NetStream.Unpublish.Success", publisher.Status().Code)
+	assert.Equal(t, io.EOF, publisher.WriteMedia(&MediaStreamData{Type: registry.VideoPacket, Data: []byte{0x27, 0x01}}))
+
+	for {
+		if _, err := player.ReadMedia(); err != nil {
+			assert.Equal(t, io.EOF, err)
+			break
+		}
+	}
+
+	// depending on which connection shuts down first
+	assert.Contains(t, []string{"NetStream.Play.Stop", "NetStream.Play.UnpublishNotify"}, player.Status().Code)
+}
+
+func TestDialHonorsContext(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	// accepts connections without ever answering the handshake
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = Dial(ctx, "rtmp://"+listener.Addr().String()+"/live/key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestClientClose(t *testing.T) {
+	_, _, url := startStreamingServer(t, allowAllCallbacks())
+
+	player := dialClient(t, url)
+	assert.Nil(t, player.Close())
+
+	_, err := player.ReadMedia()
+	assert.Equal(t, ErrClientClosed, err)
+	assert.Equal(t, ErrClientClosed, player.Err())
+}
@@ -0,0 +1,55 @@
+package rtmp
+
+import (
+	"fmt"
+
+	"limen/internal/rtmp/amf"
+)
+
+// marshalCommand encodes the values of a command one after another.
+func marshalCommand(values ...interface{}) []byte {
+	var payload []byte
+
+	for _, value := range values {
+		bytes, err := amf.Marshal(value)
+		if err != nil {
+			panic("failed to encode AMF payload")
+		}
+
+		payload = append(payload, bytes...)
+	}
+
+	return payload
+}
+
+// unmarshalCommand verifies the name of a command and stores the values following it
+// in the targets, a nil target skips the corresponding value.
+//
+// At least required values, including the name, must be present. Targets of the
+// missing optional values are left untouched so they can be preset with defaults.
+func unmarshalCommand(payload interface{}, name string, required int, targets ...interface{}) error {
+	p, ok := payload.([]interface{})
+	if !ok {
+		return ErrInvalidMessageFormat
+	}
+
+	if len(p) < required || len(p) > len(targets)+1 {
+		return ErrInvalidMessageFormat
+	}
+
+	if p[0] != name {
+		return ErrInvalidMessageFormat
+	}
+
+	for i, value := range p[1:] {
+		if targets[i] == nil {
+			continue
+		}
+
+		if err := amf.UnmarshalValue(value, targets[i]); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidMessageFormat, err)
+		}
+	}
+
+	return nil
+}
@@ -1,60 +1,54 @@
 package rtmp
 
-import (
-	"github.com/mitchellh/mapstructure"
-
-	"limen/internal/rtmp/amf"
-)
+import "limen/internal/flv"
 
 type ConnectCommand struct {
-	App            string  `mapstucture:"app"`
-	Type           string  `mapstucture:"type"`
-	FlashVer       string  `mapstructure:"flashVer"`
-	TcUrl          string  `mapstructure:"tcUrl"`
-	SupportsGoAway bool    `mapstucture:",omitempty"`
-	TxId           float64 `mapstructure:"-"`
+	App            string  `amf:"app"`
+	Type           string  `amf:"type,omitempty"`
+	FlashVer       string  `amf:"flashVer"`
+	TcUrl          string  `amf:"tcUrl"`
+	SupportsGoAway bool    `amf:"supportsGoAway,omitempty"`
+	ObjectEncoding float64 `amf:"objectEncoding"`
+	// FourCcList holds the extended video codecs of enhanced RTMP the client supports
+	FourCcList []string `amf:"fourCcList,omitempty"`
+	TxId       float64  `amf:"-"`
 }
 
 func (c *ConnectCommand) Serialize() []byte {
-	payload := []interface{}{
-		"connect",
-		c.TxId,
-		map[string]interface{}{
-			"app":            c.App,
-			"type":           c.Type,
-			"flashVer":       c.FlashVer,
-			"tcUrl":          c.TcUrl,
-			"supportsGoAway": c.SupportsGoAway,
-		},
-	}
-	bytes, _ := amf.NewAMF0Encoder().Encode(payload)
-
-	return bytes
+	return marshalCommand("connect", c.TxId, c)
 }
 
 func (c *ConnectCommand) Deserialize(payload interface{}) error {
-	if p, ok := payload.([]interface{}); ok {
-		if len(p) != 3 {
-			return ErrInvalidMessageFormat
-		}
+	return unmarshalCommand(payload, "connect", 3, &c.TxId, c)
+}
 
-		if p[0] != "connect" {
-			return ErrInvalidMessageFormat
-		}
+// fourCcWildcard in the list of a client stands for any codec
+const fourCcWildcard = "*"
 
-		if err := mapstructure.Decode(p[2], c); err != nil {
-			return ErrInvalidMessageFormat
-		}
+// supportedFourCcs returns the FourCCs of the extended video codecs which
+// can be published and played.
+func supportedFourCcs() []string {
+	var fourCcs []string
+	for _, fourCc := range flv.ExtVideoCodecs() {
+		fourCcs = append(fourCcs, string(fourCc[:]))
+	}
 
-		if txId, ok := p[1].(float64); ok {
-			c.TxId = txId
-		} else {
-			return ErrInvalidMessageFormat
-		}
+	return fourCcs
+}
 
-	} else {
-		return ErrInvalidMessageFormat
+// negotiateFourCcs returns the extended video codecs requested by the client
+// which are supported by the server, in the order of the server.
+func negotiateFourCcs(requested []string) []string {
+	var fourCcs []string
+
+	for _, fourCc := range supportedFourCcs() {
+		for _, other := range requested {
+			if other == fourCc || other == fourCcWildcard {
+				fourCcs = append(fourCcs, fourCc)
+				break
+			}
+		}
 	}
 
-	return nil
+	return fourCcs
 }
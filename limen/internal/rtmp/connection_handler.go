@@ -2,134 +2,202 @@ package rtmp
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net"
+	"sync"
 	"time"
+
+	"limen/internal/registry"
+	"limen/internal/rtmp/amf"
 )
 
 const (
 	WindowAcknowledgementSize = 2_500_000
 	PeerBandwidthSize         = 2_5_000_000
+	ServerChunkSize           = 4096
 )
 
 type HandlerCallabcks struct {
 	OnAuthorize    func(streamKey string) bool
+	OnPlay         func(streamKey string) bool
 	OnSetDataFrame func(message SetDataFrameMessage) bool
+	// OnStreamMissing is optional, it gets called when a player requests a stream
+	// which is not published and returns whether the stream got published since,
+	// e.g. by pulling it from another server.
+	OnStreamMissing func(app string, streamKey string) bool
 }
 
+const (
+	controlChunkStreamId  = 2
+	responseChunkStreamId = 3
+	audioChunkStreamId    = 4
+	dataChunkStreamId     = 5
+	videoChunkStreamId    = 6
+
+	// the only message stream we hand out in createStream responses
+	mediaMessageStreamId = 1
+
+	readTimeout  = 10 * time.Second
+	writeTimeout = 10 * time.Second
+)
+
 type handler struct {
-	logger              *slog.Logger
-	handshakeFinished   bool
-	connInitialized     bool
-	connAuthorized      bool
-	setDataFrameHandled bool
-	conn                net.Conn
-	callbacks           *HandlerCallabcks
-	reader              *bufio.Reader
-	writer              *bufio.Writer
-	messageReader       *messageReader
-	messageWriter       *messageWriter
-	currentTxId         uint32
-	mediaStreamWrapper  *mediaFlvWrapper
-	mediaChannel        chan interface{}
-}
-
-func NewHandler(conn net.Conn, logger *slog.Logger, callbacks *HandlerCallabcks, mediaChannel chan interface{}) *handler {
+	logger          *slog.Logger
+	connInitialized bool
+	conn            net.Conn
+	callbacks       *HandlerCallabcks
+	registry        *registry.Registry
+	reader          *bufio.Reader
+	writer          *bufio.Writer
+	writeMu         sync.Mutex
+	messageReader   *messageReader
+	messageWriter   *messageWriter
+	objectEncoding  float64
+	flow            *flowControl
+	// last acknowledgement window announced to the peer
+	ackWindowSent uint32
+	app           string
+	stream        *registry.Stream
+	playback      *playback
+}
+
+func NewHandler(conn net.Conn, logger *slog.Logger, callbacks *HandlerCallabcks, registry *registry.Registry) *handler {
+	flow := newFlowControl(WindowAcknowledgementSize)
+
 	return &handler{
-		conn:               conn,
-		logger:             logger,
-		callbacks:          callbacks,
-		reader:             bufio.NewReader(conn),
-		writer:             bufio.NewWriter(conn),
-		messageReader:      NewMessageReader(),
-		messageWriter:      NewMessageWriter(),
-		currentTxId:        1,
-		mediaStreamWrapper: NewMediaFlvWrapper(true, true),
-		mediaChannel:       mediaChannel,
+		conn:          conn,
+		logger:        logger,
+		callbacks:     callbacks,
+		registry:      registry,
+		reader:        bufio.NewReader(&countingReader{reader: conn, flow: flow}),
+		writer:        bufio.NewWriter(&countingWriter{writer: conn, flow: flow}),
+		messageReader: NewMessageReader(),
+		messageWriter: NewMessageWriter(),
+		flow:          flow,
 	}
 }
 
-func (h *handler) Run() error {
+// Run handles the connection until the peer disconnects or the context gets cancelled,
+// in which case the peer gets notified that its stream is over.
+func (h *handler) Run(ctx context.Context) error {
 	defer h.conn.Close()
+	defer h.flow.close()
 
 	defer func() {
 		h.logger.Info("Closing connection")
 	}()
 
+	defer h.release()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			// interrupts a blocked read, the reading loop takes care of the rest
+			h.conn.SetReadDeadline(time.Now())
+		case <-stopped:
+		}
+	}()
+
 	h.logger.Info("Handling connection")
-	for {
-		h.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 
-		if !h.handshakeFinished {
-			err := h.handleHandshake()
-			if err == ErrNotEnoughData {
-				continue
-			}
+	h.conn.SetReadDeadline(time.Now().Add(readTimeout))
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 
-			if err != nil {
-				return err
-			}
+	if err := h.handleHandshake(); err != nil {
+		return err
+	}
 
-			h.handshakeFinished = true
-			continue
+	for {
+		if h.playback != nil {
+			// players might not send anything for a long time,
+			// a broken connection gets detected by the playback writes
+			h.conn.SetReadDeadline(time.Time{})
+		} else {
+			h.conn.SetReadDeadline(time.Now().Add(readTimeout))
 		}
 
-		if !h.connInitialized {
-			err := h.handleInitialization()
+		// checked after setting the deadline, a later cancellation interrupts the read
+		if ctx.Err() != nil {
+			return h.shutdown()
+		}
 
-			if err == ErrNotEnoughData {
-				continue
-			}
+		err := h.handleMessage()
+		if ctx.Err() != nil {
+			return h.shutdown()
+		}
 
-			if err != nil {
-				h.logger.Info("Failed initialization")
-				return err
-			}
+		if err == io.EOF {
+			return nil
+		}
 
-			h.connInitialized = true
-			continue
+		if err != nil {
+			h.logger.Info(fmt.Sprintf("Failed to handle message: %s", err.Error()))
+			return err
 		}
+	}
+}
 
-		if !h.connAuthorized {
-			err := h.handleAuthorization()
+// release detaches the connection from the published or played stream.
+func (h *handler) release() {
+	if h.stream != nil {
+		h.stream.Unpublish()
+		h.stream = nil
+	}
 
-			if errors.Is(err, ErrNotEnoughData) {
-				continue
-			}
+	if h.playback != nil {
+		h.playback.subscription.Close()
+		h.playback = nil
+	}
+}
 
-			if err != nil {
-				h.logger.Info("Failed authorization")
-				return err
-			}
+// shutdown ends the published or played stream and lets the peer know about it.
+func (h *handler) shutdown() error {
+	h.logger.Info("Shutting down connection")
 
-			h.connAuthorized = true
-			continue
-		}
+	if h.stream != nil {
+		streamKey := h.stream.Key.Name
 
-		if !h.setDataFrameHandled {
-			err := h.handleSetDataFrame()
-			if err != nil {
-				h.logger.Info("Failed to handle setDataFrame")
-				return err
-			}
+		h.stream.Unpublish()
+		h.stream = nil
 
-			h.setDataFrameHandled = true
-			continue
+		response := unpublishSuccessResponse(streamKey)
+		if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+			return err
 		}
+	}
 
-		err := h.handleMessage()
-		if err == io.EOF {
+	if h.playback != nil {
+		playback := h.playback
+		h.playback = nil
+
+		playback.subscription.Close()
+		<-playback.done
+
+		// the player has already been notified about the unpublished stream
+		if playback.subscription.Reason() == registry.ReasonUnpublished {
 			return nil
 		}
 
-		if err != nil {
-			h.logger.Info(fmt.Sprintf("Failed to handle message: %s", err.Error()))
+		if err := h.serializeAndSendMessage(controlChunkStreamId, NewStreamEOFMessage(mediaMessageStreamId)); err != nil {
+			return err
+		}
+
+		response := playStopResponse(playback.streamKey)
+		if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
 			return err
 		}
 	}
+
+	return nil
 }
 
 func (h *handler) handleHandshake() error {
@@ -166,203 +234,397 @@ func (h *handler) handleHandshake() error {
 	return nil
 }
 
-func (h *handler) handleInitialization() error {
-	setChunkSize, err := h.readAndParseMessage()
+func (h *handler) handleMessage() error {
+	rawMsg, err := h.messageReader.ReadMessage(h.reader)
 	if err != nil {
 		return err
 	}
 
-	if setChunkSize, ok := setChunkSize.(*SetChunkSizeMessage); ok {
-		h.messageReader.SetChunkSize(int32(setChunkSize.ChunkSize))
-		h.messageWriter.SetChunkSize(int32(setChunkSize.ChunkSize))
-	} else {
-		return errors.New("expected SetChunkSize message")
+	if sequenceNumber, ok := h.flow.pendingAcknowledgement(); ok {
+		ack := &AcknowledgementMessage{SequenceNumber: sequenceNumber}
+		if err := h.serializeAndSendMessage(controlChunkStreamId, ack); err != nil {
+			return err
+		}
+	}
+
+	msg, err := ParseMessage(rawMsg)
+	if err != nil {
+		return err
 	}
 
-	connect, err := h.readAndParseMessage()
-	if _, ok := connect.(*ConnectCommand); !ok {
+	if _, ok := msg.(*ConnectCommand); !ok && !h.connInitialized && (rawMsg.Header.Type == AmfCommandType || rawMsg.Header.Type == Amf3CommandType) {
 		return errors.New("expected Connect command")
 	}
 
+	switch msg := msg.(type) {
+	case *SetChunkSizeMessage:
+		h.messageReader.SetChunkSize(int32(msg.ChunkSize))
+
+	case *AcknowledgementMessage:
+		h.flow.acknowledged(msg.SequenceNumber)
+
+	case *WindowAcknowledgementSizeMessage:
+		h.flow.setAckWindow(msg.Size)
+
+	case *SetPeerBandwidthMessage:
+		return h.handleSetPeerBandwidth(msg)
+
+	case *ConnectCommand:
+		return h.handleConnect(msg)
+
+	case *ReleaseStreamCommand:
+		return h.sendDefaultResponse(responseChunkStreamId, msg.TxId, []interface{}{})
+
+	case *FCPublishCommand:
+		return h.serializeAndSendMessage(responseChunkStreamId, fcPublishResponse())
+
+	case *CreateStreamCommand:
+		return h.sendDefaultResponse(responseChunkStreamId, msg.TxId, []interface{}{float64(mediaMessageStreamId)})
+
+	case *PublishCommand:
+		return h.handlePublish(msg)
+
+	case *SetDataFrameMessage:
+		return h.handleSetDataFrame(rawMsg, msg)
+
+	case *PlayCommand:
+		return h.handlePlay(msg.StreamKey, false)
+
+	case *Play2Command:
+		return h.handlePlay(msg.StreamKey, true)
+
+	case *VideoMessage, *AudioMessage:
+		return h.handleMedia(rawMsg)
+
+	case *AnonymousMessage:
+		h.logger.Debug("Ignoring unsupported command", "name", msg.Name)
+	}
+
+	return nil
+}
+
+func (h *handler) handleConnect(connect *ConnectCommand) error {
+	if h.connInitialized {
+		return errors.New("connection already initialized")
+	}
+
 	winAckMsg := &WindowAcknowledgementSizeMessage{
 		Size: WindowAcknowledgementSize,
 	}
 
-	const defaultChunkStreamId = 2
-	if err := h.serializeAndSendMessage(defaultChunkStreamId, winAckMsg); err != nil {
+	if err := h.serializeAndSendMessage(controlChunkStreamId, winAckMsg); err != nil {
 		return err
 	}
 
+	h.ackWindowSent = WindowAcknowledgementSize
+
 	setPeerBandMsg := &SetPeerBandwidthMessage{
-		Size: PeerBandwidthSize,
+		Size:      PeerBandwidthSize,
+		LimitType: PeerBandwidthLimitDynamic,
 	}
 
-	if err := h.serializeAndSendMessage(defaultChunkStreamId, setPeerBandMsg); err != nil {
+	if err := h.serializeAndSendMessage(controlChunkStreamId, setPeerBandMsg); err != nil {
 		return err
 	}
 
-	userControlMsg := &UserControlMessage{
-		EventType: 0,
-		Data:      []byte{0x0, 0x0, 0x0, 0x0},
-	}
-
-	if err := h.serializeAndSendMessage(defaultChunkStreamId, userControlMsg); err != nil {
+	if err := h.serializeAndSendMessage(controlChunkStreamId, NewStreamBeginMessage(0)); err != nil {
 		return err
 	}
 
 	setChunkSizeMsg := &SetChunkSizeMessage{
-		ChunkSize: setChunkSize.(*SetChunkSizeMessage).ChunkSize,
+		ChunkSize: ServerChunkSize,
 	}
 
-	if err := h.serializeAndSendMessage(defaultChunkStreamId, setChunkSizeMsg); err != nil {
+	if err := h.serializeAndSendMessage(controlChunkStreamId, setChunkSizeMsg); err != nil {
 		return err
 	}
 
-	const responseChunkStreamId = 3
+	h.messageWriter.SetChunkSize(ServerChunkSize)
 
-	if err := h.serializeAndSendMessage(responseChunkStreamId, connectSuccessResponse(h.currentTxId)); err != nil {
+	if err := h.serializeAndSendMessage(responseChunkStreamId, connectSuccessResponse(connect.TxId, connect.ObjectEncoding, negotiateFourCcs(connect.FourCcList))); err != nil {
 		return err
-	} else {
-		h.currentTxId += 1
 	}
 
 	if err := h.serializeAndSendMessage(responseChunkStreamId, onBwDoneResponse()); err != nil {
 		return err
 	}
 
-	releaseStream, err := h.readAndParseMessage()
-	if err != nil {
-		return err
+	h.app = connect.App
+	h.connInitialized = true
+
+	// any further commands are sent in the encoding requested by the client
+	h.objectEncoding = connect.ObjectEncoding
+
+	return nil
+}
+
+// handleSetPeerBandwidth limits the amount of data sent without
+// being acknowledged by the peer.
+func (h *handler) handleSetPeerBandwidth(msg *SetPeerBandwidthMessage) error {
+	if !h.flow.setPeerBandwidth(msg.Size, msg.LimitType) {
+		return nil
 	}
 
-	if releaseStream, ok := releaseStream.(*ReleaseStreamCommand); ok {
-		if err := h.sendDefaultResponse(responseChunkStreamId, releaseStream.TxId, []interface{}{}); err != nil {
-			return err
-		}
-	} else {
-		return errors.New("expected a ReleaseStream command")
+	// the peer has to acknowledge often enough for the data to keep flowing
+	if msg.Size == h.ackWindowSent {
+		return nil
 	}
 
-	fcPublish, err := h.readAndParseMessage()
-	if err != nil {
-		return err
+	h.ackWindowSent = msg.Size
+
+	return h.serializeAndSendMessage(controlChunkStreamId, &WindowAcknowledgementSizeMessage{Size: msg.Size})
+}
+
+func (h *handler) handlePublish(publish *PublishCommand) error {
+	if h.stream != nil || h.playback != nil {
+		return errors.New("stream already in use")
 	}
-	if _, ok := fcPublish.(*FCPublishCommand); ok {
-		response := fcPublishResponse()
-		if err := h.serializeAndSendMessage(responseChunkStreamId, response); err != nil {
-			return err
-		}
-	} else {
-		return errors.New("expected FCPublish command")
+
+	if !h.callbacks.OnAuthorize(publish.StreamKey) {
+		return errors.New("unauthorized")
 	}
 
-	createStream, err := h.readAndParseMessage()
+	stream, err := h.registry.Publish(registry.Key{App: h.app, Name: publish.StreamKey})
 	if err != nil {
+		response := publishBadNameResponse(publish.StreamKey)
+		if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+			return err
+		}
+
 		return err
 	}
-	if createStream, ok := createStream.(*CreateStreamCommand); ok {
-		if err := h.sendDefaultResponse(responseChunkStreamId, createStream.TxId, []interface{}{float64(1.0)}); err != nil {
-			return err
+
+	h.stream = stream
+
+	go func() {
+		<-stream.Done()
+
+		if stream.TakenOver() {
+			h.logger.Info("Stream has been taken over by another publisher", "stream", stream.Key.String())
+			h.conn.Close()
 		}
-	} else {
-		return errors.New("expected a CreateStream command")
+	}()
+
+	response := publishSuccessResponse(publish.StreamKey)
+	if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (h *handler) handleAuthorization() error {
-	publish, err := h.readAndParseMessage()
-	if err != nil {
-		return err
+func (h *handler) handleSetDataFrame(rawMsg *Message, setDataFrame *SetDataFrameMessage) error {
+	if h.stream == nil {
+		return errors.New("unexpected SetDataFrame message")
 	}
 
-	if publish, ok := publish.(*PublishCommand); ok {
-		if h.callbacks.OnAuthorize(publish.StreamKey) {
-			const responseChunkStreamId = 3
-			response := publishSuccessResponse(publish.StreamKey)
-			if err := h.serializeAndSendMessage(responseChunkStreamId, response); err != nil {
-				return err
-			}
+	if !h.callbacks.OnSetDataFrame(*setDataFrame) {
+		return errors.New("setDataFrame has been rejected")
+	}
 
-			h.mediaChannel <- MediaStreamInfo{StreamKey: publish.StreamKey}
+	// players expect the metadata without the @setDataFrame prefix
+	prefix, _ := amf.NewAMF0Encoder().Encode("@setDataFrame")
+	if rawMsg.Header.Type == Amf3DataType {
+		// format selector preceding the values
+		prefix = append([]byte{0x00}, prefix...)
+	}
 
-			return nil
-		} else {
-			return errors.New("unauthorized")
-		}
-	} else {
-		return errors.New("expected a Publish command")
+	h.stream.SetMetadata(&registry.Packet{
+		Type:      registry.MetadataPacket,
+		Timestamp: rawMsg.Header.Timestamp,
+		Data:      rawMsg.Payload[len(prefix):],
+	})
+
+	return nil
+}
+
+func (h *handler) handleMedia(rawMsg *Message) error {
+	if h.stream == nil {
+		return errors.New("unexpected media message")
 	}
+
+	packetType := registry.AudioPacket
+	if rawMsg.Header.Type == VideoType {
+		packetType = registry.VideoPacket
+	}
+
+	h.stream.WritePacket(&registry.Packet{
+		Type:      packetType,
+		Timestamp: rawMsg.Header.Timestamp,
+		Data:      rawMsg.Payload,
+	})
+
+	return nil
 }
 
-func (h *handler) handleSetDataFrame() error {
-	setDataFrame, err := h.readAndParseMessage()
+func (h *handler) handlePlay(streamKey string, transition bool) error {
+	if h.stream != nil {
+		return errors.New("stream already in use")
+	}
+
+	if !h.callbacks.OnPlay(streamKey) {
+		return errors.New("unauthorized")
+	}
+
+	switching := h.playback != nil
+	if switching {
+		h.playback.subscription.Close()
+		h.playback = nil
+	}
+
+	key := registry.Key{App: h.app, Name: streamKey}
+	subscription, err := h.registry.Subscribe(key, registry.SubscribeOptions{Policy: registry.DropUntilKeyframe})
+	if errors.Is(err, registry.ErrStreamNotPublished) && h.callbacks.OnStreamMissing != nil && h.callbacks.OnStreamMissing(h.app, streamKey) {
+		subscription, err = h.registry.Subscribe(key, registry.SubscribeOptions{Policy: registry.DropUntilKeyframe})
+	}
+
 	if err != nil {
+		response := playStreamNotFoundResponse(streamKey)
+		if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+			return err
+		}
+
 		return err
 	}
 
-	if setDataFrame, ok := setDataFrame.(*SetDataFrameMessage); ok {
-		if h.callbacks.OnSetDataFrame(*setDataFrame) {
-			return nil
-		} else {
-			return errors.New("setDataFrame has been rejected")
+	playback := newPlayback(streamKey, subscription)
+
+	if !switching {
+		if err := h.serializeAndSendMessage(controlChunkStreamId, NewStreamBeginMessage(mediaMessageStreamId)); err != nil {
+			return err
 		}
+	}
+
+	var responses []MessageSerializer
+	if transition && switching {
+		responses = []MessageSerializer{playTransitionResponse(streamKey)}
 	} else {
-		return errors.New("expected a SetDataFrame message")
+		responses = []MessageSerializer{playResetResponse(streamKey), playStartResponse(streamKey), sampleAccessMessage()}
 	}
-}
 
-func (h *handler) readAndParseMessage() (interface{}, error) {
-	rawMsg, err := h.messageReader.ReadMessage(h.reader)
-	if err != nil {
-		return nil, err
+	for _, response := range responses {
+		if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+			return err
+		}
 	}
 
-	return ParseMessage(rawMsg)
+	h.playback = playback
+
+	go h.runPlayback(playback)
+
+	return nil
 }
 
-func (h *handler) handleMessage() error {
-	rawMsg, err := h.messageReader.ReadMessage(h.reader)
-	if err != nil {
-		return err
+// runPlayback writes packets of the played stream until
+// the publisher goes away or the connection breaks.
+func (h *handler) runPlayback(playback *playback) {
+	defer close(playback.done)
+
+	for packet := range playback.subscription.Packets() {
+		if err := h.sendPlaybackPacket(playback, packet); err != nil {
+			h.logger.Info(fmt.Sprintf("Failed to send playback message: %s", err.Error()))
+			h.conn.Close()
+			return
+		}
 	}
 
-	msg, err := ParseMessage(rawMsg)
-	if err != nil {
-		return err
+	switch playback.subscription.Reason() {
+	case registry.ReasonOverflow:
+		h.logger.Info("Player is too slow, disconnecting", "streamKey", playback.streamKey)
+		h.conn.Close()
+		return
+
+	case registry.ReasonUnsubscribed:
+		// subscription has been replaced by play2 or the connection is closing
+		return
 	}
 
-	switch msg.(type) {
-	case *VideoMessage:
-		data := h.mediaStreamWrapper.WrapMessage(rawMsg)
-		h.mediaChannel <- MediaStreamData{Data: data}
-	case *AudioMessage:
-		data := h.mediaStreamWrapper.WrapMessage(rawMsg)
-		h.mediaChannel <- MediaStreamData{Data: data}
+	h.logger.Info("Played stream has been unpublished", "streamKey", playback.streamKey)
+
+	if err := h.serializeAndSendMessage(controlChunkStreamId, NewStreamEOFMessage(mediaMessageStreamId)); err != nil {
+		h.conn.Close()
+		return
 	}
 
-	return nil
+	response := playUnpublishNotifyResponse(playback.streamKey)
+	if err := h.serializeAndSendStreamMessage(responseChunkStreamId, mediaMessageStreamId, response); err != nil {
+		h.conn.Close()
+		return
+	}
+
+	h.conn.Close()
 }
 
-func (h *handler) serializeAndSendMessage(chunkStreamId uint8, msg MessageSerializer) error {
+func (h *handler) sendPlaybackPacket(playback *playback, packet *registry.Packet) error {
+	var chunkStreamId uint32
+	var msgType uint8
+	switch packet.Type {
+	case registry.AudioPacket:
+		chunkStreamId = audioChunkStreamId
+		msgType = AudioType
+	case registry.VideoPacket:
+		chunkStreamId = videoChunkStreamId
+		msgType = VideoType
+	default:
+		chunkStreamId = dataChunkStreamId
+		msgType = AmfDataType
+	}
+
+	if err := h.flow.waitForWindow(writeTimeout); err != nil {
+		return err
+	}
+
+	return h.sendMessage(&Message{
+		Header: &Header{
+			Type:          msgType,
+			ChunkStreamId: chunkStreamId,
+			Timestamp:     playback.timestamp(packet.Timestamp),
+			BodySize:      uint32(len(packet.Data)),
+			StreamId:      mediaMessageStreamId,
+		},
+		Payload: packet.Data,
+	})
+}
+
+func (h *handler) serializeAndSendMessage(chunkStreamId uint32, msg MessageSerializer) error {
+	return h.serializeAndSendStreamMessage(chunkStreamId, 0, msg)
+}
+
+func (h *handler) serializeAndSendStreamMessage(chunkStreamId uint32, streamId uint32, msg MessageSerializer) error {
 	msgType := msg.Type()
-	msgPayload := msg.Serialize()
 
-	payload, err := h.messageWriter.Write(&Message{
+	var msgPayload []byte
+	if amf3Msg, ok := msg.(amf3Serializer); ok && msgType == AmfCommandType && h.objectEncoding == ObjectEncodingAMF3 {
+		msgType = Amf3CommandType
+		msgPayload = amf3Msg.SerializeAMF3()
+	} else {
+		msgPayload = msg.Serialize()
+	}
+
+	return h.sendMessage(&Message{
 		Header: &Header{
 			Type:          msgType,
 			ChunkStreamId: chunkStreamId,
 			Timestamp:     0,
 			BodySize:      uint32(len(msgPayload)),
-			StreamId:      0,
+			StreamId:      streamId,
 		},
 		Payload: msgPayload,
 	})
+}
+
+// sendMessage is safe to be called both from the reading loop and the playback goroutine.
+func (h *handler) sendMessage(message *Message) error {
+	h.writeMu.Lock()
+	defer h.writeMu.Unlock()
+
+	payload, err := h.messageWriter.Write(message)
 	if err != nil {
 		return err
 	}
 
+	h.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+
 	if _, err := h.writer.Write(payload); err != nil {
 		return err
 	}
@@ -374,7 +636,7 @@ func (h *handler) serializeAndSendMessage(chunkStreamId uint8, msg MessageSerial
 	return nil
 }
 
-func (h *handler) sendDefaultResponse(chunkStreamId uint8, txId float64, properties []interface{}) error {
+func (h *handler) sendDefaultResponse(chunkStreamId uint32, txId float64, properties []interface{}) error {
 	response := &AnonymousMessage{
 		Name:       "_result",
 		TxId:       &txId,
@@ -384,21 +646,34 @@ func (h *handler) sendDefaultResponse(chunkStreamId uint8, txId float64, propert
 	return h.serializeAndSendMessage(chunkStreamId, response)
 }
 
-func connectSuccessResponse(txId uint32) *AnonymousMessage {
-	id := float64(txId)
+// connectSuccessResponse accepts the connection, the negotiated FourCCs
+// of enhanced RTMP are listed only when there are any.
+func connectSuccessResponse(txId float64, objectEncoding float64, fourCcs []string) *AnonymousMessage {
+	properties := amf.OrderedObject{
+		{Key: "fmsVer", Value: "FMS/3,0,1,123"},
+		{Key: "capabilities", Value: float64(31.0)},
+	}
+
+	if len(fourCcs) > 0 {
+		list := make([]interface{}, 0, len(fourCcs))
+		for _, fourCc := range fourCcs {
+			list = append(list, fourCc)
+		}
+
+		properties = append(properties, &amf.KeyValuePair{Key: "fourCcList", Value: list})
+	}
+
+	id := txId
 	return &AnonymousMessage{
 		Name: "_result",
 		TxId: &id,
 		Properties: []interface{}{
-			map[string]interface{}{
-				"fsmVer":       "FMS/3,0,1,123",
-				"capabilities": float64(31.0),
-			},
-			map[string]interface{}{
-				"level":          "status",
-				"code":           "NetConnection.Connect.Success",
-				"descritpion":    "Connection succeeded.",
-				"objectEncoding": float64(0.0),
+			properties,
+			amf.OrderedObject{
+				{Key: "level", Value: "status"},
+				{Key: "code", Value: "NetConnection.Connect.Success"},
+				{Key: "description", Value: "Connection succeeded."},
+				{Key: "objectEncoding", Value: objectEncoding},
 			},
 		},
 	}
@@ -411,16 +686,74 @@ func publishSuccessResponse(streamKey string) *AnonymousMessage {
 		TxId: &id,
 		Properties: []interface{}{
 			nil,
-			map[string]interface{}{
-				"level":       "status",
-				"code":        "NetStream.Publish.Start",
-				"descritpion": fmt.Sprintf("%s is published", streamKey),
-				"details":     streamKey,
+			amf.OrderedObject{
+				{Key: "level", Value: "status"},
+				{Key: "code", Value: "NetStream.Publish.Start"},
+				{Key: "description", Value: fmt.Sprintf("%s is published", streamKey)},
+				{Key: "details", Value: streamKey},
 			},
 		},
 	}
 }
 
+func publishBadNameResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("error", "NetStream.Publish.BadName", fmt.Sprintf("%s is already published", streamKey), streamKey)
+}
+
+func playResetResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Play.Reset", fmt.Sprintf("Playing and resetting %s", streamKey), streamKey)
+}
+
+func playStartResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Play.Start", fmt.Sprintf("Started playing %s", streamKey), streamKey)
+}
+
+func playTransitionResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Play.Transition", fmt.Sprintf("Transitioned to %s", streamKey), streamKey)
+}
+
+func playStreamNotFoundResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("error", "NetStream.Play.StreamNotFound", fmt.Sprintf("%s is not published", streamKey), streamKey)
+}
+
+func playUnpublishNotifyResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Play.UnpublishNotify", fmt.Sprintf("%s is now unpublished", streamKey), streamKey)
+}
+
+func playStopResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Play.Stop", fmt.Sprintf("Stopped playing %s", streamKey), streamKey)
+}
+
+func unpublishSuccessResponse(streamKey string) *AnonymousMessage {
+	return streamStatusResponse("status", "NetStream.Unpublish.Success", fmt.Sprintf("%s is now unpublished", streamKey), streamKey)
+}
+
+func streamStatusResponse(level string, code string, description string, streamKey string) *AnonymousMessage {
+	id := float64(0.0)
+	return &AnonymousMessage{
+		Name: "onStatus",
+		TxId: &id,
+		Properties: []interface{}{
+			nil,
+			amf.OrderedObject{
+				{Key: "level", Value: level},
+				{Key: "code", Value: code},
+				{Key: "description", Value: description},
+				{Key: "details", Value: streamKey},
+			},
+		},
+	}
+}
+
+func sampleAccessMessage() *AnonymousDataMessage {
+	return &AnonymousDataMessage{
+		AnonymousMessage{
+			Name:       "|RtmpSampleAccess",
+			Properties: []interface{}{true, true},
+		},
+	}
+}
+
 func onBwDoneResponse() *AnonymousMessage {
 	id := float64(0.0)
 	return &AnonymousMessage{
@@ -0,0 +1,94 @@
+package rtmp
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConnectSuccessResponseBytes(t *testing.T) {
+	expected := []byte{
+		// "_result"
+		0x02, 0x00, 0x07, 0x5f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74,
+		// transaction id: 1
+		0x00, 0x3f, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// object
+		0x03,
+		// fmsVer: "FMS/3,0,1,123"
+		0x00, 0x06, 0x66, 0x6d, 0x73, 0x56, 0x65, 0x72, 0x02, 0x00, 0x0d, 0x46, 0x4d, 0x53, 0x2f, 0x33,
+		0x2c, 0x30, 0x2c, 0x31, 0x2c, 0x31, 0x32, 0x33,
+		// capabilities: 31
+		0x00, 0x0c, 0x63, 0x61, 0x70, 0x61, 0x62, 0x69, 0x6c, 0x69, 0x74, 0x69, 0x65, 0x73, 0x00, 0x40,
+		0x3f, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// object end
+		0x00, 0x00, 0x09,
+		// object
+		0x03,
+		// level: "status"
+		0x00, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x02, 0x00, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+		// code: "NetConnection.Connect.Success"
+		0x00, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x02, 0x00, 0x1d, 0x4e, 0x65, 0x74, 0x43, 0x6f, 0x6e, 0x6e,
+		0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x2e, 0x53,
+		0x75, 0x63, 0x63, 0x65, 0x73, 0x73,
+		// description: "Connection succeeded."
+		0x00, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x02, 0x00, 0x15,
+		0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x20, 0x73, 0x75, 0x63, 0x63, 0x65,
+		0x65, 0x64, 0x65, 0x64, 0x2e,
+		// objectEncoding: 0
+		0x00, 0x0e, 0x6f, 0x62, 0x6a, 0x65, 0x63, 0x74, 0x45, 0x6e, 0x63, 0x6f, 0x64, 0x69, 0x6e, 0x67,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// object end
+		0x00, 0x00, 0x09,
+	}
+
+	assert.Equal(t, expected, connectSuccessResponse(1, ObjectEncodingAMF0, nil).Serialize())
+}
+
+func TestConnectSuccessResponseFourCcList(t *testing.T) {
+	expected := []byte{
+		// fourCcList: ["hvc1", "av01"]
+		0x00, 0x0a, 0x66, 0x6f, 0x75, 0x72, 0x43, 0x63, 0x4c, 0x69, 0x73, 0x74, 0x0a, 0x00, 0x00, 0x00,
+		0x02, 0x02, 0x00, 0x04, 0x68, 0x76, 0x63, 0x31, 0x02, 0x00, 0x04, 0x61, 0x76, 0x30, 0x31,
+		// object end
+		0x00, 0x00, 0x09,
+	}
+
+	serialized := connectSuccessResponse(1, ObjectEncodingAMF0, []string{"hvc1", "av01"}).Serialize()
+	// the list ends the object holding fmsVer and capabilities
+	assert.True(t, bytes.Contains(serialized, expected))
+}
+
+func TestNegotiateFourCcs(t *testing.T) {
+	assert.Equal(t, []string{"hvc1", "av01"}, negotiateFourCcs([]string{"av01", "hvc1", "vvc1"}))
+	assert.Equal(t, []string{"hvc1", "av01", "vp09"}, negotiateFourCcs([]string{fourCcWildcard}))
+	assert.Nil(t, negotiateFourCcs(nil))
+	assert.Nil(t, negotiateFourCcs([]string{"vvc1"}))
+}
+
+func TestPublishSuccessResponseBytes(t *testing.T) {
+	expected := []byte{
+		// "onStatus"
+		0x02, 0x00, 0x08, 0x6f, 0x6e, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73,
+		// transaction id: 0
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		// null
+		0x05,
+		// object
+		0x03,
+		// level: "status"
+		0x00, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x02, 0x00, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+		// code: "NetStream.Publish.Start"
+		0x00, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x02, 0x00, 0x17, 0x4e, 0x65, 0x74, 0x53, 0x74, 0x72, 0x65,
+		0x61, 0x6d, 0x2e, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x2e, 0x53, 0x74, 0x61, 0x72, 0x74,
+		// description: "key is published"
+		0x00, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x02, 0x00, 0x10,
+		0x6b, 0x65, 0x79, 0x20, 0x69, 0x73, 0x20, 0x70, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x65, 0x64,
+		// details: "key"
+		0x00, 0x07, 0x64, 0x65, 0x74, 0x61, 0x69, 0x6c, 0x73, 0x02, 0x00, 0x03, 0x6b, 0x65, 0x79,
+		// object end
+		0x00, 0x00, 0x09,
+	}
+
+	assert.Equal(t, expected, publishSuccessResponse("key").Serialize())
+}
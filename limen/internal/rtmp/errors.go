@@ -8,4 +8,5 @@ var (
 	ErrOtherHeaderTypeExpected = errors.New("ErrOtherHeaderTypeExpected")
 	ErrInvalidMessageFormat    = errors.New("invalid message format")
 	ErrInvalidHandshake        = errors.New("invalid handshake")
+	ErrAcknowledgementTimeout  = errors.New("peer did not acknowledge sent data in time")
 )
@@ -0,0 +1,179 @@
+package rtmp
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// flowControl implements the acknowledgement based flow control of RTMP.
+//
+// It counts bytes received from the peer, so that an Acknowledgement can be sent
+// each time the peer's acknowledgement window fills up, and bytes sent to the peer,
+// so that no more than the peer's bandwidth worth of unacknowledged data is in flight.
+//
+// Sequence numbers are 32 bit and are expected to wrap around.
+type flowControl struct {
+	mu sync.Mutex
+
+	received  uint32
+	lastAck   uint32
+	ackWindow uint32
+
+	sent          uint32
+	peerAck       uint32
+	peerBandwidth uint32
+	// limit type of the currently enforced peer bandwidth,
+	// needed to interpret the dynamic limit type
+	limitType uint8
+	limited   bool
+
+	// signals that the peer acknowledged some data
+	acked  chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newFlowControl(ackWindow uint32) *flowControl {
+	return &flowControl{
+		ackWindow: ackWindow,
+		acked:     make(chan struct{}, 1),
+		closed:    make(chan struct{}),
+	}
+}
+
+func (f *flowControl) addReceived(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.received += uint32(n)
+}
+
+// pendingAcknowledgement returns the sequence number to be acknowledged
+// if the acknowledgement window has been filled since the last acknowledgement.
+func (f *flowControl) pendingAcknowledgement() (uint32, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.ackWindow == 0 || f.received-f.lastAck < f.ackWindow {
+		return 0, false
+	}
+
+	f.lastAck = f.received
+
+	return f.received, true
+}
+
+func (f *flowControl) setAckWindow(size uint32) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.ackWindow = size
+}
+
+func (f *flowControl) addSent(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent += uint32(n)
+}
+
+func (f *flowControl) acknowledged(sequenceNumber uint32) {
+	f.mu.Lock()
+	f.peerAck = sequenceNumber
+	f.mu.Unlock()
+
+	select {
+	case f.acked <- struct{}{}:
+	default:
+	}
+}
+
+// setPeerBandwidth applies the limit requested by the peer,
+// returns true if the enforced bandwidth has changed.
+func (f *flowControl) setPeerBandwidth(size uint32, limitType uint8) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	previous := f.peerBandwidth
+
+	switch limitType {
+	case PeerBandwidthLimitHard:
+		f.peerBandwidth = size
+		f.limitType = PeerBandwidthLimitHard
+
+	case PeerBandwidthLimitSoft:
+		if !f.limited || size < f.peerBandwidth {
+			f.peerBandwidth = size
+			f.limitType = PeerBandwidthLimitSoft
+		}
+
+	case PeerBandwidthLimitDynamic:
+		// treated as hard when the previous limit was hard, ignored otherwise
+		if !f.limited || f.limitType != PeerBandwidthLimitHard {
+			return false
+		}
+
+		f.peerBandwidth = size
+	}
+
+	f.limited = true
+
+	return previous != f.peerBandwidth
+}
+
+func (f *flowControl) canSend() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return !f.limited || f.sent-f.peerAck < f.peerBandwidth
+}
+
+// waitForWindow blocks until the unacknowledged data fits in the peer's bandwidth.
+func (f *flowControl) waitForWindow(timeout time.Duration) error {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for !f.canSend() {
+		select {
+		case <-f.acked:
+		case <-f.closed:
+			return io.ErrClosedPipe
+		case <-timer.C:
+			return ErrAcknowledgementTimeout
+		}
+	}
+
+	return nil
+}
+
+// close wakes up all writers waiting for an acknowledgement.
+func (f *flowControl) close() {
+	f.once.Do(func() {
+		close(f.closed)
+	})
+}
+
+type countingReader struct {
+	reader io.Reader
+	flow   *flowControl
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.flow.addReceived(n)
+
+	return n, err
+}
+
+type countingWriter struct {
+	writer io.Writer
+	flow   *flowControl
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.flow.addSent(n)
+
+	return n, err
+}
@@ -0,0 +1,91 @@
+package rtmp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowControlAcknowledgementWindow(t *testing.T) {
+	flow := newFlowControl(100)
+
+	flow.addReceived(99)
+	_, ok := flow.pendingAcknowledgement()
+	assert.False(t, ok)
+
+	flow.addReceived(1)
+	sequenceNumber, ok := flow.pendingAcknowledgement()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(100), sequenceNumber)
+
+	_, ok = flow.pendingAcknowledgement()
+	assert.False(t, ok)
+
+	flow.setAckWindow(10)
+	flow.addReceived(15)
+	sequenceNumber, ok = flow.pendingAcknowledgement()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(115), sequenceNumber)
+}
+
+func TestFlowControlSequenceNumberWrapsAround(t *testing.T) {
+	flow := newFlowControl(100)
+	flow.received = 0xFFFFFFF0
+	flow.lastAck = 0xFFFFFFF0
+
+	flow.addReceived(100)
+	sequenceNumber, ok := flow.pendingAcknowledgement()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(84), sequenceNumber)
+}
+
+func TestFlowControlPeerBandwidthLimitTypes(t *testing.T) {
+	flow := newFlowControl(0)
+
+	// dynamic is ignored unless the previous limit was hard
+	assert.False(t, flow.setPeerBandwidth(100, PeerBandwidthLimitDynamic))
+	assert.True(t, flow.canSend())
+
+	assert.True(t, flow.setPeerBandwidth(100, PeerBandwidthLimitSoft))
+	// soft limit never raises the current one
+	assert.False(t, flow.setPeerBandwidth(200, PeerBandwidthLimitSoft))
+	assert.Equal(t, uint32(100), flow.peerBandwidth)
+
+	assert.True(t, flow.setPeerBandwidth(300, PeerBandwidthLimitHard))
+	assert.True(t, flow.setPeerBandwidth(50, PeerBandwidthLimitDynamic))
+	assert.Equal(t, uint32(50), flow.peerBandwidth)
+}
+
+func TestFlowControlWaitsForAcknowledgement(t *testing.T) {
+	flow := newFlowControl(0)
+	flow.setPeerBandwidth(100, PeerBandwidthLimitHard)
+
+	flow.addSent(100)
+	assert.False(t, flow.canSend())
+	assert.Equal(t, ErrAcknowledgementTimeout, flow.waitForWindow(10*time.Millisecond))
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		flow.acknowledged(100)
+	}()
+
+	assert.Nil(t, flow.waitForWindow(time.Second))
+}
+
+func TestSetPeerBandwidthDeserialize(t *testing.T) {
+	data := []byte{
+		// window size
+		0x00, 0x26, 0x25, 0xa0,
+		// limit type
+		0x01,
+	}
+
+	msg := &SetPeerBandwidthMessage{}
+	assert.Nil(t, msg.Deserialize(data))
+	assert.Equal(t, uint32(2_500_000), msg.Size)
+	assert.Equal(t, PeerBandwidthLimitSoft, msg.LimitType)
+	assert.Equal(t, data, msg.Serialize())
+
+	assert.Equal(t, ErrInvalidMessageFormat, msg.Deserialize([]byte{0x00, 0x26, 0x25, 0xa0, 0x03}))
+}
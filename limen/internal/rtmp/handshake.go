@@ -59,3 +59,47 @@ func (h *handshake) ReceiveC2(buffer *bufio.Reader) error {
 func (h *handshake) GetS2() []byte {
 	return h.c1
 }
+
+func (h *handshake) GenerateC0C1() []byte {
+	buf := make([]byte, 1537)
+	buf[0] = 0x03
+	_, _ = rand.Read(buf[1:])
+
+	h.c1 = buf[1:]
+
+	return buf
+}
+
+func (h *handshake) ReceiveS0S1(buffer *bufio.Reader) error {
+	var payload [1537]byte
+
+	if _, err := io.ReadFull(buffer, payload[:]); err != nil {
+		return io.EOF
+	}
+
+	if payload[0] != 0x03 {
+		return ErrInvalidHandshake
+	}
+
+	h.s1 = payload[1:]
+
+	return nil
+}
+
+func (h *handshake) GetC2() []byte {
+	return h.s1
+}
+
+func (h *handshake) ReceiveS2(buffer *bufio.Reader) error {
+	var s2 [1536]byte
+
+	if _, err := io.ReadFull(buffer, s2[:]); err != nil {
+		return io.EOF
+	}
+
+	if !bytes.Equal(s2[:], h.c1) {
+		return ErrInvalidHandshake
+	}
+
+	return nil
+}
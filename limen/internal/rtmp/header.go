@@ -1,7 +1,7 @@
 package rtmp
 
 type Header struct {
-	ChunkStreamId     uint8
+	ChunkStreamId     uint32
 	Timestamp         uint32
 	TimestampDelta    uint32
 	BodySize          uint32
@@ -75,9 +75,8 @@ func (w *mediaFlvWrapper) insertBody(writer *bufio.Writer, message *Message) {
 		byte(header.Timestamp),
 		// extended timestamp
 		byte(header.Timestamp>>24) & 0xff,
-		byte(header.StreamId>>16) & 0xff,
-		byte(header.StreamId>>8) & 0xff,
-		byte(header.StreamId) & 0xff,
+		// stream id, always 0
+		0x0, 0x0, 0x0,
 	}
 
 	if _, err := writer.Write(metadata); err != nil {
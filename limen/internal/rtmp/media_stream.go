@@ -1,9 +1,18 @@
 package rtmp
 
+import "limen/internal/registry"
+
+// MediaStreamData is a single audio, video or metadata message of a stream.
+//
+// Data holds the FLV tag body, metadata is the AMF encoded onMetaData without
+// the @setDataFrame prefix, the same way the registry stores the stream's packets.
 type MediaStreamData struct {
-	Data []byte
+	Type      registry.PacketType
+	Timestamp uint32
+	Data      []byte
 }
 
 type MediaStreamInfo struct {
+	App       string
 	StreamKey string
 }
@@ -2,15 +2,23 @@ package rtmp
 
 const (
 	SetChunkSizeType     = 0x1
+	AcknowledgementType  = 0x3
 	UserControlType      = 0x4
 	WindowAckSizeType    = 0x5
 	SetPeerBandwidthType = 0x6
 	AudioType            = 0x8
 	VideoType            = 0x9
+	Amf3DataType         = 0xF
+	Amf3CommandType      = 0x11
 	AmfDataType          = 0x12
 	AmfCommandType       = 0x14
 )
 
+const (
+	ObjectEncodingAMF0 = 0
+	ObjectEncodingAMF3 = 3
+)
+
 type Message struct {
 	Header  *Header
 	Payload []byte
@@ -20,3 +28,9 @@ type MessageSerializer interface {
 	Serialize() []byte
 	Type() uint8
 }
+
+// amf3Serializer is implemented by commands which can be sent
+// to clients that negotiated the AMF3 object encoding.
+type amf3Serializer interface {
+	SerializeAMF3() []byte
+}
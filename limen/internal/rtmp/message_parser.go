@@ -18,6 +18,15 @@ func ParseMessage(message *Message) (interface{}, error) {
 
 		return msg, nil
 
+	case AcknowledgementType:
+		msg := &AcknowledgementMessage{}
+
+		if err := msg.Deserialize(message.Payload); err != nil {
+			return nil, err
+		}
+
+		return msg, nil
+
 	case UserControlType:
 		msg := &UserControlMessage{}
 
@@ -66,11 +75,18 @@ func ParseMessage(message *Message) (interface{}, error) {
 	case AmfDataType, AmfCommandType:
 		return parseAmfMessage(message.Payload)
 
+	case Amf3DataType, Amf3CommandType:
+		// AMF0 encoded values preceded by a format selector, objects
+		// are usually switched to AMF3 with the AVM+ marker
+		if len(message.Payload) < 1 || message.Payload[0] != 0x00 {
+			return nil, ErrInvalidMessageFormat
+		}
+
+		return parseAmfMessage(message.Payload[1:])
+
 	default:
 		return nil, ErrInvalidHeaderType
 	}
-
-	return nil, ErrInvalidHeaderType
 }
 
 func parseAmfMessage(payload []byte) (interface{}, error) {
@@ -124,6 +140,22 @@ func parseAmfMessage(payload []byte) (interface{}, error) {
 				}
 				return msg, nil
 
+			case "play":
+				msg := &PlayCommand{}
+
+				if err := msg.Deserialize(data); err != nil {
+					return nil, err
+				}
+				return msg, nil
+
+			case "play2":
+				msg := &Play2Command{}
+
+				if err := msg.Deserialize(data); err != nil {
+					return nil, err
+				}
+				return msg, nil
+
 			case "@setDataFrame":
 				msg := &SetDataFrameMessage{}
 
@@ -132,7 +164,14 @@ func parseAmfMessage(payload []byte) (interface{}, error) {
 				}
 				return msg, nil
 			default:
-				return nil, ErrInvalidMessageFormat
+				// commands we don't know about are passed as they are
+				// so that the handler can decide whether to ignore them
+				msg := &AnonymousMessage{}
+
+				if err := msg.Deserialize(data); err != nil {
+					return nil, err
+				}
+				return msg, nil
 			}
 		} else {
 			return nil, ErrInvalidMessageFormat
@@ -0,0 +1,101 @@
+package rtmp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"limen/internal/rtmp/amf"
+)
+
+func TestParseAmf3ConnectCommand(t *testing.T) {
+	encoder := amf.NewAMF0Encoder()
+
+	name, _ := encoder.Encode("connect")
+	txId, _ := encoder.Encode(float64(1))
+	object, _ := encoder.Encode(amf.AVMPlus{Value: map[string]interface{}{
+		"app":            "live",
+		"tcUrl":          "rtmp://localhost/live",
+		"objectEncoding": float64(ObjectEncodingAMF3),
+	}})
+
+	payload := []byte{
+		// format selector
+		0x00,
+	}
+	payload = append(payload, name...)
+	payload = append(payload, txId...)
+	payload = append(payload, object...)
+
+	msg, err := ParseMessage(&Message{Header: &Header{Type: Amf3CommandType}, Payload: payload})
+	assert.Nil(t, err)
+
+	connect, ok := msg.(*ConnectCommand)
+	assert.True(t, ok)
+	assert.Equal(t, "live", connect.App)
+	assert.Equal(t, "rtmp://localhost/live", connect.TcUrl)
+	assert.Equal(t, float64(ObjectEncodingAMF3), connect.ObjectEncoding)
+	assert.Equal(t, float64(1), connect.TxId)
+
+	_, err = ParseMessage(&Message{Header: &Header{Type: Amf3CommandType}, Payload: payload[1:]})
+	assert.Equal(t, ErrInvalidMessageFormat, err)
+}
+
+func TestParseSerializedAmf3Command(t *testing.T) {
+	txId := float64(4)
+	response := &AnonymousMessage{
+		Name: "_result",
+		TxId: &txId,
+		Properties: []interface{}{
+			nil,
+			map[string]interface{}{"code": "NetConnection.Connect.Success"},
+		},
+	}
+
+	msg, err := ParseMessage(&Message{Header: &Header{Type: Amf3CommandType}, Payload: response.SerializeAMF3()})
+	assert.Nil(t, err)
+	assert.Equal(t, response, msg)
+}
+
+func TestParseSerializedCommands(t *testing.T) {
+	commands := []interface{ Serialize() []byte }{
+		&ConnectCommand{App: "live", FlashVer: "FMLE/3.0", TcUrl: "rtmp://localhost/live", TxId: 1},
+		&ConnectCommand{App: "live", FlashVer: "FMLE/3.0", TcUrl: "rtmp://localhost/live", FourCcList: []string{"hvc1", "av01"}, TxId: 8},
+		&ReleaseStreamCommand{StreamKey: "key", TxId: 2},
+		&FCPublishCommand{StreamKey: "key", TxId: 3},
+		&CreateStreamCommand{TxId: 4},
+		&PublishCommand{StreamKey: "key", PublishType: "live", TxId: 5},
+		&PlayCommand{StreamKey: "key", Start: PlayStartLive, Duration: PlayDurationUntilEnd, Reset: true, TxId: 6},
+		&Play2Command{StreamKey: "key", Start: 0, Len: PlayDurationUntilEnd, TxId: 7},
+	}
+
+	for _, command := range commands {
+		msg, err := ParseMessage(&Message{Header: &Header{Type: AmfCommandType}, Payload: command.Serialize()})
+		assert.Nil(t, err)
+		assert.Equal(t, command, msg)
+	}
+}
+
+func TestParseSerializedSetDataFrame(t *testing.T) {
+	metadata := &SetDataFrameMessage{Encoder: "obs", Width: 1280, Height: 720, Framerate: 30, Stereo: true}
+
+	msg, err := ParseMessage(&Message{Header: &Header{Type: AmfDataType}, Payload: metadata.Serialize()})
+	assert.Nil(t, err)
+	assert.Equal(t, metadata, msg)
+}
+
+func TestParseCommandWithInvalidValue(t *testing.T) {
+	encoder := amf.NewAMF0Encoder()
+
+	var payload []byte
+	for _, value := range []interface{}{"publish", float64(5), nil, float64(1), "live"} {
+		encoded, _ := encoder.Encode(value)
+		payload = append(payload, encoded...)
+	}
+
+	_, err := ParseMessage(&Message{Header: &Header{Type: AmfCommandType}, Payload: payload})
+	assert.ErrorIs(t, err, ErrInvalidMessageFormat)
+
+	var typeErr *amf.UnmarshalTypeError
+	assert.ErrorAs(t, err, &typeErr)
+}
@@ -6,94 +6,164 @@ import (
 	"io"
 )
 
-const ExtendedTimestampMarker = 0xFFFFFF
+const (
+	ExtendedTimestampMarker = 0xFFFFFF
+	DefaultChunkSize        = 128
+)
+
+// chunkStream keeps the state of a single chunk stream.
+//
+// Chunks of messages belonging to different chunk streams can be interleaved,
+// therefore each chunk stream has to keep track of its own previous header
+// and of the partially assembled payload.
+type chunkStream struct {
+	// header of the last (or currently assembled) message
+	lastHeader *Header
+	// payload of a message that has not been fully received yet
+	payload []byte
+	// indicates that a message is being assembled
+	inProgress bool
+	// the last header was of type 0, which carries no delta
+	absoluteTimestamp bool
+}
 
 type messageReader struct {
-	// FIXME: this should be done on chunk basis instead of
-	// being a global state
-	lastHeader           *Header
-	partialHeader        *Header
-	readingHeader        bool
-	currentPayloadBuffer []byte
-	chunkSize            int32
+	chunkStreams map[uint32]*chunkStream
+	chunkSize    int32
 }
 
 func NewMessageReader() *messageReader {
-	return &messageReader{readingHeader: true, chunkSize: -1}
+	return &messageReader{chunkStreams: make(map[uint32]*chunkStream), chunkSize: DefaultChunkSize}
 }
 
+// ReadMessage reads chunks until any of the chunk streams completes a message.
 func (r *messageReader) ReadMessage(buffer *bufio.Reader) (*Message, error) {
-	// Read the header
-
-	if r.partialHeader != nil {
-		header, err := r.readPartialHeader(buffer)
+	for {
+		headerType, chunkStreamId, err := r.readBasicHeader(buffer)
 		if err != nil {
 			return nil, err
 		}
 
-		r.lastHeader = header
-		r.currentPayloadBuffer = make([]byte, chunkedBodySize(header, r.chunkSize))
-	} else if r.readingHeader {
-		header, err := r.readHeader(buffer)
-		if err != nil {
+		stream := r.chunkStream(chunkStreamId)
+
+		if stream.inProgress && headerType == 3 {
+			// continuation of a message, the extended timestamp is repeated in each chunk
+			if stream.lastHeader.ExtendedTimestamp {
+				if _, err := r.readExtendedTimestamp(buffer); err != nil {
+					return nil, err
+				}
+			}
+		} else {
+			// a new message header discards any partially read message
+			header, err := r.readMessageHeader(buffer, headerType, chunkStreamId, stream)
+			if err != nil {
+				return nil, err
+			}
+
+			stream.lastHeader = header
+			stream.absoluteTimestamp = headerType == 0
+			stream.payload = make([]byte, 0, header.BodySize)
+			stream.inProgress = true
+		}
+
+		if err := r.readChunkPayload(buffer, stream); err != nil {
 			return nil, err
 		}
 
-		r.lastHeader = header
-		r.currentPayloadBuffer = make([]byte, chunkedBodySize(header, r.chunkSize))
+		if uint32(len(stream.payload)) < stream.lastHeader.BodySize {
+			continue
+		}
+
+		payload := stream.payload
+		stream.payload = nil
+		stream.inProgress = false
+
+		return &Message{
+			Header:  stream.lastHeader,
+			Payload: payload,
+		}, nil
 	}
+}
 
-	r.readingHeader = false
+func (r *messageReader) SetChunkSize(size int32) {
+	r.chunkSize = size
+}
 
-	// Read the payload
-	_, err := io.ReadFull(buffer, r.currentPayloadBuffer)
-	if err != nil {
-		return nil, io.EOF
+func (r *messageReader) chunkStream(chunkStreamId uint32) *chunkStream {
+	stream, ok := r.chunkStreams[chunkStreamId]
+	if !ok {
+		stream = &chunkStream{}
+		r.chunkStreams[chunkStreamId] = stream
 	}
 
-	r.currentPayloadBuffer = unchunkPayload(r.lastHeader, r.currentPayloadBuffer, r.chunkSize)
+	return stream
+}
 
-	// Payload has been read, switch to reading header
-	r.readingHeader = true
+func (r *messageReader) readChunkPayload(buffer *bufio.Reader, stream *chunkStream) error {
+	left := int(stream.lastHeader.BodySize) - len(stream.payload)
 
-	payload := r.currentPayloadBuffer
-	r.currentPayloadBuffer = nil
+	size := left
+	if r.chunkSize > 0 && size > int(r.chunkSize) {
+		size = int(r.chunkSize)
+	}
 
-	// Return the message
-	return &Message{
-		Header:  r.lastHeader,
-		Payload: payload,
-	}, nil
-}
+	offset := len(stream.payload)
+	stream.payload = stream.payload[:offset+size]
 
-func (r *messageReader) SetChunkSize(size int32) {
-	r.chunkSize = size
+	if _, err := io.ReadFull(buffer, stream.payload[offset:]); err != nil {
+		return io.EOF
+	}
+
+	return nil
 }
 
-func (r *messageReader) readHeader(buffer *bufio.Reader) (*Header, error) {
-	first_byte, err := buffer.ReadByte()
+func (r *messageReader) readBasicHeader(buffer *bufio.Reader) (uint8, uint32, error) {
+	firstByte, err := buffer.ReadByte()
 	if err != nil {
-		return nil, io.EOF
+		return 0, 0, io.EOF
 	}
 
-	headerType := (first_byte & 0b11000000) >> 6
-	chunkStreamId := first_byte & 0b00111111
+	headerType := (firstByte & 0b11000000) >> 6
+	chunkStreamId := uint32(firstByte & 0b00111111)
+
+	switch chunkStreamId {
+	case 0:
+		// 2-byte form, chunk stream ids 64-319
+		secondByte, err := buffer.ReadByte()
+		if err != nil {
+			return 0, 0, io.EOF
+		}
+
+		chunkStreamId = uint32(secondByte) + 64
+	case 1:
+		// 3-byte form, chunk stream ids 64-65599
+		var buff [2]byte
+		if _, err := io.ReadFull(buffer, buff[:]); err != nil {
+			return 0, 0, io.EOF
+		}
+
+		chunkStreamId = uint32(buff[1])<<8 + uint32(buff[0]) + 64
+	}
+
+	return headerType, chunkStreamId, nil
+}
 
+func (r *messageReader) readMessageHeader(buffer *bufio.Reader, headerType uint8, chunkStreamId uint32, stream *chunkStream) (*Header, error) {
 	switch headerType {
 	case 0:
 		return r.readHeaderType0(buffer, chunkStreamId)
 	case 1:
-		return r.readHeaderType1(buffer, chunkStreamId)
+		return r.readHeaderType1(buffer, chunkStreamId, stream.lastHeader)
 	case 2:
-		return r.readHeaderType2(buffer, chunkStreamId)
+		return r.readHeaderType2(buffer, chunkStreamId, stream.lastHeader)
 	case 3:
-		return r.readHeaderType3(buffer, chunkStreamId)
+		return r.readHeaderType3(buffer, chunkStreamId, stream.lastHeader, stream.absoluteTimestamp)
 	default:
 		return nil, ErrInvalidHeaderType
 	}
 }
 
-func (r *messageReader) readHeaderType0(buffer *bufio.Reader, chunkStreamId byte) (*Header, error) {
+func (r *messageReader) readHeaderType0(buffer *bufio.Reader, chunkStreamId uint32) (*Header, error) {
 	var buff [11]byte
 	_, err := io.ReadFull(buffer, buff[:])
 	if err != nil {
@@ -105,13 +175,13 @@ func (r *messageReader) readHeaderType0(buffer *bufio.Reader, chunkStreamId byte
 		Timestamp:     binary.BigEndian.Uint32(buff[0:4]) >> 8,
 		BodySize:      binary.BigEndian.Uint32(buff[3:7]) >> 8,
 		Type:          buff[6],
-		StreamId:      binary.BigEndian.Uint32(buff[7:11]),
+		StreamId:      binary.LittleEndian.Uint32(buff[7:11]),
 	}
 
 	if header.Timestamp == ExtendedTimestampMarker {
 		header.ExtendedTimestamp = true
 
-		extendedTimestamp, err := r.readExtendedTimestamp(buffer, header)
+		extendedTimestamp, err := r.readExtendedTimestamp(buffer)
 		if err != nil {
 			return nil, err
 		}
@@ -122,8 +192,8 @@ func (r *messageReader) readHeaderType0(buffer *bufio.Reader, chunkStreamId byte
 	return header, nil
 }
 
-func (r *messageReader) readHeaderType1(buffer *bufio.Reader, chunkStreamId byte) (*Header, error) {
-	if r.lastHeader == nil {
+func (r *messageReader) readHeaderType1(buffer *bufio.Reader, chunkStreamId uint32, lastHeader *Header) (*Header, error) {
+	if lastHeader == nil {
 		return nil, ErrOtherHeaderTypeExpected
 	}
 
@@ -136,30 +206,30 @@ func (r *messageReader) readHeaderType1(buffer *bufio.Reader, chunkStreamId byte
 	timestampDelta := (binary.BigEndian.Uint32(buff[0:4]) >> 8)
 	header := &Header{
 		ChunkStreamId:  chunkStreamId,
-		Timestamp:      r.lastHeader.Timestamp + timestampDelta,
+		Timestamp:      lastHeader.Timestamp + timestampDelta,
 		TimestampDelta: timestampDelta,
 		BodySize:       binary.BigEndian.Uint32(buff[3:7]) >> 8,
 		Type:           buff[6],
-		StreamId:       r.lastHeader.StreamId,
+		StreamId:       lastHeader.StreamId,
 	}
 
 	if timestampDelta == ExtendedTimestampMarker {
 		header.ExtendedTimestamp = true
 
-		timestampDelta, err := r.readExtendedTimestamp(buffer, header)
+		timestampDelta, err := r.readExtendedTimestamp(buffer)
 		if err != nil {
 			return nil, err
 		}
 
-		header.Timestamp = r.lastHeader.Timestamp + timestampDelta
+		header.Timestamp = lastHeader.Timestamp + timestampDelta
 		header.TimestampDelta = timestampDelta
 	}
 
 	return header, nil
 }
 
-func (r *messageReader) readHeaderType2(buffer *bufio.Reader, chunkStreamId byte) (*Header, error) {
-	if r.lastHeader == nil {
+func (r *messageReader) readHeaderType2(buffer *bufio.Reader, chunkStreamId uint32, lastHeader *Header) (*Header, error) {
+	if lastHeader == nil {
 		return nil, ErrOtherHeaderTypeExpected
 	}
 
@@ -172,131 +242,71 @@ func (r *messageReader) readHeaderType2(buffer *bufio.Reader, chunkStreamId byte
 	timestampDelta := (uint32(buff[0])<<16 | uint32(buff[1])<<8 | uint32(buff[2]))
 	header := &Header{
 		ChunkStreamId:  chunkStreamId,
-		Timestamp:      r.lastHeader.Timestamp + timestampDelta,
+		Timestamp:      lastHeader.Timestamp + timestampDelta,
 		TimestampDelta: timestampDelta,
-		BodySize:       r.lastHeader.BodySize,
-		Type:           r.lastHeader.Type,
-		StreamId:       r.lastHeader.StreamId,
+		BodySize:       lastHeader.BodySize,
+		Type:           lastHeader.Type,
+		StreamId:       lastHeader.StreamId,
 	}
 
 	if timestampDelta == ExtendedTimestampMarker {
 		header.ExtendedTimestamp = true
 
-		timestampDelta, err := r.readExtendedTimestamp(buffer, header)
+		timestampDelta, err := r.readExtendedTimestamp(buffer)
 		if err != nil {
 			return nil, err
 		}
 
-		header.Timestamp = r.lastHeader.Timestamp + timestampDelta
+		header.Timestamp = lastHeader.Timestamp + timestampDelta
 		header.TimestampDelta = timestampDelta
 	}
 
 	return header, nil
 }
 
-func (r *messageReader) readHeaderType3(buffer *bufio.Reader, chunkStreamId byte) (*Header, error) {
-	if r.lastHeader == nil {
+// readHeaderType3 reads the header of a new message sharing the header of the
+// previous one, its timestamp advances by the previous delta or, following a
+// type 0 header, by the absolute timestamp of that header.
+func (r *messageReader) readHeaderType3(buffer *bufio.Reader, chunkStreamId uint32, lastHeader *Header, absoluteTimestamp bool) (*Header, error) {
+	if lastHeader == nil {
 		return nil, ErrOtherHeaderTypeExpected
 	}
 
+	timestampDelta := lastHeader.TimestampDelta
+	if absoluteTimestamp {
+		timestampDelta = lastHeader.Timestamp
+	}
+
 	header := &Header{
-		ChunkStreamId:  chunkStreamId,
-		Timestamp:      r.lastHeader.Timestamp + r.lastHeader.TimestampDelta,
-		TimestampDelta: r.lastHeader.TimestampDelta,
-		BodySize:       r.lastHeader.BodySize,
-		Type:           r.lastHeader.Type,
-		StreamId:       r.lastHeader.StreamId,
+		ChunkStreamId:     chunkStreamId,
+		Timestamp:         lastHeader.Timestamp + timestampDelta,
+		TimestampDelta:    timestampDelta,
+		BodySize:          lastHeader.BodySize,
+		Type:              lastHeader.Type,
+		StreamId:          lastHeader.StreamId,
+		ExtendedTimestamp: lastHeader.ExtendedTimestamp,
 	}
 
-	if r.lastHeader.ExtendedTimestamp {
-		timestampDelta, err := r.readExtendedTimestamp(buffer, header)
+	if lastHeader.ExtendedTimestamp {
+		timestampDelta, err := r.readExtendedTimestamp(buffer)
 		if err != nil {
 			return nil, err
 		}
 
-		header.Timestamp = r.lastHeader.Timestamp + timestampDelta
+		header.Timestamp = lastHeader.Timestamp + timestampDelta
 		header.TimestampDelta = timestampDelta
 	}
 
 	return header, nil
 }
 
-func (r *messageReader) readPartialHeader(buffer *bufio.Reader) (*Header, error) {
-	header := r.partialHeader
-	extendedTimestamp, err := r.readExtendedTimestamp(buffer, header)
-	if err != nil {
-		return nil, err
-	}
-
-	r.partialHeader = nil
-
-	switch header.Type {
-	case 0:
-		header.Timestamp = extendedTimestamp
-	case 1, 2, 3:
-		header.Timestamp = r.lastHeader.Timestamp + extendedTimestamp
-		header.TimestampDelta = extendedTimestamp
-	}
-
-	return header, nil
-}
-
-func (r *messageReader) readExtendedTimestamp(buffer *bufio.Reader, header *Header) (uint32, error) {
+func (r *messageReader) readExtendedTimestamp(buffer *bufio.Reader) (uint32, error) {
 	var extendedTimestamp [4]byte
 
 	_, err := io.ReadFull(buffer, extendedTimestamp[:])
 	if err != nil {
-		r.partialHeader = header
 		return 0, io.EOF
 	}
 
 	return binary.BigEndian.Uint32(extendedTimestamp[:]), nil
 }
-
-func chunkedBodySize(header *Header, chunkSize int32) uint32 {
-	if chunkSize == -1 {
-		return header.BodySize
-	}
-
-	chunks := uint32(int32(header.BodySize-1) / chunkSize)
-
-	var extendedTimestamps uint32 = 0
-	if header.ExtendedTimestamp {
-		extendedTimestamps = 4 * chunks
-	}
-
-	return header.BodySize + chunks + extendedTimestamps
-}
-
-func unchunkPayload(header *Header, chunked []byte, chunkSize int32) []byte {
-	if chunkSize == -1 {
-		return chunked
-	}
-
-	payload := make([]byte, header.BodySize)
-
-	left := int(header.BodySize)
-	offset := 0
-	chunkedOffset := 0
-	for left > 0 {
-		size := int(chunkSize)
-
-		if size > left {
-			size = left
-		}
-
-		copy(payload[offset:offset+size], chunked[chunkedOffset:chunkedOffset+size])
-
-		offset += size
-
-		chunkedOffset += 1
-		if header.ExtendedTimestamp {
-			chunkedOffset += 4
-		}
-		chunkedOffset += size
-
-		left -= size
-	}
-
-	return payload
-}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"math/rand"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,7 +13,7 @@ import (
 func TestReadMessageWithHeaderType0(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// timestmap
 		0x0f, 0xff, 0xff,
 		// body size
@@ -20,7 +21,7 @@ func TestReadMessageWithHeaderType0(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// payload
 		0xff,
 	}
@@ -31,7 +32,7 @@ func TestReadMessageWithHeaderType0(t *testing.T) {
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, uint32(0x000fffff))
 	assert.Equal(t, message.Header.BodySize, uint32(1))
 	assert.Equal(t, message.Header.Type, uint8(2))
@@ -42,7 +43,7 @@ func TestReadMessageWithHeaderType0(t *testing.T) {
 func TestReadMessageWithHeaderType0ExtendedTimestamp(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// extended timestamp marker
 		0xff, 0xff, 0xff,
 		// body size
@@ -50,7 +51,7 @@ func TestReadMessageWithHeaderType0ExtendedTimestamp(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// extended timestmap
 		0x00, 0xAA, 0xAA, 0xAA,
 		// payload
@@ -63,7 +64,7 @@ func TestReadMessageWithHeaderType0ExtendedTimestamp(t *testing.T) {
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, uint32(0x00aaaaaa))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0))
 	assert.Equal(t, message.Header.BodySize, uint32(1))
@@ -75,7 +76,7 @@ func TestReadMessageWithHeaderType0ExtendedTimestamp(t *testing.T) {
 func TestReadMessageWithHeaderType1(t *testing.T) {
 	payload := []byte{
 		// type
-		0b01000001,
+		0b01000011,
 		// timestmap delta
 		0x00, 0x00, 0xff,
 		// body size
@@ -87,7 +88,7 @@ func TestReadMessageWithHeaderType1(t *testing.T) {
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId: 1,
+		ChunkStreamId: 3,
 		Timestamp:     2137,
 		BodySize:      1,
 		Type:          2,
@@ -95,13 +96,13 @@ func TestReadMessageWithHeaderType1(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+uint32(0xff))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0xff))
 	assert.Equal(t, message.Header.BodySize, uint32(1))
@@ -113,7 +114,7 @@ func TestReadMessageWithHeaderType1(t *testing.T) {
 func TestReadMessageWithHeaderType1WithExtendedTimestamp(t *testing.T) {
 	payload := []byte{
 		// type
-		0b01000001,
+		0b01000011,
 		// extended timestamp marker
 		0xff, 0xff, 0xff,
 		// body size
@@ -127,7 +128,7 @@ func TestReadMessageWithHeaderType1WithExtendedTimestamp(t *testing.T) {
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId: 1,
+		ChunkStreamId: 3,
 		Timestamp:     0x00aaaaaa,
 		BodySize:      1,
 		Type:          2,
@@ -135,13 +136,13 @@ func TestReadMessageWithHeaderType1WithExtendedTimestamp(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+uint32(0xbb000000))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0xbb000000))
 	assert.Equal(t, message.Header.BodySize, uint32(1))
@@ -153,7 +154,7 @@ func TestReadMessageWithHeaderType1WithExtendedTimestamp(t *testing.T) {
 func TestReadMessageWithHeaderType2(t *testing.T) {
 	payload := []byte{
 		// type
-		0b10000001,
+		0b10000011,
 		// timestmap delta
 		0x00, 0x00, 0xff,
 		// payload
@@ -161,7 +162,7 @@ func TestReadMessageWithHeaderType2(t *testing.T) {
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId: 1,
+		ChunkStreamId: 3,
 		Timestamp:     2137,
 		BodySize:      1,
 		Type:          2,
@@ -169,13 +170,13 @@ func TestReadMessageWithHeaderType2(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+uint32(0xff))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0xff))
 	assert.Equal(t, message.Header.BodySize, previousHeader.BodySize)
@@ -187,7 +188,7 @@ func TestReadMessageWithHeaderType2(t *testing.T) {
 func TestReadMessageWithHeaderType2WithExtendedTimestmap(t *testing.T) {
 	payload := []byte{
 		// type
-		0b10000001,
+		0b10000011,
 		// extended timestamp marker
 		0xff, 0xff, 0xff,
 		// extended timestamp
@@ -197,7 +198,7 @@ func TestReadMessageWithHeaderType2WithExtendedTimestmap(t *testing.T) {
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId: 1,
+		ChunkStreamId: 3,
 		Timestamp:     0x00aaaaaa,
 		BodySize:      1,
 		Type:          2,
@@ -205,13 +206,13 @@ func TestReadMessageWithHeaderType2WithExtendedTimestmap(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+uint32(0xbb000000))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0xbb000000))
 	assert.Equal(t, message.Header.BodySize, previousHeader.BodySize)
@@ -223,13 +224,13 @@ func TestReadMessageWithHeaderType2WithExtendedTimestmap(t *testing.T) {
 func TestReadMessageWithHeaderType3(t *testing.T) {
 	payload := []byte{
 		// type
-		0b11000001,
+		0b11000011,
 		// payload
 		0xff,
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId:  1,
+		ChunkStreamId:  3,
 		Timestamp:      2137,
 		TimestampDelta: 1,
 		BodySize:       1,
@@ -238,13 +239,13 @@ func TestReadMessageWithHeaderType3(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+previousHeader.TimestampDelta)
 	assert.Equal(t, message.Header.TimestampDelta, previousHeader.TimestampDelta)
 	assert.Equal(t, message.Header.BodySize, previousHeader.BodySize)
@@ -256,7 +257,7 @@ func TestReadMessageWithHeaderType3(t *testing.T) {
 func TestReadMessageWithHeaderType3WithExtendedTimestamp(t *testing.T) {
 	payload := []byte{
 		// type
-		0b11000001,
+		0b11000011,
 		// extended timestmap
 		0xbb, 0x00, 0x00, 0x00,
 		// payload
@@ -264,7 +265,7 @@ func TestReadMessageWithHeaderType3WithExtendedTimestamp(t *testing.T) {
 	}
 
 	previousHeader := &Header{
-		ChunkStreamId:     1,
+		ChunkStreamId:     3,
 		Timestamp:         0x00aaaaaa,
 		ExtendedTimestamp: true,
 		BodySize:          1,
@@ -273,13 +274,13 @@ func TestReadMessageWithHeaderType3WithExtendedTimestamp(t *testing.T) {
 	}
 
 	reader := NewMessageReader()
-	reader.lastHeader = previousHeader
+	reader.chunkStreams[3] = &chunkStream{lastHeader: previousHeader}
 
 	buffer := bufio.NewReader(bytes.NewReader(payload))
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, previousHeader.Timestamp+uint32(0xbb000000))
 	assert.Equal(t, message.Header.TimestampDelta, uint32(0xbb000000))
 	assert.Equal(t, message.Header.BodySize, previousHeader.BodySize)
@@ -288,10 +289,54 @@ func TestReadMessageWithHeaderType3WithExtendedTimestamp(t *testing.T) {
 	assert.Equal(t, message.Payload, []byte{0xff})
 }
 
+func TestReadMessageWithHeaderType3AfterHeaderType0(t *testing.T) {
+	payload := []byte{
+		// type 0
+		0x03,
+		// timestamp
+		0x0, 0x0, 0x28,
+		// body size
+		0x0, 0x0, 0x01,
+		// type
+		0x9,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xff,
+		// type 3 starting a new message
+		0b11000011,
+		// payload
+		0xfe,
+		// type 3 starting a new message
+		0b11000011,
+		// payload
+		0xfd,
+	}
+
+	reader := NewMessageReader()
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+
+	message, err := reader.ReadMessage(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(40), message.Header.Timestamp)
+
+	// the absolute timestamp of the type 0 header is the delta
+	message, err = reader.ReadMessage(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(80), message.Header.Timestamp)
+	assert.Equal(t, uint32(40), message.Header.TimestampDelta)
+	assert.Equal(t, []byte{0xfe}, message.Payload)
+
+	message, err = reader.ReadMessage(buffer)
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(120), message.Header.Timestamp)
+	assert.Equal(t, []byte{0xfd}, message.Payload)
+}
+
 func TestReturnErrorOnNotEnoughData(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// timestmap
 		0x0f, 0xff, 0xff,
 		// body size
@@ -310,7 +355,7 @@ func TestReturnErrorOnNotEnoughData(t *testing.T) {
 func TestReturnEOFOnNotEnoughDataExtendedTimestamp(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// extended timestamp marker
 		0xff, 0xff, 0xff,
 		// body size
@@ -318,7 +363,7 @@ func TestReturnEOFOnNotEnoughDataExtendedTimestamp(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// partial extended timestmap
 		0x00, 0xAA,
 		// missing payload
@@ -333,7 +378,7 @@ func TestReturnEOFOnNotEnoughDataExtendedTimestamp(t *testing.T) {
 func TestReadMessageWithHeaderType0AndChunkSize(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// timestmap
 		0x0f, 0xff, 0xff,
 		// body size
@@ -341,11 +386,11 @@ func TestReadMessageWithHeaderType0AndChunkSize(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// payload
 		0xff,
 		0xff,
-		0xc1,
+		0xc3,
 		0xff,
 	}
 
@@ -356,7 +401,7 @@ func TestReadMessageWithHeaderType0AndChunkSize(t *testing.T) {
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, uint32(0x000fffff))
 	assert.Equal(t, message.Header.BodySize, uint32(3))
 	assert.Equal(t, message.Header.Type, uint8(2))
@@ -367,7 +412,7 @@ func TestReadMessageWithHeaderType0AndChunkSize(t *testing.T) {
 func TestReadMessageWithHeaderType0AndChunkSizeAndExtendedTimestamp(t *testing.T) {
 	payload := []byte{
 		// type
-		0x01,
+		0x03,
 		// timestmap
 		0xff, 0xff, 0xff,
 		// body size
@@ -375,14 +420,14 @@ func TestReadMessageWithHeaderType0AndChunkSizeAndExtendedTimestamp(t *testing.T
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// extended timestamp
 		0x0f, 0xff, 0xff, 0xff,
 		// payload
 		0xff,
 		0xff,
 		// marker
-		0xc1,
+		0xc3,
 		// extended timestamp
 		0x0f, 0xff, 0xff, 0xff,
 		0xff,
@@ -395,10 +440,300 @@ func TestReadMessageWithHeaderType0AndChunkSizeAndExtendedTimestamp(t *testing.T
 	message, err := reader.ReadMessage(buffer)
 
 	assert.Nil(t, err)
-	assert.Equal(t, message.Header.ChunkStreamId, uint8(0x01))
+	assert.Equal(t, message.Header.ChunkStreamId, uint32(0x03))
 	assert.Equal(t, message.Header.Timestamp, uint32(0x0fffffff))
 	assert.Equal(t, message.Header.BodySize, uint32(3))
 	assert.Equal(t, message.Header.Type, uint8(2))
 	assert.Equal(t, message.Header.StreamId, uint32(1))
 	assert.Equal(t, message.Payload, []byte{0xff, 0xff, 0xff})
 }
+
+func TestReadMessagesWithInterleavedChunkStreams(t *testing.T) {
+	payload := []byte{
+		// audio, chunk stream 4, type 0
+		0x04,
+		// timestamp
+		0x0, 0x0, 0x0a,
+		// body size
+		0x0, 0x0, 0x02,
+		// type
+		AudioType,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xa1, 0xa1,
+
+		// video, chunk stream 6, type 0
+		0x06,
+		// timestamp
+		0x0, 0x0, 0x14,
+		// body size
+		0x0, 0x0, 0x03,
+		// type
+		VideoType,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// first chunk of payload
+		0xb1, 0xb1,
+
+		// audio, chunk stream 4, type 2 interrupting video message
+		0b10000100,
+		// timestamp delta
+		0x0, 0x0, 0x05,
+		// payload
+		0xa2, 0xa2,
+
+		// video continuation, chunk stream 6, type 3
+		0b11000110,
+		// rest of the payload
+		0xb1,
+
+		// video, chunk stream 6, type 1
+		0b01000110,
+		// timestamp delta
+		0x0, 0x0, 0x21,
+		// body size
+		0x0, 0x0, 0x01,
+		// type
+		VideoType,
+		// payload
+		0xb2,
+
+		// audio, chunk stream 4, type 3
+		0b11000100,
+		// payload
+		0xa3, 0xa3,
+	}
+
+	reader := NewMessageReader()
+	reader.SetChunkSize(2)
+
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+
+	expected := []struct {
+		chunkStreamId uint32
+		timestamp     uint32
+		msgType       uint8
+		payload       []byte
+	}{
+		{4, 10, AudioType, []byte{0xa1, 0xa1}},
+		{4, 15, AudioType, []byte{0xa2, 0xa2}},
+		{6, 20, VideoType, []byte{0xb1, 0xb1, 0xb1}},
+		{6, 53, VideoType, []byte{0xb2}},
+		{4, 20, AudioType, []byte{0xa3, 0xa3}},
+	}
+
+	for _, e := range expected {
+		message, err := reader.ReadMessage(buffer)
+
+		assert.Nil(t, err)
+		assert.Equal(t, e.chunkStreamId, message.Header.ChunkStreamId)
+		assert.Equal(t, e.timestamp, message.Header.Timestamp)
+		assert.Equal(t, e.msgType, message.Header.Type)
+		assert.Equal(t, uint32(1), message.Header.StreamId)
+		assert.Equal(t, e.payload, message.Payload)
+	}
+
+	_, err := reader.ReadMessage(buffer)
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestReadMessageWithTwoByteBasicHeader(t *testing.T) {
+	payload := []byte{
+		// type 0, 2-byte basic header
+		0x00,
+		// chunk stream id - 64
+		0xff,
+		// timestmap
+		0x0, 0x0, 0x01,
+		// body size
+		0x0, 0x0, 0x01,
+		// type
+		0x2,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xff,
+	}
+
+	reader := NewMessageReader()
+
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	message, err := reader.ReadMessage(buffer)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(319), message.Header.ChunkStreamId)
+	assert.Equal(t, uint32(1), message.Header.Timestamp)
+	assert.Equal(t, []byte{0xff}, message.Payload)
+}
+
+func TestReadMessageWithThreeByteBasicHeader(t *testing.T) {
+	payload := []byte{
+		// type 0, 3-byte basic header
+		0x01,
+		// chunk stream id - 64, little endian
+		0xff, 0xff,
+		// timestmap
+		0x0, 0x0, 0x01,
+		// body size
+		0x0, 0x0, 0x03,
+		// type
+		0x2,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xff,
+		0xff,
+		// type 3, 3-byte basic header
+		0xc1,
+		0xff, 0xff,
+		// payload
+		0xff,
+	}
+
+	reader := NewMessageReader()
+	reader.SetChunkSize(2)
+
+	buffer := bufio.NewReader(bytes.NewReader(payload))
+	message, err := reader.ReadMessage(buffer)
+
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(65599), message.Header.ChunkStreamId)
+	assert.Equal(t, uint32(3), message.Header.BodySize)
+	assert.Equal(t, []byte{0xff, 0xff, 0xff}, message.Payload)
+}
+
+func TestReadWrittenMessagesWithAllBasicHeaderForms(t *testing.T) {
+	for _, chunkStreamId := range []uint32{2, 63, 64, 319, 320, 65599} {
+		msg := &Message{
+			Header: &Header{
+				Type:          0x2,
+				Timestamp:     0x0fffff,
+				BodySize:      5,
+				StreamId:      0x00000001,
+				ChunkStreamId: chunkStreamId,
+			},
+			Payload: []byte{0x01, 0x02, 0x03, 0x04, 0x05},
+		}
+
+		writer := NewMessageWriter()
+		writer.SetChunkSize(2)
+
+		payload, err := writer.Write(msg)
+		assert.Nil(t, err)
+
+		reader := NewMessageReader()
+		reader.SetChunkSize(2)
+
+		buffer := bufio.NewReader(bytes.NewReader(payload))
+		message, err := reader.ReadMessage(buffer)
+
+		assert.Nil(t, err)
+		assert.Equal(t, chunkStreamId, message.Header.ChunkStreamId)
+		assert.Equal(t, msg.Header.Timestamp, message.Header.Timestamp)
+		assert.Equal(t, msg.Header.BodySize, message.Header.BodySize)
+		assert.Equal(t, msg.Payload, message.Payload)
+		assert.Equal(t, 0, buffer.Buffered())
+	}
+}
+
+func TestReadWrittenMessagesWithCompressedHeaders(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	for iteration := 0; iteration < 100; iteration++ {
+		chunkSize := int32(1 + random.Intn(300))
+
+		writer := NewMessageWriter()
+		writer.SetChunkSize(chunkSize)
+
+		reader := NewMessageReader()
+		reader.SetChunkSize(chunkSize)
+
+		chunkStreamIds := []uint32{2, 3, 63, 64, 320}
+		timestamps := make(map[uint32]uint32)
+
+		var messages []*Message
+		var buffer bytes.Buffer
+
+		for i := 0; i < 50; i++ {
+			chunkStreamId := chunkStreamIds[random.Intn(len(chunkStreamIds))]
+
+			// mix small deltas, repeated deltas, huge jumps and timestamps going backwards
+			timestamp := timestamps[chunkStreamId]
+			switch random.Intn(5) {
+			case 0:
+				timestamp += uint32(random.Intn(100))
+			case 1:
+				timestamp += 40
+			case 2:
+				timestamp += ExtendedTimestampMarker + uint32(random.Intn(2))
+			case 3:
+				timestamp = ExtendedTimestampMarker - 1 + uint32(random.Intn(3))
+			case 4:
+				timestamp = uint32(random.Intn(1000))
+			}
+			timestamps[chunkStreamId] = timestamp
+
+			bodySize := 1 + random.Intn(3)*random.Intn(500)
+			body := make([]byte, bodySize)
+			random.Read(body)
+
+			msg := &Message{
+				Header: &Header{
+					Type:          uint8(8 + random.Intn(2)),
+					Timestamp:     timestamp,
+					BodySize:      uint32(bodySize),
+					StreamId:      uint32(random.Intn(2)),
+					ChunkStreamId: chunkStreamId,
+				},
+				Payload: body,
+			}
+
+			payload, err := writer.Write(msg)
+			assert.Nil(t, err)
+
+			buffer.Write(payload)
+			messages = append(messages, msg)
+		}
+
+		input := bufio.NewReader(&buffer)
+
+		for _, msg := range messages {
+			message, err := reader.ReadMessage(input)
+
+			assert.Nil(t, err)
+			assert.Equal(t, msg.Header.ChunkStreamId, message.Header.ChunkStreamId)
+			assert.Equal(t, msg.Header.Timestamp, message.Header.Timestamp)
+			assert.Equal(t, msg.Header.BodySize, message.Header.BodySize)
+			assert.Equal(t, msg.Header.Type, message.Header.Type)
+			assert.Equal(t, msg.Header.StreamId, message.Header.StreamId)
+			assert.Equal(t, msg.Payload, message.Payload)
+		}
+
+		_, err := reader.ReadMessage(input)
+		assert.Equal(t, io.EOF, err)
+	}
+}
+
+func TestReadMessageStreamIdLittleEndian(t *testing.T) {
+	payload := []byte{
+		// type
+		0x03,
+		// timestmap
+		0x0, 0x0, 0x0,
+		// body size
+		0x0, 0x0, 0x01,
+		// type
+		0x14,
+		// stream id, the only little endian field of the header
+		0x04, 0x03, 0x02, 0x01,
+		// payload
+		0xff,
+	}
+
+	reader := NewMessageReader()
+
+	message, err := reader.ReadMessage(bufio.NewReader(bytes.NewReader(payload)))
+	assert.Nil(t, err)
+	assert.Equal(t, uint32(0x01020304), message.Header.StreamId)
+}
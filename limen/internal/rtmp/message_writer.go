@@ -3,25 +3,38 @@ package rtmp
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 )
 
 type messageWriter struct {
 	chunkSize int32
+	// headers as seen by the peer after reading the last message of each chunk stream
+	lastHeaders map[uint32]*Header
+	// types of the headers of the last message of each chunk stream
+	lastHeaderTypes map[uint32]uint8
 }
 
 func NewMessageWriter() *messageWriter {
-	return &messageWriter{chunkSize: -1}
+	return &messageWriter{chunkSize: -1, lastHeaders: make(map[uint32]*Header), lastHeaderTypes: make(map[uint32]uint8)}
 }
 
 func (m *messageWriter) Write(message *Message) ([]byte, error) {
 	var buffer bytes.Buffer
 	writer := bufio.NewWriter(&buffer)
-	err := m.writeHeader(writer, message)
+
+	headerType, timestamp := m.compressHeader(message.Header)
+
+	var extendedTimestamp []byte
+	if timestamp >= ExtendedTimestampMarker {
+		extendedTimestamp = binary.BigEndian.AppendUint32(nil, timestamp)
+	}
+
+	err := m.writeHeader(writer, message, headerType, timestamp, extendedTimestamp)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.writePayload(writer, message)
+	err = m.writePayload(writer, message, extendedTimestamp)
 	if err != nil {
 		return nil, err
 	}
@@ -37,68 +50,140 @@ func (m *messageWriter) SetChunkSize(size int32) {
 	m.chunkSize = size
 }
 
-func (m *messageWriter) writePayload(writer *bufio.Writer, message *Message) error {
-	chunkedPayload := chunkPayload(message, int(m.chunkSize))
+// compressHeader picks the smallest header type able to describe the message
+// given the previous message of the same chunk stream and returns it together
+// with the value of the timestamp field (absolute for type 0, delta otherwise).
+func (m *messageWriter) compressHeader(header *Header) (uint8, uint32) {
+	last := m.lastHeaders[header.ChunkStreamId]
+
+	var headerType uint8
+	var timestamp uint32
+
+	switch {
+	case last == nil || last.StreamId != header.StreamId || header.Timestamp < last.Timestamp:
+		headerType, timestamp = 0, header.Timestamp
+	case last.BodySize != header.BodySize || last.Type != header.Type:
+		headerType, timestamp = 1, header.Timestamp-last.Timestamp
+	case m.lastHeaderTypes[header.ChunkStreamId] != 0 && !last.ExtendedTimestamp && header.Timestamp-last.Timestamp == last.TimestampDelta:
+		// peers disagree on the meaning of a type 3 header following
+		// an extended timestamp, such headers are never compressed to type 3,
+		// nor are ones following a type 0 header as its absolute timestamp
+		// would be taken for the delta
+		headerType, timestamp = 3, last.TimestampDelta
+	default:
+		headerType, timestamp = 2, header.Timestamp-last.Timestamp
+	}
+
+	next := &Header{
+		ChunkStreamId:     header.ChunkStreamId,
+		Timestamp:         header.Timestamp,
+		BodySize:          header.BodySize,
+		Type:              header.Type,
+		StreamId:          header.StreamId,
+		ExtendedTimestamp: timestamp >= ExtendedTimestampMarker,
+	}
+	if headerType != 0 {
+		next.TimestampDelta = timestamp
+	}
+
+	m.lastHeaders[header.ChunkStreamId] = next
+	m.lastHeaderTypes[header.ChunkStreamId] = headerType
+
+	return headerType, timestamp
+}
+
+func (m *messageWriter) writePayload(writer *bufio.Writer, message *Message, extendedTimestamp []byte) error {
+	chunkedPayload := chunkPayload(message, int(m.chunkSize), extendedTimestamp)
 	_, err := writer.Write(chunkedPayload)
 	return err
 }
 
-func (m *messageWriter) writeHeader(writer *bufio.Writer, message *Message) error {
-	_, err := writer.Write(serializeHeader(message.Header))
+func (m *messageWriter) writeHeader(writer *bufio.Writer, message *Message, headerType uint8, timestamp uint32, extendedTimestamp []byte) error {
+	if _, err := writer.Write(serializeHeader(headerType, message.Header, timestamp)); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(extendedTimestamp)
 
 	return err
 }
 
-// NOTE: we are only serializing to type0 header
-func serializeHeader(header *Header) []byte {
-	return []byte{
-		header.ChunkStreamId & 0x3f,
-		byte(header.Timestamp>>16) & 0xff,
-		byte(header.Timestamp>>8) & 0xff,
-		byte(header.Timestamp) & 0xff,
-		byte(header.BodySize>>16) & 0xff,
-		byte(header.BodySize>>8) & 0xff,
-		byte(header.BodySize) & 0xff,
+// serializeBasicHeader encodes the chunk basic header using the shortest
+// form able to represent the chunk stream id.
+func serializeBasicHeader(headerType uint8, chunkStreamId uint32) []byte {
+	switch {
+	case chunkStreamId < 64:
+		return []byte{headerType<<6 | byte(chunkStreamId)}
+	case chunkStreamId < 320:
+		return []byte{headerType << 6, byte(chunkStreamId - 64)}
+	default:
+		id := chunkStreamId - 64
+		return []byte{headerType<<6 | 0x01, byte(id), byte(id >> 8)}
+	}
+}
+
+// serializeHeader encodes the basic header followed by the message header of the given type,
+// the extended timestamp (if any) has to be written right after it.
+func serializeHeader(headerType uint8, header *Header, timestamp uint32) []byte {
+	serialized := serializeBasicHeader(headerType, header.ChunkStreamId)
+
+	if headerType == 3 {
+		return serialized
+	}
+
+	if timestamp >= ExtendedTimestampMarker {
+		timestamp = ExtendedTimestampMarker
+	}
+
+	serialized = append(serialized,
+		byte(timestamp>>16)&0xff,
+		byte(timestamp>>8)&0xff,
+		byte(timestamp)&0xff,
+	)
+
+	if headerType == 2 {
+		return serialized
+	}
+
+	serialized = append(serialized,
+		byte(header.BodySize>>16)&0xff,
+		byte(header.BodySize>>8)&0xff,
+		byte(header.BodySize)&0xff,
 		header.Type,
-		byte(header.StreamId>>24) & 0xff,
-		byte(header.StreamId>>16) & 0xff,
-		byte(header.StreamId>>8) & 0xff,
-		byte(header.StreamId) & 0xff,
+	)
+
+	if headerType == 1 {
+		return serialized
 	}
+
+	return append(serialized,
+		// message stream id is the only little endian field
+		byte(header.StreamId)&0xff,
+		byte(header.StreamId>>8)&0xff,
+		byte(header.StreamId>>16)&0xff,
+		byte(header.StreamId>>24)&0xff,
+	)
 }
 
-func chunkPayload(msg *Message, chunkSize int) []byte {
+// chunkPayload splits the payload into chunks separated by type 3 headers,
+// each of them repeating the extended timestamp of the message header.
+func chunkPayload(msg *Message, chunkSize int, extendedTimestamp []byte) []byte {
 	if chunkSize == -1 || len(msg.Payload) <= chunkSize {
 		return msg.Payload
 	}
 
 	chunks := int((len(msg.Payload) - 1) / chunkSize)
-	var extendedTimestamps int
-	if msg.Header.ExtendedTimestamp {
-		extendedTimestamps = chunks
-	} else {
-		extendedTimestamps = 0
-	}
 
-	newPayload := make([]byte, len(msg.Payload)+chunks+4*extendedTimestamps)
+	separator := append(serializeBasicHeader(3, msg.Header.ChunkStreamId), extendedTimestamp...)
+
+	newPayload := make([]byte, len(msg.Payload)+len(separator)*chunks)
 
 	copy(newPayload[:chunkSize], msg.Payload[:chunkSize])
 
 	offset := chunkSize
 	for i := 1; i <= chunks; i++ {
 		// write the separator
-		newPayload[offset] = 0b11000000 | msg.Header.ChunkStreamId
-		offset += 1
-
-		// write the timestamp
-		if msg.Header.ExtendedTimestamp {
-			newPayload[offset] = byte(msg.Header.Timestamp>>24) & 0xff
-			newPayload[offset+1] = byte(msg.Header.Timestamp>>16) & 0xff
-			newPayload[offset+2] = byte(msg.Header.Timestamp>>8) & 0xff
-			newPayload[offset+3] = byte(msg.Header.Timestamp) & 0xff
-
-			offset += 4
-		}
+		offset += copy(newPayload[offset:], separator)
 
 		var offsetTo int
 		if i*chunkSize+chunkSize > len(msg.Payload) {
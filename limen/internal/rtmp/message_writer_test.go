@@ -33,7 +33,7 @@ func TestWriteMessage(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// payload
 		0xff,
 	})
@@ -61,7 +61,7 @@ func TestWriteMessageWithChunkSize(t *testing.T) {
 
 	assert.Equal(t, payload, []byte{
 		// header type
-		0x0 | (msg.Header.ChunkStreamId & 0x3f),
+		0x0 | byte(msg.Header.ChunkStreamId&0x3f),
 		// timestmap
 		0x0f, 0xff, 0xff,
 		// body size
@@ -69,13 +69,13 @@ func TestWriteMessageWithChunkSize(t *testing.T) {
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
 		// payload start
 		// payload
 		0xff,
 		0xff,
 		// marker
-		0b11000000 | msg.Header.ChunkStreamId,
+		0b11000000 | byte(msg.Header.ChunkStreamId),
 		// payload
 		0xff,
 	})
@@ -84,12 +84,11 @@ func TestWriteMessageWithChunkSize(t *testing.T) {
 func TestWriteMessageWithChunkSizeAndExtendedTimestamp(t *testing.T) {
 	msg := &Message{
 		Header: &Header{
-			Type:              0x2,
-			Timestamp:         0x0fffff,
-			BodySize:          3,
-			StreamId:          0x00000001,
-			ChunkStreamId:     6,
-			ExtendedTimestamp: true,
+			Type:          0x2,
+			Timestamp:     0x01000000,
+			BodySize:      3,
+			StreamId:      0x00000001,
+			ChunkStreamId: 6,
 		},
 		Payload: []byte{0xff, 0xff, 0xff},
 	}
@@ -104,24 +103,232 @@ func TestWriteMessageWithChunkSizeAndExtendedTimestamp(t *testing.T) {
 
 	assert.Equal(t, payload, []byte{
 		// header type
-		0x0 | (msg.Header.ChunkStreamId & 0x3f),
-		// timestmap
-		0x0f, 0xff, 0xff,
+		0x0 | byte(msg.Header.ChunkStreamId&0x3f),
+		// extended timestamp marker
+		0xff, 0xff, 0xff,
 		// body size
 		0x0, 0x0, 0x03,
 		// type
 		0x2,
 		// stream id
-		0x00, 0x0, 0x0, 0x1,
+		0x01, 0x0, 0x0, 0x0,
+		// extended timestamp
+		0x01, 0x00, 0x00, 0x00,
 		// payload start
 		// payload
 		0xff,
 		0xff,
 		// marker
-		0b11000000 | msg.Header.ChunkStreamId,
+		0b11000000 | byte(msg.Header.ChunkStreamId),
 		// extended timestamp
-		0x00, 0x0f, 0xff, 0xff,
+		0x01, 0x00, 0x00, 0x00,
 		// payload
 		0xff,
 	})
 }
+
+func TestWriteMessageWithTwoByteBasicHeader(t *testing.T) {
+	msg := &Message{
+		Header: &Header{
+			Type:          0x2,
+			Timestamp:     0x0fffff,
+			BodySize:      3,
+			StreamId:      0x00000001,
+			ChunkStreamId: 100,
+		},
+		Payload: []byte{0xff, 0xff, 0xff},
+	}
+
+	writer := NewMessageWriter()
+
+	writer.SetChunkSize(2)
+
+	payload, err := writer.Write(msg)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{
+		// header type, 2-byte basic header
+		0x00,
+		// chunk stream id - 64
+		100 - 64,
+		// timestmap
+		0x0f, 0xff, 0xff,
+		// body size
+		0x0, 0x0, 0x03,
+		// type
+		0x2,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xff,
+		0xff,
+		// marker
+		0b11000000,
+		100 - 64,
+		// payload
+		0xff,
+	}, payload)
+}
+
+func TestWriteMessageWithThreeByteBasicHeader(t *testing.T) {
+	msg := &Message{
+		Header: &Header{
+			Type:          0x2,
+			Timestamp:     0x0fffff,
+			BodySize:      3,
+			StreamId:      0x00000001,
+			ChunkStreamId: 1000,
+		},
+		Payload: []byte{0xff, 0xff, 0xff},
+	}
+
+	writer := NewMessageWriter()
+
+	writer.SetChunkSize(2)
+
+	payload, err := writer.Write(msg)
+	assert.Nil(t, err)
+
+	assert.Equal(t, []byte{
+		// header type, 3-byte basic header
+		0x01,
+		// chunk stream id - 64, little endian
+		0xa8, 0x03,
+		// timestmap
+		0x0f, 0xff, 0xff,
+		// body size
+		0x0, 0x0, 0x03,
+		// type
+		0x2,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+		// payload
+		0xff,
+		0xff,
+		// marker
+		0b11000001,
+		0xa8, 0x03,
+		// payload
+		0xff,
+	}, payload)
+}
+
+func TestWriteMessagesWithCompressedHeaders(t *testing.T) {
+	writer := NewMessageWriter()
+
+	write := func(timestamp uint32, bodySize uint32, msgType uint8) []byte {
+		payload, err := writer.Write(&Message{
+			Header: &Header{
+				Type:          msgType,
+				Timestamp:     timestamp,
+				BodySize:      bodySize,
+				StreamId:      0x00000001,
+				ChunkStreamId: 6,
+			},
+			Payload: make([]byte, bodySize),
+		})
+		assert.Nil(t, err)
+
+		return payload[:len(payload)-int(bodySize)]
+	}
+
+	// first message of the chunk stream
+	assert.Equal(t, []byte{
+		// header type 0
+		0x06,
+		// timestamp
+		0x0, 0x0, 0x0a,
+		// body size
+		0x0, 0x0, 0x01,
+		// type
+		0x9,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+	}, write(10, 1, 0x9))
+
+	// same length and type
+	assert.Equal(t, []byte{
+		// header type 2
+		0b10000110,
+		// timestamp delta
+		0x0, 0x0, 0x28,
+	}, write(50, 1, 0x9))
+
+	// same timestamp delta
+	assert.Equal(t, []byte{
+		// header type 3
+		0b11000110,
+	}, write(90, 1, 0x9))
+
+	// different length
+	assert.Equal(t, []byte{
+		// header type 1
+		0b01000110,
+		// timestamp delta
+		0x0, 0x0, 0x28,
+		// body size
+		0x0, 0x0, 0x02,
+		// type
+		0x9,
+	}, write(130, 2, 0x9))
+
+	// timestamp going backwards
+	assert.Equal(t, []byte{
+		// header type 0
+		0x06,
+		// timestamp
+		0x0, 0x0, 0x0,
+		// body size
+		0x0, 0x0, 0x02,
+		// type
+		0x9,
+		// stream id
+		0x01, 0x0, 0x0, 0x0,
+	}, write(0, 2, 0x9))
+
+	// type 3 is never used right after type 0
+	assert.Equal(t, []byte{
+		// header type 2
+		0b10000110,
+		// timestamp delta
+		0x0, 0x0, 0x0,
+	}, write(0, 2, 0x9))
+
+	// extended timestamp delta
+	assert.Equal(t, []byte{
+		// header type 2
+		0b10000110,
+		// extended timestamp marker
+		0xff, 0xff, 0xff,
+		// extended timestamp delta
+		0x01, 0x00, 0x00, 0x00,
+	}, write(0x01000000, 2, 0x9))
+
+	// type 3 is never used after an extended timestamp
+	assert.Equal(t, []byte{
+		// header type 2
+		0b10000110,
+		// extended timestamp marker
+		0xff, 0xff, 0xff,
+		// extended timestamp delta
+		0x01, 0x00, 0x00, 0x00,
+	}, write(0x02000000, 2, 0x9))
+}
+
+func TestWriteMessageStreamIdLittleEndian(t *testing.T) {
+	msg := &Message{
+		Header: &Header{
+			Type:      0x14,
+			Timestamp: 0,
+			BodySize:  1,
+			StreamId:  0x01020304,
+		},
+		Payload: []byte{0xff},
+	}
+
+	payload, err := NewMessageWriter().Write(msg)
+	assert.Nil(t, err)
+
+	// the message stream id is the only little endian field of the header
+	assert.Equal(t, []byte{0x04, 0x03, 0x02, 0x01}, payload[8:12])
+}
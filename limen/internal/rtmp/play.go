@@ -0,0 +1,55 @@
+package rtmp
+
+const (
+	PlayStartLive        = -2
+	PlayStartRecorded    = -1
+	PlayDurationUntilEnd = -1
+)
+
+type PlayCommand struct {
+	StreamKey string
+	Start     float64
+	Duration  float64
+	Reset     bool
+	TxId      float64
+}
+
+func (c *PlayCommand) Serialize() []byte {
+	return marshalCommand("play", c.TxId, nil, c.StreamKey, c.Start, c.Duration, c.Reset)
+}
+
+func (c *PlayCommand) Deserialize(payload interface{}) error {
+	c.Start = PlayStartLive
+	c.Duration = PlayDurationUntilEnd
+	c.Reset = true
+
+	return unmarshalCommand(payload, "play", 4, &c.TxId, nil, &c.StreamKey, &c.Start, &c.Duration, &c.Reset)
+}
+
+type Play2Command struct {
+	StreamKey    string  `amf:"streamName"`
+	OldStreamKey string  `amf:"oldStreamName,omitempty"`
+	Transition   string  `amf:"transition,omitempty"`
+	Start        float64 `amf:"start"`
+	Len          float64 `amf:"len"`
+	TxId         float64 `amf:"-"`
+}
+
+func (c *Play2Command) Serialize() []byte {
+	return marshalCommand("play2", c.TxId, nil, c)
+}
+
+func (c *Play2Command) Deserialize(payload interface{}) error {
+	c.Start = PlayStartLive
+	c.Len = PlayDurationUntilEnd
+
+	if err := unmarshalCommand(payload, "play2", 4, &c.TxId, nil, c); err != nil {
+		return err
+	}
+
+	if c.StreamKey == "" {
+		return ErrInvalidMessageFormat
+	}
+
+	return nil
+}
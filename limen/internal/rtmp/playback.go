@@ -0,0 +1,32 @@
+package rtmp
+
+import "limen/internal/registry"
+
+// playback holds the state of a stream played by the connection.
+type playback struct {
+	streamKey     string
+	subscription  *registry.Subscription
+	baseTimestamp uint32
+	baseSet       bool
+	// closed once the playback goroutine stops writing to the connection
+	done chan struct{}
+}
+
+func newPlayback(streamKey string, subscription *registry.Subscription) *playback {
+	return &playback{streamKey: streamKey, subscription: subscription, done: make(chan struct{})}
+}
+
+// timestamp translates the publisher's timestamp so that
+// each player's timeline starts at zero.
+func (p *playback) timestamp(timestamp uint32) uint32 {
+	if !p.baseSet {
+		p.baseTimestamp = timestamp
+		p.baseSet = true
+	}
+
+	if timestamp < p.baseTimestamp {
+		return 0
+	}
+
+	return timestamp - p.baseTimestamp
+}
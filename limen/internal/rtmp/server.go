@@ -1,38 +1,195 @@
 package rtmp
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net"
+	"sync"
 )
 
-type ConnHandleFunc func(conn net.Conn) error
+var ErrServerClosed = errors.New("rtmp: server closed")
+
+// ConnHandleFunc handles a single connection, the context gets cancelled
+// when the server shuts down and the handler is expected to return soon after.
+type ConnHandleFunc func(ctx context.Context, conn net.Conn) error
 
 type RtmpServer struct {
 	Handler ConnHandleFunc
 	Logger  *slog.Logger
 	Host    string
 	Port    int
-}
 
-func (s *RtmpServer) Run() error {
-	if s.Logger == nil {
-		s.Logger = slog.Default()
-	}
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	// cancel functions of the contexts of running Serve calls
+	cancels      map[int]context.CancelFunc
+	nextCancelId int
+	closed       bool
+	handlers     sync.WaitGroup
+}
 
-	s.Logger.Info("Starting RTMP server", "host", s.Host, "port", s.Port)
+// Run listens on the configured address and serves connections until
+// the context gets cancelled or the server is shut down.
+func (s *RtmpServer) Run(ctx context.Context) error {
+	s.logger().Info("Starting RTMP server", "host", s.Host, "port", s.Port)
 
 	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", s.Host, s.Port))
 	if err != nil {
 		return err
 	}
+
+	return s.Serve(ctx, listener)
+}
+
+// Serve accepts connections on the listener and closes it when done.
+//
+// Cancelling the context stops accepting new connections and cancels contexts
+// of the running handlers, Shutdown should be used to wait for them to finish.
+// The contexts of the handlers get cancelled as well once Serve returns.
+// After Shutdown, Serve returns ErrServerClosed.
+func (s *RtmpServer) Serve(ctx context.Context, listener net.Listener) error {
 	defer listener.Close()
 
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+		s.conns = make(map[net.Conn]struct{})
+		s.cancels = make(map[int]context.CancelFunc)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cancelId := s.nextCancelId
+	s.nextCancelId += 1
+	s.cancels[cancelId] = cancel
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.cancels, cancelId)
+	}()
+
+	s.listeners[listener] = struct{}{}
+	s.mu.Unlock()
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			listener.Close()
+		case <-stopped:
+		}
+	}()
+
 	for {
-		if conn, err := listener.Accept(); err != nil {
+		conn, err := listener.Accept()
+		if err != nil {
+			s.mu.Lock()
+			delete(s.listeners, listener)
+			closed := s.closed
+			s.mu.Unlock()
+
+			if closed {
+				return ErrServerClosed
+			}
+
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
 			return err
-		} else {
-			go s.Handler(conn)
 		}
+
+		if !s.trackConn(conn) {
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		go func() {
+			defer s.handlers.Done()
+			defer s.untrackConn(conn)
+
+			s.Handler(ctx, conn)
+		}()
 	}
 }
+
+// Shutdown stops accepting new connections, asks all handlers to notify their peers
+// and waits for them to finish. When the context expires first, the remaining
+// connections get closed forcefully and the context's error is returned.
+func (s *RtmpServer) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+
+	for listener := range s.listeners {
+		listener.Close()
+	}
+
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.mu.Unlock()
+
+	s.logger().Info("Shutting down RTMP server")
+
+	finished := make(chan struct{})
+	go func() {
+		s.handlers.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	return ctx.Err()
+}
+
+func (s *RtmpServer) logger() *slog.Logger {
+	if s.Logger == nil {
+		return slog.Default()
+	}
+
+	return s.Logger
+}
+
+func (s *RtmpServer) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return false
+	}
+
+	s.conns[conn] = struct{}{}
+	s.handlers.Add(1)
+
+	return true
+}
+
+func (s *RtmpServer) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+}
@@ -0,0 +1,111 @@
+package rtmp
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func startServer(t *testing.T, handler ConnHandleFunc) (*RtmpServer, string, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := &RtmpServer{Handler: handler}
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Serve(context.Background(), listener)
+	}()
+
+	return server, listener.Addr().String(), result
+}
+
+func TestShutdownWaitsForHandlers(t *testing.T) {
+	handled := make(chan struct{})
+
+	server, addr, result := startServer(t, func(ctx context.Context, conn net.Conn) error {
+		defer conn.Close()
+
+		close(handled)
+		<-ctx.Done()
+
+		// a handler may still talk to the peer after being cancelled
+		_, err := conn.Write([]byte("bye"))
+		return err
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	<-handled
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.Nil(t, server.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-result)
+
+	buff := make([]byte, 3)
+	_, err = conn.Read(buff)
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("bye"), buff)
+
+	// no more connections are accepted
+	_, err = net.Dial("tcp", addr)
+	assert.NotNil(t, err)
+}
+
+func TestShutdownClosesConnectionsAfterTimeout(t *testing.T) {
+	handled := make(chan struct{})
+
+	server, addr, result := startServer(t, func(ctx context.Context, conn net.Conn) error {
+		close(handled)
+
+		// ignores the cancellation and waits for the connection to get closed
+		_, err := conn.Read(make([]byte, 1))
+		return err
+	})
+
+	conn, err := net.Dial("tcp", addr)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	<-handled
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	assert.Equal(t, context.DeadlineExceeded, server.Shutdown(ctx))
+	assert.Equal(t, ErrServerClosed, <-result)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(t, err)
+}
+
+func TestServeStopsOnContextCancel(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	server := &RtmpServer{Handler: func(ctx context.Context, conn net.Conn) error {
+		return conn.Close()
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	result := make(chan error, 1)
+	go func() {
+		result <- server.Serve(ctx, listener)
+	}()
+
+	cancel()
+
+	assert.Equal(t, context.Canceled, <-result)
+
+	// nothing is left behind for Shutdown to cancel
+	assert.Empty(t, server.cancels)
+}
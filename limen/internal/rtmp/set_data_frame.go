@@ -1,72 +1,35 @@
 package rtmp
 
-import (
-	"github.com/mitchellh/mapstructure"
-
-	"limen/internal/rtmp/amf"
-)
-
 type SetDataFrameMessage struct {
-	Encoder         string
-	Duration        float64
-	FileSize        float64 `mapstructure:"filesize"`
-	Width           float64
-	Height          float64
-	VideoCodecId    float64 `mapstructure:"videocodecid"`
-	VideoDataRate   float64 `mapstructure:"videodatarate"`
-	Framerate       float64
-	AudioCodecId    float64 `mapstructure:"audiocodecid"`
-	AudioSampleRate float64 `mapstructure:"audiosamplerate"`
-	AudioSampleSize float64 `mapstructure:"audiosamplesize"`
-	Stereo          bool
+	Encoder         string  `amf:"encoder"`
+	Duration        float64 `amf:"duration"`
+	FileSize        float64 `amf:"filesize"`
+	Width           float64 `amf:"width"`
+	Height          float64 `amf:"height"`
+	VideoCodecId    float64 `amf:"videocodecid"`
+	VideoDataRate   float64 `amf:"videodatarate"`
+	Framerate       float64 `amf:"framerate"`
+	AudioCodecId    float64 `amf:"audiocodecid"`
+	AudioSampleRate float64 `amf:"audiosamplerate"`
+	AudioSampleSize float64 `amf:"audiosamplesize"`
+	Stereo          bool    `amf:"stereo"`
 }
 
 func (c *SetDataFrameMessage) Serialize() []byte {
-	payload := map[string]interface{}{
-		"encoder":         c.Encoder,
-		"duration":        c.Duration,
-		"filesize":        c.FileSize,
-		"width":           c.Width,
-		"height":          c.Height,
-		"videocodecid":    c.VideoCodecId,
-		"videoDataRate":   c.VideoDataRate,
-		"framerate":       c.Framerate,
-		"audioCodecId":    c.AudioCodecId,
-		"audioSampleRate": c.AudioSampleRate,
-		"audioSampleSize": c.AudioSampleSize,
-		"stereo":          c.Stereo,
-	}
-
-	bytes, _ := amf.NewAMF0Encoder().Encode([]interface{}{payload})
-
-	return bytes
+	return marshalCommand("@setDataFrame", "onMetaData", c)
 }
 
 func (c *SetDataFrameMessage) Deserialize(payload interface{}) error {
-	if p, ok := payload.([]interface{}); ok {
-		if len(p) != 3 {
-			return ErrInvalidMessageFormat
-		}
+	var name string
 
-		if p[0] != "@setDataFrame" {
-			return ErrInvalidMessageFormat
-		}
-
-		if p[1] != "onMetaData" {
-			return ErrInvalidMessageFormat
-		}
-
-		fields := map[string]interface{}{}
-
-		for _, pair := range p[2].([]*amf.KeyValuePair) {
-			fields[pair.Key] = pair.Value
-		}
+	// the metadata can be sent either as an object or as an ECMA array
+	if err := unmarshalCommand(payload, "@setDataFrame", 3, &name, c); err != nil {
+		return err
+	}
 
-		if err := mapstructure.Decode(fields, c); err != nil {
-			return ErrInvalidMessageFormat
-		}
-	} else {
+	if name != "onMetaData" {
 		return ErrInvalidMessageFormat
 	}
+
 	return nil
 }
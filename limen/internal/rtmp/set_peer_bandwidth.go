@@ -4,8 +4,15 @@ import (
 	"encoding/binary"
 )
 
+const (
+	PeerBandwidthLimitHard    uint8 = 0
+	PeerBandwidthLimitSoft    uint8 = 1
+	PeerBandwidthLimitDynamic uint8 = 2
+)
+
 type SetPeerBandwidthMessage struct {
-	Size uint32
+	Size      uint32
+	LimitType uint8
 }
 
 func (c *SetPeerBandwidthMessage) Type() uint8 {
@@ -15,7 +22,7 @@ func (c *SetPeerBandwidthMessage) Type() uint8 {
 func (c *SetPeerBandwidthMessage) Serialize() []byte {
 	payload := make([]byte, 5)
 	binary.BigEndian.PutUint32(payload, c.Size)
-	payload[4] = 0x02
+	payload[4] = c.LimitType
 
 	return payload
 }
@@ -24,11 +31,12 @@ func (c *SetPeerBandwidthMessage) Deserialize(data []byte) error {
 	if len(data) != 5 {
 		return ErrInvalidMessageFormat
 	}
-	if data[5] != 0x02 {
+	if data[4] > PeerBandwidthLimitDynamic {
 		return ErrInvalidMessageFormat
 	}
 
-	c.Size = binary.LittleEndian.Uint32(data[:4])
+	c.Size = binary.BigEndian.Uint32(data[:4])
+	c.LimitType = data[4]
 
 	return nil
 }
@@ -1,10 +1,37 @@
 package rtmp
 
+import "encoding/binary"
+
+const (
+	UserControlStreamBegin      uint16 = 0
+	UserControlStreamEOF        uint16 = 1
+	UserControlStreamDry        uint16 = 2
+	UserControlSetBufferLength  uint16 = 3
+	UserControlStreamIsRecorded uint16 = 4
+	UserControlPingRequest      uint16 = 6
+	UserControlPingResponse     uint16 = 7
+)
+
 type UserControlMessage struct {
 	Data      []byte
 	EventType uint16
 }
 
+func NewStreamBeginMessage(streamId uint32) *UserControlMessage {
+	return newStreamEventMessage(UserControlStreamBegin, streamId)
+}
+
+func NewStreamEOFMessage(streamId uint32) *UserControlMessage {
+	return newStreamEventMessage(UserControlStreamEOF, streamId)
+}
+
+func newStreamEventMessage(eventType uint16, streamId uint32) *UserControlMessage {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, streamId)
+
+	return &UserControlMessage{EventType: eventType, Data: data}
+}
+
 func (c *UserControlMessage) Type() uint8 {
 	return UserControlType
 }
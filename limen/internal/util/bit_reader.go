@@ -42,6 +42,61 @@ func (r *BitReader) ReadBits(bits int, payload *uint64) bool {
 	return true
 }
 
+func (r *BitReader) ReadFlag(payload *bool) bool {
+	var bit uint64
+	ok := r.ReadBits(1, &bit)
+	*payload = bit == 1
+	return ok
+}
+
+// ReadUE reads an unsigned Exp-Golomb code, codes longer than 32 bits
+// of value are rejected as none of the H.264 and H.265 syntax uses them.
+func (r *BitReader) ReadUE(payload *uint64) bool {
+	*payload = 0
+
+	zeros := 0
+	for {
+		var bit uint64
+		if !r.ReadBits(1, &bit) {
+			return false
+		}
+
+		if bit == 1 {
+			break
+		}
+
+		zeros++
+		if zeros > 31 {
+			return false
+		}
+	}
+
+	var suffix uint64
+	if !r.ReadBits(zeros, &suffix) {
+		return false
+	}
+
+	*payload = uint64(1)<<zeros - 1 + suffix
+	return true
+}
+
+// ReadSE reads a signed Exp-Golomb code.
+func (r *BitReader) ReadSE(payload *int64) bool {
+	var value uint64
+	if !r.ReadUE(&value) {
+		*payload = 0
+		return false
+	}
+
+	if value&1 == 1 {
+		*payload = int64((value + 1) / 2)
+	} else {
+		*payload = -int64(value / 2)
+	}
+
+	return true
+}
+
 func (r *BitReader) SkipBits(bits int) bool {
 	totalRegBits := r.regBits + r.nextRegBits
 	if totalRegBits >= bits {
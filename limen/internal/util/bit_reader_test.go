@@ -155,3 +155,35 @@ func TestBitReaderReadingSlice(t *testing.T) {
 	assert.True(t, reader.ReadBits(1, &bytePayload))
 	assert.False(t, reader.ReadSlice(payload[:]))
 }
+
+func TestBitReaderExpGolombCodes(t *testing.T) {
+	// codes of 0, 1, 2 and 3 followed by a set flag
+	data := []byte{0b10100110, 0b01001000}
+
+	reader := BitReader{Data: data}
+
+	var unsigned uint64
+	for _, expected := range []uint64{0, 1, 2, 3} {
+		assert.True(t, reader.ReadUE(&unsigned))
+		assert.Equal(t, expected, unsigned)
+	}
+
+	var flag bool
+	assert.True(t, reader.ReadFlag(&flag))
+	assert.True(t, flag)
+
+	// the code is cut short
+	assert.False(t, reader.ReadUE(&unsigned))
+
+	reader = BitReader{Data: data}
+
+	var signed int64
+	for _, expected := range []int64{0, 1, -1, 2} {
+		assert.True(t, reader.ReadSE(&signed))
+		assert.Equal(t, expected, signed)
+	}
+
+	// values past 32 bits
+	reader = BitReader{Data: []byte{0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0xff, 0xff}}
+	assert.False(t, reader.ReadUE(&unsigned))
+}
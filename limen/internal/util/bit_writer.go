@@ -0,0 +1,35 @@
+package util
+
+type BitWriter struct {
+	Data []byte
+	bits int
+}
+
+// WriteBits appends the lowest bits of the payload, most significant bit first.
+func (w *BitWriter) WriteBits(bits int, payload uint64) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.Data = append(w.Data, 0)
+		}
+
+		w.Data[len(w.Data)-1] |= byte(payload>>i&1) << (7 - w.bits%8)
+		w.bits++
+	}
+}
+
+func (w *BitWriter) WriteFlag(flag bool) {
+	if flag {
+		w.WriteBits(1, 1)
+	} else {
+		w.WriteBits(1, 0)
+	}
+}
+
+func (w *BitWriter) BitsWritten() int {
+	return w.bits
+}
+
+// Align pads the data with zero bits up to the next byte boundary.
+func (w *BitWriter) Align() {
+	w.bits = 8 * len(w.Data)
+}
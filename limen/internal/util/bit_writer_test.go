@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBitWriterWritingBits(t *testing.T) {
+	writer := BitWriter{}
+
+	writer.WriteBits(2, 0b11)
+	writer.WriteBits(4, 0b0100)
+	writer.WriteFlag(false)
+	writer.WriteFlag(true)
+	assert.Equal(t, []byte{0b11010001}, writer.Data)
+
+	// only the lowest bits get written
+	writer.WriteBits(12, 0xfabc)
+	assert.Equal(t, 20, writer.BitsWritten())
+	assert.Equal(t, []byte{0b11010001, 0xab, 0xc0}, writer.Data)
+
+	writer.Align()
+	assert.Equal(t, 24, writer.BitsWritten())
+
+	writer.WriteBits(64, 0xff00ff00ff00ff00)
+	assert.Equal(t, []byte{0b11010001, 0xab, 0xc0, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00, 0xff, 0x00}, writer.Data)
+
+	// written bits read back the same
+	reader := BitReader{Data: writer.Data}
+	payload := uint64(0)
+	assert.True(t, reader.ReadBits(6, &payload))
+	assert.Equal(t, uint64(0b110100), payload)
+}
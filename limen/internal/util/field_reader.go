@@ -0,0 +1,78 @@
+package util
+
+// FieldReader reads the fields of a bitstream syntax such as a parameter
+// set, the first read past the end of the data or of an invalid code is
+// remembered and turns into the given error while later reads return zero.
+type FieldReader struct {
+	reader  BitReader
+	invalid error
+	err     error
+}
+
+func NewFieldReader(data []byte, invalid error) *FieldReader {
+	return &FieldReader{reader: BitReader{Data: data}, invalid: invalid}
+}
+
+// Err returns the error of the first failed read.
+func (r *FieldReader) Err() error {
+	return r.err
+}
+
+func (r *FieldReader) Bits(n int) uint32 {
+	var payload uint64
+	if r.check(r.reader.ReadBits(n, &payload)) {
+		return uint32(payload)
+	}
+
+	return 0
+}
+
+func (r *FieldReader) Flag() bool {
+	var payload bool
+	return r.check(r.reader.ReadFlag(&payload)) && payload
+}
+
+func (r *FieldReader) UE() uint32 {
+	var payload uint64
+	if r.check(r.reader.ReadUE(&payload)) {
+		return uint32(payload)
+	}
+
+	return 0
+}
+
+func (r *FieldReader) SE() int32 {
+	var payload int64
+	if r.check(r.reader.ReadSE(&payload)) {
+		return int32(payload)
+	}
+
+	return 0
+}
+
+// Fail marks the data as invalid, for values which were read but are not allowed.
+func (r *FieldReader) Fail() {
+	r.check(false)
+}
+
+// Position returns the number of bits read from the start of the data.
+func (r *FieldReader) Position() int {
+	return 8*len(r.reader.Data) - r.reader.BitsAvailable()
+}
+
+func (r *FieldReader) BitsAvailable() int {
+	return r.reader.BitsAvailable()
+}
+
+// check records a failed read, reads after a failure always fail.
+func (r *FieldReader) check(ok bool) bool {
+	if r.err != nil {
+		return false
+	}
+
+	if !ok {
+		r.err = r.invalid
+	}
+
+	return ok
+}
@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldReaderRemembersFirstError(t *testing.T) {
+	invalid := errors.New("invalid")
+
+	reader := NewFieldReader([]byte{0b10100110, 0b01001000}, invalid)
+
+	assert.Equal(t, uint32(0), reader.UE())
+	assert.Equal(t, int32(1), reader.SE())
+	assert.Equal(t, uint32(0b011), reader.Bits(3))
+	assert.Equal(t, uint32(3), reader.UE())
+	assert.True(t, reader.Flag())
+	assert.Nil(t, reader.Err())
+
+	// only 3 bits are left
+	assert.Equal(t, uint32(0), reader.Bits(4))
+	assert.Equal(t, invalid, reader.Err())
+
+	// the error is kept by the reads that follow
+	assert.Equal(t, uint32(0), reader.Bits(1))
+	assert.Equal(t, invalid, reader.Err())
+}
+
+func TestFieldReaderPosition(t *testing.T) {
+	invalid := errors.New("invalid")
+
+	reader := NewFieldReader([]byte{0xff, 0xff}, invalid)
+	assert.Equal(t, 0, reader.Position())
+	assert.Equal(t, 16, reader.BitsAvailable())
+
+	reader.Bits(5)
+	reader.Flag()
+	assert.Equal(t, 6, reader.Position())
+	assert.Equal(t, 10, reader.BitsAvailable())
+
+	reader.Fail()
+	assert.Equal(t, invalid, reader.Err())
+	assert.Equal(t, uint32(0), reader.Bits(2))
+}
@@ -1,34 +1,126 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log/slog"
 	"net"
-
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"limen/internal/dash"
 	"limen/internal/flv"
+	"limen/internal/hls"
+	"limen/internal/registry"
+	"limen/internal/relay"
 	"limen/internal/rtmp"
 )
 
+const (
+	shutdownTimeout = 10 * time.Second
+	pullTimeout     = 10 * time.Second
+)
+
 func main() {
+	var pushRules []relay.PushRule
+	flag.Func("push", "forward published streams, except pulled ones, to an upstream server, app[/name]=rtmp://host/app/{name} (repeatable)", func(value string) error {
+		rule, err := relay.ParsePushRule(value)
+		if err != nil {
+			return err
+		}
+
+		pushRules = append(pushRules, rule)
+		return nil
+	})
+
+	var pullRules []relay.PullRule
+	flag.Func("pull", "play streams missing locally from an origin, app[/name]=rtmp://host/app/{name} (repeatable)", func(value string) error {
+		rule, err := relay.ParsePullRule(value)
+		if err != nil {
+			return err
+		}
+
+		pullRules = append(pullRules, rule)
+		return nil
+	})
+
+	httpAddress := flag.String("http", ":8080", "address of the HTTP server serving HLS under /hls/ and DASH under /dash/")
+	hlsVOD := flag.Bool("hls-vod", false, "keep every HLS segment in memory and serve /hls/{app}/{name}/vod.m3u8")
+	flag.Parse()
+
 	logger := slog.Default()
-	rtmpServer := &rtmp.RtmpServer{Host: "0.0.0.0", Port: 1935, Logger: logger, Handler: func(conn net.Conn) error {
+	streams := registry.New(registry.Options{PublishPolicy: registry.RejectDuplicate})
+
+	pusher := relay.NewPusher(streams, relay.PushOptions{Rules: pushRules, Logger: logger})
+	pusher.Start()
+
+	puller := relay.NewPuller(streams, relay.PullOptions{Rules: pullRules, Logger: logger})
+
+	hlsServer := hls.NewServer(streams, hls.Options{VOD: *hlsVOD, Logger: logger})
+	hlsServer.Start()
+
+	dashServer := dash.NewServer(streams, dash.Options{Logger: logger})
+	dashServer.Start()
+
+	mux := http.NewServeMux()
+	mux.Handle("/hls/", http.StripPrefix("/hls", hlsServer))
+	mux.Handle("/dash/", http.StripPrefix("/dash", dashServer))
+	httpServer := &http.Server{Addr: *httpAddress, Handler: mux}
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(fmt.Sprintf("HTTP server failed %+v\n", err))
+		}
+	}()
+
+	var consumers sync.WaitGroup
+
+	streams.Watch(func(event registry.Event) {
+		if event.Type != registry.StreamPublished {
+			return
+		}
+
+		// the reader must not keep streams pulled from origins alive
+		subscription, err := event.Stream.Subscribe(registry.SubscribeOptions{Policy: registry.DropUntilKeyframe, Passive: true})
+		if err != nil {
+			return
+		}
+
+		consumers.Add(1)
+		go func() {
+			defer consumers.Done()
+			runFlvReader(logger, subscription)
+		}()
+	})
+
+	rtmpServer := &rtmp.RtmpServer{Host: "0.0.0.0", Port: 1935, Logger: logger, Handler: func(ctx context.Context, conn net.Conn) error {
 		callbacks := &rtmp.HandlerCallabcks{
 			OnAuthorize: func(streamKey string) bool {
 				return true
 			},
+			OnPlay: func(streamKey string) bool {
+				return true
+			},
 			OnSetDataFrame: func(message rtmp.SetDataFrameMessage) bool {
 				return true
 			},
-		}
+			OnStreamMissing: func(app string, streamKey string) bool {
+				pullCtx, cancel := context.WithTimeout(ctx, pullTimeout)
+				defer cancel()
 
-		mediaStream := make(chan interface{})
-		handler := rtmp.NewHandler(conn, logger, callbacks, mediaStream)
+				return puller.Pull(pullCtx, registry.Key{App: app, Name: streamKey}) == nil
+			},
+		}
 
-		go runFlvReader(logger, mediaStream)
+		handler := rtmp.NewHandler(conn, logger, callbacks, streams)
 
-		err := handler.Run()
+		err := handler.Run(ctx)
 		if err != nil {
 			logger.Info(fmt.Sprintf("Error running handler %+v\n", err))
 		} else {
@@ -37,42 +129,58 @@ func main() {
 		return err
 	}}
 
-	rtmpServer.Run()
-}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
 
-func runFlvReader(logger *slog.Logger, mediaStream chan interface{}) {
-	decoder := flv.NewFlvDecoder()
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
 
-	buffer := &bytes.Buffer{}
-	writer := bufio.NewWriter(buffer)
+		if err := rtmpServer.Shutdown(ctx); err != nil {
+			logger.Error(fmt.Sprintf("Failed to shut down gracefully %+v\n", err))
+		}
+
+		if err := httpServer.Shutdown(ctx); err != nil {
+			logger.Error(fmt.Sprintf("Failed to shut down the HTTP server gracefully %+v\n", err))
+		}
 
-	reader := bufio.NewReader(buffer)
+		// ends consumers of streams whose publishers did not finish in time
+		streams.Close()
+	}()
+
+	if err := rtmpServer.Run(context.Background()); err != nil && !errors.Is(err, rtmp.ErrServerClosed) {
+		logger.Error(fmt.Sprintf("Server failed %+v\n", err))
+	}
 
-	for msg := range mediaStream {
-		switch message := msg.(type) {
-		case rtmp.MediaStreamInfo:
-			fmt.Printf("Media info %+v\n", message)
+	pusher.Close()
+	puller.Close()
+	hlsServer.Close()
+	dashServer.Close()
 
-		case rtmp.MediaStreamData:
-			writer.Write(message.Data)
-			writer.Flush()
+	// let consumers finalize their work
+	consumers.Wait()
+}
 
-			packet, err := decoder.Decode(reader)
-			if err != nil {
-				logger.Error(fmt.Sprintf("Error -> %+v\n", err))
-			}
+func runFlvReader(logger *slog.Logger, subscription *registry.Subscription) {
+	stream := subscription.Stream()
+	fmt.Printf("Media info %+v\n", stream.Key)
 
-			if packet != nil {
-				packet.Data = []byte{}
-				if packet.Type == 1 {
-					// logger.Info(fmt.Sprintf("Got FLV packet %+v\n", packet))
+	for packet := range subscription.Packets() {
+		if packet.Type != registry.VideoPacket {
+			continue
+		}
 
-					if packet.CodecParams.(*flv.VideoCodecParams).KeyFrame {
-						logger.Info("Key frame")
-					}
-				}
-			}
+		decoded, err := flv.DecodeTagData(flv.VideoPacket, packet.Data)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Error -> %+v\n", err))
+			continue
+		}
 
+		if decoded.CodecParams.(*flv.VideoCodecParams).KeyFrame {
+			logger.Info("Key frame")
 		}
 	}
+
+	logger.Info("Stream finished", "stream", stream.Key.String(), "stats", fmt.Sprintf("%+v", stream.Stats()))
 }